@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/well"
 )
 
@@ -61,3 +65,103 @@ func postAction(ctx context.Context, p string, params map[string]string) error {
 	}
 	return err
 }
+
+func postJSON(ctx context.Context, p string, data interface{}) error {
+	client := &well.HTTPClient{
+		Client: &http.Client{},
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	req, _ := http.NewRequest("POST", globalParams.endpoint+p, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// responseError returns an error with the message in the response body if any.
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error != "" {
+		return fmt.Errorf("%s: %s", resp.Status, body.Error)
+	}
+	return errors.New(resp.Status)
+}
+
+func deleteResource(ctx context.Context, p string) error {
+	client := &well.HTTPClient{
+		Client: &http.Client{},
+	}
+
+	req, _ := http.NewRequest("DELETE", globalParams.endpoint+p, nil)
+	req = req.WithContext(ctx)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// getEvents reads Server-Sent Events and calls fn with the data of each event.
+func getEvents(ctx context.Context, p string, fn func(data []byte) error) error {
+	client := &well.HTTPClient{
+		Client: &http.Client{},
+	}
+
+	req, _ := http.NewRequest("GET", globalParams.endpoint+p, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req = req.WithContext(ctx)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data:"))
+		if !ok {
+			continue
+		}
+		if err := fn(bytes.TrimSpace(data)); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return scanner.Err()
+}
+
+// runRequest runs f and exits on error.
+func runRequest(f func(ctx context.Context) error) {
+	well.Go(f)
+	well.Stop()
+	err := well.Wait()
+	if err != nil {
+		log.ErrorExit(err)
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/event"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var eventsParams struct {
+	JSON bool
+}
+
+// eventsCmd represents the events command
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "follow cluster events",
+	Long: `follow cluster events
+
+Events are shown as they occur until interrupted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		well.Go(func(ctx context.Context) error {
+			return getEvents(ctx, "/events", func(data []byte) error {
+				if eventsParams.JSON {
+					fmt.Println(string(data))
+					return nil
+				}
+
+				var ev event.Event
+				if err := json.Unmarshal(data, &ev); err != nil {
+					return err
+				}
+				fmt.Println(formatEvent(&ev))
+				return nil
+			})
+		})
+		well.Stop()
+		err := well.Wait()
+		if err != nil && !well.IsSignaled(err) {
+			log.ErrorExit(err)
+		}
+	},
+}
+
+func formatEvent(ev *event.Event) string {
+	fields := []string{ev.Time.Format(time.RFC3339), string(ev.Type)}
+	if ev.Node != "" {
+		fields = append(fields, "node="+ev.Node)
+	}
+	if ev.NetNS != "" {
+		fields = append(fields, "netns="+ev.NetNS)
+	}
+
+	keys := make([]string, 0, len(ev.Details))
+	for k := range ev.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%q", k, ev.Details[k]))
+	}
+
+	return strings.Join(fields, " ")
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().BoolVar(&eventsParams.JSON, "json", false, "show in JSON")
+}
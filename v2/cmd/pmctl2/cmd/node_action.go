@@ -16,14 +16,16 @@ const (
 	nodeActionStart   = nodeAction("start")
 	nodeActionStop    = nodeAction("stop")
 	nodeActionRestart = nodeAction("restart")
+	nodeActionPause   = nodeAction("pause")
+	nodeActionResume  = nodeAction("resume")
 )
 
 func (n nodeAction) valid() error {
 	switch n {
-	case nodeActionStart, nodeActionStop, nodeActionRestart:
+	case nodeActionStart, nodeActionStop, nodeActionRestart, nodeActionPause, nodeActionResume:
 		return nil
 	default:
-		return fmt.Errorf("invalid node action: %s: valid actions are [%s|%s|%s]", n, nodeActionStart, nodeActionStop, nodeActionRestart)
+		return fmt.Errorf("invalid node action: %s: valid actions are [%s|%s|%s|%s|%s]", n, nodeActionStart, nodeActionStop, nodeActionRestart, nodeActionPause, nodeActionResume)
 	}
 }
 
@@ -36,7 +38,9 @@ var nodeActionCmd = &cobra.Command{
 ACTION
   * start: power on the target node
   * stop: power off the target node 
-  * restart: restart the target node`,
+  * restart: restart the target node
+  * pause: pause the vCPUs of the target node
+  * resume: resume the paused target node`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			return errors.New("action name not specified")
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var nodeInterfaceAttachParams struct {
+	types.NodeInterfaceSpec
+	bootIndex int
+}
+
+// nodeInterfaceCmd represents the nodeInterface command
+var nodeInterfaceCmd = &cobra.Command{
+	Use:   "interface",
+	Short: "interface subcommand",
+	Long:  `interface subcommand is the parent of commands that attach or detach network interfaces of a node`,
+}
+
+// nodeInterfaceAttachCmd represents the nodeInterfaceAttach command
+var nodeInterfaceAttachCmd = &cobra.Command{
+	Use:   "attach NODE NETWORK",
+	Short: "attach a network interface to a node",
+	Long: `attach a network interface to a node
+
+A tap is created on the network and hot-plugged into the node as a new NIC.
+If the node is powered off, the NIC is attached at the next power-on.
+If --mac is not specified, the MAC address is derived from the node name and the interface index.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		req := nodeInterfaceAttachParams.NodeInterfaceSpec
+		req.Network = args[1]
+		if nodeInterfaceAttachParams.bootIndex >= 0 {
+			req.BootIndex = &nodeInterfaceAttachParams.bootIndex
+		}
+		runRequest(func(ctx context.Context) error {
+			return postJSON(ctx, fmt.Sprintf("/nodes/%s/interfaces", args[0]), &req)
+		})
+	},
+}
+
+// nodeInterfaceDetachCmd represents the nodeInterfaceDetach command
+var nodeInterfaceDetachCmd = &cobra.Command{
+	Use:   "detach NODE INTERFACE",
+	Short: "detach a network interface from a node",
+	Long: `detach a network interface from a node
+
+INTERFACE is either a tap name or a network name.
+If a network name is given, the last interface connected to the network is detached.
+The NIC is hot-unplugged from the node and its tap is deleted.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return deleteResource(ctx, fmt.Sprintf("/nodes/%s/interfaces/%s", args[0], args[1]))
+		})
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeInterfaceCmd)
+	nodeInterfaceCmd.AddCommand(nodeInterfaceAttachCmd)
+	nodeInterfaceCmd.AddCommand(nodeInterfaceDetachCmd)
+
+	f := nodeInterfaceAttachCmd.Flags()
+	f.StringVar(&nodeInterfaceAttachParams.MAC, "mac", "", "MAC address of the NIC")
+	f.StringVar((*string)(&nodeInterfaceAttachParams.Model), "model", string(types.NodeInterfaceModelVirtio), "NIC model [virtio|e1000|igb]")
+	f.IntVar(&nodeInterfaceAttachParams.Queues, "queues", 0, "number of queues of a virtio NIC")
+	f.IntVar(&nodeInterfaceAttachParams.bootIndex, "bootindex", -1, "boot index of the NIC")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cybozu-go/placemat/v2/pkg/placemat"
+	"github.com/spf13/cobra"
+)
+
+var nodeResizeParams placemat.ResizeRequest
+
+// nodeResizeCmd represents the nodeResize command
+var nodeResizeCmd = &cobra.Command{
+	Use:   "resize NODE",
+	Short: "change the number of vCPUs and the memory size of a node",
+	Long: `change the number of vCPUs and the memory size of a node
+
+vCPUs and DIMMs are hot-plugged into a running node, and the memory
+is shrunk by the balloon. The new capacity is also used at the next power-on.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("wrong number of arguments")
+		}
+		if nodeResizeParams.CPU == 0 && nodeResizeParams.Memory == "" {
+			return errors.New("--cpu or --memory is required")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return postJSON(ctx, fmt.Sprintf("/nodes/%s/resize", args[0]), &nodeResizeParams)
+		})
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeResizeCmd)
+	nodeResizeCmd.Flags().IntVar(&nodeResizeParams.CPU, "cpu", 0, "number of vCPUs")
+	nodeResizeCmd.Flags().StringVar(&nodeResizeParams.Memory, "memory", "", "memory size")
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/placemat"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var nodeSELListParams struct {
+	JSON bool
+}
+
+var nodeSELAddParams struct {
+	placemat.SELEntryRequest
+	EventData []byte
+}
+
+// nodeSELCmd represents the nodeSEL command
+var nodeSELCmd = &cobra.Command{
+	Use:   "sel",
+	Short: "sel subcommand",
+	Long:  `sel subcommand is the parent of commands that manage the System Event Log of the BMC of a node`,
+}
+
+// nodeSELListCmd represents the nodeSELList command
+var nodeSELListCmd = &cobra.Command{
+	Use:   "list NODE",
+	Short: "show SEL entries of a node",
+	Long:  `show SEL entries of a node from the oldest`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		well.Go(func(ctx context.Context) error {
+			var entries []virtualbmc.SELEntry
+			err := getJSON(ctx, fmt.Sprintf("/nodes/%s/sel", args[0]), nil, &entries)
+			if err != nil {
+				return err
+			}
+			if nodeSELListParams.JSON {
+				return json.NewEncoder(os.Stdout).Encode(entries)
+			}
+			for _, e := range entries {
+				fmt.Printf("%d %s %s\n", e.RecordID, e.Timestamp.Format(time.RFC3339), e.Message())
+			}
+			return nil
+		})
+		well.Stop()
+		err := well.Wait()
+		if err != nil {
+			log.ErrorExit(err)
+		}
+	},
+}
+
+// nodeSELAddCmd represents the nodeSELAdd command
+var nodeSELAddCmd = &cobra.Command{
+	Use:   "add NODE",
+	Short: "add an entry to the SEL of a node",
+	Long: `add an entry to the SEL of a node
+
+The entry is a system event record logged by the BMC.
+It is also sent to the Redfish event subscribers of the BMC as an alert.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("wrong number of arguments")
+		}
+		if len(nodeSELAddParams.EventData) != 3 {
+			return errors.New("--event-data must be 3 bytes")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		req := nodeSELAddParams.SELEntryRequest
+		copy(req.EventData[:], nodeSELAddParams.EventData)
+		runRequest(func(ctx context.Context) error {
+			return postJSON(ctx, fmt.Sprintf("/nodes/%s/sel", args[0]), &req)
+		})
+	},
+}
+
+// nodeSELClearCmd represents the nodeSELClear command
+var nodeSELClearCmd = &cobra.Command{
+	Use:   "clear NODE",
+	Short: "delete all entries of the SEL of a node",
+	Long:  `delete all entries of the SEL of a node`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return deleteResource(ctx, fmt.Sprintf("/nodes/%s/sel", args[0]))
+		})
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeSELCmd)
+	nodeSELCmd.AddCommand(nodeSELListCmd)
+	nodeSELCmd.AddCommand(nodeSELAddCmd)
+	nodeSELCmd.AddCommand(nodeSELClearCmd)
+	nodeSELListCmd.Flags().BoolVar(&nodeSELListParams.JSON, "json", false, "show in JSON")
+	nodeSELAddCmd.Flags().Uint8Var(&nodeSELAddParams.SensorType, "sensor-type", 0, "sensor type")
+	nodeSELAddCmd.Flags().Uint8Var(&nodeSELAddParams.SensorNumber, "sensor-number", 0, "sensor number")
+	nodeSELAddCmd.Flags().Uint8Var(&nodeSELAddParams.EventType, "event-type", virtualbmc.EventReadingTypeSensorSpecific, "event/reading type")
+	nodeSELAddCmd.Flags().BoolVar(&nodeSELAddParams.Deassertion, "deassertion", false, "log a deassertion event")
+	nodeSELAddCmd.Flags().BytesHexVar(&nodeSELAddParams.EventData, "event-data", []byte{0, 0xff, 0xff}, "event data 1 to 3 in hex")
+}
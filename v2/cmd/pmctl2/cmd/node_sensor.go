@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/placemat"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var nodeSensorListParams struct {
+	JSON bool
+}
+
+// nodeSensorCmd represents the nodeSensor command
+var nodeSensorCmd = &cobra.Command{
+	Use:   "sensor",
+	Short: "sensor subcommand",
+	Long:  `sensor subcommand is the parent of commands that control the sensors of the BMC of a node`,
+}
+
+// nodeSensorListCmd represents the nodeSensorList command
+var nodeSensorListCmd = &cobra.Command{
+	Use:   "list NODE",
+	Short: "show sensor list of a node",
+	Long:  `show sensor list of a node`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		well.Go(func(ctx context.Context) error {
+			var sensors []virtualbmc.Sensor
+			err := getJSON(ctx, fmt.Sprintf("/nodes/%s/sensors", args[0]), nil, &sensors)
+			if err != nil {
+				return err
+			}
+			if nodeSensorListParams.JSON {
+				return json.NewEncoder(os.Stdout).Encode(sensors)
+			}
+			for _, s := range sensors {
+				fmt.Printf("%s: %g %s\n", s.Name, s.Value, s.Unit)
+			}
+			return nil
+		})
+		well.Stop()
+		err := well.Wait()
+		if err != nil {
+			log.ErrorExit(err)
+		}
+	},
+}
+
+// nodeSensorSetCmd represents the nodeSensorSet command
+var nodeSensorSetCmd = &cobra.Command{
+	Use:   "set NODE SENSOR VALUE",
+	Short: "change the value of a sensor of a node",
+	Long: `change the value of a sensor of a node
+
+SENSOR is the name of the sensor shown by "pmctl2 node sensor list".
+Crossing a threshold of the sensor adds an entry to the SEL of the node.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 3 {
+			return fmt.Errorf("accepts 3 arg(s), received %d", len(args))
+		}
+		if _, err := strconv.ParseFloat(args[2], 64); err != nil {
+			return fmt.Errorf("invalid value: %s", args[2])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		value, _ := strconv.ParseFloat(args[2], 64)
+		runRequest(func(ctx context.Context) error {
+			return postJSON(ctx, fmt.Sprintf("/nodes/%s/sensors/%s", args[0], url.PathEscape(args[1])), &placemat.SensorRequest{Value: value})
+		})
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeSensorCmd)
+	nodeSensorCmd.AddCommand(nodeSensorListCmd)
+	nodeSensorCmd.AddCommand(nodeSensorSetCmd)
+	nodeSensorListCmd.Flags().BoolVar(&nodeSensorListParams.JSON, "json", false, "show in JSON")
+}
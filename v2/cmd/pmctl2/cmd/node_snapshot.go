@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/vm"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var nodeSnapshotListParams struct {
+	JSON bool
+}
+
+// nodeSnapshotCmd represents the nodeSnapshot command
+var nodeSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "snapshot subcommand",
+	Long:  `snapshot subcommand is the parent of commands that control snapshots of a node`,
+}
+
+// nodeSnapshotSaveCmd represents the nodeSnapshotSave command
+var nodeSnapshotSaveCmd = &cobra.Command{
+	Use:   "save NODE NAME",
+	Short: "save a snapshot of a node",
+	Long: `save a snapshot of a node
+
+The disks and the RAM of the node are saved as an internal snapshot named NAME.
+An existing snapshot of the same name is replaced.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runNodeSnapshotAction(args[0], args[1], "save")
+	},
+}
+
+// nodeSnapshotLoadCmd represents the nodeSnapshotLoad command
+var nodeSnapshotLoadCmd = &cobra.Command{
+	Use:   "load NODE NAME",
+	Short: "load a snapshot of a node",
+	Long:  `load a snapshot of a node`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runNodeSnapshotAction(args[0], args[1], "load")
+	},
+}
+
+// nodeSnapshotDeleteCmd represents the nodeSnapshotDelete command
+var nodeSnapshotDeleteCmd = &cobra.Command{
+	Use:   "delete NODE NAME",
+	Short: "delete a snapshot of a node",
+	Long:  `delete a snapshot of a node`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return deleteResource(ctx, fmt.Sprintf("/nodes/%s/snapshots/%s", args[0], args[1]))
+		})
+	},
+}
+
+// nodeSnapshotListCmd represents the nodeSnapshotList command
+var nodeSnapshotListCmd = &cobra.Command{
+	Use:   "list NODE",
+	Short: "show snapshot list of a node",
+	Long:  `show snapshot list of a node`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		well.Go(func(ctx context.Context) error {
+			var snapshots []vm.Snapshot
+			err := getJSON(ctx, fmt.Sprintf("/nodes/%s/snapshots", args[0]), nil, &snapshots)
+			if err != nil {
+				return err
+			}
+			if nodeSnapshotListParams.JSON {
+				return json.NewEncoder(os.Stdout).Encode(snapshots)
+			}
+			for _, s := range snapshots {
+				fmt.Println(s.Name)
+			}
+			return nil
+		})
+		well.Stop()
+		err := well.Wait()
+		if err != nil {
+			log.ErrorExit(err)
+		}
+	},
+}
+
+func runNodeSnapshotAction(node, name, action string) {
+	runRequest(func(ctx context.Context) error {
+		return postAction(ctx, fmt.Sprintf("/nodes/%s/snapshots/%s/%s", node, name, action), nil)
+	})
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeSnapshotCmd)
+	nodeSnapshotCmd.AddCommand(nodeSnapshotSaveCmd)
+	nodeSnapshotCmd.AddCommand(nodeSnapshotLoadCmd)
+	nodeSnapshotCmd.AddCommand(nodeSnapshotDeleteCmd)
+	nodeSnapshotCmd.AddCommand(nodeSnapshotListCmd)
+	nodeSnapshotListCmd.Flags().BoolVar(&nodeSnapshotListParams.JSON, "json", false, "show in JSON")
+}
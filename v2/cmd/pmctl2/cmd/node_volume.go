@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var nodeVolumeAttachParams types.NodeVolumeSpec
+
+var nodeVolumeInsertParams types.NodeMediaSpec
+
+// nodeVolumeCmd represents the nodeVolume command
+var nodeVolumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "volume subcommand",
+	Long:  `volume subcommand is the parent of commands that manage volumes of a node`,
+}
+
+// nodeVolumeAttachCmd represents the nodeVolumeAttach command
+var nodeVolumeAttachCmd = &cobra.Command{
+	Use:   "attach NODE NAME",
+	Short: "attach a volume to a node",
+	Long: `attach a volume to a node
+
+A raw or image volume is created and hot-plugged into the node.
+If the node is powered off, the volume is attached at the next power-on.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		spec := nodeVolumeAttachParams
+		spec.Name = args[1]
+		runRequest(func(ctx context.Context) error {
+			return postJSON(ctx, fmt.Sprintf("/nodes/%s/volumes", args[0]), &spec)
+		})
+	},
+}
+
+// nodeVolumeDetachCmd represents the nodeVolumeDetach command
+var nodeVolumeDetachCmd = &cobra.Command{
+	Use:   "detach NODE NAME",
+	Short: "detach a volume from a node",
+	Long: `detach a volume from a node
+
+The volume is hot-unplugged from the node. The volume file is kept on the host.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return deleteResource(ctx, fmt.Sprintf("/nodes/%s/volumes/%s", args[0], args[1]))
+		})
+	},
+}
+
+// nodeVolumeInsertCmd represents the nodeVolumeInsert command
+var nodeVolumeInsertCmd = &cobra.Command{
+	Use:   "insert NODE NAME",
+	Short: "insert a media into a cdrom volume",
+	Long: `insert a media into a cdrom volume
+
+The current media of the volume is replaced.
+Specify the media by exactly one of --image, --path, or --url.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		spec := nodeVolumeInsertParams
+		if spec.Path != "" {
+			// the path is resolved on the host where placemat runs
+			p, err := filepath.Abs(spec.Path)
+			if err != nil {
+				log.ErrorExit(err)
+			}
+			spec.Path = p
+		}
+		runRequest(func(ctx context.Context) error {
+			return postJSON(ctx, fmt.Sprintf("/nodes/%s/volumes/%s/media", args[0], args[1]), &spec)
+		})
+	},
+}
+
+// nodeVolumeEjectCmd represents the nodeVolumeEject command
+var nodeVolumeEjectCmd = &cobra.Command{
+	Use:   "eject NODE NAME",
+	Short: "eject the media from a cdrom volume",
+	Long:  `eject the media from a cdrom volume`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return deleteResource(ctx, fmt.Sprintf("/nodes/%s/volumes/%s/media", args[0], args[1]))
+		})
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeVolumeCmd)
+	nodeVolumeCmd.AddCommand(nodeVolumeAttachCmd)
+	nodeVolumeCmd.AddCommand(nodeVolumeDetachCmd)
+	nodeVolumeCmd.AddCommand(nodeVolumeInsertCmd)
+	nodeVolumeCmd.AddCommand(nodeVolumeEjectCmd)
+
+	f := nodeVolumeAttachCmd.Flags()
+	f.StringVar((*string)(&nodeVolumeAttachParams.Kind), "kind", string(types.NodeVolumeKindRaw), "volume kind [raw|image]")
+	f.StringVar(&nodeVolumeAttachParams.Size, "size", "", "size of a raw volume")
+	f.StringVar((*string)(&nodeVolumeAttachParams.Format), "format", "", "format of a raw volume [qcow2|raw]")
+	f.StringVar(&nodeVolumeAttachParams.Image, "image", "", "image name of an image volume")
+	f.BoolVar(&nodeVolumeAttachParams.CopyOnWrite, "copy-on-write", false, "create an image volume as a copy-on-write image")
+	f.StringVar((*string)(&nodeVolumeAttachParams.Cache), "cache", "", "cache mode [writeback|none|writethrough|directsync|unsafe]")
+	f.StringVar(&nodeVolumeAttachParams.DeviceClass, "device-class", "", "device class of the volume")
+
+	f = nodeVolumeInsertCmd.Flags()
+	f.StringVar(&nodeVolumeInsertParams.Image, "image", "", "image name of the media")
+	f.StringVar(&nodeVolumeInsertParams.Path, "path", "", "path of the media file on the host")
+	f.StringVar(&nodeVolumeInsertParams.URL, "url", "", "URL to download the media from")
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "snapshot subcommand",
+	Long: `snapshot subcommand is the parent of commands that control snapshots of the whole cluster
+
+All running nodes are paused while saving or loading snapshots so that
+the snapshots are consistent across the cluster.`,
+}
+
+// snapshotSaveCmd represents the snapshotSave command
+var snapshotSaveCmd = &cobra.Command{
+	Use:   "save NAME",
+	Short: "save a snapshot of all running nodes",
+	Long:  `save a snapshot of all running nodes`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return postAction(ctx, fmt.Sprintf("/snapshots/%s/save", args[0]), nil)
+		})
+	},
+}
+
+// snapshotLoadCmd represents the snapshotLoad command
+var snapshotLoadCmd = &cobra.Command{
+	Use:   "load NAME",
+	Short: "load a snapshot of all running nodes",
+	Long:  `load a snapshot of all running nodes`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return postAction(ctx, fmt.Sprintf("/snapshots/%s/load", args[0]), nil)
+		})
+	},
+}
+
+// snapshotDeleteCmd represents the snapshotDelete command
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "delete a snapshot of all running nodes",
+	Long:  `delete a snapshot of all running nodes`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRequest(func(ctx context.Context) error {
+			return deleteResource(ctx, fmt.Sprintf("/snapshots/%s", args[0]))
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotSaveCmd)
+	snapshotCmd.AddCommand(snapshotLoadCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+}
@@ -80,29 +80,25 @@ var _ = Describe("Virtual BMC", func() {
 					return err
 				}
 
-				// Graceful Shutdown
-				taskMonitor, err := system.Reset(schemas.GracefulShutdownResetType)
-				if err != nil {
-					return err
-				}
-				if taskMonitor != nil {
-					_, err := schemas.WaitForTaskMonitor(context.Background(), c, 0, taskMonitor, nil)
+				switch system.PowerState {
+				case schemas.OffPowerState:
+					return nil
+				case schemas.OnPowerState:
+					// Graceful Shutdown
+					// The guest shuts down asynchronously, so check the power state in the next try.
+					taskMonitor, err := system.Reset(schemas.GracefulShutdownResetType)
 					if err != nil {
 						return err
 					}
+					if taskMonitor != nil {
+						_, err := schemas.WaitForTaskMonitor(context.Background(), c, 0, taskMonitor, nil)
+						if err != nil {
+							return err
+						}
+					}
 				}
 
-				system, err = getComputerSystem(c.Service)
-				if err != nil {
-					return err
-				}
-
-				// Check if the powerState is Off
-				if system.PowerState != schemas.OffPowerState {
-					return fmt.Errorf("powerState is not Off, actual: %s", system.PowerState)
-				}
-
-				return nil
+				return fmt.Errorf("powerState is not Off, actual: %s", system.PowerState)
 			}).Should(Succeed())
 		})
 
@@ -0,0 +1,168 @@
+package bootserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/well"
+)
+
+const tftpPort = 69
+
+// Server serves files for network boot over TFTP and HTTP.
+type Server struct {
+	address  net.IP
+	files    *fileSystem
+	tftp     bool
+	httpPort int
+	netNS    ns.NetNS
+}
+
+// NewServer creates a Server from spec.
+// If netNS is not nil, the server listens in the network namespace.
+// The server takes the ownership of netNS and closes it when Start returns.
+func NewServer(spec *types.BootServerSpec, netNS ns.NetNS) (*Server, error) {
+	ip, _, err := net.ParseCIDR(spec.Address)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(spec.Root)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	return &Server{
+		address:  ip,
+		files:    &fileSystem{root: root},
+		tftp:     spec.TFTP,
+		httpPort: spec.HTTPPort,
+		netNS:    netNS,
+	}, nil
+}
+
+// Start starts the TFTP and HTTP servers, and blocks until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	// TFTP transfers open sockets in the network namespace until the servers stop
+	if s.netNS != nil {
+		defer s.netNS.Close()
+	}
+
+	env := well.NewEnvironment(ctx)
+
+	if s.tftp {
+		conn, err := s.listenUDP(tftpPort)
+		if err != nil {
+			return fmt.Errorf("failed to listen TFTP: %w", err)
+		}
+		server := &tftpServer{
+			files: s.files,
+			listen: func() (*net.UDPConn, error) {
+				return s.listenUDP(0)
+			},
+		}
+		env.Go(func(ctx context.Context) error {
+			return server.serve(ctx, conn)
+		})
+	}
+
+	if s.httpPort != 0 {
+		var l net.Listener
+		err := s.do(func() error {
+			var err error
+			l, err = net.Listen("tcp", net.JoinHostPort(s.address.String(), strconv.Itoa(s.httpPort)))
+			return err
+		})
+		if err != nil {
+			env.Cancel(err)
+			env.Wait()
+			return fmt.Errorf("failed to listen HTTP: %w", err)
+		}
+		server := &well.HTTPServer{
+			Server: &http.Server{
+				Handler: http.FileServer(s.files),
+			},
+			Env: env,
+		}
+		if err := server.Serve(l); err != nil {
+			env.Cancel(err)
+			env.Wait()
+			return err
+		}
+	}
+
+	log.Info("boot server started", map[string]interface{}{
+		"address":   s.address.String(),
+		"root":      s.files.root,
+		"tftp":      s.tftp,
+		"http_port": s.httpPort,
+	})
+
+	env.Stop()
+	return env.Wait()
+}
+
+func (s *Server) listenUDP(port int) (*net.UDPConn, error) {
+	var conn *net.UDPConn
+	err := s.do(func() error {
+		var err error
+		conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: s.address, Port: port})
+		return err
+	})
+	return conn, err
+}
+
+// do runs f in the network namespace of the server.
+// Sockets created by f stay in the namespace.
+func (s *Server) do(f func() error) error {
+	if s.netNS == nil {
+		return f()
+	}
+	return s.netNS.Do(func(ns.NetNS) error {
+		return f()
+	})
+}
+
+// fileSystem is a read-only file system which does not allow access outside the root directory.
+type fileSystem struct {
+	root string
+}
+
+func (fs *fileSystem) open(name string) (*os.File, error) {
+	p := filepath.Join(fs.root, filepath.FromSlash(path.Clean("/"+name)))
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, errors.New("is a directory")
+	}
+	return f, nil
+}
+
+// Open implements http.FileSystem.
+func (fs *fileSystem) Open(name string) (http.File, error) {
+	return http.Dir(fs.root).Open(name)
+}
@@ -0,0 +1,107 @@
+package bootserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+)
+
+var _ = Describe("Boot server", func() {
+	It("should serve files in a network namespace until it stops", func() {
+		netNS, err := testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(testutils.UnmountNS, netNS)
+		// the server closes netNS, so the namespace is accessed through another handle
+		testNS, err := ns.GetNS(netNS.Path())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(testNS.Close)
+
+		Expect(testNS.Do(func(ns.NetNS) error {
+			lo, err := netlink.LinkByName("lo")
+			if err != nil {
+				return err
+			}
+			return netlink.LinkSetUp(lo)
+		})).To(Succeed())
+
+		root := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(root, "ipxe.efi"), []byte("ipxe"), 0644)).To(Succeed())
+		server, err := NewServer(&types.BootServerSpec{
+			Address:  "127.0.0.1/8",
+			Root:     root,
+			TFTP:     true,
+			HTTPPort: 8080,
+		}, netNS)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error, 1)
+		go func() {
+			done <- server.Start(ctx)
+		}()
+
+		Eventually(func() (string, error) {
+			var body []byte
+			err := testNS.Do(func(ns.NetNS) error {
+				// http.Client dials in another goroutine, which is not in the namespace
+				conn, err := net.Dial("tcp", "127.0.0.1:8080")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err := io.WriteString(conn, "GET /ipxe.efi HTTP/1.0\r\n\r\n"); err != nil {
+					return err
+				}
+				resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				body, err = io.ReadAll(resp.Body)
+				return err
+			})
+			return string(body), err
+		}).Should(Equal("ipxe"))
+
+		// each TFTP transfer listens on a new socket in the namespace
+		var packet []byte
+		Expect(testNS.Do(func(ns.NetNS) error {
+			client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+			_, err = client.WriteToUDP([]byte("\x00\x01ipxe.efi\x00octet\x00"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tftpPort})
+			if err != nil {
+				return err
+			}
+			buf := make([]byte, 1024)
+			if err := client.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				return err
+			}
+			n, _, err := client.ReadFromUDP(buf)
+			packet = buf[:n]
+			return err
+		})).To(Succeed())
+		Expect(binary.BigEndian.Uint16(packet)).To(BeNumerically("==", tftpOpDATA))
+		Expect(string(packet[4:])).To(Equal("ipxe"))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(netNS.Do(func(ns.NetNS) error { return nil })).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,13 @@
+package bootserver
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestBootServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "BootServer Suite")
+}
@@ -0,0 +1,308 @@
+package bootserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// TFTP opcodes
+const (
+	tftpOpRRQ   = 1
+	tftpOpWRQ   = 2
+	tftpOpDATA  = 3
+	tftpOpACK   = 4
+	tftpOpERROR = 5
+	tftpOpOACK  = 6
+)
+
+// TFTP error codes
+const (
+	tftpErrUndefined  = 0
+	tftpErrNotFound   = 1
+	tftpErrAccess     = 2
+	tftpErrIllegalOp  = 4
+	tftpErrUnknownTID = 5
+	tftpErrBadOption  = 8
+)
+
+const (
+	tftpDefaultBlksize  = 512
+	tftpMinBlksize      = 8
+	tftpMaxBlksize      = 65464
+	tftpDefaultTimeout  = 3 * time.Second
+	tftpMaxRetries      = 5
+	tftpMaxRequestBytes = 512
+)
+
+// listenFunc creates a UDP socket for a transfer
+type listenFunc func() (*net.UDPConn, error)
+
+// tftpServer is a read-only TFTP server (RFC 1350) which supports blksize, tsize and timeout options (RFC 2347-2349).
+type tftpServer struct {
+	files  *fileSystem
+	listen listenFunc
+}
+
+type tftpRequest struct {
+	filename string
+	mode     string
+	options  map[string]string
+}
+
+// serve handles read requests received on conn until ctx is done.
+// Each transfer uses a new socket as a transfer ID.
+func (s *tftpServer) serve(ctx context.Context, conn *net.UDPConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, tftpMaxRequestBytes)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		req := make([]byte, n)
+		copy(req, buf[:n])
+		go s.handle(ctx, addr, req)
+	}
+}
+
+func (s *tftpServer) handle(ctx context.Context, addr *net.UDPAddr, packet []byte) {
+	conn, err := s.listen()
+	if err != nil {
+		log.Error("failed to create a TFTP transfer socket", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+	defer conn.Close()
+
+	if len(packet) < 2 || binary.BigEndian.Uint16(packet) != tftpOpRRQ {
+		sendTFTPError(conn, addr, tftpErrIllegalOp, "only read requests are supported")
+		return
+	}
+	req, err := parseTFTPRequest(packet[2:])
+	if err != nil {
+		sendTFTPError(conn, addr, tftpErrUndefined, err.Error())
+		return
+	}
+
+	f, err := s.files.open(req.filename)
+	if err != nil {
+		code := uint16(tftpErrAccess)
+		if errors.Is(err, os.ErrNotExist) {
+			code = tftpErrNotFound
+		}
+		sendTFTPError(conn, addr, code, err.Error())
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		sendTFTPError(conn, addr, tftpErrUndefined, err.Error())
+		return
+	}
+
+	t := &tftpTransfer{
+		conn:    conn,
+		addr:    addr,
+		blksize: tftpDefaultBlksize,
+		timeout: tftpDefaultTimeout,
+	}
+	oack, err := t.negotiate(req.options, fi.Size())
+	if err != nil {
+		sendTFTPError(conn, addr, tftpErrBadOption, err.Error())
+		return
+	}
+	if err := t.send(ctx, f, oack); err != nil {
+		log.Warn("TFTP transfer failed", map[string]interface{}{
+			log.FnError: err,
+			"client":    addr.String(),
+			"filename":  req.filename,
+		})
+		return
+	}
+
+	log.Info("TFTP transfer completed", map[string]interface{}{
+		"client":   addr.String(),
+		"filename": req.filename,
+		"size":     fi.Size(),
+	})
+}
+
+func parseTFTPRequest(data []byte) (*tftpRequest, error) {
+	fields := bytes.Split(data, []byte{0})
+	// the request ends with a null byte, so the last field is empty
+	if len(fields) < 3 || len(fields[len(fields)-1]) != 0 {
+		return nil, errors.New("malformed request")
+	}
+	fields = fields[:len(fields)-1]
+	if len(fields)%2 != 0 {
+		return nil, errors.New("malformed options")
+	}
+
+	req := &tftpRequest{
+		filename: string(fields[0]),
+		mode:     strings.ToLower(string(fields[1])),
+		options:  make(map[string]string),
+	}
+	if req.mode != "octet" && req.mode != "netascii" {
+		return nil, fmt.Errorf("unsupported mode: %s", req.mode)
+	}
+	for i := 2; i < len(fields); i += 2 {
+		req.options[strings.ToLower(string(fields[i]))] = string(fields[i+1])
+	}
+
+	return req, nil
+}
+
+type tftpTransfer struct {
+	conn    *net.UDPConn
+	addr    *net.UDPAddr
+	blksize int
+	timeout time.Duration
+}
+
+// negotiate applies the requested options, and returns the OACK packet if any option is accepted.
+// Unknown options are ignored.
+func (t *tftpTransfer) negotiate(options map[string]string, size int64) ([]byte, error) {
+	var oack []byte
+	appendOption := func(name, value string) {
+		oack = append(oack, name...)
+		oack = append(oack, 0)
+		oack = append(oack, value...)
+		oack = append(oack, 0)
+	}
+
+	for name, value := range options {
+		switch name {
+		case "blksize":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < tftpMinBlksize {
+				return nil, fmt.Errorf("invalid blksize: %s", value)
+			}
+			if n > tftpMaxBlksize {
+				n = tftpMaxBlksize
+			}
+			t.blksize = n
+			appendOption(name, strconv.Itoa(n))
+		case "tsize":
+			appendOption(name, strconv.FormatInt(size, 10))
+		case "timeout":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 255 {
+				return nil, fmt.Errorf("invalid timeout: %s", value)
+			}
+			t.timeout = time.Duration(n) * time.Second
+			appendOption(name, value)
+		}
+	}
+
+	if oack == nil {
+		return nil, nil
+	}
+	return append([]byte{0, tftpOpOACK}, oack...), nil
+}
+
+// send sends the file in DATA packets, waiting for the ACK of each packet.
+func (t *tftpTransfer) send(ctx context.Context, r io.Reader, oack []byte) error {
+	if oack != nil {
+		if err := t.sendAndWait(ctx, oack, 0); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 4+t.blksize)
+	binary.BigEndian.PutUint16(buf, tftpOpDATA)
+	for block := uint16(1); ; block++ {
+		n, err := io.ReadFull(r, buf[4:])
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			sendTFTPError(t.conn, t.addr, tftpErrUndefined, err.Error())
+			return err
+		}
+		binary.BigEndian.PutUint16(buf[2:], block)
+		if err := t.sendAndWait(ctx, buf[:4+n], block); err != nil {
+			return err
+		}
+		// a block shorter than blksize terminates the transfer
+		if n < t.blksize {
+			return nil
+		}
+	}
+}
+
+// sendAndWait sends a packet, and retransmits it until the ACK of the block is received.
+func (t *tftpTransfer) sendAndWait(ctx context.Context, packet []byte, block uint16) error {
+	buf := make([]byte, tftpMaxRequestBytes)
+	for retry := 0; retry < tftpMaxRetries; retry++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := t.conn.WriteToUDP(packet, t.addr); err != nil {
+			return err
+		}
+
+		deadline := time.Now().Add(t.timeout)
+		for {
+			if err := t.conn.SetReadDeadline(deadline); err != nil {
+				return err
+			}
+			n, addr, err := t.conn.ReadFromUDP(buf)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if !addr.IP.Equal(t.addr.IP) || addr.Port != t.addr.Port {
+				sendTFTPError(t.conn, addr, tftpErrUnknownTID, "unknown transfer ID")
+				continue
+			}
+			if n < 4 {
+				continue
+			}
+			switch binary.BigEndian.Uint16(buf) {
+			case tftpOpACK:
+				if binary.BigEndian.Uint16(buf[2:]) == block {
+					return nil
+				}
+			case tftpOpERROR:
+				return fmt.Errorf("client aborted the transfer: %s", string(bytes.TrimRight(buf[4:n], "\x00")))
+			}
+		}
+	}
+
+	return fmt.Errorf("timed out waiting for ACK of block %d", block)
+}
+
+func sendTFTPError(conn *net.UDPConn, addr *net.UDPAddr, code uint16, msg string) {
+	packet := make([]byte, 4, 5+len(msg))
+	binary.BigEndian.PutUint16(packet, tftpOpERROR)
+	binary.BigEndian.PutUint16(packet[2:], code)
+	packet = append(packet, msg...)
+	packet = append(packet, 0)
+	if _, err := conn.WriteToUDP(packet, addr); err != nil {
+		log.Warn("failed to send TFTP error", map[string]interface{}{
+			log.FnError: err,
+			"client":    addr.String(),
+		})
+	}
+}
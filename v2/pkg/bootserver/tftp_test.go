@@ -0,0 +1,115 @@
+package bootserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TFTP server", func() {
+	var (
+		root   string
+		addr   *net.UDPAddr
+		client *net.UDPConn
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(root, "pxelinux.cfg"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "ipxe.efi"), bytes.Repeat([]byte("x"), 1000), 0644)).To(Succeed())
+
+		listen := func() (*net.UDPConn, error) {
+			return net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		}
+		conn, err := listen()
+		Expect(err).NotTo(HaveOccurred())
+		addr = conn.LocalAddr().(*net.UDPAddr)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		server := &tftpServer{files: &fileSystem{root: root}, listen: listen}
+		go server.serve(ctx, conn)
+
+		client, err = listen()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		client.Close()
+		cancel()
+	})
+
+	request := func(fields ...string) {
+		packet := []byte{0, tftpOpRRQ}
+		for _, f := range fields {
+			packet = append(packet, f...)
+			packet = append(packet, 0)
+		}
+		_, err := client.WriteToUDP(packet, addr)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	receive := func() ([]byte, *net.UDPAddr) {
+		buf := make([]byte, 1024)
+		Expect(client.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		n, from, err := client.ReadFromUDP(buf)
+		Expect(err).NotTo(HaveOccurred())
+		return buf[:n], from
+	}
+
+	ack := func(to *net.UDPAddr, block uint16) {
+		packet := make([]byte, 4)
+		binary.BigEndian.PutUint16(packet, tftpOpACK)
+		binary.BigEndian.PutUint16(packet[2:], block)
+		_, err := client.WriteToUDP(packet, to)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("should send a file with negotiated options", func() {
+		request("ipxe.efi", "octet", "blksize", "600", "tsize", "0")
+
+		packet, tid := receive()
+		Expect(tid.Port).NotTo(Equal(addr.Port))
+		Expect(binary.BigEndian.Uint16(packet)).To(BeNumerically("==", tftpOpOACK))
+		options := bytes.Split(bytes.TrimSuffix(packet[2:], []byte{0}), []byte{0})
+		Expect(options).To(ConsistOf([]byte("blksize"), []byte("600"), []byte("tsize"), []byte("1000")))
+		ack(tid, 0)
+
+		packet, _ = receive()
+		Expect(binary.BigEndian.Uint16(packet)).To(BeNumerically("==", tftpOpDATA))
+		Expect(binary.BigEndian.Uint16(packet[2:])).To(BeNumerically("==", 1))
+		Expect(packet[4:]).To(HaveLen(600))
+		ack(tid, 1)
+
+		packet, _ = receive()
+		Expect(binary.BigEndian.Uint16(packet[2:])).To(BeNumerically("==", 2))
+		Expect(packet[4:]).To(HaveLen(400))
+		ack(tid, 2)
+	})
+
+	It("should not serve files outside the root", func() {
+		Expect(os.WriteFile(filepath.Join(filepath.Dir(root), "secret"), []byte("secret"), 0644)).To(Succeed())
+
+		for _, name := range []string{"../secret", "/../secret", "pxelinux.cfg"} {
+			request(name, "octet")
+			packet, _ := receive()
+			Expect(binary.BigEndian.Uint16(packet)).To(BeNumerically("==", tftpOpERROR), name)
+		}
+	})
+
+	It("should reject write requests", func() {
+		_, err := client.WriteToUDP([]byte("\x00\x02ipxe.efi\x00octet\x00"), addr)
+		Expect(err).NotTo(HaveOccurred())
+		packet, _ := receive()
+		Expect(binary.BigEndian.Uint16(packet)).To(BeNumerically("==", tftpOpERROR))
+		Expect(binary.BigEndian.Uint16(packet[2:])).To(BeNumerically("==", tftpErrIllegalOp))
+	})
+})
@@ -13,6 +13,7 @@ import (
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/utils/sysctl"
 	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/event"
 	"github.com/cybozu-go/placemat/v2/pkg/types"
 	"github.com/cybozu-go/well"
 	"github.com/vishvananda/netlink"
@@ -197,6 +198,17 @@ func (n *netNS) Setup(ctx context.Context, mtu int, force bool) error {
 				}
 				return nil
 			})
+
+			ev := event.Event{
+				Type:    event.TypeNetNSAppExited,
+				NetNS:   n.name,
+				Details: map[string]string{"app": app.name},
+			}
+			if err != nil {
+				ev.Details["error"] = err.Error()
+			}
+			event.Publish(ev)
+
 			if err != nil {
 				return err
 			}
@@ -234,6 +246,16 @@ func (n *netNS) createNetNS() (ns.NetNS, error) {
 	return createdNS, err
 }
 
+// GetNetNS returns the network namespace created by placemat.
+// The caller should close it after use.
+func GetNetNS(name string) (ns.NetNS, error) {
+	netNS, err := ns.GetNS(path.Join(getNsRunDir(), name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network namespace %s: %w", name, err)
+	}
+	return netNS, nil
+}
+
 // Reference https://github.com/containernetworking/plugins/blob/509d645ee9ccfee0ad90fe29de3133d0598b7305/pkg/testutils/netns_linux.go#L31-L47
 func getNsRunDir() string {
 	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
@@ -0,0 +1,102 @@
+package event
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// Type represents the type of an event
+type Type string
+
+// Event types
+const (
+	TypeQEMUStarted        = Type("qemu-started")
+	TypeQEMUExited         = Type("qemu-exited")
+	TypePowerStatusChanged = Type("power-status-changed")
+	TypeGuestReset         = Type("guest-reset")
+	TypeBMCRegistered      = Type("bmc-registered")
+	TypeBMCReset           = Type("bmc-reset")
+	TypeNetNSAppExited     = Type("netns-app-exited")
+	TypeSELEntryAdded      = Type("sel-entry-added")
+)
+
+const subscriberBufferSize = 64
+
+// Event represents a lifecycle event of placemat resources
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Type    Type              `json:"type"`
+	Node    string            `json:"node,omitempty"`
+	NetNS   string            `json:"netns,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Broker delivers published events to subscribers.
+type Broker struct {
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]chan Event
+}
+
+// NewBroker creates a Broker.
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[int]chan Event),
+	}
+}
+
+// Publish sends an event to all subscribers.
+// Time is set to the current time if it is zero.
+// Events are dropped for subscribers which do not keep up, so that publishers never block.
+func (b *Broker) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			log.Warn("dropped an event for a slow subscriber", map[string]interface{}{
+				"type": e.Type,
+			})
+		}
+	}
+}
+
+// Subscribe returns a channel which receives published events, and a function to stop the subscription.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Event, subscriberBufferSize)
+	b.subscribers[id] = ch
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if ch, ok := b.subscribers[id]; ok {
+			close(ch)
+			delete(b.subscribers, id)
+		}
+	}
+}
+
+var defaultBroker = NewBroker()
+
+// Publish sends an event to the subscribers of the default broker.
+func Publish(e Event) {
+	defaultBroker.Publish(e)
+}
+
+// Subscribe subscribes the default broker.
+func Subscribe() (<-chan Event, func()) {
+	return defaultBroker.Subscribe()
+}
@@ -0,0 +1,43 @@
+package event
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Broker", func() {
+	It("should deliver events to all subscribers", func() {
+		b := NewBroker()
+		ch1, cancel1 := b.Subscribe()
+		ch2, cancel2 := b.Subscribe()
+		defer cancel2()
+
+		b.Publish(Event{Type: TypeQEMUStarted, Node: "node1"})
+
+		var ev Event
+		Expect(ch1).To(Receive(&ev))
+		Expect(ev.Type).To(Equal(TypeQEMUStarted))
+		Expect(ev.Node).To(Equal("node1"))
+		Expect(ev.Time.IsZero()).To(BeFalse())
+		Expect(ch2).To(Receive(&ev))
+		Expect(ev.Type).To(Equal(TypeQEMUStarted))
+
+		cancel1()
+		Expect(ch1).To(BeClosed())
+
+		b.Publish(Event{Type: TypeQEMUExited, Node: "node1"})
+		Expect(ch2).To(Receive(&ev))
+		Expect(ev.Type).To(Equal(TypeQEMUExited))
+	})
+
+	It("should not block publishers on slow subscribers", func() {
+		b := NewBroker()
+		ch, cancel := b.Subscribe()
+		defer cancel()
+
+		for i := 0; i < subscriberBufferSize*2; i++ {
+			b.Publish(Event{Type: TypePowerStatusChanged})
+		}
+		Expect(ch).To(HaveLen(subscriberBufferSize))
+	})
+})
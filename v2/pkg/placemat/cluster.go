@@ -2,18 +2,22 @@ package placemat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
 
 	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/netutil"
+	"github.com/cybozu-go/placemat/v2/pkg/bootserver"
 	"github.com/cybozu-go/placemat/v2/pkg/dcnet"
 	"github.com/cybozu-go/placemat/v2/pkg/types"
 	"github.com/cybozu-go/placemat/v2/pkg/vm"
 	"github.com/cybozu-go/well"
 )
 
+const bootServerNetNSPrefix = "boot-"
+
 // Cluster represents the interface to setup virtual data center
 type Cluster interface {
 	// Setup configures and starts virtual data center
@@ -26,6 +30,7 @@ type cluster struct {
 	deviceClassSpecs []*types.DeviceClassSpec
 	nodeSpecs        []*types.NodeSpec
 	imageSpecs       []*types.ImageSpec
+	bmcSpec          *types.BMCSpec
 	networks         []dcnet.Network
 	netNss           []dcnet.NetNS
 	nodes            []vm.Node
@@ -53,6 +58,28 @@ func NewCluster(spec *types.ClusterSpec) (*cluster, error) {
 		cluster.nodeSpecMap[node.Name] = node
 	}
 
+	// boot servers run in network namespaces named after their networks
+	netNSNames := make(map[string]bool)
+	for _, netns := range cluster.netNSSpecs {
+		netNSNames[netns.Name] = true
+	}
+	for _, network := range cluster.networkSpecs {
+		if network.BootServer == nil {
+			continue
+		}
+		if name := bootServerNetNSPrefix + network.Name; netNSNames[name] {
+			return nil, fmt.Errorf("NetworkNamespace %s clashes with the boot server of network %s", name, network.Name)
+		}
+	}
+
+	switch len(spec.BMCs) {
+	case 0:
+	case 1:
+		cluster.bmcSpec = spec.BMCs[0]
+	default:
+		return nil, errors.New("BMC resource must be specified at most once")
+	}
+
 	return cluster, nil
 }
 
@@ -88,7 +115,7 @@ func (c *cluster) Setup(ctx context.Context, r *vm.Runtime) error {
 	}
 
 	for _, spec := range c.nodeSpecs {
-		node, err := vm.NewNode(spec, c.imageSpecs, c.deviceClassSpecs)
+		node, err := vm.NewNode(spec, c.imageSpecs, c.deviceClassSpecs, c.bmcSpec)
 		if err != nil {
 			return err
 		}
@@ -147,6 +174,17 @@ func (c *cluster) Setup(ctx context.Context, r *vm.Runtime) error {
 		})
 	}
 
+	for _, spec := range c.networkSpecs {
+		if spec.BootServer == nil {
+			continue
+		}
+		srv, err := c.setupBootServer(ctx, spec, mtu, r.Force)
+		if err != nil {
+			return err
+		}
+		env.Go(srv.Start)
+	}
+
 	for _, vm := range c.vms {
 		vm := vm
 		env.Go(func(ctx context.Context) error {
@@ -181,6 +219,40 @@ func (c *cluster) Setup(ctx context.Context, r *vm.Runtime) error {
 	return nil
 }
 
+// setupBootServer creates a network namespace connected to the network, and a boot server listening in it.
+func (c *cluster) setupBootServer(ctx context.Context, spec *types.NetworkSpec, mtu int, force bool) (*bootserver.Server, error) {
+	name := bootServerNetNSPrefix + spec.Name
+	netNs, err := dcnet.NewNetNS(&types.NetNSSpec{
+		Name: name,
+		Interfaces: []*types.NetNSInterfaceSpec{
+			{
+				Network:   spec.Name,
+				Addresses: []string{spec.BootServer.Address},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.netNss = append(c.netNss, netNs)
+	if err := netNs.Setup(ctx, mtu, force); err != nil {
+		return nil, err
+	}
+
+	createdNS, err := dcnet.GetNetNS(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the server closes the network namespace when it stops
+	srv, err := bootserver.NewServer(spec.BootServer, createdNS)
+	if err != nil {
+		createdNS.Close()
+		return nil, err
+	}
+	return srv, nil
+}
+
 func (c *cluster) cleanup() {
 	dcnet.CleanupNatRules()
 
@@ -2,10 +2,13 @@ package placemat
 
 import (
 	"context"
+	"io"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/event"
 	"github.com/cybozu-go/placemat/v2/pkg/types"
 	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
 	"github.com/cybozu-go/placemat/v2/pkg/vm"
@@ -13,10 +16,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// eventKeepAliveInterval is the interval of the comments sent to the event stream while no event occurs
+const eventKeepAliveInterval = 30 * time.Second
+
 // NodeStatus represents status of a Node
 type NodeStatus struct {
 	Name        string                 `json:"name"`
 	Taps        map[string]string      `json:"taps"`
+	Interfaces  []vm.Interface         `json:"interfaces"`
 	Volumes     []string               `json:"volumes"`
 	CPU         int                    `json:"cpu"`
 	Memory      string                 `json:"memory"`
@@ -73,6 +80,24 @@ func (s *apiServer) prepareRouter() http.Handler {
 	router.GET("/nodes", s.handleNodes)
 	router.GET("/nodes/:name", s.handleNode)
 	router.POST("/nodes/:name/:action", s.handleNodeAction)
+	router.POST("/nodes/:name/volumes", s.handleNodeVolumeAttach)
+	router.DELETE("/nodes/:name/volumes/:volume", s.handleNodeVolumeDetach)
+	router.POST("/nodes/:name/volumes/:volume/media", s.handleNodeMediaChange)
+	router.DELETE("/nodes/:name/volumes/:volume/media", s.handleNodeMediaEject)
+	router.POST("/nodes/:name/interfaces", s.handleNodeInterfaceAttach)
+	router.DELETE("/nodes/:name/interfaces/:interface", s.handleNodeInterfaceDetach)
+	router.POST("/nodes/:name/resize", s.handleNodeResize)
+	router.GET("/nodes/:name/snapshots", s.handleNodeSnapshots)
+	router.POST("/nodes/:name/snapshots/:snapshot/:action", s.handleNodeSnapshotAction)
+	router.DELETE("/nodes/:name/snapshots/:snapshot", s.handleNodeSnapshotDelete)
+	router.POST("/snapshots/:snapshot/:action", s.handleSnapshotAction)
+	router.DELETE("/snapshots/:snapshot", s.handleSnapshotDelete)
+	router.GET("/nodes/:name/sensors", s.handleNodeSensors)
+	router.POST("/nodes/:name/sensors/:sensor", s.handleNodeSensorSet)
+	router.GET("/nodes/:name/sel", s.handleNodeSEL)
+	router.POST("/nodes/:name/sel", s.handleNodeSELAdd)
+	router.DELETE("/nodes/:name/sel", s.handleNodeSELClear)
+	router.GET("/events", s.handleEvents)
 
 	return router
 }
@@ -130,6 +155,18 @@ func (s *apiServer) handleNodeAction(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, nil)
 			return
 		}
+	case "pause":
+		if err := v.Pause(); err != nil {
+			log.Error("failed to pause", map[string]interface{}{log.FnError: err})
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+	case "resume":
+		if err := v.Resume(); err != nil {
+			log.Error("failed to resume", map[string]interface{}{log.FnError: err})
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
 	default:
 		c.JSON(http.StatusBadRequest, nil)
 		return
@@ -138,6 +175,423 @@ func (s *apiServer) handleNodeAction(c *gin.Context) {
 	c.JSON(http.StatusOK, nil)
 }
 
+func (s *apiServer) handleNodeVolumeAttach(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	var volume types.NodeVolumeSpec
+	if err := c.ShouldBindJSON(&volume); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].AttachVolume(volume); err != nil {
+		log.Error("failed to attach volume", map[string]interface{}{log.FnError: err, "node": name, "volume": volume.Name})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeVolumeDetach(c *gin.Context) {
+	name := c.Param("name")
+	volume := c.Param("volume")
+
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].DetachVolume(volume); err != nil {
+		log.Error("failed to detach volume", map[string]interface{}{log.FnError: err, "node": name, "volume": volume})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeMediaChange(c *gin.Context) {
+	name := c.Param("name")
+	volume := c.Param("volume")
+
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	var media types.NodeMediaSpec
+	if err := c.ShouldBindJSON(&media); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].ChangeMedia(volume, media); err != nil {
+		log.Error("failed to change media", map[string]interface{}{log.FnError: err, "node": name, "volume": volume})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeMediaEject(c *gin.Context) {
+	name := c.Param("name")
+	volume := c.Param("volume")
+
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].EjectMedia(volume); err != nil {
+		log.Error("failed to eject media", map[string]interface{}{log.FnError: err, "node": name, "volume": volume})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeInterfaceAttach(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	var req types.NodeInterfaceSpec
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := s.cluster.networkMap[req.Network]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "network " + req.Network + " not found"})
+		return
+	}
+
+	iface, err := s.cluster.vms[spec.SMBIOS.Serial].AttachInterface(req)
+	if err != nil {
+		log.Error("failed to attach interface", map[string]interface{}{log.FnError: err, "node": name, "network": req.Network})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, iface)
+}
+
+func (s *apiServer) handleNodeInterfaceDetach(c *gin.Context) {
+	name := c.Param("name")
+	iface := c.Param("interface")
+
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].DetachInterface(iface); err != nil {
+		log.Error("failed to detach interface", map[string]interface{}{log.FnError: err, "node": name, "interface": iface})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+// ResizeRequest represents a request to change the capacity of a Node
+type ResizeRequest struct {
+	CPU    int    `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+func (s *apiServer) handleNodeResize(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	var req ResizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].Resize(req.CPU, req.Memory); err != nil {
+		log.Error("failed to resize node", map[string]interface{}{log.FnError: err, "node": name, "cpu": req.CPU, "memory": req.Memory})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeSnapshots(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	snapshots, err := s.cluster.vms[spec.SMBIOS.Serial].ListSnapshots()
+	if err != nil {
+		log.Error("failed to list snapshots", map[string]interface{}{log.FnError: err})
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
+}
+
+func (s *apiServer) handleNodeSnapshotAction(c *gin.Context) {
+	name := c.Param("name")
+	snapshot := c.Param("snapshot")
+	action := c.Param("action")
+
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	v := s.cluster.vms[spec.SMBIOS.Serial]
+	switch action {
+	case "save":
+		if err := v.SaveSnapshot(snapshot); err != nil {
+			log.Error("failed to save snapshot", map[string]interface{}{log.FnError: err, "node": name, "snapshot": snapshot})
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+	case "load":
+		if err := v.LoadSnapshot(snapshot); err != nil {
+			log.Error("failed to load snapshot", map[string]interface{}{log.FnError: err, "node": name, "snapshot": snapshot})
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeSnapshotDelete(c *gin.Context) {
+	name := c.Param("name")
+	snapshot := c.Param("snapshot")
+
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].DeleteSnapshot(snapshot); err != nil {
+		log.Error("failed to delete snapshot", map[string]interface{}{log.FnError: err, "node": name, "snapshot": snapshot})
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleSnapshotAction(c *gin.Context) {
+	snapshot := c.Param("snapshot")
+	action := c.Param("action")
+
+	switch action {
+	case "save":
+		if err := s.cluster.saveSnapshot(snapshot); err != nil {
+			log.Error("failed to save cluster snapshot", map[string]interface{}{log.FnError: err, "snapshot": snapshot})
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+	case "load":
+		if err := s.cluster.loadSnapshot(snapshot); err != nil {
+			log.Error("failed to load cluster snapshot", map[string]interface{}{log.FnError: err, "snapshot": snapshot})
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleSnapshotDelete(c *gin.Context) {
+	snapshot := c.Param("snapshot")
+
+	if err := s.cluster.deleteSnapshot(snapshot); err != nil {
+		log.Error("failed to delete cluster snapshot", map[string]interface{}{log.FnError: err, "snapshot": snapshot})
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeSensors(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, s.cluster.vms[spec.SMBIOS.Serial].Sensors().Sensors())
+}
+
+// SensorRequest represents a request to change the value of a sensor
+type SensorRequest struct {
+	Value float64 `json:"value"`
+}
+
+func (s *apiServer) handleNodeSensorSet(c *gin.Context) {
+	name := c.Param("name")
+	sensor := c.Param("sensor")
+
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	var req SensorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].Sensors().SetValue(sensor, req.Value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func (s *apiServer) handleNodeSEL(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, s.cluster.vms[spec.SMBIOS.Serial].SEL().Entries())
+}
+
+// SELEntryRequest represents a request to add an entry to the SEL of a Node
+type SELEntryRequest struct {
+	SensorType   uint8 `json:"sensor_type"`
+	SensorNumber uint8 `json:"sensor_number"`
+	// EventType defaults to sensor-specific
+	EventType   uint8    `json:"event_type,omitempty"`
+	Deassertion bool     `json:"deassertion,omitempty"`
+	EventData   [3]uint8 `json:"event_data"`
+}
+
+func (s *apiServer) handleNodeSELAdd(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	var req SELEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.EventType == 0 {
+		req.EventType = virtualbmc.EventReadingTypeSensorSpecific
+	}
+	if req.EventType > 0x7f {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "event_type must be less than 0x80"})
+		return
+	}
+
+	entry, err := s.cluster.vms[spec.SMBIOS.Serial].SEL().Add(virtualbmc.SELEntry{
+		// the entries added via the API look as if they are logged by the BMC
+		GeneratorID:  virtualbmc.SELGeneratorBMC,
+		SensorType:   req.SensorType,
+		SensorNumber: req.SensorNumber,
+		EventType:    req.EventType,
+		Deassertion:  req.Deassertion,
+		EventData:    req.EventData,
+	})
+	if err != nil {
+		log.Error("failed to add SEL entry", map[string]interface{}{log.FnError: err, "node": name})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func (s *apiServer) handleNodeSELClear(c *gin.Context) {
+	name := c.Param("name")
+	spec, ok := s.cluster.nodeSpecMap[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err := s.cluster.vms[spec.SMBIOS.Serial].SEL().Clear(); err != nil {
+		log.Error("failed to clear SEL", map[string]interface{}{log.FnError: err, "node": name})
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+// handleEvents streams events as Server-Sent Events until the client disconnects.
+func (s *apiServer) handleEvents(c *gin.Context) {
+	events, cancel := event.Subscribe()
+	defer cancel()
+
+	// send the header immediately so that clients know that the subscription has started
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(eventKeepAliveInterval)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(string(ev.Type), ev)
+			return true
+		case <-ticker.C:
+			// a comment keeps idle connections from being closed by proxies
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
 func newNodeStatus(spec *types.NodeSpec, node vm.Node, vm vm.VM, runtime *vm.Runtime) *NodeStatus {
 	powerStatus, err := vm.PowerStatus()
 	if err != nil {
@@ -147,8 +601,9 @@ func newNodeStatus(spec *types.NodeSpec, node vm.Node, vm vm.VM, runtime *vm.Run
 	status := &NodeStatus{
 		Name:        spec.Name,
 		Taps:        node.Taps(),
-		CPU:         spec.CPU,
-		Memory:      spec.Memory,
+		Interfaces:  node.Interfaces(),
+		CPU:         node.CPU(),
+		Memory:      node.Memory(),
 		UEFI:        spec.UEFI,
 		TPM:         spec.TPM,
 		PowerStatus: powerStatus,
@@ -159,9 +614,6 @@ func newNodeStatus(spec *types.NodeSpec, node vm.Node, vm vm.VM, runtime *vm.Run
 	if !runtime.Graphic {
 		status.SocketPath = vm.SocketPath()
 	}
-	status.Volumes = make([]string, len(spec.Volumes))
-	for i, v := range spec.Volumes {
-		status.Volumes[i] = v.Name
-	}
+	status.Volumes = node.Volumes()
 	return status
 }
@@ -0,0 +1,101 @@
+package placemat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	"github.com/cybozu-go/placemat/v2/pkg/vm"
+	"github.com/cybozu-go/well"
+)
+
+// runningVMs returns running VMs keyed by their node names.
+// Powered off VMs are excluded because they have nothing to snapshot.
+func (c *cluster) runningVMs() (map[string]vm.VM, error) {
+	vms := make(map[string]vm.VM)
+	for _, spec := range c.nodeSpecs {
+		v := c.vms[spec.SMBIOS.Serial]
+		status, err := v.PowerStatus()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the power status of %s: %w", spec.Name, err)
+		}
+		if status == virtualbmc.PowerStatusOn || status == virtualbmc.PowerStatusPaused {
+			vms[spec.Name] = v
+		}
+	}
+
+	return vms, nil
+}
+
+// withPausedVMs pauses all running VMs, applies f to them in parallel, and then resumes them.
+// Pausing all VMs first makes the snapshots of the whole cluster consistent.
+func (c *cluster) withPausedVMs(f func(vm.VM) error) error {
+	vms, err := c.runningVMs()
+	if err != nil {
+		return err
+	}
+
+	var paused []vm.VM
+	defer func() {
+		for _, v := range paused {
+			if err := v.Resume(); err != nil {
+				log.Error("failed to resume", map[string]interface{}{log.FnError: err})
+			}
+		}
+	}()
+	for name, v := range vms {
+		status, err := v.PowerStatus()
+		if err != nil {
+			return err
+		}
+		if status != virtualbmc.PowerStatusOn {
+			continue
+		}
+		if err := v.Pause(); err != nil {
+			return fmt.Errorf("failed to pause %s: %w", name, err)
+		}
+		paused = append(paused, v)
+	}
+
+	return forEachVM(vms, f)
+}
+
+// forEachVM applies f to VMs in parallel.
+func forEachVM(vms map[string]vm.VM, f func(vm.VM) error) error {
+	env := well.NewEnvironment(context.Background())
+	for name, v := range vms {
+		name, v := name, v
+		env.Go(func(ctx context.Context) error {
+			if err := f(v); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		})
+	}
+	env.Stop()
+	return env.Wait()
+}
+
+func (c *cluster) saveSnapshot(name string) error {
+	return c.withPausedVMs(func(v vm.VM) error {
+		return v.SaveSnapshot(name)
+	})
+}
+
+func (c *cluster) loadSnapshot(name string) error {
+	return c.withPausedVMs(func(v vm.VM) error {
+		return v.LoadSnapshot(name)
+	})
+}
+
+func (c *cluster) deleteSnapshot(name string) error {
+	vms, err := c.runningVMs()
+	if err != nil {
+		return err
+	}
+
+	return forEachVM(vms, func(v vm.VM) error {
+		return v.DeleteSnapshot(name)
+	})
+}
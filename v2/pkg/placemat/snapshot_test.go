@@ -0,0 +1,122 @@
+package placemat
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	"github.com/cybozu-go/placemat/v2/pkg/vm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// operationLog records the operations on VMs in order
+type operationLog struct {
+	mu         sync.Mutex
+	operations []string
+}
+
+func (l *operationLog) add(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.operations = append(l.operations, op)
+}
+
+func (l *operationLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.operations...)
+}
+
+// snapshotVMMock implements the power and snapshot operations of vm.VM
+type snapshotVMMock struct {
+	vm.VM
+	name    string
+	log     *operationLog
+	saveErr error
+
+	mu     sync.Mutex
+	status virtualbmc.PowerStatus
+}
+
+func (v *snapshotVMMock) PowerStatus() (virtualbmc.PowerStatus, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.status, nil
+}
+
+func (v *snapshotVMMock) Pause() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.status = virtualbmc.PowerStatusPaused
+	v.log.add("pause " + v.name)
+	return nil
+}
+
+func (v *snapshotVMMock) Resume() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.status = virtualbmc.PowerStatusOn
+	v.log.add("resume " + v.name)
+	return nil
+}
+
+func (v *snapshotVMMock) SaveSnapshot(name string) error {
+	v.log.add("save " + v.name)
+	return v.saveErr
+}
+
+func (v *snapshotVMMock) DeleteSnapshot(name string) error {
+	v.log.add("delete " + v.name)
+	return nil
+}
+
+var _ = Describe("Cluster snapshots", func() {
+	var log *operationLog
+	var vms map[string]*snapshotVMMock
+	var c *cluster
+
+	BeforeEach(func() {
+		log = &operationLog{}
+		vms = map[string]*snapshotVMMock{
+			"running": {name: "running", log: log, status: virtualbmc.PowerStatusOn},
+			"paused":  {name: "paused", log: log, status: virtualbmc.PowerStatusPaused},
+			"off":     {name: "off", log: log, status: virtualbmc.PowerStatusOff},
+		}
+		c = &cluster{vms: make(map[string]vm.VM)}
+		for _, name := range []string{"running", "paused", "off"} {
+			spec := &types.NodeSpec{Name: name}
+			spec.SMBIOS.Serial = "serial-" + name
+			c.nodeSpecs = append(c.nodeSpecs, spec)
+			c.vms[spec.SMBIOS.Serial] = vms[name]
+		}
+	})
+
+	It("should pause running VMs before saving snapshots, and resume them after that", func() {
+		Expect(c.saveSnapshot("snap1")).To(Succeed())
+
+		Expect(log.get()).To(HaveLen(4))
+		Expect(log.get()[0]).To(Equal("pause running"))
+		Expect(log.get()[1:3]).To(ConsistOf("save running", "save paused"))
+		Expect(log.get()[3]).To(Equal("resume running"))
+
+		// the VM paused by the user is kept paused
+		Expect(vms["paused"].PowerStatus()).To(Equal(virtualbmc.PowerStatusPaused))
+		Expect(vms["running"].PowerStatus()).To(Equal(virtualbmc.PowerStatusOn))
+	})
+
+	It("should resume VMs even if a snapshot fails", func() {
+		vms["paused"].saveErr = errors.New("no space left on device")
+
+		err := c.saveSnapshot("snap1")
+		Expect(err).To(MatchError(ContainSubstring("paused: no space left on device")))
+		Expect(log.get()).To(ContainElement("resume running"))
+		Expect(vms["running"].PowerStatus()).To(Equal(virtualbmc.PowerStatusOn))
+	})
+
+	It("should delete snapshots without pausing VMs", func() {
+		Expect(c.deleteSnapshot("snap1")).To(Succeed())
+		Expect(log.get()).To(ConsistOf("delete running", "delete paused"))
+	})
+})
@@ -0,0 +1,13 @@
+package placemat
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPlacemat(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Placemat Suite")
+}
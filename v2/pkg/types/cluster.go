@@ -1,10 +1,14 @@
 package types
 
 import (
+	gojson "encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"sigs.k8s.io/yaml"
@@ -17,6 +21,7 @@ type ClusterSpec struct {
 	DeviceClasses []*DeviceClassSpec
 	Nodes         []*NodeSpec
 	Images        []*ImageSpec
+	BMCs          []*BMCSpec
 }
 
 // Append appends another cluster into the receiver.
@@ -26,6 +31,7 @@ func (c *ClusterSpec) Append(other *ClusterSpec) *ClusterSpec {
 	c.Nodes = append(c.Nodes, other.Nodes...)
 	c.Images = append(c.Images, other.Images...)
 	c.DeviceClasses = append(c.DeviceClasses, other.DeviceClasses...)
+	c.BMCs = append(c.BMCs, other.BMCs...)
 	return c
 }
 
@@ -43,11 +49,12 @@ const (
 
 // NetworkSpec represents a Network specification in YAML
 type NetworkSpec struct {
-	Kind    string      `json:"kind"`
-	Name    string      `json:"name"`
-	Type    NetworkType `json:"type"`
-	UseNAT  bool        `json:"use-nat"`
-	Address string      `json:"address,omitempty"`
+	Kind       string          `json:"kind"`
+	Name       string          `json:"name"`
+	Type       NetworkType     `json:"type"`
+	UseNAT     bool            `json:"use-nat"`
+	Address    string          `json:"address,omitempty"`
+	BootServer *BootServerSpec `json:"boot-server,omitempty"`
 }
 
 func (n *NetworkSpec) validate() error {
@@ -78,6 +85,36 @@ func (n *NetworkSpec) validate() error {
 		return fmt.Errorf("unknown type: %s", n.Type)
 	}
 
+	if n.BootServer != nil {
+		if err := n.BootServer.validate(); err != nil {
+			return fmt.Errorf("invalid boot server for network %s: %w", n.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// BootServerSpec represents a built-in TFTP/HTTP server for network boot attached to a Network
+type BootServerSpec struct {
+	Address  string `json:"address"`
+	Root     string `json:"root"`
+	TFTP     bool   `json:"tftp,omitempty"`
+	HTTPPort int    `json:"http-port,omitempty"`
+}
+
+func (b *BootServerSpec) validate() error {
+	if _, _, err := net.ParseCIDR(b.Address); err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if b.Root == "" {
+		return errors.New("root is empty")
+	}
+	if b.HTTPPort < 0 || b.HTTPPort > 65535 {
+		return fmt.Errorf("invalid http-port: %d", b.HTTPPort)
+	}
+	if !b.TFTP && b.HTTPPort == 0 {
+		return errors.New("either tftp or http-port must be specified")
+	}
 	return nil
 }
 
@@ -144,6 +181,9 @@ func (n *DeviceClassSpec) validate() error {
 type NodeVolumeCache string
 type NodeVolumeKind string
 type NodeVolumeFormat string
+type NodeVolumeBus string
+type NodeInterfaceModel string
+type NodeBootDevice string
 
 const (
 	NodeVolumeCacheWriteback    = NodeVolumeCache("writeback")
@@ -156,9 +196,22 @@ const (
 	NodeVolumeKindLocalds  = NodeVolumeKind("localds")
 	NodeVolumeKindRaw      = NodeVolumeKind("raw")
 	NodeVolumeKindHostPath = NodeVolumeKind("hostPath")
+	NodeVolumeKindCDROM    = NodeVolumeKind("cdrom")
 
 	NodeVolumeFormatQcow2 = NodeVolumeFormat("qcow2")
 	NodeVolumeFormatRaw   = NodeVolumeFormat("raw")
+
+	NodeVolumeBusIDE  = NodeVolumeBus("ide")
+	NodeVolumeBusSATA = NodeVolumeBus("sata")
+	NodeVolumeBusSCSI = NodeVolumeBus("scsi")
+
+	NodeInterfaceModelVirtio = NodeInterfaceModel("virtio")
+	NodeInterfaceModelE1000  = NodeInterfaceModel("e1000")
+	NodeInterfaceModelIGB    = NodeInterfaceModel("igb")
+
+	NodeBootDeviceDisk    = NodeBootDevice("disk")
+	NodeBootDeviceNetwork = NodeBootDevice("network")
+	NodeBootDeviceCDROM   = NodeBootDevice("cdrom")
 )
 
 // SMPSpec represents a SMP (CPU) specification in YAML
@@ -178,19 +231,23 @@ type NUMASpec struct {
 
 // NodeSpec represents a Node specification in YAML
 type NodeSpec struct {
-	Kind               string           `json:"kind"`
-	Name               string           `json:"name"`
-	Interfaces         []string         `json:"interfaces,omitempty"`
-	Volumes            []NodeVolumeSpec `json:"volumes,omitempty"`
-	IgnitionFile       string           `json:"ignition,omitempty"`
-	CPU                int              `json:"cpu,omitempty"` // compatibility use
-	SMP                *SMPSpec         `json:"smp,omitempty"`
-	Memory             string           `json:"memory,omitempty"`
-	NUMA               NUMASpec         `json:"numa,omitempty"`
-	NetworkDeviceQueue int              `json:"network-device-queue,omitempty"`
-	UEFI               bool             `json:"uefi,omitempty"`
-	TPM                bool             `json:"tpm,omitempty"`
-	SMBIOS             SMBIOSConfigSpec `json:"smbios,omitempty"`
+	Kind               string              `json:"kind"`
+	Name               string              `json:"name"`
+	Interfaces         []NodeInterfaceSpec `json:"interfaces,omitempty"`
+	Volumes            []NodeVolumeSpec    `json:"volumes,omitempty"`
+	IgnitionFile       string              `json:"ignition,omitempty"`
+	CPU                int                 `json:"cpu,omitempty"` // compatibility use
+	SMP                *SMPSpec            `json:"smp,omitempty"`
+	Memory             string              `json:"memory,omitempty"`
+	MaxMemory          string              `json:"max-memory,omitempty"`
+	MemorySlots        int                 `json:"memory-slots,omitempty"`
+	NUMA               NUMASpec            `json:"numa,omitempty"`
+	NetworkDeviceQueue int                 `json:"network-device-queue,omitempty"`
+	BootOrder          []NodeBootDevice    `json:"boot-order,omitempty"`
+	UEFI               bool                `json:"uefi,omitempty"`
+	TPM                bool                `json:"tpm,omitempty"`
+	SMBIOS             SMBIOSConfigSpec    `json:"smbios,omitempty"`
+	BMC                *NodeBMCSpec        `json:"bmc,omitempty"`
 }
 
 func (n *NodeSpec) validate() error {
@@ -198,6 +255,12 @@ func (n *NodeSpec) validate() error {
 		return errors.New("node name is empty")
 	}
 
+	for i := range n.Interfaces {
+		if err := n.Interfaces[i].validate(); err != nil {
+			return err
+		}
+	}
+
 	for _, volume := range n.Volumes {
 		if err := volume.validate(); err != nil {
 			return err
@@ -215,6 +278,141 @@ func (n *NodeSpec) validate() error {
 		n.CPU = 0
 	}
 
+	seen := make(map[NodeBootDevice]bool)
+	for _, d := range n.BootOrder {
+		switch d {
+		case NodeBootDeviceDisk, NodeBootDeviceNetwork, NodeBootDeviceCDROM:
+		default:
+			return fmt.Errorf("invalid boot device: %s", d)
+		}
+		if seen[d] {
+			return fmt.Errorf("duplicate boot device: %s", d)
+		}
+		seen[d] = true
+	}
+
+	if n.MaxMemory != "" {
+		if n.Memory == "" {
+			return errors.New("node max-memory requires memory")
+		}
+		if n.MemorySlots <= 0 {
+			return errors.New("node max-memory requires memory-slots")
+		}
+		memory, err := ParseMemorySize(n.Memory)
+		if err != nil {
+			return err
+		}
+		maxMemory, err := ParseMemorySize(n.MaxMemory)
+		if err != nil {
+			return err
+		}
+		if maxMemory < memory {
+			return errors.New("node max-memory must not be less than memory")
+		}
+	} else if n.MemorySlots != 0 {
+		return errors.New("node memory-slots requires max-memory")
+	}
+
+	if n.BMC != nil {
+		if err := validateBMCUsers(n.BMC.Users); err != nil {
+			return err
+		}
+		if err := n.BMC.Profile.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseMemorySize parses a memory size in the same way as the -m option of QEMU.
+// A size without a suffix is in MiB.
+func ParseMemorySize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.TrimSuffix(size, "B"), "i")
+	if s == "" {
+		return 0, errors.New("memory size is empty")
+	}
+
+	units := map[byte]int64{
+		'k': 1 << 10, 'K': 1 << 10,
+		'm': 1 << 20, 'M': 1 << 20,
+		'g': 1 << 30, 'G': 1 << 30,
+		't': 1 << 40, 'T': 1 << 40,
+	}
+	unit := int64(1 << 20)
+	if u, ok := units[s[len(s)-1]]; ok {
+		unit = u
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory size: %s", size)
+	}
+	return n * unit, nil
+}
+
+// NodeInterfaceSpec represents a Node's network interface specification in YAML.
+// It is also written as a network name only.
+type NodeInterfaceSpec struct {
+	Network   string             `json:"network"`
+	MAC       string             `json:"mac,omitempty"`
+	Model     NodeInterfaceModel `json:"model,omitempty"`
+	Queues    int                `json:"queues,omitempty"`
+	BootIndex *int               `json:"bootindex,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (n *NodeInterfaceSpec) UnmarshalJSON(data []byte) error {
+	var network string
+	if err := gojson.Unmarshal(data, &network); err == nil {
+		*n = NodeInterfaceSpec{Network: network}
+		return nil
+	}
+
+	type nodeInterfaceSpec NodeInterfaceSpec
+	var spec nodeInterfaceSpec
+	if err := gojson.Unmarshal(data, &spec); err != nil {
+		return err
+	}
+	*n = NodeInterfaceSpec(spec)
+	return nil
+}
+
+func (n *NodeInterfaceSpec) validate() error {
+	if n.Network == "" {
+		return errors.New("node interface network is empty")
+	}
+
+	switch n.Model {
+	case "":
+		n.Model = NodeInterfaceModelVirtio
+	case NodeInterfaceModelVirtio, NodeInterfaceModelE1000, NodeInterfaceModelIGB:
+	default:
+		return fmt.Errorf("invalid model for interface %s: %s", n.Network, n.Model)
+	}
+	if n.Queues < 0 {
+		return fmt.Errorf("invalid queues for interface %s: %d", n.Network, n.Queues)
+	}
+	if n.Queues > 1 && n.Model != NodeInterfaceModelVirtio {
+		return fmt.Errorf("multi queue is only supported by virtio for interface %s", n.Network)
+	}
+	if n.BootIndex != nil && *n.BootIndex < 0 {
+		return fmt.Errorf("invalid bootindex for interface %s: %d", n.Network, *n.BootIndex)
+	}
+
+	if n.MAC == "" {
+		return nil
+	}
+
+	mac, err := net.ParseMAC(n.MAC)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address for interface %s: %w", n.Network, err)
+	}
+	if len(mac) != 6 || mac[0]&1 != 0 {
+		return fmt.Errorf("MAC address for interface %s must be a unicast EUI-48 address: %s", n.Network, n.MAC)
+	}
+	n.MAC = mac.String()
 	return nil
 }
 
@@ -240,6 +438,7 @@ type NodeVolumeSpec struct {
 	VG            string           `json:"vg,omitempty"`
 	Writable      bool             `json:"writable,omitempty"`
 	DeviceClass   string           `json:"device-class,omitempty"`
+	Bus           NodeVolumeBus    `json:"bus,omitempty"`
 }
 
 func (n *NodeVolumeSpec) validate() error {
@@ -279,6 +478,20 @@ func (n *NodeVolumeSpec) validate() error {
 		if !filepath.IsAbs(n.Path) {
 			return errors.New("path should be absolute")
 		}
+	case NodeVolumeKindCDROM:
+		if n.Image != "" && n.Path != "" {
+			return errors.New("cdrom volume cannot specify both image and path")
+		}
+		if n.Path != "" && !filepath.IsAbs(n.Path) {
+			return errors.New("path should be absolute")
+		}
+		switch n.Bus {
+		case "":
+			n.Bus = NodeVolumeBusIDE
+		case NodeVolumeBusIDE, NodeVolumeBusSATA, NodeVolumeBusSCSI:
+		default:
+			return errors.New("invalid bus for cdrom volume")
+		}
 	default:
 		return errors.New("unknown volume kind: " + string(n.Kind))
 	}
@@ -286,6 +499,111 @@ func (n *NodeVolumeSpec) validate() error {
 	return nil
 }
 
+// NodeMediaSpec represents a media inserted into a cdrom volume.
+// Exactly one of the fields should be specified.
+type NodeMediaSpec struct {
+	Image string `json:"image,omitempty"`
+	Path  string `json:"path,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// NodeBMCSpec represents the BMC of a Node in YAML
+type NodeBMCSpec struct {
+	Users   []BMCUserSpec `json:"users,omitempty"`
+	Profile BMCProfile    `json:"profile,omitempty"`
+	// CipherSuiteZero enables IPMI cipher suite 0, which does not authenticate users
+	CipherSuiteZero bool `json:"cipher-suite-zero,omitempty"`
+}
+
+// BMCProfile represents the vendor personality of a BMC
+type BMCProfile string
+
+const (
+	BMCProfileDefault    = BMCProfile("")
+	BMCProfileDell       = BMCProfile("dell")
+	BMCProfileSupermicro = BMCProfile("supermicro")
+	BMCProfileHPE        = BMCProfile("hpe")
+)
+
+// BMCProfiles is the list of the supported BMC profiles
+var BMCProfiles = []BMCProfile{BMCProfileDefault, BMCProfileDell, BMCProfileSupermicro, BMCProfileHPE}
+
+// Validate returns an error if the profile is not supported
+func (p BMCProfile) Validate() error {
+	for _, s := range BMCProfiles {
+		if p == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid BMC profile: %s", p)
+}
+
+// BMCSpec represents a BMC specification in YAML, which applies to the nodes without their own BMC users
+type BMCSpec struct {
+	Kind  string        `json:"kind"`
+	Users []BMCUserSpec `json:"users"`
+}
+
+func (b *BMCSpec) validate() error {
+	return validateBMCUsers(b.Users)
+}
+
+type BMCPrivilege string
+
+const (
+	BMCPrivilegeAdministrator = BMCPrivilege("administrator")
+	BMCPrivilegeOperator      = BMCPrivilege("operator")
+	BMCPrivilegeUser          = BMCPrivilege("user")
+	BMCPrivilegeCallback      = BMCPrivilege("callback")
+)
+
+const (
+	// maxBMCUsers is the number of BMC users excluding the IPMI null user
+	maxBMCUsers           = 15
+	maxBMCUserNameLen     = 16
+	maxBMCUserPasswordLen = 20
+)
+
+// BMCUserSpec represents a user of a BMC in YAML
+type BMCUserSpec struct {
+	Name      string       `json:"name"`
+	Password  string       `json:"password"`
+	Privilege BMCPrivilege `json:"privilege,omitempty"`
+}
+
+func validateBMCUsers(users []BMCUserSpec) error {
+	if len(users) > maxBMCUsers {
+		return fmt.Errorf("too many BMC users: %d", len(users))
+	}
+
+	seen := make(map[string]bool)
+	for i := range users {
+		u := &users[i]
+		if u.Name == "" {
+			return errors.New("BMC user name is empty")
+		}
+		if len(u.Name) > maxBMCUserNameLen {
+			return fmt.Errorf("too long BMC user name: %s", u.Name)
+		}
+		if seen[u.Name] {
+			return fmt.Errorf("duplicate BMC user: %s", u.Name)
+		}
+		seen[u.Name] = true
+		if len(u.Password) > maxBMCUserPasswordLen {
+			return fmt.Errorf("too long password for BMC user %s", u.Name)
+		}
+
+		switch u.Privilege {
+		case "":
+			u.Privilege = BMCPrivilegeAdministrator
+		case BMCPrivilegeAdministrator, BMCPrivilegeOperator, BMCPrivilegeUser, BMCPrivilegeCallback:
+		default:
+			return fmt.Errorf("invalid privilege for BMC user %s: %s", u.Name, u.Privilege)
+		}
+	}
+	return nil
+}
+
 // ImageSpec represents an Image specification in YAML.
 type ImageSpec struct {
 	Kind              string `json:"kind"`
@@ -377,6 +695,15 @@ func Parse(r io.Reader) (*ClusterSpec, error) {
 				return nil, fmt.Errorf("invalid Image resource: %w", err)
 			}
 			cluster.Images = append(cluster.Images, i)
+		case "BMC":
+			b := &BMCSpec{}
+			if err := yaml.Unmarshal(y, b); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal the BMC yaml document %s: %w", y, err)
+			}
+			if err := b.validate(); err != nil {
+				return nil, fmt.Errorf("invalid BMC resource: %w", err)
+			}
+			cluster.BMCs = append(cluster.BMCs, b)
 		default:
 			return nil, errors.New("unknown resource: " + b.Kind)
 		}
@@ -9,6 +9,7 @@ import (
 
 var _ = Describe("ClusterSpec resource types", func() {
 	It("should create a cluster from a yaml", func() {
+		bootIndex := 1
 		clusterYaml := `
 kind: Network
 name: internet
@@ -20,6 +21,11 @@ kind: Network
 name: core-to-op
 type: internal
 use-nat: false
+boot-server:
+  address: 10.69.0.5/24
+  root: /var/lib/placemat/boot
+  tftp: true
+  http-port: 8080
 ---
 kind: NetworkNamespace
 name: core
@@ -49,8 +55,13 @@ kind: Node
 name: boot-0
 interfaces:
 - r0-node1
-- r0-node2
+- network: r0-node2
+  mac: 52:54:00:12:34:56
+  model: e1000
+  bootindex: 1
 memory: 2G
+max-memory: 8G
+memory-slots: 4
 smp:
   cpus: 8
   cores: 3
@@ -61,6 +72,9 @@ smp:
 numa:
   nodes: 12
 network-device-queue: 16
+boot-order:
+- network
+- disk
 smbios:
   manufacturer: cybozu
   product: mk2
@@ -80,6 +94,9 @@ volumes:
 - kind: hostPath
   name: sabakan
   path: /var/foo/sabakan-data
+- kind: cdrom
+  name: installer
+  image: custom-ubuntu-image
 uefi: false
 tpm: true
 ---
@@ -101,6 +118,12 @@ file: cybozu-ubuntu-18.04-server-cloudimg-amd64.img
 				Name:   "core-to-op",
 				Type:   "internal",
 				UseNAT: false,
+				BootServer: &BootServerSpec{
+					Address:  "10.69.0.5/24",
+					Root:     "/var/lib/placemat/boot",
+					TFTP:     true,
+					HTTPPort: 8080,
+				},
 			}},
 			NetNSs: []*NetNSSpec{{
 				Kind: "NetworkNamespace",
@@ -143,9 +166,9 @@ file: cybozu-ubuntu-18.04-server-cloudimg-amd64.img
 				{
 					Kind: "Node",
 					Name: "boot-0",
-					Interfaces: []string{
-						"r0-node1",
-						"r0-node2",
+					Interfaces: []NodeInterfaceSpec{
+						{Network: "r0-node1", Model: "virtio"},
+						{Network: "r0-node2", MAC: "52:54:00:12:34:56", Model: "e1000", BootIndex: &bootIndex},
 					},
 					Volumes: []NodeVolumeSpec{
 						{
@@ -167,6 +190,11 @@ file: cybozu-ubuntu-18.04-server-cloudimg-amd64.img
 							Name: "sabakan",
 							Path: "/var/foo/sabakan-data",
 						},
+						{
+							Kind:  "cdrom",
+							Name:  "installer",
+							Image: "custom-ubuntu-image",
+						},
 					},
 					IgnitionFile: "my-node.ign",
 					SMP: &SMPSpec{
@@ -177,11 +205,14 @@ file: cybozu-ubuntu-18.04-server-cloudimg-amd64.img
 						Sockets: 4,
 						MaxCPUs: 100,
 					},
-					Memory: "2G",
+					Memory:      "2G",
+					MaxMemory:   "8G",
+					MemorySlots: 4,
 					NUMA: NUMASpec{
 						Nodes: 12,
 					},
 					NetworkDeviceQueue: 16,
+					BootOrder:          []NodeBootDevice{"network", "disk"},
 					UEFI:               false,
 					TPM:                true,
 					SMBIOS: SMBIOSConfigSpec{
@@ -241,6 +272,103 @@ name: boot-0
 		Expect(err).To(HaveOccurred())
 	})
 
+	It("should NOT create a node with max-memory but without memory-slots", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+memory: 2G
+max-memory: 8G
+`
+		_, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should NOT create a node with max-memory less than memory", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+memory: 4G
+max-memory: 2048M
+memory-slots: 4
+`
+		_, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should parse memory sizes in the same way as QEMU", func() {
+		for s, expected := range map[string]int64{
+			"2048": 2 << 30,
+			"512M": 512 << 20,
+			"4G":   4 << 30,
+			"4GiB": 4 << 30,
+			"1T":   1 << 40,
+		} {
+			size, err := ParseMemorySize(s)
+			Expect(err).NotTo(HaveOccurred(), s)
+			Expect(size).To(Equal(expected), s)
+		}
+
+		for _, s := range []string{"", "G", "-1G", "4X"} {
+			_, err := ParseMemorySize(s)
+			Expect(err).To(HaveOccurred(), s)
+		}
+	})
+
+	It("should NOT create a node interface with a multicast MAC address", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+interfaces:
+- network: r0-node1
+  mac: 01:00:5e:00:00:01
+`
+		_, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should NOT create a node interface with multi queue for e1000", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+interfaces:
+- network: r0-node1
+  model: e1000
+  queues: 4
+`
+		_, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should NOT create a node with an unknown boot device", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+boot-order:
+- floppy
+`
+		_, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should NOT create a boot server without tftp nor http", func() {
+		clusterYaml := `
+kind: Network
+name: net0
+type: internal
+use-nat: false
+boot-server:
+  address: 10.69.0.5/24
+  root: /var/lib/placemat/boot
+`
+		_, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+	})
+
 	It("should NOT create a network whose name is more than 15 characters", func() {
 		clusterYaml := `
 kind: Network
@@ -354,4 +482,140 @@ tpm: true
 		Expect(err).To(HaveOccurred())
 		Expect(cluster).To(BeNil())
 	})
+
+	It("should NOT create a cdrom node volume with both image and path", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+memory: 2G
+cpu: 8
+volumes:
+- kind: cdrom
+  name: installer
+  image: ubuntu-iso
+  path: /var/lib/ubuntu.iso
+`
+		cluster, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+		Expect(cluster).To(BeNil())
+	})
+
+	It("should NOT create a cdrom node volume whose path is not absolute", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+memory: 2G
+cpu: 8
+volumes:
+- kind: cdrom
+  name: installer
+  path: ubuntu.iso
+`
+		cluster, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+		Expect(cluster).To(BeNil())
+	})
+
+	It("should NOT create a cdrom node volume on an unknown bus", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+memory: 2G
+cpu: 8
+volumes:
+- kind: cdrom
+  name: installer
+  bus: usb
+`
+		cluster, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+		Expect(cluster).To(BeNil())
+	})
+
+	It("should create BMC users from a yaml", func() {
+		clusterYaml := `
+kind: BMC
+users:
+- name: admin
+  password: secret
+---
+kind: Node
+name: boot-0
+cpu: 8
+bmc:
+  users:
+  - name: operator
+    password: secret
+    privilege: operator
+`
+		cluster, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.BMCs).To(Equal([]*BMCSpec{
+			{
+				Kind: "BMC",
+				Users: []BMCUserSpec{
+					{Name: "admin", Password: "secret", Privilege: BMCPrivilegeAdministrator},
+				},
+			},
+		}))
+		Expect(cluster.Nodes[0].BMC).To(Equal(&NodeBMCSpec{
+			Users: []BMCUserSpec{
+				{Name: "operator", Password: "secret", Privilege: BMCPrivilegeOperator},
+			},
+		}))
+	})
+
+	It("should NOT create BMC users with an invalid privilege", func() {
+		clusterYaml := `
+kind: BMC
+users:
+- name: admin
+  password: secret
+  privilege: root
+`
+		cluster, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+		Expect(cluster).To(BeNil())
+	})
+
+	It("should NOT create a node with duplicate BMC users", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+bmc:
+  users:
+  - name: admin
+    password: foo
+  - name: admin
+    password: bar
+`
+		cluster, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+		Expect(cluster).To(BeNil())
+	})
+
+	It("should create a node with a BMC profile", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+bmc:
+  profile: supermicro
+`
+		cluster, err := Parse(strings.NewReader(clusterYaml))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Nodes[0].BMC.Profile).To(Equal(BMCProfileSupermicro))
+
+		clusterYaml = `
+kind: Node
+name: boot-0
+cpu: 8
+bmc:
+  profile: lenovo
+`
+		cluster, err = Parse(strings.NewReader(clusterYaml))
+		Expect(err).To(HaveOccurred())
+		Expect(cluster).To(BeNil())
+	})
 })
@@ -0,0 +1,213 @@
+package virtualbmc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+)
+
+// Profile represents the vendor personality of a BMC.
+// The supported profiles are defined by types.BMCProfiles, and each of them has its vendorProfile.
+type Profile types.BMCProfile
+
+const (
+	// ProfileDefault is the personality of placemat, whose system ID resembles iDRAC
+	ProfileDefault    = Profile(types.BMCProfileDefault)
+	ProfileDell       = Profile(types.BMCProfileDell)
+	ProfileSupermicro = Profile(types.BMCProfileSupermicro)
+	ProfileHPE        = Profile(types.BMCProfileHPE)
+)
+
+// vendorProfile represents the resource IDs and the identities of a vendor's BMC
+type vendorProfile struct {
+	name Profile
+	// systemID is the ID of both the ComputerSystem and the Chassis resources
+	systemID  string
+	managerID string
+	// vendor and product are shown in the service root
+	vendor       string
+	product      string
+	managerModel string
+	// manufacturerID is the IANA enterprise number returned by Get Device ID
+	manufacturerID uint32
+	productID      uint16
+
+	// baseRegistry is the prefix of the message IDs from the Base message registry
+	baseRegistry string
+	// noOperationMessageID is the message ID for the requests which change nothing such as powering on a running machine
+	noOperationMessageID string
+	// resourceMissingMessageID is the vendor specific message ID for missing resources, or empty if the vendor has none
+	resourceMissingMessageID string
+	errorCode                string
+	errorMessage             string
+}
+
+var vendorProfiles = map[Profile]*vendorProfile{
+	ProfileDefault: {
+		name:                     ProfileDefault,
+		systemID:                 "System.Embedded.1",
+		managerID:                "1",
+		product:                  "Placemat",
+		managerModel:             "Placemat Virtual BMC",
+		baseRegistry:             "Base.X.X",
+		noOperationMessageID:     "X.X.X",
+		resourceMissingMessageID: "X.X.X",
+		errorCode:                "Base.X.X.GeneralError",
+		errorMessage:             "A general error has occurred. See ExtendedInfo for more information",
+	},
+	ProfileDell: {
+		name:                     ProfileDell,
+		systemID:                 "System.Embedded.1",
+		managerID:                "iDRAC.Embedded.1",
+		vendor:                   "Dell",
+		product:                  "Integrated Dell Remote Access Controller",
+		managerModel:             "14G Monolithic",
+		manufacturerID:           674,
+		productID:                0x0100,
+		baseRegistry:             "Base.1.12",
+		noOperationMessageID:     "Base.1.12.NoOperation",
+		resourceMissingMessageID: "IDRAC.2.8.SYS403",
+		errorCode:                "Base.1.12.GeneralError",
+		errorMessage:             "A general error has occurred. See ExtendedInfo for more information",
+	},
+	ProfileSupermicro: {
+		name:                 ProfileSupermicro,
+		systemID:             "1",
+		managerID:            "1",
+		vendor:               "Supermicro",
+		product:              "Supermicro BMC",
+		managerModel:         "ASPEED",
+		manufacturerID:       10876,
+		baseRegistry:         "Base.1.4",
+		noOperationMessageID: "Base.1.4.NoOperation",
+		errorCode:            "Base.1.4.GeneralError",
+		errorMessage:         "A general error has occurred. See ExtendedInfo for more information.",
+	},
+	ProfileHPE: {
+		name:                 ProfileHPE,
+		systemID:             "1",
+		managerID:            "1",
+		vendor:               "HPE",
+		product:              "ProLiant",
+		managerModel:         "iLO 5",
+		manufacturerID:       11,
+		productID:            0x2000,
+		baseRegistry:         "Base.1.4",
+		noOperationMessageID: "Base.1.4.NoOperation",
+		errorCode:            "iLO.0.10.ExtendedInfo",
+		errorMessage:         "See @Message.ExtendedInfo for more information.",
+	},
+}
+
+// lookupProfile returns the vendor profile. Unknown profiles fall back to the default.
+func lookupProfile(p Profile) *vendorProfile {
+	if v, ok := vendorProfiles[p]; ok {
+		return v
+	}
+	return vendorProfiles[ProfileDefault]
+}
+
+// vendorProfileOf returns the vendor profile of the BMC
+func vendorProfileOf(bmc BMC) *vendorProfile {
+	if bmc == nil {
+		return lookupProfile(ProfileDefault)
+	}
+	return lookupProfile(bmc.Profile())
+}
+
+func (v *vendorProfile) errorResponse(infos ...MessageExtendedInfo) ErrorResponse {
+	return ErrorResponse{
+		Error: Error{
+			MessageExtendedInfo: infos,
+			Code:                v.errorCode,
+			Message:             v.errorMessage,
+		},
+	}
+}
+
+// createResourceNotFoundErrorResponse creates the response for a missing resource
+func (v *vendorProfile) createResourceNotFoundErrorResponse(resourceID string) ErrorResponse {
+	return v.errorResponse(MessageExtendedInfo{
+		Message:                     fmt.Sprintf("The resource at the URI %s was not found.", resourceID),
+		MessageArgs:                 []string{resourceID},
+		MessageArgsOdataCount:       1,
+		MessageID:                   v.baseRegistry + ".ResourceMissingAtURI",
+		RelatedProperties:           []interface{}{},
+		RelatedPropertiesOdataCount: 0,
+		Resolution:                  "Place a valid resource at the URI or correct the URI and resubmit the request.",
+		Severity:                    "Critical",
+	})
+}
+
+// createNoOperationErrorResponse creates the response for a request which changes nothing
+func (v *vendorProfile) createNoOperationErrorResponse(message string) ErrorResponse {
+	return v.errorResponse(MessageExtendedInfo{
+		Message:                     message,
+		MessageArgs:                 []string{},
+		MessageArgsOdataCount:       0,
+		MessageID:                   v.noOperationMessageID,
+		RelatedProperties:           []interface{}{},
+		RelatedPropertiesOdataCount: 0,
+		Resolution:                  "No response action is required.",
+		Severity:                    "Informational",
+	})
+}
+
+// computerSystemOem creates the Oem section of the ComputerSystem resource
+func (v *vendorProfile) computerSystemOem(powerState PowerStatus, inv Inventory) ComputerSystemOem {
+	switch v.name {
+	case ProfileDell:
+		return ComputerSystemOem{
+			Dell: &DellComputerSystemOem{
+				DellSystem: DellSystem{
+					OdataType:         "#DellSystem.v1_6_0.DellSystem",
+					ChassisServiceTag: inv.SerialNumber,
+					SystemGeneration:  v.managerModel,
+				},
+			},
+		}
+	case ProfileHPE:
+		postState := "FinishedPost"
+		if powerState != PowerStatusOn {
+			postState = "PowerOff"
+		}
+		return ComputerSystemOem{
+			Hpe: &HpeComputerSystemOem{
+				OdataType: "#HpeComputerSystemExt.v2_9_0.HpeComputerSystemExt",
+				PostState: postState,
+			},
+		}
+	case ProfileSupermicro:
+		return ComputerSystemOem{
+			Supermicro: &SupermicroComputerSystemOem{
+				OdataType: "#SmcSystemExtensions.v1_0_0.System",
+			},
+		}
+	}
+	return ComputerSystemOem{}
+}
+
+// managerOem creates the Oem section of the Manager resource, or nil if the vendor has none
+func (v *vendorProfile) managerOem(address string) *ManagerOem {
+	switch v.name {
+	case ProfileDell:
+		return &ManagerOem{
+			Dell: &DellManagerOem{
+				DelliDRACCard: DelliDRACCard{
+					OdataType:   "#DelliDRACCard.v1_1_0.DelliDRACCard",
+					IPMIVersion: "2.0",
+					URLString:   "https://" + net.JoinHostPort(address, strconv.Itoa(redfishPort)),
+				},
+			},
+		}
+	case ProfileHPE:
+		return &ManagerOem{
+			Hpe: &HpeManagerOem{
+				OdataType: "#HpeiLO.v2_7_0.HpeiLO",
+			},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package virtualbmc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BMC profiles", func() {
+	var users *UserHolder
+
+	BeforeEach(func() {
+		var err error
+		users, err = NewUserHolder([]User{
+			{Name: "admin", Password: "admin-password", Privilege: PrivilegeAdministrator},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	request := func(router http.Handler, method, path string, v interface{}) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.SetBasicAuth("admin", "admin-password")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if v != nil {
+			Expect(json.Unmarshal(w.Body.Bytes(), v)).To(Succeed())
+		}
+		return w.Code
+	}
+
+	It("should mimic iDRAC", func() {
+		machine := &MachineMock{status: PowerStatusOn, inventory: Inventory{SerialNumber: "abcd"}}
+		bmc := &BMCMock{address: "10.0.0.5", profile: ProfileDell}
+		router := prepareRouter(redfishOptions{machine: machine, bmc: bmc, users: users})
+
+		var root ServiceRoot
+		Expect(request(router, http.MethodGet, "/redfish/v1", &root)).To(Equal(http.StatusOK))
+		Expect(root.Vendor).To(Equal("Dell"))
+
+		var collection ResourceCollection
+		Expect(request(router, http.MethodGet, "/redfish/v1/Managers", &collection)).To(Equal(http.StatusOK))
+		Expect(collection.Members).To(Equal([]OdataID{{OdataID: "/redfish/v1/Managers/iDRAC.Embedded.1"}}))
+
+		var manager Manager
+		Expect(request(router, http.MethodGet, "/redfish/v1/Managers/iDRAC.Embedded.1", &manager)).To(Equal(http.StatusOK))
+		Expect(manager.Oem).NotTo(BeNil())
+		Expect(manager.Oem.Dell.DelliDRACCard.URLString).To(Equal("https://10.0.0.5:443"))
+
+		var system ComputerSystem
+		Expect(request(router, http.MethodGet, "/redfish/v1/Systems/System.Embedded.1", &system)).To(Equal(http.StatusOK))
+		Expect(system.Oem.Dell.DellSystem.ChassisServiceTag).To(Equal("abcd"))
+		Expect(system.Links.ManagedBy).To(Equal([]OdataID{{OdataID: "/redfish/v1/Managers/iDRAC.Embedded.1"}}))
+
+		var errorResponse ErrorResponse
+		Expect(request(router, http.MethodGet, "/redfish/v1/Chassis/System.Embedded.2", &errorResponse)).To(Equal(http.StatusNotFound))
+		Expect(errorResponse.Error.MessageExtendedInfo).To(HaveLen(2))
+		Expect(errorResponse.Error.MessageExtendedInfo[0].MessageID).To(Equal("IDRAC.2.8.SYS403"))
+		Expect(errorResponse.Error.MessageExtendedInfo[1].MessageID).To(Equal("Base.1.12.ResourceMissingAtURI"))
+	})
+
+	It("should mimic Supermicro BMC", func() {
+		machine := &MachineMock{status: PowerStatusOn}
+		router := prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{profile: ProfileSupermicro}, users: users})
+
+		var collection ResourceCollection
+		Expect(request(router, http.MethodGet, "/redfish/v1/Systems", &collection)).To(Equal(http.StatusOK))
+		Expect(collection.Members).To(Equal([]OdataID{{OdataID: "/redfish/v1/Systems/1"}}))
+		Expect(request(router, http.MethodGet, "/redfish/v1/Systems/System.Embedded.1", nil)).To(Equal(http.StatusNotFound))
+
+		var system ComputerSystem
+		Expect(request(router, http.MethodGet, "/redfish/v1/Systems/1", &system)).To(Equal(http.StatusOK))
+		Expect(system.Oem.Supermicro).NotTo(BeNil())
+		Expect(system.Oem.Dell).To(BeNil())
+
+		var errorResponse ErrorResponse
+		Expect(request(router, http.MethodGet, "/redfish/v1/Chassis/2", &errorResponse)).To(Equal(http.StatusNotFound))
+		Expect(errorResponse.Error.MessageExtendedInfo).To(HaveLen(1))
+		Expect(errorResponse.Error.MessageExtendedInfo[0].MessageID).To(Equal("Base.1.4.ResourceMissingAtURI"))
+	})
+
+	It("should mimic iLO", func() {
+		machine := &MachineMock{status: PowerStatusOff}
+		router := prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{profile: ProfileHPE}, users: users})
+
+		var system ComputerSystem
+		Expect(request(router, http.MethodGet, "/redfish/v1/Systems/1", &system)).To(Equal(http.StatusOK))
+		Expect(system.Oem.Hpe.PostState).To(Equal("PowerOff"))
+
+		var errorResponse ErrorResponse
+		req := httptest.NewRequest(http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", bytes.NewBufferString(`{"ResetType": "ForceOff"}`))
+		req.SetBasicAuth("admin", "admin-password")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusConflict))
+		Expect(json.Unmarshal(w.Body.Bytes(), &errorResponse)).To(Succeed())
+		Expect(errorResponse.Error.Code).To(Equal("iLO.0.10.ExtendedInfo"))
+		Expect(errorResponse.Error.MessageExtendedInfo[0].MessageID).To(Equal("Base.1.4.NoOperation"))
+	})
+
+	It("should return the manufacturer ID of the profile in Get Device ID", func() {
+		i := &ipmi{session: newRMCPPlusSessionHolder(nil, &BMCMock{profile: ProfileDell})}
+		data, err := i.handleIPMIGetDeviceID()
+		Expect(err).NotTo(HaveOccurred())
+
+		var response ipmiGetDeviceIDResponse
+		Expect(binary.Read(bytes.NewReader(data), binary.LittleEndian, &response)).To(Succeed())
+		Expect(response.ManufacturerID).To(Equal([3]uint8{0xa2, 0x02, 0x00}))
+		Expect(response.ProductID).To(Equal(uint16(0x0100)))
+	})
+
+	It("should have the vendor profiles of all the supported profiles", func() {
+		for _, p := range types.BMCProfiles {
+			Expect(vendorProfiles).To(HaveKey(Profile(p)))
+		}
+	})
+})
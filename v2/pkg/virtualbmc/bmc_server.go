@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -19,6 +21,119 @@ type Machine interface {
 	PowerStatus() (PowerStatus, error)
 	PowerOn() error
 	PowerOff() error
+	// GracefulShutdown requests the guest OS to shut down.
+	// It returns without waiting for the shutdown to complete.
+	GracefulShutdown() error
+	// GracefulRestart requests the guest OS to shut down, and powers on the machine again after that.
+	// It returns without waiting for the restart to complete.
+	GracefulRestart() error
+	// Reset resets the machine without powering it off
+	Reset() error
+	// InjectNMI injects a non-maskable interrupt into the machine
+	InjectNMI() error
+	// VirtualMedia returns the virtual media devices of the machine
+	VirtualMedia() ([]VirtualMedia, error)
+	// InsertMedia starts downloading the image from the URL without waiting for it to finish.
+	// The image is inserted into the virtual media device when the download finishes.
+	InsertMedia(id, image string) error
+	// EjectMedia ejects the media from the virtual media device
+	EjectMedia(id string) error
+	// BootOverride returns the boot override
+	BootOverride() (BootOverride, error)
+	// SetBootOverride sets the boot override which is applied at the next power-on
+	SetBootOverride(BootOverride) error
+	// SerialConsole connects to the serial console of the machine
+	SerialConsole() (io.ReadWriteCloser, error)
+	// Inventory returns the hardware configuration of the machine
+	Inventory() (Inventory, error)
+}
+
+// BMC defines the interface to manipulate the BMC itself
+type BMC interface {
+	// Address returns the IP address of the BMC
+	Address() string
+	// Reset restarts the IPMI and Redfish servers of the BMC.
+	// It returns without waiting for the restart so that the response to the request can be sent.
+	Reset() error
+	// Profile returns the vendor personality of the BMC
+	Profile() Profile
+	// Sensors returns the sensors monitored by the BMC
+	Sensors() *SensorHolder
+	// SEL returns the System Event Log of the BMC
+	SEL() *SEL
+	// CipherSuiteZero returns true if IPMI cipher suite 0, which does not authenticate users, is enabled
+	CipherSuiteZero() bool
+}
+
+// BootDevice represents a boot device. The values are the same as BootSourceOverrideTarget of Redfish.
+// BiosSetup makes the firmware prompt for its boot menu, as QEMU cannot enter the setup directly.
+type BootDevice string
+
+const (
+	BootDeviceNone      = BootDevice("None")
+	BootDevicePxe       = BootDevice("Pxe")
+	BootDeviceHdd       = BootDevice("Hdd")
+	BootDeviceCd        = BootDevice("Cd")
+	BootDeviceBiosSetup = BootDevice("BiosSetup")
+)
+
+// BootOverride represents the boot device used instead of the normal boot order
+type BootOverride struct {
+	Device BootDevice
+	// Persistent is true if the override is applied to all future boots, or false if only to the next boot
+	Persistent bool
+	// UEFI is true if the boot is requested in UEFI mode, or false in legacy BIOS mode
+	UEFI bool
+}
+
+// VirtualMedia represents a virtual media device such as a CD drive
+type VirtualMedia struct {
+	ID string
+	// Image is the URI of the inserted image, or empty if no media is inserted
+	Image string
+}
+
+// Inventory represents the hardware configuration of a machine
+type Inventory struct {
+	// Manufacturer, Model and SerialNumber are the SMBIOS system information seen by the guest
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	// UUID is the SMBIOS system UUID in the canonical form
+	UUID string
+	// UEFI is true if the machine boots with UEFI firmware, or false with legacy BIOS
+	UEFI bool
+	// TPM is true if the machine has a TPM device
+	TPM        bool
+	Processors ProcessorInventory
+	// MemoryBytes is the current memory size
+	MemoryBytes int64
+	Drives      []DriveInventory
+	NICs        []NICInventory
+}
+
+// ProcessorInventory represents the CPU topology of a machine
+type ProcessorInventory struct {
+	Model          string
+	Sockets        int
+	CoresPerSocket int
+	ThreadsPerCore int
+	// Threads is the number of online logical processors
+	Threads int
+}
+
+// DriveInventory represents a disk of a machine
+type DriveInventory struct {
+	Name string
+	// CapacityBytes is the size of the disk, or zero if it is unknown
+	CapacityBytes int64
+}
+
+// NICInventory represents a network interface of a machine
+type NICInventory struct {
+	// Network is the name of the network the interface is connected to
+	Network    string
+	MACAddress string
 }
 
 type PowerStatus string
@@ -28,19 +143,19 @@ const (
 	PowerStatusPoweringOn  = PowerStatus("PoweringOn")
 	PowerStatusOff         = PowerStatus("Off")
 	PowerStatusPoweringOff = PowerStatus("PoweringOff")
+	PowerStatusPaused      = PowerStatus("Paused")
 	PowerStatusUnknown     = PowerStatus("Unknown")
 )
 
 // StartIPMIServer starts an ipmi server that handles RMCP requests
-func StartIPMIServer(ctx context.Context, conn net.PacketConn, machine Machine) error {
+func StartIPMIServer(ctx context.Context, conn net.PacketConn, machine Machine, bmc BMC, users *UserHolder) error {
 	go func() {
 		<-ctx.Done()
 		conn.Close()
 	}()
 
-	session := newRMCPPlusSessionHolder()
-	bmcUser := newBMCUserHolder()
-	bmcUser.addBMCUser("cybozu", "cybozu")
+	session := newRMCPPlusSessionHolder(conn, bmc)
+	defer session.close()
 
 	buf := make([]byte, 1024)
 	for {
@@ -50,13 +165,16 @@ func StartIPMIServer(ctx context.Context, conn net.PacketConn, machine Machine)
 		}
 
 		bytebuf := bytes.NewBuffer(buf)
-		res, err := handleRMCPRequest(bytebuf, machine, session, bmcUser)
+		res, err := handleRMCPRequest(bytebuf, addr, machine, session, users)
 		if err != nil {
 			log.Warn("failed to handle RMCP request", map[string]interface{}{
 				log.FnError: err,
 			})
 			continue
 		}
+		if res == nil {
+			continue
+		}
 		_, err = conn.WriteTo(res, addr)
 		if err != nil {
 			log.Warn("failed to write to UDP", map[string]interface{}{
@@ -68,10 +186,15 @@ func StartIPMIServer(ctx context.Context, conn net.PacketConn, machine Machine)
 }
 
 // StartRedfishServer starts a redfish server
-func StartRedfishServer(ctx context.Context, listener net.Listener, machine Machine) error {
+func StartRedfishServer(ctx context.Context, listener net.Listener, machine Machine, bmc BMC, users *UserHolder, events *EventDispatcher) error {
 	serv := &well.HTTPServer{
 		Server: &http.Server{
-			Handler: prepareRouter(machine),
+			Handler: prepareRouter(redfishOptions{
+				machine: machine,
+				bmc:     bmc,
+				users:   users,
+				events:  events,
+			}),
 		},
 	}
 
@@ -82,8 +205,9 @@ func StartRedfishServer(ctx context.Context, listener net.Listener, machine Mach
 
 	go func() {
 		<-ctx.Done()
-		listener.Close()
+		// close the server first so that Serve returns http.ErrServerClosed
 		serv.Close()
+		listener.Close()
 	}()
 
 	cert, err := tls.X509KeyPair(certPem, keyPem)
@@ -93,7 +217,11 @@ func StartRedfishServer(ctx context.Context, listener net.Listener, machine Mach
 
 	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
 	tlsListener := tls.NewListener(listener, cfg)
-	if err := serv.Server.Serve(tlsListener); err != nil {
+	err = serv.Server.Serve(tlsListener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	if err != nil {
 		log.Error("failed to serve TLS", map[string]interface{}{
 			log.FnError: err,
 		})
@@ -103,24 +231,66 @@ func StartRedfishServer(ctx context.Context, listener net.Listener, machine Mach
 	return nil
 }
 
-func prepareRouter(machine Machine) http.Handler {
+func prepareRouter(opts redfishOptions) http.Handler {
 	router := gin.Default()
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, nil)
 	})
-	router.GET("redfish/v1", handleServiceRoot)
-	router.GET("redfish/v1/", handleServiceRoot)
-
-	authorized := router.Group("/", gin.BasicAuth(gin.Accounts{
-		"cybozu": "cybozu",
-	}))
-	redfish := newRedfishServer(machine)
-	authorized.GET("redfish/v1/Chassis", handleChassisCollection)
+
+	redfish := newRedfishServer(opts)
+	redfish.router = router
+	router.GET("redfish/v1", redfish.handleServiceRoot)
+	router.GET("redfish/v1/", redfish.handleServiceRoot)
+	router.POST("redfish/v1/SessionService/Sessions", redfish.handleSessionCreate)
+	authorized := router.Group("/", redfish.authenticate, redfish.handleQueryOptions)
+	operator := requirePrivilege(PrivilegeOperator)
+	administrator := requirePrivilege(PrivilegeAdministrator)
+	authorized.GET("redfish/v1/Chassis", redfish.handleChassisCollection)
 	authorized.GET("redfish/v1/Chassis/:id", redfish.handleChassis)
-	authorized.POST("redfish/v1/Chassis/:id/Actions/Chassis.Reset", redfish.handleChassisActionsReset)
-	authorized.GET("redfish/v1/Systems", handleComputerSystemCollection)
+	authorized.POST("redfish/v1/Chassis/:id/Actions/Chassis.Reset", operator, redfish.handleChassisActionsReset)
+	authorized.GET("redfish/v1/Systems", redfish.handleComputerSystemCollection)
 	authorized.GET("redfish/v1/Systems/:id", redfish.handleComputerSystem)
-	authorized.POST("redfish/v1/Systems/:id/Actions/ComputerSystem.Reset", redfish.handleComputerSystemActionsReset)
+	authorized.PATCH("redfish/v1/Systems/:id", operator, redfish.handleComputerSystemPatch)
+	authorized.POST("redfish/v1/Systems/:id/Actions/ComputerSystem.Reset", operator, redfish.handleComputerSystemActionsReset)
+	authorized.GET("redfish/v1/Systems/:id/Processors", redfish.handleProcessorCollection)
+	authorized.GET("redfish/v1/Systems/:id/Processors/:processor", redfish.handleProcessor)
+	authorized.GET("redfish/v1/Systems/:id/Memory", redfish.handleMemoryCollection)
+	authorized.GET("redfish/v1/Systems/:id/Memory/:memory", redfish.handleMemory)
+	authorized.GET("redfish/v1/Systems/:id/Storage", redfish.handleStorageCollection)
+	authorized.GET("redfish/v1/Systems/:id/Storage/:storage", redfish.handleStorage)
+	authorized.GET("redfish/v1/Systems/:id/Storage/:storage/Drives/:drive", redfish.handleDrive)
+	authorized.GET("redfish/v1/Systems/:id/EthernetInterfaces", redfish.handleSystemEthernetInterfaceCollection)
+	authorized.GET("redfish/v1/Systems/:id/EthernetInterfaces/:nic", redfish.handleSystemEthernetInterface)
+	authorized.GET("redfish/v1/Systems/:id/Bios", redfish.handleBios)
+	authorized.GET("redfish/v1/Managers", redfish.handleManagerCollection)
+	authorized.GET("redfish/v1/Managers/:id", redfish.handleManager)
+	authorized.POST("redfish/v1/Managers/:id/Actions/Manager.Reset", administrator, redfish.handleManagerActionsReset)
+	authorized.GET("redfish/v1/Managers/:id/NetworkProtocol", redfish.handleManagerNetworkProtocol)
+	authorized.GET("redfish/v1/Managers/:id/EthernetInterfaces", redfish.handleEthernetInterfaceCollection)
+	authorized.GET("redfish/v1/Managers/:id/EthernetInterfaces/:nic", redfish.handleEthernetInterface)
+	authorized.GET("redfish/v1/Managers/:id/VirtualMedia", redfish.handleVirtualMediaCollection)
+	authorized.GET("redfish/v1/Managers/:id/VirtualMedia/:media", redfish.handleVirtualMedia)
+	authorized.POST("redfish/v1/Managers/:id/VirtualMedia/:media/Actions/VirtualMedia.InsertMedia", operator, redfish.handleVirtualMediaActionsInsertMedia)
+	authorized.POST("redfish/v1/Managers/:id/VirtualMedia/:media/Actions/VirtualMedia.EjectMedia", operator, redfish.handleVirtualMediaActionsEjectMedia)
+	authorized.GET("redfish/v1/AccountService", handleAccountService)
+	authorized.GET("redfish/v1/AccountService/Accounts", redfish.handleAccountCollection)
+	authorized.POST("redfish/v1/AccountService/Accounts", administrator, redfish.handleAccountCreate)
+	authorized.GET("redfish/v1/AccountService/Accounts/:id", redfish.handleAccount)
+	authorized.PATCH("redfish/v1/AccountService/Accounts/:id", redfish.handleAccountPatch)
+	authorized.DELETE("redfish/v1/AccountService/Accounts/:id", administrator, redfish.handleAccountDelete)
+	authorized.GET("redfish/v1/AccountService/Roles", handleRoleCollection)
+	authorized.GET("redfish/v1/AccountService/Roles/:id", redfish.handleRole)
+	authorized.GET("redfish/v1/EventService", redfish.handleEventService)
+	authorized.POST("redfish/v1/EventService/Actions/EventService.SubmitTestEvent", operator, redfish.handleEventServiceActionsSubmitTestEvent)
+	authorized.GET("redfish/v1/EventService/Subscriptions", redfish.handleEventSubscriptionCollection)
+	authorized.POST("redfish/v1/EventService/Subscriptions", operator, redfish.handleEventSubscriptionCreate)
+	authorized.GET("redfish/v1/EventService/Subscriptions/:id", redfish.handleEventSubscription)
+	authorized.DELETE("redfish/v1/EventService/Subscriptions/:id", operator, redfish.handleEventSubscriptionDelete)
+	authorized.GET("redfish/v1/SessionService", redfish.handleSessionService)
+	authorized.PATCH("redfish/v1/SessionService", administrator, redfish.handleSessionServicePatch)
+	authorized.GET("redfish/v1/SessionService/Sessions", redfish.handleSessionCollection)
+	authorized.GET("redfish/v1/SessionService/Sessions/:id", redfish.handleSession)
+	authorized.DELETE("redfish/v1/SessionService/Sessions/:id", redfish.handleSessionDelete)
 
 	return router
 }
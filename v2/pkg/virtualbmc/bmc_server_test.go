@@ -2,7 +2,9 @@ package virtualbmc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 
 	"github.com/cybozu-go/well"
@@ -19,9 +21,11 @@ var _ = Describe("Virtual BMC", func() {
 		conn, err := net.ListenUDP("udp", serverAddr)
 		Expect(err).NotTo(HaveOccurred())
 
+		users, err := NewUserHolder(DefaultUsers)
+		Expect(err).NotTo(HaveOccurred())
 		env := well.NewEnvironment(context.Background())
 		env.Go(func(ctx context.Context) error {
-			return StartIPMIServer(ctx, conn, &MachineMock{status: PowerStatusOff})
+			return StartIPMIServer(ctx, conn, &MachineMock{status: PowerStatusOff}, &BMCMock{address: "127.0.0.1"}, users)
 		})
 
 		Eventually(func() error {
@@ -115,9 +119,11 @@ var _ = Describe("Virtual BMC", func() {
 		listener, err := net.ListenTCP("tcp", addr)
 		Expect(err).NotTo(HaveOccurred())
 
+		users, err := NewUserHolder(DefaultUsers)
+		Expect(err).NotTo(HaveOccurred())
 		env := well.NewEnvironment(context.Background())
 		env.Go(func(ctx context.Context) error {
-			return StartRedfishServer(ctx, listener, &MachineMock{status: PowerStatusOff})
+			return StartRedfishServer(ctx, listener, &MachineMock{status: PowerStatusOff}, &BMCMock{address: "127.0.0.1"}, users, NewEventDispatcher(ProfileDefault))
 		})
 
 		By("Retrieving a ComputerSystem resource and manipulate it")
@@ -321,8 +327,55 @@ func getChassis(service *gofish.Service) (*schemas.Chassis, error) {
 	return chassisCollection[0], nil
 }
 
+type BMCMock struct {
+	address string
+	resets  int
+	profile Profile
+	sensors *SensorHolder
+	sel     *SEL
+	// cipherSuiteZero enables IPMI cipher suite 0
+	cipherSuiteZero bool
+}
+
+func (b *BMCMock) Address() string {
+	return b.address
+}
+
+func (b *BMCMock) Reset() error {
+	b.resets++
+	return nil
+}
+
+func (b *BMCMock) Profile() Profile {
+	return b.profile
+}
+
+func (b *BMCMock) Sensors() *SensorHolder {
+	if b.sensors == nil {
+		b.sensors = NewSensorHolder(b.SEL())
+	}
+	return b.sensors
+}
+
+func (b *BMCMock) CipherSuiteZero() bool {
+	return b.cipherSuiteZero
+}
+
+func (b *BMCMock) SEL() *SEL {
+	if b.sel == nil {
+		b.sel, _ = NewSEL("", nil)
+	}
+	return b.sel
+}
+
 type MachineMock struct {
-	status PowerStatus
+	status    PowerStatus
+	media     []VirtualMedia
+	boot      BootOverride
+	console   io.ReadWriteCloser
+	inventory Inventory
+	// restarts is the number of graceful restarts
+	restarts int
 }
 
 func (v *MachineMock) PowerStatus() (PowerStatus, error) {
@@ -338,3 +391,64 @@ func (v *MachineMock) PowerOff() error {
 	v.status = PowerStatusOff
 	return nil
 }
+
+func (v *MachineMock) GracefulShutdown() error {
+	v.status = PowerStatusOff
+	return nil
+}
+
+func (v *MachineMock) GracefulRestart() error {
+	v.restarts++
+	return nil
+}
+
+func (v *MachineMock) Reset() error {
+	return nil
+}
+
+func (v *MachineMock) InjectNMI() error {
+	return nil
+}
+
+func (v *MachineMock) VirtualMedia() ([]VirtualMedia, error) {
+	return v.media, nil
+}
+
+func (v *MachineMock) InsertMedia(id, image string) error {
+	for i := range v.media {
+		if v.media[i].ID == id {
+			v.media[i].Image = image
+			return nil
+		}
+	}
+	return fmt.Errorf("media %s not found", id)
+}
+
+func (v *MachineMock) EjectMedia(id string) error {
+	return v.InsertMedia(id, "")
+}
+
+func (v *MachineMock) BootOverride() (BootOverride, error) {
+	return v.boot, nil
+}
+
+func (v *MachineMock) SetBootOverride(o BootOverride) error {
+	v.boot = o
+	return nil
+}
+
+func (v *MachineMock) SerialConsole() (io.ReadWriteCloser, error) {
+	if v.console == nil {
+		return nil, errors.New("serial console is not available")
+	}
+	return v.console, nil
+}
+
+// Inventory returns the inventory with a fixed UUID if it is not set, as a real machine always has a system UUID
+func (v *MachineMock) Inventory() (Inventory, error) {
+	inv := v.inventory
+	if inv.UUID == "" {
+		inv.UUID = "7b30fe03-757f-5975-823d-0f31fd9a1dba"
+	}
+	return inv, nil
+}
@@ -1,33 +1,268 @@
 package virtualbmc
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync"
+
 	"github.com/cybozu-go/log"
 )
 
-type bmcUserHolder struct {
-	users map[string]*bmcUser
+// Privilege represents the privilege level of a BMC user. The values are the same as IPMI privilege levels.
+type Privilege uint8
+
+const (
+	PrivilegeCallback      = Privilege(0x01)
+	PrivilegeUser          = Privilege(0x02)
+	PrivilegeOperator      = Privilege(0x03)
+	PrivilegeAdministrator = Privilege(0x04)
+	PrivilegeNoAccess      = Privilege(0x0f)
+)
+
+// allows returns true if the privilege level is sufficient for the required level
+func (p Privilege) allows(required Privilege) bool {
+	return p != PrivilegeNoAccess && p >= required
+}
+
+const (
+	// maxBMCUsers is the number of user IDs including the null user
+	maxBMCUsers = 16
+	// nullUserID is the ID of the null user, whose name cannot be changed
+	nullUserID = 1
+
+	maxUserNameLength = 16
+	maxPasswordLength = 20
+)
+
+// User represents a BMC user account
+type User struct {
+	Name      string
+	Password  string
+	Privilege Privilege
+}
+
+// DefaultUsers is used if no users are configured
+var DefaultUsers = []User{
+	{Name: "cybozu", Password: "cybozu", Privilege: PrivilegeAdministrator},
+}
+
+// UserHolder holds the BMC users shared by the IPMI and Redfish servers
+type UserHolder struct {
+	mu sync.Mutex
+	// users is indexed by user ID - 1
+	users [maxBMCUsers]bmcUser
 }
 
 type bmcUser struct {
-	Username string
-	Password string
+	ID        uint8
+	Username  string
+	Password  string
+	Privilege Privilege
+	Enabled   bool
+}
+
+// NewUserHolder creates a UserHolder. The users are assigned user IDs from 2 in order.
+func NewUserHolder(users []User) (*UserHolder, error) {
+	b := newBMCUserHolder()
+	for _, u := range users {
+		if _, err := b.createUser(u, true); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
 }
 
-func newBMCUserHolder() *bmcUserHolder {
-	return &bmcUserHolder{users: make(map[string]*bmcUser)}
+func newBMCUserHolder() *UserHolder {
+	b := &UserHolder{}
+	for i := range b.users {
+		b.users[i] = bmcUser{ID: uint8(i + 1), Privilege: PrivilegeNoAccess}
+	}
+	return b
+}
+
+// getBMCUser returns the enabled user with the name
+func (b *UserHolder) getBMCUser(name string) (bmcUser, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if name == "" {
+		return bmcUser{}, false
+	}
+	for _, u := range b.users {
+		if u.Username == name && u.Enabled {
+			return u, true
+		}
+	}
+	return bmcUser{}, false
+}
+
+// authenticate returns the user if the name and password match an enabled user
+func (b *UserHolder) authenticate(name, password string) (bmcUser, bool) {
+	u, ok := b.getBMCUser(name)
+	if !ok {
+		return bmcUser{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) != 1 {
+		return bmcUser{}, false
+	}
+	return u, true
+}
+
+func (b *UserHolder) user(id uint8) (bmcUser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id < 1 || id > maxBMCUsers {
+		return bmcUser{}, fmt.Errorf("invalid user ID: %d", id)
+	}
+	return b.users[id-1], nil
 }
 
-func (b *bmcUserHolder) addBMCUser(name string, password string) {
-	newUser := &bmcUser{
-		Username: name,
-		Password: password,
+// list returns the users whose names are set
+func (b *UserHolder) list() []bmcUser {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var users []bmcUser
+	for _, u := range b.users {
+		if u.Username != "" {
+			users = append(users, u)
+		}
 	}
-	b.users[name] = newUser
-	log.Info("BMC USer: Add user", map[string]interface{}{"user": name})
+	return users
 }
 
-func (b *bmcUserHolder) getBMCUser(name string) (*bmcUser, bool) {
-	obj, ok := b.users[name]
+// countEnabled returns the number of the enabled users
+func (b *UserHolder) countEnabled() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	return obj, ok
+	n := 0
+	for _, u := range b.users {
+		if u.Enabled {
+			n++
+		}
+	}
+	return n
+}
+
+// update calls f with the user of the ID while holding the lock
+func (b *UserHolder) update(id uint8, f func(u *bmcUser) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id <= nullUserID || id > maxBMCUsers {
+		return fmt.Errorf("invalid user ID: %d", id)
+	}
+	u := b.users[id-1]
+	if err := f(&u); err != nil {
+		return err
+	}
+	b.users[id-1] = u
+	return nil
+}
+
+// setUserName changes the name of the user. An empty name deletes the user.
+func (b *UserHolder) setUserName(id uint8, name string) error {
+	if len(name) > maxUserNameLength {
+		return fmt.Errorf("user name is too long: %s", name)
+	}
+	return b.update(id, func(u *bmcUser) error {
+		for _, other := range b.users {
+			if name != "" && other.ID != id && other.Username == name {
+				return fmt.Errorf("user already exists: %s", name)
+			}
+		}
+		if name == "" {
+			*u = bmcUser{ID: id, Privilege: PrivilegeNoAccess}
+			return nil
+		}
+		u.Username = name
+		return nil
+	})
+}
+
+func (b *UserHolder) setUserPassword(id uint8, password string) error {
+	if len(password) > maxPasswordLength {
+		return errors.New("password is too long")
+	}
+	return b.update(id, func(u *bmcUser) error {
+		u.Password = password
+		return nil
+	})
+}
+
+func (b *UserHolder) setUserPrivilege(id uint8, privilege Privilege) error {
+	if err := validatePrivilege(privilege); err != nil {
+		return err
+	}
+	return b.update(id, func(u *bmcUser) error {
+		u.Privilege = privilege
+		return nil
+	})
+}
+
+func (b *UserHolder) setUserEnabled(id uint8, enabled bool) error {
+	return b.update(id, func(u *bmcUser) error {
+		if enabled && u.Username == "" {
+			return fmt.Errorf("user %d has no name", id)
+		}
+		u.Enabled = enabled
+		return nil
+	})
+}
+
+// testUserPassword returns true if the password of the user matches
+func (b *UserHolder) testUserPassword(id uint8, password string) (bool, error) {
+	u, err := b.user(id)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1, nil
+}
+
+// createUser adds a user to a free user ID, and returns the ID
+func (b *UserHolder) createUser(user User, enabled bool) (uint8, error) {
+	if user.Name == "" || len(user.Name) > maxUserNameLength {
+		return 0, fmt.Errorf("invalid user name: %s", user.Name)
+	}
+	if len(user.Password) > maxPasswordLength {
+		return 0, errors.New("password is too long")
+	}
+	if err := validatePrivilege(user.Privilege); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, u := range b.users {
+		if u.Username == user.Name {
+			return 0, fmt.Errorf("user already exists: %s", user.Name)
+		}
+	}
+	for i := nullUserID; i < maxBMCUsers; i++ {
+		if b.users[i].Username != "" {
+			continue
+		}
+		b.users[i] = bmcUser{
+			ID:        uint8(i + 1),
+			Username:  user.Name,
+			Password:  user.Password,
+			Privilege: user.Privilege,
+			Enabled:   enabled,
+		}
+		log.Info("BMC USer: Add user", map[string]interface{}{"user": user.Name})
+		return uint8(i + 1), nil
+	}
+	return 0, errors.New("no free user ID")
+}
+
+func validatePrivilege(privilege Privilege) error {
+	switch privilege {
+	case PrivilegeCallback, PrivilegeUser, PrivilegeOperator, PrivilegeAdministrator, PrivilegeNoAccess:
+		return nil
+	}
+	return fmt.Errorf("invalid privilege level: %d", privilege)
 }
@@ -0,0 +1,170 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BMC users", func() {
+	var (
+		machine *MachineMock
+		users   *UserHolder
+	)
+
+	BeforeEach(func() {
+		machine = &MachineMock{status: PowerStatusOn}
+		var err error
+		users, err = NewUserHolder([]User{
+			{Name: "admin", Password: "admin-password", Privilege: PrivilegeAdministrator},
+			{Name: "viewer", Password: "viewer-password", Privilege: PrivilegeUser},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	newClient := func(user, password string, privilege Privilege) *rmcpPlusClient {
+		client := newRMCPPlusClient(machine)
+		client.users = users
+		client.user = user
+		client.password = password
+		client.role = 0x10 | uint8(privilege)
+		return client
+	}
+	suite := supportedCipherSuites[len(supportedCipherSuites)-1]
+
+	It("should authorize IPMI commands by the privilege level", func() {
+		By("rejecting a role higher than the privilege of the user")
+		client := newClient("viewer", "viewer-password", PrivilegeAdministrator)
+		Expect(client.authenticate(suite)).To(Equal(rmcpPlusStatusUnauthorizedRole))
+		client = newClient("nobody", "viewer-password", PrivilegeUser)
+		Expect(client.authenticate(suite)).To(Equal(rmcpPlusStatusUnauthorizedName))
+
+		By("allowing only the commands of the privilege level")
+		client = newClient("viewer", "viewer-password", PrivilegeUser)
+		client.activate(suite)
+		Expect(client.getChassisStatus()[0] & chassisPowerStateBitmaskPowerOn).NotTo(BeZero())
+		code, _ := client.command(ipmiNetFNChassis, ipmiCmdChassisControl, chassisControlPowerDown)
+		Expect(code).To(Equal(completionCodeInsufficientPrivilege))
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetSessionPrivilege, uint8(PrivilegeOperator))
+		Expect(code).To(Equal(completionCodePrivilegeLevelNotAllowed))
+
+		By("lowering the privilege level of the session")
+		client = newClient("admin", "admin-password", PrivilegeAdministrator)
+		client.activate(suite)
+		code, data := client.command(ipmiNetFNApp, ipmiCmdSetSessionPrivilege, uint8(PrivilegeUser))
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{uint8(PrivilegeUser)}))
+		code, _ = client.command(ipmiNetFNChassis, ipmiCmdChassisControl, chassisControlPowerDown)
+		Expect(code).To(Equal(completionCodeInsufficientPrivilege))
+	})
+
+	It("should manage users via IPMI", func() {
+		client := newClient("admin", "admin-password", PrivilegeAdministrator)
+		client.activate(suite)
+
+		By("listing users")
+		code, data := client.command(ipmiNetFNApp, ipmiCmdGetUserName, 2)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal(append([]byte("admin"), make([]byte, 11)...)))
+		code, data = client.command(ipmiNetFNApp, ipmiCmdGetUserAccess, ipmiChannelLAN, 3)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{maxBMCUsers, userIDStatusEnabled | 2, 1, userAccessIPMIMessaging | uint8(PrivilegeUser)}))
+
+		By("adding an operator")
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserName, append([]byte{4}, append([]byte("operator"), make([]byte, 8)...)...)...)
+		Expect(code).To(Equal(completionCodeOK))
+		password := append([]byte("operator-password"), make([]byte, 3)...)
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserPassword, append([]byte{passwordSize20 | 4, passwordOperationSet}, password...)...)
+		Expect(code).To(Equal(completionCodeOK))
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserAccess, 0x90|ipmiChannelLAN, 4, uint8(PrivilegeOperator))
+		Expect(code).To(Equal(completionCodeOK))
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserPassword, 4, passwordOperationEnable)
+		Expect(code).To(Equal(completionCodeOK))
+
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserPassword, append([]byte{passwordSize20 | 4, passwordOperationTest}, password...)...)
+		Expect(code).To(Equal(completionCodeOK))
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserPassword, append([]byte{passwordSize20 | 4, passwordOperationTest}, make([]byte, 20)...)...)
+		Expect(code).To(Equal(completionCodePasswordTestFailed))
+
+		operator := newClient("operator", "operator-password", PrivilegeOperator)
+		operator.activate(suite)
+		code, _ = operator.command(ipmiNetFNChassis, ipmiCmdChassisControl, chassisControlPowerDown)
+		Expect(code).To(Equal(completionCodeOK))
+		code, _ = operator.command(ipmiNetFNApp, ipmiCmdSetUserPassword, 2, passwordOperationDisable)
+		Expect(code).To(Equal(completionCodeInsufficientPrivilege))
+
+		By("disabling the operator")
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserPassword, 4, passwordOperationDisable)
+		Expect(code).To(Equal(completionCodeOK))
+		operator = newClient("operator", "operator-password", PrivilegeOperator)
+		Expect(operator.authenticate(suite)).To(Equal(rmcpPlusStatusUnauthorizedName))
+
+		By("rejecting invalid requests")
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserName, append([]byte{1}, append([]byte("null"), make([]byte, 12)...)...)...)
+		Expect(code).To(Equal(completionCodeInvalidDataField))
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdSetUserName, append([]byte{5}, append([]byte("viewer"), make([]byte, 10)...)...)...)
+		Expect(code).To(Equal(completionCodeInvalidDataField))
+	})
+
+	It("should manage accounts via Redfish", func() {
+		router := prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{}, users: users})
+		request := func(method, path, user, password, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.SetBasicAuth(user, password)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		By("listing accounts")
+		w := request(http.MethodGet, "/redfish/v1/AccountService/Accounts", "viewer", "viewer-password", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var collection ResourceCollection
+		Expect(json.Unmarshal(w.Body.Bytes(), &collection)).To(Succeed())
+		Expect(collection.Members).To(Equal([]OdataID{
+			{OdataID: "/redfish/v1/AccountService/Accounts/2"},
+			{OdataID: "/redfish/v1/AccountService/Accounts/3"},
+		}))
+		w = request(http.MethodGet, "/redfish/v1/AccountService/Accounts/3", "viewer", "viewer-password", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var account ManagerAccount
+		Expect(json.Unmarshal(w.Body.Bytes(), &account)).To(Succeed())
+		Expect(account.UserName).To(Equal("viewer"))
+		Expect(account.RoleID).To(Equal(RoleIDReadOnly))
+		Expect(account.Password).To(BeNil())
+
+		By("authorizing requests by the role")
+		Expect(request(http.MethodGet, "/redfish/v1/Systems/System.Embedded.1", "viewer", "wrong", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodPost, "/redfish/v1/Systems/System.Embedded.1/Actions/ComputerSystem.Reset", "viewer", "viewer-password", `{"ResetType": "ForceOff"}`).Code).To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodPost, "/redfish/v1/AccountService/Accounts", "viewer", "viewer-password", `{"UserName": "foo", "Password": "bar", "RoleId": "Administrator"}`).Code).To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodPatch, "/redfish/v1/AccountService/Accounts/3", "viewer", "viewer-password", `{"RoleId": "Administrator"}`).Code).To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodPatch, "/redfish/v1/AccountService/Accounts/2", "viewer", "viewer-password", `{"Password": "foo"}`).Code).To(Equal(http.StatusForbidden))
+
+		By("changing the password of the user itself")
+		Expect(request(http.MethodPatch, "/redfish/v1/AccountService/Accounts/3", "viewer", "viewer-password", `{"Password": "new-password"}`).Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodGet, "/redfish/v1/Systems", "viewer", "viewer-password", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodGet, "/redfish/v1/Systems", "viewer", "new-password", "").Code).To(Equal(http.StatusOK))
+
+		By("creating an operator")
+		w = request(http.MethodPost, "/redfish/v1/AccountService/Accounts", "admin", "admin-password", `{"UserName": "operator", "Password": "operator-password", "RoleId": "Operator"}`)
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		Expect(w.Header().Get("Location")).To(Equal("/redfish/v1/AccountService/Accounts/4"))
+		Expect(request(http.MethodPost, "/redfish/v1/Systems/System.Embedded.1/Actions/ComputerSystem.Reset", "operator", "operator-password", `{"ResetType": "ForceOff"}`).Code).To(Equal(http.StatusNoContent))
+		Expect(request(http.MethodPost, "/redfish/v1/AccountService/Accounts", "admin", "admin-password", `{"UserName": "operator", "Password": "foo", "RoleId": "Operator"}`).Code).To(Equal(http.StatusBadRequest))
+
+		// the account is also available via IPMI
+		client := newClient("operator", "operator-password", PrivilegeOperator)
+		client.activate(suite)
+
+		By("disabling and deleting the operator")
+		Expect(request(http.MethodPatch, "/redfish/v1/AccountService/Accounts/4", "admin", "admin-password", `{"Enabled": false}`).Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodGet, "/redfish/v1/Systems", "operator", "operator-password", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodDelete, "/redfish/v1/AccountService/Accounts/4", "admin", "admin-password", "").Code).To(Equal(http.StatusNoContent))
+		Expect(request(http.MethodGet, "/redfish/v1/AccountService/Accounts/4", "admin", "admin-password", "").Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,102 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Boot override", func() {
+	var (
+		machine *MachineMock
+		router  http.Handler
+	)
+
+	BeforeEach(func() {
+		machine = &MachineMock{
+			status: PowerStatusOn,
+			boot:   BootOverride{Device: BootDeviceNone},
+		}
+		users, err := NewUserHolder(DefaultUsers)
+		Expect(err).NotTo(HaveOccurred())
+		router = prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{}, users: users})
+	})
+
+	patch := func(body string) (int, ComputerSystem) {
+		req := httptest.NewRequest(http.MethodPatch, "/redfish/v1/Systems/System.Embedded.1", strings.NewReader(body))
+		req.SetBasicAuth("cybozu", "cybozu")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var res ComputerSystem
+		if w.Code == http.StatusOK {
+			Expect(json.Unmarshal(w.Body.Bytes(), &res)).To(Succeed())
+		}
+		return w.Code, res
+	}
+
+	It("should set boot override via Redfish", func() {
+		code, res := patch(`{"Boot": {"BootSourceOverrideTarget": "Pxe", "BootSourceOverrideEnabled": "Once"}}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(machine.boot).To(Equal(BootOverride{Device: BootDevicePxe}))
+		Expect(res.Boot.BootSourceOverrideTarget).To(Equal("Pxe"))
+		Expect(res.Boot.BootSourceOverrideEnabled).To(Equal("Once"))
+		Expect(res.Boot.BootSourceOverrideMode).To(Equal("Legacy"))
+
+		code, res = patch(`{"Boot": {"BootSourceOverrideTarget": "Cd", "BootSourceOverrideEnabled": "Continuous", "BootSourceOverrideMode": "UEFI"}}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(machine.boot).To(Equal(BootOverride{Device: BootDeviceCd, Persistent: true, UEFI: true}))
+		Expect(res.Boot.BootSourceOverrideEnabled).To(Equal("Continuous"))
+		Expect(res.Boot.BootSourceOverrideMode).To(Equal("UEFI"))
+
+		code, res = patch(`{"Boot": {"BootSourceOverrideEnabled": "Disabled"}}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(machine.boot.Device).To(Equal(BootDeviceNone))
+		Expect(res.Boot.BootSourceOverrideTarget).To(Equal("None"))
+		Expect(res.Boot.BootSourceOverrideEnabled).To(Equal("Disabled"))
+	})
+
+	It("should reject unsupported boot override", func() {
+		for _, body := range []string{
+			`{"Boot": {"BootSourceOverrideTarget": "Floppy"}}`,
+			`{"Boot": {"BootSourceOverrideEnabled": "Always"}}`,
+			`{"Boot": {"BootSourceOverrideMode": "Legacy+UEFI"}}`,
+		} {
+			code, _ := patch(body)
+			Expect(code).To(Equal(http.StatusBadRequest), body)
+		}
+		Expect(machine.boot).To(Equal(BootOverride{Device: BootDeviceNone}))
+	})
+
+	It("should decode and encode IPMI boot flags", func() {
+		testCases := []struct {
+			flags  uint8
+			device uint8
+			o      BootOverride
+		}{
+			{flags: 0x80, device: 0x04, o: BootOverride{Device: BootDevicePxe}},
+			{flags: 0xc0, device: 0x08, o: BootOverride{Device: BootDeviceHdd, Persistent: true}},
+			{flags: 0xa0, device: 0x14, o: BootOverride{Device: BootDeviceCd, UEFI: true}},
+			{flags: 0x80, device: 0x18, o: BootOverride{Device: BootDeviceBiosSetup}},
+		}
+		for _, tc := range testCases {
+			o, err := decodeBootFlags(tc.flags, tc.device)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(o).To(Equal(tc.o))
+			flags, device := encodeBootFlags(o)
+			Expect(flags).To(Equal(tc.flags))
+			Expect(device).To(Equal(tc.device))
+		}
+
+		o, err := decodeBootFlags(0x00, 0x04)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(o.Device).To(Equal(BootDeviceNone))
+
+		_, err = decodeBootFlags(0x80, 0x3c)
+		Expect(err).To(HaveOccurred())
+	})
+})
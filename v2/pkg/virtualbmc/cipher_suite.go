@@ -0,0 +1,180 @@
+package virtualbmc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+)
+
+type authenticationAlgorithm uint8
+
+// 0x00: RAKP-none, 0x01: RKAP-HMAC-SHA1, 0x02: RKAP-HMAC-MD5, 0x03: RKAP-HMAC-SHA256
+// We don't support RAKP-HMAC-MD5
+const (
+	authenticationAlgorithmRAKPNone       authenticationAlgorithm = 0x00
+	authenticationAlgorithmRKAPHMACSHA1   authenticationAlgorithm = 0x01
+	authenticationAlgorithmRAKPHMACSHA256 authenticationAlgorithm = 0x03
+)
+
+type integrityAlgorithm uint8
+
+// 0x00: none, 0x01: HMAC-SHA1-96, 0x02: HMAC-MD5-128, 0x03: MD5-128, 0x04: HMAC-SHA256-128
+// We don't support MD5 based algorithms
+const (
+	integrityAlgorithmNone          integrityAlgorithm = 0x00
+	integrityAlgorithmHMACSHA1196   integrityAlgorithm = 0x01
+	integrityAlgorithmHMACSHA256128 integrityAlgorithm = 0x04
+)
+
+type confidentialityAlgorithm uint8
+
+// 0x00: none, 0x01: AES-CBC-128, 0x02: XRC-4128, 0x03: XRC-440
+// We don't support XRC4 based algorithms
+const (
+	confidentialityAlgorithmNone      confidentialityAlgorithm = 0x00
+	confidentialityAlgorithmAESCBC128 confidentialityAlgorithm = 0x01
+)
+
+// cipherSuite represents a set of the algorithms used in an RMCP+ session
+type cipherSuite struct {
+	id              uint8
+	authentication  authenticationAlgorithm
+	integrity       integrityAlgorithm
+	confidentiality confidentialityAlgorithm
+}
+
+// supportedCipherSuites lists the cipher suites in ascending order of strength.
+// The first one is cipher suite 0, which does not authenticate users.
+var supportedCipherSuites = []cipherSuite{
+	{0, authenticationAlgorithmRAKPNone, integrityAlgorithmNone, confidentialityAlgorithmNone},
+	{1, authenticationAlgorithmRKAPHMACSHA1, integrityAlgorithmNone, confidentialityAlgorithmNone},
+	{2, authenticationAlgorithmRKAPHMACSHA1, integrityAlgorithmHMACSHA1196, confidentialityAlgorithmNone},
+	{3, authenticationAlgorithmRKAPHMACSHA1, integrityAlgorithmHMACSHA1196, confidentialityAlgorithmAESCBC128},
+	{15, authenticationAlgorithmRAKPHMACSHA256, integrityAlgorithmNone, confidentialityAlgorithmNone},
+	{16, authenticationAlgorithmRAKPHMACSHA256, integrityAlgorithmHMACSHA256128, confidentialityAlgorithmNone},
+	{17, authenticationAlgorithmRAKPHMACSHA256, integrityAlgorithmHMACSHA256128, confidentialityAlgorithmAESCBC128},
+}
+
+// algorithmRequest represents an algorithm requested in Open Session Request.
+// any is true if the remote console lets the BMC choose the algorithm.
+type algorithmRequest struct {
+	algorithm uint8
+	any       bool
+}
+
+func (a algorithmRequest) matches(algorithm uint8) bool {
+	return a.any || a.algorithm == algorithm
+}
+
+// availableCipherSuites returns the cipher suites the BMC accepts.
+// Cipher suite 0 lets anyone log in as any user without the password, so it is only available if enabled.
+func availableCipherSuites(cipherSuiteZero bool) []cipherSuite {
+	if cipherSuiteZero {
+		return supportedCipherSuites
+	}
+	return supportedCipherSuites[1:]
+}
+
+// negotiateCipherSuite chooses the strongest cipher suite in suites that matches the requested algorithms
+func negotiateCipherSuite(suites []cipherSuite, authentication, integrity, confidentiality algorithmRequest) (cipherSuite, rmcpStatus) {
+	status := rmcpPlusStatusNoCipherSuiteMatch
+	switch {
+	case !authentication.any && !isSupportedAuthenticationAlgorithm(suites, authenticationAlgorithm(authentication.algorithm)):
+		status = rmcpPlusStatusInvalidAuthenticationAlgorithm
+	case !integrity.any && !isSupportedIntegrityAlgorithm(suites, integrityAlgorithm(integrity.algorithm)):
+		status = rmcpPlusStatusInvalidIntegrityAlgorithm
+	case !confidentiality.any && !isSupportedConfidentialityAlgorithm(suites, confidentialityAlgorithm(confidentiality.algorithm)):
+		status = rmcpPlusStatusInvalidConfidentialityAlgorithm
+	}
+
+	for i := len(suites) - 1; i >= 0; i-- {
+		suite := suites[i]
+		if authentication.matches(uint8(suite.authentication)) &&
+			integrity.matches(uint8(suite.integrity)) &&
+			confidentiality.matches(uint8(suite.confidentiality)) {
+			return suite, rmcpPlusStatusNoErrors
+		}
+	}
+	return cipherSuite{}, status
+}
+
+func isSupportedAuthenticationAlgorithm(suites []cipherSuite, a authenticationAlgorithm) bool {
+	for _, suite := range suites {
+		if suite.authentication == a {
+			return true
+		}
+	}
+	return false
+}
+
+func isSupportedIntegrityAlgorithm(suites []cipherSuite, a integrityAlgorithm) bool {
+	for _, suite := range suites {
+		if suite.integrity == a {
+			return true
+		}
+	}
+	return false
+}
+
+func isSupportedConfidentialityAlgorithm(suites []cipherSuite, a confidentialityAlgorithm) bool {
+	for _, suite := range suites {
+		if suite.confidentiality == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (a authenticationAlgorithm) hash() func() hash.Hash {
+	switch a {
+	case authenticationAlgorithmRKAPHMACSHA1:
+		return sha1.New
+	case authenticationAlgorithmRAKPHMACSHA256:
+		return sha256.New
+	}
+	return nil
+}
+
+// authCode calculates the key exchange authentication code for RAKP messages and the session integrity key.
+// It returns nil for RAKP-none.
+func (c cipherSuite) authCode(key, data []byte) []byte {
+	h := c.authentication.hash()
+	if h == nil {
+		return nil
+	}
+	mac := hmac.New(h, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// integrityCheckValue calculates the integrity check value of RAKP Message 4
+func (c cipherSuite) integrityCheckValue(sessionIntegrityKey, data []byte) []byte {
+	code := c.authCode(sessionIntegrityKey, data)
+	switch c.authentication {
+	case authenticationAlgorithmRKAPHMACSHA1:
+		// HMAC-SHA1-96
+		return code[:12]
+	case authenticationAlgorithmRAKPHMACSHA256:
+		// HMAC-SHA256-128
+		return code[:16]
+	}
+	return nil
+}
+
+// integrityData calculates the AuthCode of the session trailer. It returns nil if the integrity algorithm is none.
+func (c cipherSuite) integrityData(integrityKey, data []byte) []byte {
+	var h func() hash.Hash
+	var size int
+	switch c.integrity {
+	case integrityAlgorithmHMACSHA1196:
+		h, size = sha1.New, 12
+	case integrityAlgorithmHMACSHA256128:
+		h, size = sha256.New, 16
+	default:
+		return nil
+	}
+	mac := hmac.New(h, integrityKey)
+	mac.Write(data)
+	return mac.Sum(nil)[:size]
+}
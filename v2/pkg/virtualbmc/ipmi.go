@@ -3,6 +3,7 @@ package virtualbmc
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
@@ -30,13 +31,41 @@ type completionCode uint8
 
 const (
 	completionCodeOK                     = completionCode(0x00)
+	completionCodeInvalidDataField       = completionCode(0xcc)
+	completionCodeInsufficientPrivilege  = completionCode(0xd4)
 	completionCodeCouldNotExecuteCommand = completionCode(0xd5)
 )
 
+// ipmiError is an error reported with a specific completion code
+type ipmiError struct {
+	code completionCode
+	err  error
+}
+
+func (e *ipmiError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ipmiError) Unwrap() error {
+	return e.err
+}
+
+// errorCompletionCode returns the completion code for the error returned by a command handler
+func errorCompletionCode(err error) completionCode {
+	var ipmiErr *ipmiError
+	if errors.As(err, &ipmiErr) {
+		return ipmiErr.code
+	}
+	return completionCodeCouldNotExecuteCommand
+}
+
 type ipmi struct {
 	message *ipmiMessage
 	machine Machine
 	session *rmcpPlusSessionHolder
+	users   *UserHolder
+	// current is the RMCP+ session of the request, or nil if the request is outside of a session
+	current *rmcpPlusSession
 }
 
 // Length from TargetAddress to Command
@@ -54,7 +83,7 @@ type ipmiMessage struct {
 	DataChecksum   uint8
 }
 
-func newIPMI(buf io.Reader, ipmiMessageLen int, machine Machine, session *rmcpPlusSessionHolder) (*ipmi, error) {
+func newIPMI(buf io.Reader, ipmiMessageLen int, machine Machine, session *rmcpPlusSessionHolder, users *UserHolder, current *rmcpPlusSession) (*ipmi, error) {
 	message, err := deserializeIPMIMessage(buf, ipmiMessageLen)
 	if err != nil {
 		return nil, fmt.Errorf("failed to desetialize ipmi message : %w", err)
@@ -64,6 +93,8 @@ func newIPMI(buf io.Reader, ipmiMessageLen int, machine Machine, session *rmcpPl
 		message: message,
 		machine: machine,
 		session: session,
+		users:   users,
+		current: current,
 	}, nil
 }
 
@@ -105,13 +136,22 @@ func deserializeIPMIMessage(buf io.Reader, ipmiMessageLen int) (*ipmiMessage, er
 func (i *ipmi) handle() ([]byte, error) {
 	netFunction := (i.message.TargetLun & 0xFC) >> 2
 
+	if i.current != nil && !i.current.Privilege.allows(requiredPrivilege(netFunction, i.message.Command)) {
+		log.Warn("insufficient privilege", map[string]interface{}{
+			"user":        string(i.current.UserName),
+			"netfunction": netFunction,
+			"command":     i.message.Command,
+		})
+		return appendIPMIMessageHeader(i.message, nil, netFunction|ipmiNetFNResponse, completionCodeInsufficientPrivilege)
+	}
+
 	switch netFunction {
 	case ipmiNetFNApp:
 		log.Info("    ipmi: NetFunction = APP", map[string]interface{}{})
 		code := completionCodeOK
 		res, err := i.handleIPMIApp(i.message)
 		if err != nil {
-			code = completionCodeCouldNotExecuteCommand
+			code = errorCompletionCode(err)
 		}
 		return appendIPMIMessageHeader(i.message, res, ipmiNetFNApp|ipmiNetFNResponse, code)
 	case ipmiNetFNChassis:
@@ -119,17 +159,29 @@ func (i *ipmi) handle() ([]byte, error) {
 		code := completionCodeOK
 		res, err := i.handleIPMIChassis(i.message)
 		if err != nil {
-			code = completionCodeCouldNotExecuteCommand
+			code = errorCompletionCode(err)
 		}
 		return appendIPMIMessageHeader(i.message, res, ipmiNetFNChassis|ipmiNetFNResponse, code)
 	case ipmiNetFNBridge:
 		log.Info("    ipmi: NetFunction = BRIDGE", map[string]interface{}{})
 	case ipmiNetFNSensorEvent:
 		log.Info("    ipmi: NetFunction = SENSOR / EVENT", map[string]interface{}{})
+		code := completionCodeOK
+		res, err := i.handleIPMISensorEvent(i.message)
+		if err != nil {
+			code = errorCompletionCode(err)
+		}
+		return appendIPMIMessageHeader(i.message, res, ipmiNetFNSensorEvent|ipmiNetFNResponse, code)
 	case ipmiNetFNFirmware:
 		log.Info("    ipmi: NetFunction = FIRMWARE", map[string]interface{}{})
 	case ipmiNetFNStorage:
 		log.Info("    ipmi: NetFunction = STORAGE", map[string]interface{}{})
+		code := completionCodeOK
+		res, err := i.handleIPMIStorage(i.message)
+		if err != nil {
+			code = errorCompletionCode(err)
+		}
+		return appendIPMIMessageHeader(i.message, res, ipmiNetFNStorage|ipmiNetFNResponse, code)
 	case ipmiNetFNTransport:
 		log.Info("    ipmi: NetFunction = TRANSPORT", map[string]interface{}{})
 	case ipmiNetFNGroupExtension:
@@ -143,6 +195,58 @@ func (i *ipmi) handle() ([]byte, error) {
 	return nil, fmt.Errorf("unsupported NetFunction: %x", netFunction)
 }
 
+// isSessionless returns true if the command is allowed outside of a session
+func (i *ipmi) isSessionless() bool {
+	netFunction := (i.message.TargetLun & 0xFC) >> 2
+	if netFunction != ipmiNetFNApp {
+		return false
+	}
+	switch i.message.Command {
+	case ipmiCmdGetChannelAuthCapabilities, ipmiCmdGetChannelCipherSuites:
+		return true
+	}
+	return false
+}
+
+// requiredPrivilege returns the privilege level required to execute the command in a session
+func requiredPrivilege(netFunction, command uint8) Privilege {
+	switch netFunction {
+	case ipmiNetFNApp:
+		switch command {
+		case ipmiCmdGetChannelAuthCapabilities, ipmiCmdGetChannelCipherSuites, ipmiCmdSetSessionPrivilege, ipmiCmdCloseSession:
+			return PrivilegeCallback
+		case ipmiCmdGetDeviceID, ipmiCmdGetDeviceGUID, ipmiCmdGetSystemGUID, ipmiCmdActivatePayload, ipmiCmdDeactivatePayload, ipmiCmdGetPayloadActivationStatus:
+			return PrivilegeUser
+		case ipmiCmdGetUserAccess, ipmiCmdGetUserName:
+			return PrivilegeOperator
+		}
+	case ipmiNetFNChassis:
+		switch command {
+		case ipmiCmdGetChassisStatus:
+			return PrivilegeUser
+		case ipmiCmdChassisControl, ipmiCmdSetSystemBootOptions, ipmiCmdGetSystemBootOptions:
+			return PrivilegeOperator
+		}
+	case ipmiNetFNSensorEvent:
+		switch command {
+		case ipmiCmdGetSensorReading, ipmiCmdGetSensorThresholds, ipmiCmdGetSensorHysteresis:
+			return PrivilegeUser
+		case ipmiCmdPlatformEvent:
+			return PrivilegeOperator
+		}
+	case ipmiNetFNStorage:
+		switch command {
+		case ipmiCmdGetFRUInventoryAreaInfo, ipmiCmdReadFRUData,
+			ipmiCmdGetSDRRepositoryInfo, ipmiCmdReserveSDRRepository, ipmiCmdGetSDR,
+			ipmiCmdGetSELInfo, ipmiCmdReserveSEL, ipmiCmdGetSELEntry, ipmiCmdGetSELTime:
+			return PrivilegeUser
+		case ipmiCmdAddSELEntry, ipmiCmdDeleteSELEntry, ipmiCmdClearSEL, ipmiCmdSetSELTime:
+			return PrivilegeOperator
+		}
+	}
+	return PrivilegeAdministrator
+}
+
 func appendIPMIMessageHeader(request *ipmiMessage, response []byte, netfn uint8, code completionCode) ([]byte, error) {
 	responseMessage := buildResponseMessageTemplate(request, netfn, code)
 	responseMessage.Data = response
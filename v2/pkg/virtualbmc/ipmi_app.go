@@ -3,7 +3,9 @@ package virtualbmc
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"net"
 
 	"github.com/cybozu-go/log"
 )
@@ -85,6 +87,9 @@ const (
 	authStatusKG          = 0x20
 )
 
+// ipmiChannelLAN is the channel number of the LAN interface
+const ipmiChannelLAN = 1
+
 const (
 	extendedCapabilitiesChannel15 = 0x01
 	extendedCapabilitiesChannel20 = 0x02
@@ -112,10 +117,131 @@ type ipmiSetSessionPrivilegeLevelResponse struct {
 	NewPrivilegeLevel uint8
 }
 
+type ipmiSetUserAccessRequest struct {
+	// change bits(1b) + callback(1b) + link auth(1b) + IPMI messaging(1b) + channel(4b)
+	Channel uint8
+	UserID  uint8
+	// reserved(4b) + user privilege limit(4b)
+	PrivilegeLimit uint8
+}
+
+type ipmiGetUserAccessRequest struct {
+	Channel uint8
+	UserID  uint8
+}
+
+type ipmiGetUserAccessResponse struct {
+	MaximumUserIDs uint8
+	// user ID enable status(2b) + count of enabled user IDs(6b)
+	EnabledUserIDs   uint8
+	FixedNameUserIDs uint8
+	// reserved(1b) + callback(1b) + link auth(1b) + IPMI messaging(1b) + privilege limit(4b)
+	ChannelAccess uint8
+}
+
+type ipmiSetUserNameRequest struct {
+	UserID   uint8
+	UserName [maxUserNameLength]byte
+}
+
+type ipmiGetUserNameRequest struct {
+	UserID uint8
+}
+
+type ipmiGetUserNameResponse struct {
+	UserName [maxUserNameLength]byte
+}
+
 type ipmiCloseSessionRequest struct {
 	SessionID uint32
 }
 
+type ipmiGetDeviceIDResponse struct {
+	DeviceID                uint8
+	DeviceRevision          uint8
+	FirmwareRevision1       uint8
+	FirmwareRevision2       uint8
+	IPMIVersion             uint8
+	AdditionalDeviceSupport uint8
+	ManufacturerID          [3]uint8
+	ProductID               uint16
+}
+
+type ipmiActivatePayloadRequest struct {
+	PayloadType     uint8
+	PayloadInstance uint8
+	AuxiliaryData   [4]uint8
+}
+
+type ipmiActivatePayloadResponse struct {
+	AuxiliaryData       [4]uint8
+	InboundPayloadSize  uint16
+	OutboundPayloadSize uint16
+	PayloadUDPPort      uint16
+	PayloadVLANNumber   uint16
+}
+
+type ipmiDeactivatePayloadRequest struct {
+	PayloadType     uint8
+	PayloadInstance uint8
+	AuxiliaryData   [4]uint8
+}
+
+type ipmiGetPayloadActivationStatusRequest struct {
+	PayloadType uint8
+}
+
+type ipmiGetPayloadActivationStatusResponse struct {
+	InstanceCapacity uint8
+	ActivationStatus [2]uint8
+}
+
+type ipmiGetChannelCipherSuitesRequest struct {
+	Channel     uint8
+	PayloadType uint8
+	// list type(1b) + reserved(1b) + list index(6b)
+	ListIndex uint8
+}
+
+const (
+	// cipherSuiteListByCipherSuite requests the algorithms listed by cipher suite instead of the supported algorithms
+	cipherSuiteListByCipherSuite = 0x80
+	cipherSuiteListIndexMask     = 0x3f
+	// cipherSuiteRecordSize is the maximum size of the record data in a response
+	cipherSuiteRecordSize = 16
+
+	cipherSuiteRecordStart        = 0xc0
+	cipherSuiteTagIntegrity       = 0x40
+	cipherSuiteTagConfidentiality = 0x80
+)
+
+const (
+	userIDMask              = 0x3f
+	privilegeLimitMask      = 0x0f
+	userIDStatusEnabled     = 0x40
+	userIDStatusDisabled    = 0x80
+	userAccessIPMIMessaging = 0x10
+
+	// the flag of Set User Password to set a 20 bytes password instead of 16 bytes
+	passwordSize20           = 0x80
+	passwordOperationMask    = 0x03
+	passwordOperationDisable = 0x00
+	passwordOperationEnable  = 0x01
+	passwordOperationSet     = 0x02
+	passwordOperationTest    = 0x03
+
+	completionCodePasswordTestFailed       = completionCode(0x80)
+	completionCodePrivilegeLevelNotAllowed = completionCode(0x81)
+)
+
+const (
+	ipmiVersion20 = 0x02
+	// rmcpPort is the port number of RMCP, used when the port of the server is unknown
+	rmcpPort = 623
+	// payloadVLANNone means that the payload is not sent over a VLAN
+	payloadVLANNone = 0xffff
+)
+
 func (i *ipmi) handleIPMIApp(message *ipmiMessage) ([]byte, error) {
 	switch message.Command {
 	case ipmiCmdGetChannelAuthCapabilities:
@@ -123,16 +249,19 @@ func (i *ipmi) handleIPMIApp(message *ipmiMessage) ([]byte, error) {
 		return handleIPMIAuthenticationCapabilities(message)
 	case ipmiCmdSetSessionPrivilege:
 		log.Info("      ipmi APP: Command = IPMI_CMD_SET_SESSION_PRIVILEGE", map[string]interface{}{})
-		return handleIPMISetSessionPrivilegeLevel(message)
+		return i.handleIPMISetSessionPrivilegeLevel(message)
 	case ipmiCmdCloseSession:
 		log.Info("      ipmi APP: Command = IPMI_CMD_CLOSE_SESSION", map[string]interface{}{})
 		return nil, i.handleIPMICloseSession(message)
 	case ipmiCmdGetDeviceID:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_DEVICE_ID", map[string]interface{}{})
+		return i.handleIPMIGetDeviceID()
 	case ipmiCmdColdReset:
 		log.Info("      ipmi APP: Command = IPMI_CMD_COLD_RESET", map[string]interface{}{})
+		return nil, i.session.bmc.Reset()
 	case ipmiCmdWarmReset:
 		log.Info("      ipmi APP: Command = IPMI_CMD_WARM_RESET", map[string]interface{}{})
+		return nil, i.session.bmc.Reset()
 	case ipmiCmdGetSelfTestResults:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_SELF_TEST_RESULTS", map[string]interface{}{})
 	case ipmiCmdManufacturingTestOn:
@@ -143,6 +272,7 @@ func (i *ipmi) handleIPMIApp(message *ipmiMessage) ([]byte, error) {
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_ACPI_POWER_STATE", map[string]interface{}{})
 	case ipmiCmdGetDeviceGUID:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_DEVICE_GUID", map[string]interface{}{})
+		return i.handleIPMIGetDeviceGUID()
 	case ipmiCmdResetWatchdogTimer:
 		log.Info("      ipmi APP: Command = IPMI_CMD_RESET_WATCHDOG_TIMER", map[string]interface{}{})
 	case ipmiCmdSetWatchdogTimer:
@@ -169,6 +299,7 @@ func (i *ipmi) handleIPMIApp(message *ipmiMessage) ([]byte, error) {
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_BT_INTERFACE_CAPABILITIES", map[string]interface{}{})
 	case ipmiCmdGetSystemGUID:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_SYSTEM_GUID", map[string]interface{}{})
+		return i.handleIPMIGetSystemGUID()
 	case ipmiCmdGetSessionChallenge:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_SESSION_CHALLENGE", map[string]interface{}{})
 	case ipmiCmdActivateSession:
@@ -185,20 +316,28 @@ func (i *ipmi) handleIPMIApp(message *ipmiMessage) ([]byte, error) {
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_CHANNEL_INFO", map[string]interface{}{})
 	case ipmiCmdSetUserAccess:
 		log.Info("      ipmi APP: Command = IPMI_CMD_SET_USER_ACCESS", map[string]interface{}{})
+		return nil, i.handleIPMISetUserAccess(message)
 	case ipmiCmdGetUserAccess:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_USER_ACCESS", map[string]interface{}{})
+		return i.handleIPMIGetUserAccess(message)
 	case ipmiCmdSetUserName:
 		log.Info("      ipmi APP: Command = IPMI_CMD_SET_USER_NAME", map[string]interface{}{})
+		return nil, i.handleIPMISetUserName(message)
 	case ipmiCmdGetUserName:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_USER_NAME", map[string]interface{}{})
+		return i.handleIPMIGetUserName(message)
 	case ipmiCmdSetUserPassword:
 		log.Info("      ipmi APP: Command = IPMI_CMD_SET_USER_PASSWORD", map[string]interface{}{})
+		return nil, i.handleIPMISetUserPassword(message)
 	case ipmiCmdActivatePayload:
 		log.Info("      ipmi APP: Command = IPMI_CMD_ACTIVATE_PAYLOAD", map[string]interface{}{})
+		return i.handleIPMIActivatePayload(message)
 	case ipmiCmdDeactivatePayload:
 		log.Info("      ipmi APP: Command = IPMI_CMD_DEACTIVATE_PAYLOAD", map[string]interface{}{})
+		return nil, i.handleIPMIDeactivatePayload(message)
 	case ipmiCmdGetPayloadActivationStatus:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_PAYLOAD_ACTIVATION_STATUS", map[string]interface{}{})
+		return i.handleIPMIGetPayloadActivationStatus(message)
 	case ipmiCmdGetPayloadInstanceInfo:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_PAYLOAD_INSTANCE_INFO", map[string]interface{}{})
 	case ipmiCmdSetUserPayloadAccess:
@@ -215,6 +354,7 @@ func (i *ipmi) handleIPMIApp(message *ipmiMessage) ([]byte, error) {
 		log.Info("      ipmi APP: Command = IPMI_CMD_MASTER_READ_WRITE", map[string]interface{}{})
 	case ipmiCmdGetChannelCipherSuites:
 		log.Info("      ipmi APP: Command = IPMI_CMD_GET_CHANNEL_CIPHER_SUITES", map[string]interface{}{})
+		return i.handleIPMIGetChannelCipherSuites(message)
 	case ipmiCmdSuspendResumePayloadEncryption:
 		log.Info("      ipmi APP: Command = IPMI_CMD_SUSPEND_RESUME_PAYLOAD_ENCRYPTION", map[string]interface{}{})
 	case ipmiCmdSetChannelSecurityKey:
@@ -226,15 +366,30 @@ func (i *ipmi) handleIPMIApp(message *ipmiMessage) ([]byte, error) {
 	return nil, fmt.Errorf("unsupported Command: %x", message.Command)
 }
 
-func handleIPMISetSessionPrivilegeLevel(message *ipmiMessage) ([]byte, error) {
+func (i *ipmi) handleIPMISetSessionPrivilegeLevel(message *ipmiMessage) ([]byte, error) {
 	buf := bytes.NewBuffer(message.Data)
 	request := ipmiSetSessionPrivilegeLevelRequest{}
 	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
 		return nil, fmt.Errorf("failed to read ipmiSetSessionPrivilegeLevelRequest: %w", err)
 	}
+	if i.current == nil {
+		return nil, errors.New("privilege level can be set only in an RMCP+ session")
+	}
+
+	// 0 requests the current privilege level
+	privilege := Privilege(request.RequestPrivilegeLevel & privilegeLimitMask)
+	if privilege != 0 {
+		if privilege > PrivilegeAdministrator || !i.current.MaxPrivilege.allows(privilege) {
+			return nil, &ipmiError{
+				code: completionCodePrivilegeLevelNotAllowed,
+				err:  fmt.Errorf("privilege level %d exceeds the limit of the user", privilege),
+			}
+		}
+		i.current.Privilege = privilege
+	}
 
 	response := ipmiSetSessionPrivilegeLevelResponse{}
-	response.NewPrivilegeLevel = request.RequestPrivilegeLevel
+	response.NewPrivilegeLevel = uint8(i.current.Privilege)
 
 	dataBuf := bytes.Buffer{}
 	if err := binary.Write(&dataBuf, binary.LittleEndian, response); err != nil {
@@ -254,7 +409,7 @@ func handleIPMIAuthenticationCapabilities(message *ipmiMessage) ([]byte, error)
 	// prepare for response data
 	// We don't simulate OEM related behavior
 	response := ipmiAuthenticationCapabilitiesResponse{}
-	response.Channel = 1
+	response.Channel = ipmiChannelLAN
 	response.AuthenticationTypeSupport = authBitmaskIPMIV2 | authBitmaskMD5 | authBitmaskMD2 | authBitmaskNone
 	response.AuthenticationStatus = authStatusNonNullUser | authStatusNullUser
 	response.ExtCapabilities = extendedCapabilitiesChannel20
@@ -278,3 +433,299 @@ func (i *ipmi) handleIPMICloseSession(message *ipmiMessage) error {
 	i.session.removeRMCPPlusSession(request.SessionID)
 	return nil
 }
+
+// handleIPMIGetDeviceID responds to Get Device ID, which is also used by remote consoles to keep the session alive
+func (i *ipmi) handleIPMIGetDeviceID() ([]byte, error) {
+	profile := vendorProfileOf(i.session.bmc)
+	response := ipmiGetDeviceIDResponse{
+		DeviceID:          0x20,
+		DeviceRevision:    0x01,
+		FirmwareRevision1: 0x01,
+		FirmwareRevision2: 0x00,
+		IPMIVersion:       ipmiVersion20,
+		// sensor device, SDR repository device, SEL device and FRU inventory device
+		AdditionalDeviceSupport: 0x0f,
+		ManufacturerID: [3]uint8{
+			uint8(profile.manufacturerID),
+			uint8(profile.manufacturerID >> 8),
+			uint8(profile.manufacturerID >> 16),
+		},
+		ProductID: profile.productID,
+	}
+
+	dataBuf := bytes.Buffer{}
+	if err := binary.Write(&dataBuf, binary.LittleEndian, response); err != nil {
+		return nil, fmt.Errorf("failed to write ipmiGetDeviceIDResponse: %w", err)
+	}
+
+	return dataBuf.Bytes(), nil
+}
+
+func (i *ipmi) handleIPMIActivatePayload(message *ipmiMessage) ([]byte, error) {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiActivatePayloadRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return nil, fmt.Errorf("failed to read ipmiActivatePayloadRequest: %w", err)
+	}
+
+	if request.PayloadType&0x3f != payloadTypeSOL || request.PayloadInstance != solPayloadInstance {
+		return nil, fmt.Errorf("unsupported payload: type %x, instance %d", request.PayloadType, request.PayloadInstance)
+	}
+	if i.current == nil {
+		return nil, errors.New("payload can be activated only in an RMCP+ session")
+	}
+	if i.session.activeSOL() != nil {
+		return nil, errors.New("SOL payload is already activated")
+	}
+
+	current := i.current
+	conn := i.session.conn
+	send := func(payload []byte) error {
+		res, err := encapsulatePayload(current, payloadTypeSOL, payload)
+		if err != nil {
+			return err
+		}
+		res, err = appendRMCPHeader(res)
+		if err != nil {
+			return err
+		}
+		_, err = conn.WriteTo(res, current.getRemoteAddr())
+		return err
+	}
+	sol := newSOLSession(current.ManagedSystemSessionId, i.machine, send)
+	i.session.sol = sol
+	sol.start()
+
+	port := rmcpPort
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		port = addr.Port
+	}
+	response := ipmiActivatePayloadResponse{
+		InboundPayloadSize:  solMaxPayloadSize,
+		OutboundPayloadSize: solMaxPayloadSize,
+		PayloadUDPPort:      uint16(port),
+		PayloadVLANNumber:   payloadVLANNone,
+	}
+
+	dataBuf := bytes.Buffer{}
+	if err := binary.Write(&dataBuf, binary.LittleEndian, response); err != nil {
+		return nil, fmt.Errorf("failed to write ipmiActivatePayloadResponse: %w", err)
+	}
+
+	return dataBuf.Bytes(), nil
+}
+
+func (i *ipmi) handleIPMIDeactivatePayload(message *ipmiMessage) error {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiDeactivatePayloadRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return fmt.Errorf("failed to read ipmiDeactivatePayloadRequest: %w", err)
+	}
+
+	if request.PayloadType&0x3f != payloadTypeSOL || request.PayloadInstance != solPayloadInstance {
+		return fmt.Errorf("unsupported payload: type %x, instance %d", request.PayloadType, request.PayloadInstance)
+	}
+	if i.session.activeSOL() == nil {
+		return errors.New("SOL payload is not activated")
+	}
+
+	i.session.deactivateSOL()
+	return nil
+}
+
+func (i *ipmi) handleIPMIGetPayloadActivationStatus(message *ipmiMessage) ([]byte, error) {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiGetPayloadActivationStatusRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return nil, fmt.Errorf("failed to read ipmiGetPayloadActivationStatusRequest: %w", err)
+	}
+
+	if request.PayloadType&0x3f != payloadTypeSOL {
+		return nil, fmt.Errorf("unsupported payload type: %x", request.PayloadType)
+	}
+
+	response := ipmiGetPayloadActivationStatusResponse{InstanceCapacity: 1}
+	if i.session.activeSOL() != nil {
+		response.ActivationStatus[0] = 1 << (solPayloadInstance - 1)
+	}
+
+	dataBuf := bytes.Buffer{}
+	if err := binary.Write(&dataBuf, binary.LittleEndian, response); err != nil {
+		return nil, fmt.Errorf("failed to write ipmiGetPayloadActivationStatusResponse: %w", err)
+	}
+
+	return dataBuf.Bytes(), nil
+}
+
+func (i *ipmi) handleIPMIGetChannelCipherSuites(message *ipmiMessage) ([]byte, error) {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiGetChannelCipherSuitesRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return nil, fmt.Errorf("failed to read ipmiGetChannelCipherSuitesRequest: %w", err)
+	}
+
+	suites := i.session.cipherSuites()
+	var records []byte
+	if request.ListIndex&cipherSuiteListByCipherSuite != 0 {
+		for _, suite := range suites {
+			records = append(records, cipherSuiteRecordStart, suite.id,
+				uint8(suite.authentication),
+				cipherSuiteTagIntegrity|uint8(suite.integrity),
+				cipherSuiteTagConfidentiality|uint8(suite.confidentiality))
+		}
+	} else {
+		seen := make(map[uint8]bool)
+		for _, suite := range suites {
+			for _, alg := range []uint8{
+				uint8(suite.authentication),
+				cipherSuiteTagIntegrity | uint8(suite.integrity),
+				cipherSuiteTagConfidentiality | uint8(suite.confidentiality),
+			} {
+				if !seen[alg] {
+					seen[alg] = true
+					records = append(records, alg)
+				}
+			}
+		}
+	}
+
+	// The records are returned in 16 bytes chunks. A response shorter than that marks the end of the list.
+	start := int(request.ListIndex&cipherSuiteListIndexMask) * cipherSuiteRecordSize
+	end := start + cipherSuiteRecordSize
+	if start > len(records) {
+		start = len(records)
+	}
+	if end > len(records) {
+		end = len(records)
+	}
+
+	return append([]byte{ipmiChannelLAN}, records[start:end]...), nil
+}
+
+func (i *ipmi) handleIPMISetUserAccess(message *ipmiMessage) error {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiSetUserAccessRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return fmt.Errorf("failed to read ipmiSetUserAccessRequest: %w", err)
+	}
+
+	privilege := Privilege(request.PrivilegeLimit & privilegeLimitMask)
+	if err := i.users.setUserPrivilege(request.UserID&userIDMask, privilege); err != nil {
+		return &ipmiError{code: completionCodeInvalidDataField, err: err}
+	}
+	return nil
+}
+
+func (i *ipmi) handleIPMIGetUserAccess(message *ipmiMessage) ([]byte, error) {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiGetUserAccessRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return nil, fmt.Errorf("failed to read ipmiGetUserAccessRequest: %w", err)
+	}
+
+	user, err := i.users.user(request.UserID & userIDMask)
+	if err != nil {
+		return nil, &ipmiError{code: completionCodeInvalidDataField, err: err}
+	}
+
+	response := ipmiGetUserAccessResponse{
+		MaximumUserIDs:   maxBMCUsers,
+		EnabledUserIDs:   uint8(i.users.countEnabled()),
+		FixedNameUserIDs: nullUserID,
+		ChannelAccess:    uint8(user.Privilege),
+	}
+	if user.Enabled {
+		response.EnabledUserIDs |= userIDStatusEnabled
+	} else {
+		response.EnabledUserIDs |= userIDStatusDisabled
+	}
+	if user.Privilege != PrivilegeNoAccess {
+		response.ChannelAccess |= userAccessIPMIMessaging
+	}
+
+	dataBuf := bytes.Buffer{}
+	if err := binary.Write(&dataBuf, binary.LittleEndian, response); err != nil {
+		return nil, fmt.Errorf("failed to write ipmiGetUserAccessResponse: %w", err)
+	}
+
+	return dataBuf.Bytes(), nil
+}
+
+func (i *ipmi) handleIPMISetUserName(message *ipmiMessage) error {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiSetUserNameRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return fmt.Errorf("failed to read ipmiSetUserNameRequest: %w", err)
+	}
+
+	name := string(bytes.TrimRight(request.UserName[:], "\x00"))
+	if err := i.users.setUserName(request.UserID&userIDMask, name); err != nil {
+		return &ipmiError{code: completionCodeInvalidDataField, err: err}
+	}
+	return nil
+}
+
+func (i *ipmi) handleIPMIGetUserName(message *ipmiMessage) ([]byte, error) {
+	buf := bytes.NewBuffer(message.Data)
+	request := ipmiGetUserNameRequest{}
+	if err := binary.Read(buf, binary.LittleEndian, &request); err != nil {
+		return nil, fmt.Errorf("failed to read ipmiGetUserNameRequest: %w", err)
+	}
+
+	user, err := i.users.user(request.UserID & userIDMask)
+	if err != nil {
+		return nil, &ipmiError{code: completionCodeInvalidDataField, err: err}
+	}
+
+	response := ipmiGetUserNameResponse{}
+	copy(response.UserName[:], user.Username)
+
+	dataBuf := bytes.Buffer{}
+	if err := binary.Write(&dataBuf, binary.LittleEndian, response); err != nil {
+		return nil, fmt.Errorf("failed to write ipmiGetUserNameResponse: %w", err)
+	}
+
+	return dataBuf.Bytes(), nil
+}
+
+func (i *ipmi) handleIPMISetUserPassword(message *ipmiMessage) error {
+	if len(message.Data) < 2 {
+		return errors.New("set user password request is too short")
+	}
+	id := message.Data[0] & userIDMask
+	operation := message.Data[1] & passwordOperationMask
+
+	switch operation {
+	case passwordOperationDisable, passwordOperationEnable:
+		if err := i.users.setUserEnabled(id, operation == passwordOperationEnable); err != nil {
+			return &ipmiError{code: completionCodeInvalidDataField, err: err}
+		}
+		return nil
+	}
+
+	size := 16
+	if message.Data[0]&passwordSize20 != 0 {
+		size = maxPasswordLength
+	}
+	if len(message.Data) < 2+size {
+		return &ipmiError{code: completionCodeInvalidDataField, err: errors.New("password is too short")}
+	}
+	// passwords are padded with zeros
+	password := string(bytes.TrimRight(message.Data[2:2+size], "\x00"))
+
+	if operation == passwordOperationTest {
+		ok, err := i.users.testUserPassword(id, password)
+		if err != nil {
+			return &ipmiError{code: completionCodeInvalidDataField, err: err}
+		}
+		if !ok {
+			return &ipmiError{code: completionCodePasswordTestFailed, err: errors.New("password test failed")}
+		}
+		return nil
+	}
+
+	if err := i.users.setUserPassword(id, password); err != nil {
+		return &ipmiError{code: completionCodeInvalidDataField, err: err}
+	}
+	return nil
+}
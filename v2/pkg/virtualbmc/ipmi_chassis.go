@@ -35,6 +35,37 @@ const (
 
 const chassisPowerStateBitmaskPowerOn = 0x01
 
+// System boot option parameters
+const (
+	bootOptionSetInProgress      = 0x00
+	bootOptionBootFlagValidClear = 0x03
+	bootOptionBootInfoAck        = 0x04
+	bootOptionBootFlags          = 0x05
+
+	bootOptionParameterVersion = 0x01
+	bootOptionParameterInvalid = 0x80
+)
+
+// Boot flags
+const (
+	bootFlagsValid      = 0x80
+	bootFlagsPersistent = 0x40
+	bootFlagsEFI        = 0x20
+
+	bootDeviceSelectorMask  = 0x3c
+	bootDeviceSelectorShift = 2
+)
+
+// Boot device selectors
+const (
+	bootDeviceSelectorNone         = 0x00
+	bootDeviceSelectorPXE          = 0x01
+	bootDeviceSelectorDisk         = 0x02
+	bootDeviceSelectorDiskSafeMode = 0x03
+	bootDeviceSelectorCDROM        = 0x05
+	bootDeviceSelectorBIOSSetup    = 0x06
+)
+
 type ipmiChassisControlRequest struct {
 	ChassisControl uint8
 }
@@ -68,8 +99,10 @@ func (i *ipmi) handleIPMIChassis(message *ipmiMessage) ([]byte, error) {
 		log.Info("      ipmi CHASSIS: Command = IPMI_CMD_GET_SYSTEM_RESTART_CAUSE", map[string]interface{}{})
 	case ipmiCmdSetSystemBootOptions:
 		log.Info("      ipmi CHASSIS: Command = IPMI_CMD_SET_SYSTEM_BOOT_OPTIONS", map[string]interface{}{})
+		return nil, i.handleIPMISetSystemBootOptions(message)
 	case ipmiCmdGetSystemBootOptions:
 		log.Info("      ipmi CHASSIS: Command = IPMI_CMD_GET_SYSTEM_BOOT_OPTIONS", map[string]interface{}{})
+		return i.handleIPMIGetSystemBootOptions(message)
 	case ipmiCmdGetPOHCounter:
 		log.Info("      ipmi CHASSIS: Command = IPMI_CMD_GET_POH_COUNTER", map[string]interface{}{})
 	}
@@ -83,7 +116,7 @@ func (i *ipmi) handleIPMIGetChassisStatus() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if powerStatus == PowerStatusOn || powerStatus == PowerStatusPoweringOn {
+	if powerStatus == PowerStatusOn || powerStatus == PowerStatusPoweringOn || powerStatus == PowerStatusPaused {
 		response.CurrentPowerState |= chassisPowerStateBitmaskPowerOn
 	}
 	response.LastPowerEvent = 0
@@ -120,7 +153,7 @@ func (i *ipmi) handleIPMIChassisControl(message *ipmiMessage) error {
 		if err != nil {
 			return err
 		}
-		if powerState == PowerStatusOn || powerState == PowerStatusPoweringOn {
+		if powerState == PowerStatusOn || powerState == PowerStatusPoweringOn || powerState == PowerStatusPaused {
 			return errors.New("server is already powered on")
 		}
 		return i.machine.PowerOn()
@@ -144,15 +177,134 @@ func (i *ipmi) handleIPMIChassisControl(message *ipmiMessage) error {
 		if powerState == PowerStatusOff || powerState == PowerStatusPoweringOff {
 			return errors.New("server is already powered off")
 		}
-		if err := i.machine.PowerOff(); err != nil {
+		return i.machine.Reset()
+	case chassisControlPulse:
+		// pulse a diagnostic interrupt (NMI)
+		powerState, err := i.machine.PowerStatus()
+		if err != nil {
 			return err
 		}
-		return i.machine.PowerOn()
-	case chassisControlPulse:
-		// do nothing
+		if powerState == PowerStatusOff || powerState == PowerStatusPoweringOff {
+			return errors.New("server is already powered off")
+		}
+		return i.machine.InjectNMI()
 	case chassisControlPowerSoft:
-		// do nothing
+		// initiate a soft-shutdown of OS via ACPI
+		powerState, err := i.machine.PowerStatus()
+		if err != nil {
+			return err
+		}
+		if powerState == PowerStatusOff || powerState == PowerStatusPoweringOff {
+			return errors.New("server is already powered off")
+		}
+		return i.machine.GracefulShutdown()
+	default:
+		return fmt.Errorf("unsupported chassis control: %x", request.ChassisControl)
 	}
+}
 
-	return nil
+func (i *ipmi) handleIPMISetSystemBootOptions(message *ipmiMessage) error {
+	if len(message.Data) < 1 {
+		return errors.New("boot option parameter is missing")
+	}
+	// bit 7 marks the parameter invalid or locked, which is not supported
+	selector := message.Data[0] &^ bootOptionParameterInvalid
+	data := message.Data[1:]
+
+	switch selector {
+	case bootOptionSetInProgress, bootOptionBootFlagValidClear, bootOptionBootInfoAck:
+		// accepted for compatibility with clients such as ipmitool, but have no effect
+		return nil
+	case bootOptionBootFlags:
+		if len(data) < 2 {
+			return errors.New("boot flags are too short")
+		}
+		o, err := decodeBootFlags(data[0], data[1])
+		if err != nil {
+			return err
+		}
+		return i.machine.SetBootOverride(o)
+	default:
+		return fmt.Errorf("unsupported boot option parameter: %x", selector)
+	}
+}
+
+func (i *ipmi) handleIPMIGetSystemBootOptions(message *ipmiMessage) ([]byte, error) {
+	if len(message.Data) < 1 {
+		return nil, errors.New("boot option parameter is missing")
+	}
+	selector := message.Data[0] &^ bootOptionParameterInvalid
+
+	res := []byte{bootOptionParameterVersion, selector}
+	switch selector {
+	case bootOptionSetInProgress:
+		// set complete
+		res = append(res, 0)
+	case bootOptionBootFlagValidClear:
+		res = append(res, 0)
+	case bootOptionBootInfoAck:
+		res = append(res, 0, 0)
+	case bootOptionBootFlags:
+		o, err := i.machine.BootOverride()
+		if err != nil {
+			return nil, err
+		}
+		flags, device := encodeBootFlags(o)
+		res = append(res, flags, device, 0, 0, 0)
+	default:
+		return nil, fmt.Errorf("unsupported boot option parameter: %x", selector)
+	}
+
+	return res, nil
+}
+
+func decodeBootFlags(flags, device uint8) (BootOverride, error) {
+	o := BootOverride{
+		Device:     BootDeviceNone,
+		Persistent: flags&bootFlagsPersistent != 0,
+		UEFI:       flags&bootFlagsEFI != 0,
+	}
+	if flags&bootFlagsValid == 0 {
+		return o, nil
+	}
+
+	switch (device & bootDeviceSelectorMask) >> bootDeviceSelectorShift {
+	case bootDeviceSelectorNone:
+	case bootDeviceSelectorPXE:
+		o.Device = BootDevicePxe
+	case bootDeviceSelectorDisk, bootDeviceSelectorDiskSafeMode:
+		o.Device = BootDeviceHdd
+	case bootDeviceSelectorCDROM:
+		o.Device = BootDeviceCd
+	case bootDeviceSelectorBIOSSetup:
+		o.Device = BootDeviceBiosSetup
+	default:
+		return o, fmt.Errorf("unsupported boot device selector: %x", device)
+	}
+	return o, nil
+}
+
+func encodeBootFlags(o BootOverride) (uint8, uint8) {
+	var selector uint8
+	switch o.Device {
+	case BootDevicePxe:
+		selector = bootDeviceSelectorPXE
+	case BootDeviceHdd:
+		selector = bootDeviceSelectorDisk
+	case BootDeviceCd:
+		selector = bootDeviceSelectorCDROM
+	case BootDeviceBiosSetup:
+		selector = bootDeviceSelectorBIOSSetup
+	default:
+		return 0, 0
+	}
+
+	flags := uint8(bootFlagsValid)
+	if o.Persistent {
+		flags |= bootFlagsPersistent
+	}
+	if o.UEFI {
+		flags |= bootFlagsEFI
+	}
+	return flags, selector << bootDeviceSelectorShift
 }
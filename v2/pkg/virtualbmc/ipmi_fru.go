@@ -0,0 +1,210 @@
+package virtualbmc
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// fruDeviceBuiltIn is the ID of the FRU device of the BMC, which describes the machine
+	fruDeviceBuiltIn = 0x00
+	fruFormatVersion = 0x01
+	// fruAccessByBytes means that the FRU device is accessed in bytes, not in words
+	fruAccessByBytes = 0x00
+	// fruChassisTypeRackMount is the SMBIOS chassis type of a rack mount chassis
+	fruChassisTypeRackMount = 0x17
+	fruLanguageEnglish      = 0x00
+	fruEndOfFields          = 0xc1
+	fruMaxFieldLength       = 0x3f
+	// fruAreaUnit is the unit of the length and the offsets of the areas
+	fruAreaUnit = 8
+)
+
+type ipmiGetFRUInventoryAreaInfoResponse struct {
+	Size   uint16
+	Access uint8
+}
+
+type ipmiReadFRUDataRequest struct {
+	DeviceID uint8
+	Offset   uint16
+	Count    uint8
+}
+
+func (i *ipmi) handleIPMIGetFRUInventoryAreaInfo(message *ipmiMessage) ([]byte, error) {
+	data, err := i.fruData(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeResponse(ipmiGetFRUInventoryAreaInfoResponse{
+		Size:   uint16(len(data)),
+		Access: fruAccessByBytes,
+	})
+}
+
+func (i *ipmi) handleIPMIReadFRUData(message *ipmiMessage) ([]byte, error) {
+	request := ipmiReadFRUDataRequest{}
+	if err := binary.Read(bytes.NewReader(message.Data), binary.LittleEndian, &request); err != nil {
+		return nil, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("failed to read ipmiReadFRUDataRequest: %w", err),
+		}
+	}
+
+	data, err := i.fruData(message)
+	if err != nil {
+		return nil, err
+	}
+	if int(request.Offset) > len(data) {
+		return nil, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("offset out of the FRU data: %d", request.Offset),
+		}
+	}
+	end := int(request.Offset) + int(request.Count)
+	if end > len(data) {
+		end = len(data)
+	}
+	return append([]byte{uint8(end - int(request.Offset))}, data[request.Offset:end]...), nil
+}
+
+// fruData returns the FRU inventory of the FRU device specified by the first byte of the request
+func (i *ipmi) fruData(message *ipmiMessage) ([]byte, error) {
+	if len(message.Data) < 1 {
+		return nil, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  errors.New("FRU device ID is missing"),
+		}
+	}
+	if message.Data[0] != fruDeviceBuiltIn {
+		return nil, &ipmiError{
+			code: completionCodeRequestedDataNotPresent,
+			err:  fmt.Errorf("FRU device not found: %d", message.Data[0]),
+		}
+	}
+
+	inv, err := i.machine.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	return fruInventory(inv), nil
+}
+
+// fruInventory returns the FRU inventory of the machine, which has the same system information as SMBIOS
+func fruInventory(inv Inventory) []byte {
+	chassis := fruArea([]byte{fruChassisTypeRackMount}, "", inv.SerialNumber)
+	// the manufacturing date is unspecified
+	board := fruArea([]byte{fruLanguageEnglish, 0, 0, 0}, inv.Manufacturer, inv.Model, inv.SerialNumber, "", "")
+	product := fruArea([]byte{fruLanguageEnglish}, inv.Manufacturer, inv.Model, "", "", inv.SerialNumber, "", "")
+
+	header := []byte{
+		fruFormatVersion,
+		// internal use area
+		0,
+		1,
+		uint8(1 + len(chassis)/fruAreaUnit),
+		uint8(1 + (len(chassis)+len(board))/fruAreaUnit),
+		// multi record area
+		0,
+		0,
+	}
+	header = append(header, fruChecksum(header))
+
+	data := append(header, chassis...)
+	data = append(data, board...)
+	return append(data, product...)
+}
+
+// fruArea returns an info area which consists of the fixed fields and the string fields
+func fruArea(fixed []byte, fields ...string) []byte {
+	area := append([]byte{fruFormatVersion, 0}, fixed...)
+	for _, f := range fields {
+		if len(f) > fruMaxFieldLength {
+			f = f[:fruMaxFieldLength]
+		}
+		// 8-bit ASCII
+		area = append(area, 0xc0|uint8(len(f)))
+		area = append(area, f...)
+	}
+	area = append(area, fruEndOfFields)
+
+	// the area is padded to a multiple of 8 bytes including the checksum
+	for (len(area)+1)%fruAreaUnit != 0 {
+		area = append(area, 0)
+	}
+	area[1] = uint8((len(area) + 1) / fruAreaUnit)
+	return append(area, fruChecksum(area))
+}
+
+// fruChecksum returns the zero checksum of the data
+func fruChecksum(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+func (i *ipmi) handleIPMIGetSystemGUID() ([]byte, error) {
+	return systemGUID(i.machine)
+}
+
+// systemGUID returns the system UUID of the machine in the byte order of IPMI
+func systemGUID(machine Machine) ([]byte, error) {
+	inv, err := machine.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	u, err := parseUUID(inv.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return ipmiGUID(u), nil
+}
+
+// handleIPMIGetDeviceGUID returns the GUID of the BMC, which is derived from the system UUID so that it is stable
+func (i *ipmi) handleIPMIGetDeviceGUID() ([]byte, error) {
+	inv, err := i.machine.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	u, err := parseUUID(inv.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum(append(u[:], "bmc"...))
+	var guid [16]byte
+	copy(guid[:], sum[:])
+	guid[6] = guid[6]&0x0f | 0x50
+	guid[8] = guid[8]&0x3f | 0x80
+	return ipmiGUID(guid), nil
+}
+
+// parseUUID parses a UUID in the canonical form
+func parseUUID(s string) ([16]byte, error) {
+	var u [16]byte
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != len(u) {
+		return u, fmt.Errorf("invalid UUID: %q", s)
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+// ipmiGUID encodes a UUID in the same byte order as SMBIOS, where the first three fields are little-endian.
+// ipmitool decodes GUIDs in this order, so that it shows the same UUID as dmidecode in the guest.
+func ipmiGUID(u [16]byte) []byte {
+	return []byte{
+		u[3], u[2], u[1], u[0],
+		u[5], u[4],
+		u[7], u[6],
+		u[8], u[9], u[10], u[11], u[12], u[13], u[14], u[15],
+	}
+}
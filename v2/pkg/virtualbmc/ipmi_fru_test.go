@@ -0,0 +1,71 @@
+package virtualbmc
+
+import (
+	"encoding/binary"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IPMI FRU", func() {
+	var client *rmcpPlusClient
+
+	BeforeEach(func() {
+		client = newRMCPPlusClient(&MachineMock{
+			status: PowerStatusOn,
+			inventory: Inventory{
+				Manufacturer: "cybozu",
+				Model:        "mk2",
+				SerialNumber: "abcd",
+				UUID:         "3c49b35a-4f29-5c1e-bf60-aa5fb2fa8635",
+			},
+		})
+		client.activate(supportedCipherSuites[len(supportedCipherSuites)-1])
+	})
+
+	It("should serve the FRU inventory of the machine", func() {
+		code, data := client.command(ipmiNetFNStorage, ipmiCmdGetFRUInventoryAreaInfo, fruDeviceBuiltIn)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data[2]).To(Equal(uint8(fruAccessByBytes)))
+		size := int(binary.LittleEndian.Uint16(data))
+
+		By("reading the inventory in chunks")
+		var fru []byte
+		for len(fru) < size {
+			code, data := client.command(ipmiNetFNStorage, ipmiCmdReadFRUData, fruDeviceBuiltIn, uint8(len(fru)), uint8(len(fru)>>8), 16)
+			Expect(code).To(Equal(completionCodeOK))
+			Expect(int(data[0])).To(Equal(len(data) - 1))
+			fru = append(fru, data[1:]...)
+		}
+		Expect(fru).To(Equal(fruInventory(Inventory{Manufacturer: "cybozu", Model: "mk2", SerialNumber: "abcd"})))
+
+		By("checking the header and the areas")
+		Expect(fruChecksum(fru[:8])).To(BeZero())
+		for _, offset := range fru[2:5] {
+			area := fru[int(offset)*fruAreaUnit:]
+			area = area[:int(area[1])*fruAreaUnit]
+			Expect(fruChecksum(area)).To(BeZero())
+		}
+		board := fru[int(fru[3])*fruAreaUnit:]
+		Expect(board[6:22]).To(Equal([]byte("\xc6cybozu\xc3mk2\xc4abcd")))
+
+		code, _ = client.command(ipmiNetFNStorage, ipmiCmdReadFRUData, 1, 0, 0, 16)
+		Expect(code).To(Equal(completionCodeRequestedDataNotPresent))
+	})
+
+	It("should return the GUIDs derived from the system UUID", func() {
+		code, data := client.command(ipmiNetFNApp, ipmiCmdGetSystemGUID)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{
+			0x5a, 0xb3, 0x49, 0x3c, 0x29, 0x4f, 0x1e, 0x5c,
+			0xbf, 0x60, 0xaa, 0x5f, 0xb2, 0xfa, 0x86, 0x35,
+		}))
+
+		code, deviceGUID := client.command(ipmiNetFNApp, ipmiCmdGetDeviceGUID)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(deviceGUID).To(HaveLen(16))
+		Expect(deviceGUID).NotTo(Equal(data))
+		_, again := client.command(ipmiNetFNApp, ipmiCmdGetDeviceGUID)
+		Expect(again).To(Equal(deviceGUID))
+	})
+})
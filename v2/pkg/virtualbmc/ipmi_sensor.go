@@ -0,0 +1,170 @@
+package virtualbmc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cybozu-go/log"
+)
+
+// Sensor/Event Network Function
+const (
+	ipmiCmdSetEventReceiver       = 0x00
+	ipmiCmdGetEventReceiver       = 0x01
+	ipmiCmdPlatformEvent          = 0x02
+	ipmiCmdGetPEFCapabilities     = 0x10
+	ipmiCmdGetLastProcessedEvent  = 0x13
+	ipmiCmdGetDeviceSDRInfo       = 0x20
+	ipmiCmdGetDeviceSDR           = 0x21
+	ipmiCmdReserveDeviceSDRRepo   = 0x22
+	ipmiCmdSetSensorHysteresis    = 0x24
+	ipmiCmdGetSensorHysteresis    = 0x25
+	ipmiCmdSetSensorThresholds    = 0x26
+	ipmiCmdGetSensorThresholds    = 0x27
+	ipmiCmdSetSensorEventEnable   = 0x28
+	ipmiCmdGetSensorEventEnable   = 0x29
+	ipmiCmdRearmSensorEvents      = 0x2a
+	ipmiCmdGetSensorEventStatus   = 0x2b
+	ipmiCmdGetSensorReading       = 0x2d
+	ipmiCmdGetSensorType          = 0x2f
+	ipmiCmdSetSensorReadingStatus = 0x30
+)
+
+const (
+	sensorReadingEventMessagesEnabled = 0x80
+	sensorReadingScanningEnabled      = 0x40
+
+	completionCodeRequestedDataNotPresent = completionCode(0xcb)
+)
+
+func (i *ipmi) handleIPMISensorEvent(message *ipmiMessage) ([]byte, error) {
+	switch message.Command {
+	case ipmiCmdGetSensorReading:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_SENSOR_READING", map[string]interface{}{})
+		return i.handleIPMIGetSensorReading(message)
+	case ipmiCmdGetSensorThresholds:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_SENSOR_THRESHOLDS", map[string]interface{}{})
+		return i.handleIPMIGetSensorThresholds(message)
+	case ipmiCmdGetSensorHysteresis:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_SENSOR_HYSTERESIS", map[string]interface{}{})
+		return i.handleIPMIGetSensorHysteresis(message)
+	case ipmiCmdPlatformEvent:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_PLATFORM_EVENT", map[string]interface{}{})
+		return nil, i.handleIPMIPlatformEvent(message)
+	case ipmiCmdSetEventReceiver:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_SET_EVENT_RECEIVER", map[string]interface{}{})
+	case ipmiCmdGetEventReceiver:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_EVENT_RECEIVER", map[string]interface{}{})
+	case ipmiCmdGetPEFCapabilities:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_PEF_CAPABILITIES", map[string]interface{}{})
+	case ipmiCmdGetLastProcessedEvent:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_LAST_PROCESSED_EVENT", map[string]interface{}{})
+	case ipmiCmdGetDeviceSDRInfo:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_DEVICE_SDR_INFO", map[string]interface{}{})
+	case ipmiCmdGetDeviceSDR:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_DEVICE_SDR", map[string]interface{}{})
+	case ipmiCmdReserveDeviceSDRRepo:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_RESERVE_DEVICE_SDR_REPOSITORY", map[string]interface{}{})
+	case ipmiCmdSetSensorHysteresis:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_SET_SENSOR_HYSTERESIS", map[string]interface{}{})
+	case ipmiCmdSetSensorThresholds:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_SET_SENSOR_THRESHOLDS", map[string]interface{}{})
+	case ipmiCmdSetSensorEventEnable:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_SET_SENSOR_EVENT_ENABLE", map[string]interface{}{})
+	case ipmiCmdGetSensorEventEnable:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_SENSOR_EVENT_ENABLE", map[string]interface{}{})
+	case ipmiCmdRearmSensorEvents:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_REARM_SENSOR_EVENTS", map[string]interface{}{})
+	case ipmiCmdGetSensorEventStatus:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_SENSOR_EVENT_STATUS", map[string]interface{}{})
+	case ipmiCmdGetSensorType:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_GET_SENSOR_TYPE", map[string]interface{}{})
+	case ipmiCmdSetSensorReadingStatus:
+		log.Info("      ipmi SENSOR/EVENT: Command = IPMI_CMD_SET_SENSOR_READING_AND_EVENT_STATUS", map[string]interface{}{})
+	}
+
+	return nil, fmt.Errorf("unsupported Sensor/Event command: %x", message.Command)
+}
+
+// requestedSensor returns the sensor specified by the first byte of the request
+func (i *ipmi) requestedSensor(message *ipmiMessage) (Sensor, error) {
+	if len(message.Data) < 1 {
+		return Sensor{}, errors.New("sensor number is missing")
+	}
+	s, ok := i.session.bmc.Sensors().sensor(message.Data[0])
+	if !ok {
+		return Sensor{}, &ipmiError{
+			code: completionCodeRequestedDataNotPresent,
+			err:  fmt.Errorf("sensor not found: %d", message.Data[0]),
+		}
+	}
+	return s, nil
+}
+
+func (i *ipmi) handleIPMIGetSensorReading(message *ipmiMessage) ([]byte, error) {
+	s, err := i.requestedSensor(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte{
+		s.raw(s.Value),
+		sensorReadingEventMessagesEnabled | sensorReadingScanningEnabled,
+		s.thresholdStatus(s.Value),
+	}, nil
+}
+
+func (i *ipmi) handleIPMIGetSensorThresholds(message *ipmiMessage) ([]byte, error) {
+	s, err := i.requestedSensor(message)
+	if err != nil {
+		return nil, err
+	}
+
+	// readable mask, lower non-critical, lower critical, lower non-recoverable, upper non-critical, upper critical and upper non-recoverable
+	return []byte{
+		s.thresholdMask(),
+		s.raw(s.LowerNonCritical),
+		s.raw(s.LowerCritical),
+		0,
+		s.raw(s.UpperNonCritical),
+		s.raw(s.UpperCritical),
+		0,
+	}, nil
+}
+
+func (i *ipmi) handleIPMIGetSensorHysteresis(message *ipmiMessage) ([]byte, error) {
+	if _, err := i.requestedSensor(message); err != nil {
+		return nil, err
+	}
+
+	// no hysteresis in both directions
+	return []byte{0, 0}, nil
+}
+
+// handleIPMIPlatformEvent logs the event in the SEL.
+// The request has the generator ID only if it is sent via the system interface, otherwise the requester is the generator.
+func (i *ipmi) handleIPMIPlatformEvent(message *ipmiMessage) error {
+	data := message.Data
+	generator := uint16(message.SourceAddress)
+	switch len(data) {
+	case 7:
+	case 8:
+		generator = uint16(data[0])
+		data = data[1:]
+	default:
+		return &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("invalid length of platform event message: %d", len(data)),
+		}
+	}
+
+	_, err := i.session.bmc.SEL().Add(SELEntry{
+		GeneratorID:  generator,
+		SensorType:   data[1],
+		SensorNumber: data[2],
+		EventType:    data[3] & 0x7f,
+		Deassertion:  data[3]&0x80 != 0,
+		EventData:    [3]uint8{data[4], data[5], data[6]},
+	})
+	return err
+}
@@ -3,8 +3,10 @@ package virtualbmc
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 )
 
 type authenticationType uint8
@@ -43,14 +45,14 @@ func newIPMISession(buf io.Reader) (*ipmiSession, error) {
 }
 
 // handle handles both ipmi v1.5 and v2.0 packet formats and dispatches layers below
-func (r *ipmiSession) handle(buf io.Reader, machine Machine, session *rmcpPlusSessionHolder, bmcUser *bmcUserHolder) ([]byte, error) {
+func (r *ipmiSession) handle(buf io.Reader, addr net.Addr, machine Machine, session *rmcpPlusSessionHolder, bmcUser *UserHolder) ([]byte, error) {
 	rmcpPlus, err := isRMCPPlusFormat(r.authType)
 	if err != nil {
 		return nil, err
 	}
 
 	if rmcpPlus {
-		rmcpPlus, err := newRMCPPlus(buf, r.authType, session, bmcUser)
+		rmcpPlus, err := newRMCPPlus(buf, addr, r.authType, session, bmcUser)
 		if err != nil {
 			return nil, err
 		}
@@ -62,10 +64,14 @@ func (r *ipmiSession) handle(buf io.Reader, machine Machine, session *rmcpPlusSe
 		return nil, err
 	}
 
-	ipmi, err := newIPMI(buf, int(wrapper.MessageLen), machine, session)
+	ipmi, err := newIPMI(buf, int(wrapper.MessageLen), machine, session, bmcUser, nil)
 	if err != nil {
 		return nil, err
 	}
+	// IPMI v1.5 sessions are not supported, so only the commands to discover RMCP+ are allowed
+	if !ipmi.isSessionless() {
+		return nil, errors.New("command is not allowed outside of a session")
+	}
 	res, err := ipmi.handle()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,401 @@
+package virtualbmc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// Storage Network Function
+const (
+	ipmiCmdGetFRUInventoryAreaInfo = 0x10
+	ipmiCmdReadFRUData             = 0x11
+	ipmiCmdWriteFRUData            = 0x12
+	ipmiCmdGetSDRRepositoryInfo    = 0x20
+	ipmiCmdGetSDRRepositoryAlloc   = 0x21
+	ipmiCmdReserveSDRRepository    = 0x22
+	ipmiCmdGetSDR                  = 0x23
+	ipmiCmdAddSDR                  = 0x24
+	ipmiCmdClearSDRRepository      = 0x27
+	ipmiCmdGetSELInfo              = 0x40
+	ipmiCmdGetSELAllocationInfo    = 0x41
+	ipmiCmdReserveSEL              = 0x42
+	ipmiCmdGetSELEntry             = 0x43
+	ipmiCmdAddSELEntry             = 0x44
+	ipmiCmdDeleteSELEntry          = 0x46
+	ipmiCmdClearSEL                = 0x47
+	ipmiCmdGetSELTime              = 0x48
+	ipmiCmdSetSELTime              = 0x49
+)
+
+const (
+	// sdrVersion is the version of SDR and SEL in IPMI 2.0
+	sdrVersion = 0x51
+
+	sdrRecordTypeFullSensor = 0x01
+	sdrRecordTypeEventOnly  = 0x03
+	sdrRecordHeaderLength   = 5
+
+	sdrOwnerBMC = 0x20
+	// sdrEntitySystemBoard is the entity ID of the sensors
+	sdrEntitySystemBoard = 0x07
+	// sdrReadWholeRecord requests the whole record in Get SDR
+	sdrReadWholeRecord = 0xff
+	sdrLastRecord      = 0xffff
+	// sdrReservationID is the only reservation ID of the SDR repository, which is never modified
+	sdrReservationID = 0x0001
+
+	// selOperationSupport means that the SEL supports Delete and Reserve
+	selOperationSupport = 0x0a
+	selOverflow         = 0x80
+	selEraseCompleted   = 0x01
+	selClearInitiate    = 0xaa
+
+	completionCodeReservationCanceled = completionCode(0xc5)
+)
+
+func (i *ipmi) handleIPMIStorage(message *ipmiMessage) ([]byte, error) {
+	switch message.Command {
+	case ipmiCmdGetSDRRepositoryInfo:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_SDR_REPOSITORY_INFO", map[string]interface{}{})
+		return i.handleIPMIGetSDRRepositoryInfo()
+	case ipmiCmdReserveSDRRepository:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_RESERVE_SDR_REPOSITORY", map[string]interface{}{})
+		return []byte{sdrReservationID & 0xff, sdrReservationID >> 8}, nil
+	case ipmiCmdGetSDR:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_SDR", map[string]interface{}{})
+		return i.handleIPMIGetSDR(message)
+	case ipmiCmdGetSELInfo:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_SEL_INFO", map[string]interface{}{})
+		return i.handleIPMIGetSELInfo()
+	case ipmiCmdReserveSEL:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_RESERVE_SEL", map[string]interface{}{})
+		id := i.session.bmc.SEL().reserve()
+		return []byte{uint8(id), uint8(id >> 8)}, nil
+	case ipmiCmdGetSELEntry:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_SEL_ENTRY", map[string]interface{}{})
+		return i.handleIPMIGetSELEntry(message)
+	case ipmiCmdAddSELEntry:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_ADD_SEL_ENTRY", map[string]interface{}{})
+		return i.handleIPMIAddSELEntry(message)
+	case ipmiCmdDeleteSELEntry:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_DELETE_SEL_ENTRY", map[string]interface{}{})
+		return i.handleIPMIDeleteSELEntry(message)
+	case ipmiCmdClearSEL:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_CLEAR_SEL", map[string]interface{}{})
+		return i.handleIPMIClearSEL(message)
+	case ipmiCmdGetSELTime:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_SEL_TIME", map[string]interface{}{})
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, uint32(time.Now().Unix()))
+		return buf, nil
+	case ipmiCmdSetSELTime:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_SET_SEL_TIME", map[string]interface{}{})
+		// accepted for compatibility, but the SEL always uses the clock of the host
+		return nil, nil
+	case ipmiCmdGetFRUInventoryAreaInfo:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_FRU_INVENTORY_AREA_INFO", map[string]interface{}{})
+		return i.handleIPMIGetFRUInventoryAreaInfo(message)
+	case ipmiCmdReadFRUData:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_READ_FRU_DATA", map[string]interface{}{})
+		return i.handleIPMIReadFRUData(message)
+	case ipmiCmdWriteFRUData:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_WRITE_FRU_DATA", map[string]interface{}{})
+	case ipmiCmdGetSDRRepositoryAlloc:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_SDR_REPOSITORY_ALLOC_INFO", map[string]interface{}{})
+	case ipmiCmdAddSDR:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_ADD_SDR", map[string]interface{}{})
+	case ipmiCmdClearSDRRepository:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_CLEAR_SDR_REPOSITORY", map[string]interface{}{})
+	case ipmiCmdGetSELAllocationInfo:
+		log.Info("      ipmi STORAGE: Command = IPMI_CMD_GET_SEL_ALLOCATION_INFO", map[string]interface{}{})
+	}
+
+	return nil, fmt.Errorf("unsupported Storage command: %x", message.Command)
+}
+
+type ipmiGetRepositoryInfoResponse struct {
+	Version      uint8
+	Entries      uint16
+	FreeSpace    uint16
+	LastAddition uint32
+	LastErase    uint32
+	Operations   uint8
+}
+
+type ipmiGetRecordRequest struct {
+	ReservationID uint16
+	RecordID      uint16
+	Offset        uint8
+	BytesToRead   uint8
+}
+
+type ipmiDeleteSELEntryRequest struct {
+	ReservationID uint16
+	RecordID      uint16
+}
+
+type ipmiClearSELRequest struct {
+	ReservationID uint16
+	Signature     [3]byte
+	Action        uint8
+}
+
+func writeResponse(response interface{}) ([]byte, error) {
+	dataBuf := bytes.Buffer{}
+	if err := binary.Write(&dataBuf, binary.LittleEndian, response); err != nil {
+		return nil, fmt.Errorf("failed to write %T: %w", response, err)
+	}
+	return dataBuf.Bytes(), nil
+}
+
+func readRecordRequest(message *ipmiMessage) (ipmiGetRecordRequest, error) {
+	request := ipmiGetRecordRequest{}
+	if err := binary.Read(bytes.NewReader(message.Data), binary.LittleEndian, &request); err != nil {
+		return request, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("failed to read ipmiGetRecordRequest: %w", err),
+		}
+	}
+	return request, nil
+}
+
+// recordResponse returns the next record ID and the requested part of the record
+func recordResponse(next uint16, record []byte, offset, length uint8) ([]byte, error) {
+	if int(offset) > len(record) {
+		return nil, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("offset out of the record: %d", offset),
+		}
+	}
+	end := len(record)
+	if length != sdrReadWholeRecord && int(offset)+int(length) < end {
+		end = int(offset) + int(length)
+	}
+	return append([]byte{uint8(next), uint8(next >> 8)}, record[offset:end]...), nil
+}
+
+func (i *ipmi) handleIPMIGetSDRRepositoryInfo() ([]byte, error) {
+	sensors := i.session.bmc.Sensors()
+	return writeResponse(ipmiGetRepositoryInfoResponse{
+		Version:      sdrVersion,
+		Entries:      uint16(len(sdrRecords(sensors.Sensors()))),
+		LastAddition: uint32(sensors.created.Unix()),
+		// the SDR repository cannot be modified
+		Operations: 0,
+	})
+}
+
+func (i *ipmi) handleIPMIGetSDR(message *ipmiMessage) ([]byte, error) {
+	request, err := readRecordRequest(message)
+	if err != nil {
+		return nil, err
+	}
+
+	records := sdrRecords(i.session.bmc.Sensors().Sensors())
+	index := int(request.RecordID) - 1
+	if request.RecordID == 0 {
+		index = 0
+	}
+	if index < 0 || index >= len(records) {
+		return nil, &ipmiError{
+			code: completionCodeRequestedDataNotPresent,
+			err:  fmt.Errorf("SDR not found: %d", request.RecordID),
+		}
+	}
+
+	next := uint16(index + 2)
+	if index+1 == len(records) {
+		next = sdrLastRecord
+	}
+	return recordResponse(next, records[index], request.Offset, request.BytesToRead)
+}
+
+// sdrRecords returns the SDRs of the sensors followed by the event-only sensors for the power events. The record IDs start from 1.
+func sdrRecords(sensors []Sensor) [][]byte {
+	var records [][]byte
+	for i := range sensors {
+		records = append(records, fullSensorRecord(uint16(len(records)+1), &sensors[i]))
+	}
+	records = append(records, eventOnlySensorRecord(uint16(len(records)+1), sensorNumberACPIPowerState, SensorTypeACPIPowerState, "ACPI State"))
+	records = append(records, eventOnlySensorRecord(uint16(len(records)+1), sensorNumberSystemRestart, SensorTypeSystemRestart, "Sys Restart"))
+	return records
+}
+
+func sdrHeader(id uint16, recordType uint8, body []byte) []byte {
+	return append([]byte{uint8(id), uint8(id >> 8), sdrVersion, recordType, uint8(len(body))}, body...)
+}
+
+// sdrIDString returns the type/length byte and the ID string, which is 8-bit ASCII up to 16 bytes
+func sdrIDString(name string) []byte {
+	if len(name) > 16 {
+		name = name[:16]
+	}
+	return append([]byte{0xc0 | uint8(len(name))}, name...)
+}
+
+// fullSensorRecord returns the Full Sensor Record of a threshold based sensor
+func fullSensorRecord(id uint16, s *Sensor) []byte {
+	mask := s.thresholdMask()
+	// the readings are linear as value = M * raw * 10^exponent
+	body := []byte{
+		sdrOwnerBMC, 0, s.Number,
+		sdrEntitySystemBoard, 1,
+		// sensor initialization: scanning and events enabled
+		0x63,
+		// sensor capabilities: auto re-arm and readable thresholds
+		0x44,
+		s.Type, EventReadingTypeThreshold,
+		// assertion and deassertion event masks are not used
+		0, 0, 0, 0,
+		// readable and settable threshold masks
+		mask, 0,
+		// analog data format unsigned, the base unit and no modifier unit
+		0, uint8(s.Unit), 0,
+		// linear
+		0,
+		uint8(s.m), uint8(s.m>>8) << 6,
+		0, 0, 0,
+		uint8(s.exponent) << 4,
+		// analog characteristic flags: nominal reading specified
+		0x01,
+		s.raw(s.Value), 0, 0,
+		// sensor maximum and minimum readings
+		0xff, 0,
+		// upper non-recoverable, upper critical and upper non-critical thresholds
+		0, s.raw(s.UpperCritical), s.raw(s.UpperNonCritical),
+		// lower non-recoverable, lower critical and lower non-critical thresholds
+		0, s.raw(s.LowerCritical), s.raw(s.LowerNonCritical),
+		// positive and negative hysteresis
+		0, 0,
+		// reserved and OEM
+		0, 0, 0,
+	}
+	body = append(body, sdrIDString(s.Name)...)
+	return sdrHeader(id, sdrRecordTypeFullSensor, body)
+}
+
+// eventOnlySensorRecord returns the Event-Only Record of a sensor which only generates events
+func eventOnlySensorRecord(id uint16, number, sensorType uint8, name string) []byte {
+	body := []byte{
+		sdrOwnerBMC, 0, number,
+		sdrEntitySystemBoard, 1,
+		sensorType, EventReadingTypeSensorSpecific,
+		// sensor direction, share count and entity instance sharing
+		0, 0, 0,
+		// reserved and OEM
+		0, 0,
+	}
+	body = append(body, sdrIDString(name)...)
+	return sdrHeader(id, sdrRecordTypeEventOnly, body)
+}
+
+func (i *ipmi) handleIPMIGetSELInfo() ([]byte, error) {
+	info := i.session.bmc.SEL().info()
+	operations := uint8(selOperationSupport)
+	if info.overflow {
+		operations |= selOverflow
+	}
+	return writeResponse(ipmiGetRepositoryInfoResponse{
+		Version:      sdrVersion,
+		Entries:      uint16(info.entries),
+		FreeSpace:    uint16((maxSELEntries - info.entries) * selEntrySize),
+		LastAddition: selTimestamp(info.lastAdded),
+		LastErase:    selTimestamp(info.lastErased),
+		Operations:   operations,
+	})
+}
+
+// selTimestamp returns the timestamp in SEL, where 0xffffffff means unspecified
+func selTimestamp(t time.Time) uint32 {
+	if t.IsZero() {
+		return 0xffffffff
+	}
+	return uint32(t.Unix())
+}
+
+func (i *ipmi) handleIPMIGetSELEntry(message *ipmiMessage) ([]byte, error) {
+	request, err := readRecordRequest(message)
+	if err != nil {
+		return nil, err
+	}
+
+	e, next, err := i.session.bmc.SEL().get(request.RecordID)
+	if err != nil {
+		return nil, &ipmiError{code: completionCodeRequestedDataNotPresent, err: err}
+	}
+	return recordResponse(next, e.encode(), request.Offset, request.BytesToRead)
+}
+
+func (i *ipmi) handleIPMIAddSELEntry(message *ipmiMessage) ([]byte, error) {
+	e, err := decodeSELEntry(message.Data)
+	if err != nil {
+		return nil, &ipmiError{code: completionCodeInvalidDataField, err: err}
+	}
+	e, err = i.session.bmc.SEL().Add(e)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{uint8(e.RecordID), uint8(e.RecordID >> 8)}, nil
+}
+
+func (i *ipmi) handleIPMIDeleteSELEntry(message *ipmiMessage) ([]byte, error) {
+	request := ipmiDeleteSELEntryRequest{}
+	if err := binary.Read(bytes.NewReader(message.Data), binary.LittleEndian, &request); err != nil {
+		return nil, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("failed to read ipmiDeleteSELEntryRequest: %w", err),
+		}
+	}
+
+	sel := i.session.bmc.SEL()
+	if !sel.validReservation(request.ReservationID) {
+		return nil, &ipmiError{
+			code: completionCodeReservationCanceled,
+			err:  fmt.Errorf("invalid SEL reservation: %d", request.ReservationID),
+		}
+	}
+	id, err := sel.delete(request.RecordID)
+	if errors.Is(err, errSELEntryNotFound) {
+		return nil, &ipmiError{code: completionCodeRequestedDataNotPresent, err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte{uint8(id), uint8(id >> 8)}, nil
+}
+
+func (i *ipmi) handleIPMIClearSEL(message *ipmiMessage) ([]byte, error) {
+	request := ipmiClearSELRequest{}
+	if err := binary.Read(bytes.NewReader(message.Data), binary.LittleEndian, &request); err != nil {
+		return nil, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("failed to read ipmiClearSELRequest: %w", err),
+		}
+	}
+	if string(request.Signature[:]) != "CLR" {
+		return nil, &ipmiError{
+			code: completionCodeInvalidDataField,
+			err:  fmt.Errorf("invalid signature: %q", request.Signature[:]),
+		}
+	}
+
+	sel := i.session.bmc.SEL()
+	if !sel.validReservation(request.ReservationID) {
+		return nil, &ipmiError{
+			code: completionCodeReservationCanceled,
+			err:  fmt.Errorf("invalid SEL reservation: %d", request.ReservationID),
+		}
+	}
+	// the erasure completes immediately, so that getting the status just reports the completion
+	if request.Action == selClearInitiate {
+		if err := sel.Clear(); err != nil {
+			return nil, err
+		}
+	}
+	return []byte{selEraseCompleted}, nil
+}
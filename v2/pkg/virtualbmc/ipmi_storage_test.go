@@ -0,0 +1,124 @@
+package virtualbmc
+
+import (
+	"encoding/binary"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IPMI sensors", func() {
+	var (
+		client *rmcpPlusClient
+		bmc    *BMCMock
+	)
+
+	BeforeEach(func() {
+		client = newRMCPPlusClient(&MachineMock{status: PowerStatusOn})
+		bmc = client.holder.bmc.(*BMCMock)
+		client.activate(supportedCipherSuites[len(supportedCipherSuites)-1])
+	})
+
+	It("should serve the SDR repository", func() {
+		code, data := client.command(ipmiNetFNStorage, ipmiCmdGetSDRRepositoryInfo)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data[0]).To(Equal(uint8(sdrVersion)))
+		entries := int(binary.LittleEndian.Uint16(data[1:]))
+		Expect(entries).To(Equal(len(defaultSensors) + 2))
+
+		By("walking through the records")
+		var records [][]byte
+		id := uint16(0)
+		for id != sdrLastRecord {
+			code, data := client.command(ipmiNetFNStorage, ipmiCmdGetSDR, 0, 0, uint8(id), uint8(id>>8), 0, sdrReadWholeRecord)
+			Expect(code).To(Equal(completionCodeOK))
+			id = binary.LittleEndian.Uint16(data)
+			records = append(records, data[2:])
+		}
+		Expect(records).To(HaveLen(entries))
+		Expect(records[0][3]).To(Equal(uint8(sdrRecordTypeFullSensor)))
+		Expect(int(records[0][4])).To(Equal(len(records[0]) - sdrRecordHeaderLength))
+		Expect(string(records[0][len(records[0])-len("Inlet Temp"):])).To(Equal("Inlet Temp"))
+		Expect(records[entries-1][3]).To(Equal(uint8(sdrRecordTypeEventOnly)))
+
+		By("reading a part of a record")
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdGetSDR, 0, 0, 1, 0, 2, 3)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{2, 0, sdrVersion, sdrRecordTypeFullSensor, records[0][4]}))
+
+		code, _ = client.command(ipmiNetFNStorage, ipmiCmdGetSDR, 0, 0, 100, 0, 0, sdrReadWholeRecord)
+		Expect(code).To(Equal(completionCodeRequestedDataNotPresent))
+	})
+
+	It("should log threshold events in the SEL", func() {
+		code, data := client.command(ipmiNetFNSensorEvent, ipmiCmdGetSensorReading, 0x01)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{23, sensorReadingEventMessagesEnabled | sensorReadingScanningEnabled, 0}))
+
+		Expect(bmc.Sensors().SetValue("Inlet Temp", 50)).To(Succeed())
+		code, data = client.command(ipmiNetFNSensorEvent, ipmiCmdGetSensorReading, 0x01)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data[2]).To(Equal(uint8(thresholdMaskUpperNonCritical | thresholdMaskUpperCritical)))
+
+		entries := bmc.SEL().Entries()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[1].Message()).To(Equal("Temperature sensor #1: Upper Critical going high asserted"))
+		Expect(entries[1].EventData).To(Equal([3]uint8{0x59, 50, 47}))
+
+		Expect(bmc.Sensors().SetValue("Inlet Temp", 23)).To(Succeed())
+		entries = bmc.SEL().Entries()
+		Expect(entries).To(HaveLen(4))
+		Expect(entries[3].Deassertion).To(BeTrue())
+
+		Expect(bmc.Sensors().SetValue("Unknown", 1)).NotTo(Succeed())
+		code, _ = client.command(ipmiNetFNSensorEvent, ipmiCmdGetSensorReading, 0x99)
+		Expect(code).To(Equal(completionCodeRequestedDataNotPresent))
+	})
+
+	It("should manage the SEL", func() {
+		By("adding entries")
+		code, data := client.command(ipmiNetFNSensorEvent, ipmiCmdPlatformEvent, selEvMRev, SensorTypeFan, 0x03, EventReadingTypeThreshold, 0x52, 0x03, 0x05)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(BeEmpty())
+		record := SELEntry{SensorType: SensorTypeSystemRestart, SensorNumber: 0x31, EventType: EventReadingTypeSensorSpecific, EventData: [3]uint8{1, 0xff, 0xff}}.encode()
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdAddSELEntry, record...)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{2, 0}))
+
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdGetSELInfo)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(binary.LittleEndian.Uint16(data[1:])).To(Equal(uint16(2)))
+
+		By("reading the entries")
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdGetSELEntry, 0, 0, 0, 0, 0, sdrReadWholeRecord)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data[:2]).To(Equal([]byte{2, 0}))
+		e, err := decodeSELEntry(data[2:])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(e.GeneratorID).To(Equal(uint16(0x81)))
+		Expect(e.Severity()).To(Equal("Critical"))
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdGetSELEntry, 0, 0, 2, 0, 0, sdrReadWholeRecord)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data[:2]).To(Equal([]byte{0xff, 0xff}))
+
+		By("requiring a reservation to delete entries")
+		code, _ = client.command(ipmiNetFNStorage, ipmiCmdDeleteSELEntry, 1, 0, 1, 0)
+		Expect(code).To(Equal(completionCodeReservationCanceled))
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdReserveSEL)
+		Expect(code).To(Equal(completionCodeOK))
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdDeleteSELEntry, data[0], data[1], 1, 0)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{1, 0}))
+		Expect(bmc.SEL().Entries()).To(HaveLen(1))
+
+		By("clearing the SEL")
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdReserveSEL)
+		Expect(code).To(Equal(completionCodeOK))
+		code, data = client.command(ipmiNetFNStorage, ipmiCmdClearSEL, data[0], data[1], 'C', 'L', 'R', selClearInitiate)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(data).To(Equal([]byte{selEraseCompleted}))
+		Expect(bmc.SEL().Entries()).To(BeEmpty())
+		code, _ = client.command(ipmiNetFNStorage, ipmiCmdGetSELEntry, 0, 0, 0, 0, 0, sdrReadWholeRecord)
+		Expect(code).To(Equal(completionCodeRequestedDataNotPresent))
+	})
+})
@@ -7,8 +7,16 @@ import (
 )
 
 type redfishServer struct {
-	machine   Machine
-	systemIDs map[string]struct{}
+	machine    Machine
+	bmc        BMC
+	users      *UserHolder
+	sessions   *redfishSessionHolder
+	events     *EventDispatcher
+	systemIDs  map[string]struct{}
+	managerIDs map[string]struct{}
+	profile    *vendorProfile
+	// router serves the internal requests to expand hyperlinks
+	router http.Handler
 }
 
 // OdataID represents the unique identifier for a resource
@@ -33,6 +41,7 @@ type ServiceRoot struct {
 	Name                      string                    `json:"Name"`
 	Oem                       ServiceRootOem            `json:"Oem"`
 	Product                   string                    `json:"Product"`
+	Vendor                    string                    `json:"Vendor,omitempty"`
 	ProtocolFeaturesSupported ProtocolFeaturesSupported `json:"ProtocolFeaturesSupported"`
 	RedfishVersion            string                    `json:"RedfishVersion"`
 	Registries                OdataID                   `json:"Registries"`
@@ -107,8 +116,6 @@ type MessageExtendedInfo struct {
 	Severity                    string        `json:"Severity"`
 }
 
-const systemID = "System.Embedded.1"
-
 type ResetType string
 
 const (
@@ -118,6 +125,7 @@ const (
 	ResetTypeGracefulShutdown = ResetType("GracefulShutdown")
 	ResetTypePushPowerButton  = ResetType("PushPowerButton")
 	ResetTypeNmi              = ResetType("Nmi")
+	ResetTypeGracefulRestart  = ResetType("GracefulRestart")
 )
 
 var serviceRootResponse = ServiceRoot{
@@ -125,14 +133,14 @@ var serviceRootResponse = ServiceRoot{
 	OdataID:      "/redfish/v1",
 	OdataType:    "#ServiceRoot.v1_3_0.ServiceRoot",
 	AccountService: OdataID{
-		OdataID: "/redfish/v1/Managers/Embedded.1/AccountService",
+		OdataID: accountServiceOdataID,
 	},
 	Chassis: OdataID{
 		OdataID: "/redfish/v1/Chassis",
 	},
 	Description: "Root Service",
 	EventService: OdataID{
-		OdataID: "/redfish/v1/EventService",
+		OdataID: eventServiceOdataID,
 	},
 	Fabrics: OdataID{
 		OdataID: "/redfish/v1/Fabrics",
@@ -143,15 +151,14 @@ var serviceRootResponse = ServiceRoot{
 	},
 	Links: ServiceRootLinks{
 		Sessions: OdataID{
-			OdataID: "/redfish/v1/Sessions",
+			OdataID: sessionsOdataID,
 		},
 	},
 	Managers: OdataID{
 		OdataID: "/redfish/v1/Managers",
 	},
-	Name:    "Root Service",
-	Oem:     ServiceRootOem{},
-	Product: "Placemat",
+	Name: "Root Service",
+	Oem:  ServiceRootOem{},
 	ProtocolFeaturesSupported: ProtocolFeaturesSupported{
 		ExpandQuery: ExpandQuery{
 			ExpandAll: true,
@@ -168,7 +175,7 @@ var serviceRootResponse = ServiceRoot{
 		OdataID: "/redfish/v1/Registries",
 	},
 	SessionService: OdataID{
-		OdataID: "/redfish/v1/SessionService",
+		OdataID: sessionServiceOdataID,
 	},
 	Systems: OdataID{
 		OdataID: "/redfish/v1/Systems",
@@ -181,13 +188,36 @@ var serviceRootResponse = ServiceRoot{
 	},
 }
 
-func newRedfishServer(machine Machine) *redfishServer {
+// redfishOptions represents the dependencies of a Redfish server
+type redfishOptions struct {
+	machine Machine
+	bmc     BMC
+	users   *UserHolder
+	// events is the event dispatcher of the BMC. If nil, the events are never delivered.
+	events *EventDispatcher
+}
+
+func newRedfishServer(opts redfishOptions) *redfishServer {
+	profile := vendorProfileOf(opts.bmc)
+	events := opts.events
+	if events == nil {
+		events = NewEventDispatcher(profile.name)
+	}
 	return &redfishServer{
-		machine:   machine,
-		systemIDs: map[string]struct{}{systemID: {}},
+		machine:    opts.machine,
+		bmc:        opts.bmc,
+		users:      opts.users,
+		sessions:   newRedfishSessionHolder(),
+		events:     events,
+		systemIDs:  map[string]struct{}{profile.systemID: {}},
+		managerIDs: map[string]struct{}{profile.managerID: {}},
+		profile:    profile,
 	}
 }
 
-func handleServiceRoot(c *gin.Context) {
-	c.JSON(http.StatusOK, serviceRootResponse)
+func (r *redfishServer) handleServiceRoot(c *gin.Context) {
+	root := serviceRootResponse
+	root.Product = r.profile.product
+	root.Vendor = r.profile.vendor
+	c.JSON(http.StatusOK, root)
 }
@@ -0,0 +1,390 @@
+package virtualbmc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountService represents AccountService resource
+type AccountService struct {
+	OdataContext      string  `json:"@odata.context"`
+	OdataID           string  `json:"@odata.id"`
+	OdataType         string  `json:"@odata.type"`
+	Accounts          OdataID `json:"Accounts"`
+	Description       string  `json:"Description"`
+	ID                string  `json:"Id"`
+	MaxPasswordLength int     `json:"MaxPasswordLength"`
+	Name              string  `json:"Name"`
+	Roles             OdataID `json:"Roles"`
+	ServiceEnabled    bool    `json:"ServiceEnabled"`
+}
+
+// ManagerAccount represents ManagerAccount resource
+type ManagerAccount struct {
+	OdataContext string              `json:"@odata.context"`
+	OdataID      string              `json:"@odata.id"`
+	OdataType    string              `json:"@odata.type"`
+	Description  string              `json:"Description"`
+	Enabled      bool                `json:"Enabled"`
+	ID           string              `json:"Id"`
+	Links        ManagerAccountLinks `json:"Links"`
+	Locked       bool                `json:"Locked"`
+	Name         string              `json:"Name"`
+	Password     *string             `json:"Password"`
+	RoleID       RoleID              `json:"RoleId"`
+	UserName     string              `json:"UserName"`
+}
+
+// ManagerAccountLinks represents ManagerAccount resource's Links field
+type ManagerAccountLinks struct {
+	Role OdataID `json:"Role"`
+}
+
+// ManagerAccountRequestBody represents the request body to create or update a ManagerAccount resource
+type ManagerAccountRequestBody struct {
+	UserName *string `json:"UserName,omitempty"`
+	Password *string `json:"Password,omitempty"`
+	RoleID   *RoleID `json:"RoleId,omitempty"`
+	Enabled  *bool   `json:"Enabled,omitempty"`
+}
+
+// Role represents Role resource
+type Role struct {
+	OdataContext       string   `json:"@odata.context"`
+	OdataID            string   `json:"@odata.id"`
+	OdataType          string   `json:"@odata.type"`
+	AssignedPrivileges []string `json:"AssignedPrivileges"`
+	Description        string   `json:"Description"`
+	ID                 string   `json:"Id"`
+	IsPredefined       bool     `json:"IsPredefined"`
+	Name               string   `json:"Name"`
+	RoleID             RoleID   `json:"RoleId"`
+}
+
+// RoleID represents the role of a Redfish account, which corresponds to an IPMI privilege level
+type RoleID string
+
+const (
+	RoleIDAdministrator = RoleID("Administrator")
+	RoleIDOperator      = RoleID("Operator")
+	RoleIDReadOnly      = RoleID("ReadOnly")
+	RoleIDNoAccess      = RoleID("NoAccess")
+)
+
+var roles = []struct {
+	id         RoleID
+	privilege  Privilege
+	privileges []string
+}{
+	{RoleIDAdministrator, PrivilegeAdministrator, []string{"Login", "ConfigureManager", "ConfigureUsers", "ConfigureSelf", "ConfigureComponents"}},
+	{RoleIDOperator, PrivilegeOperator, []string{"Login", "ConfigureSelf", "ConfigureComponents"}},
+	{RoleIDReadOnly, PrivilegeUser, []string{"Login", "ConfigureSelf"}},
+	{RoleIDNoAccess, PrivilegeNoAccess, []string{}},
+}
+
+// roleOf returns the Redfish role of the privilege level.
+// The callback level is not allowed to log in to Redfish, so it is NoAccess.
+func roleOf(p Privilege) RoleID {
+	for _, r := range roles {
+		if r.privilege == p {
+			return r.id
+		}
+	}
+	return RoleIDNoAccess
+}
+
+func privilegeOf(id RoleID) (Privilege, error) {
+	for _, r := range roles {
+		if r.id == id {
+			return r.privilege, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported RoleId: %s", id)
+}
+
+const (
+	accountServiceOdataID = "/redfish/v1/AccountService"
+	accountsOdataID       = accountServiceOdataID + "/Accounts"
+	rolesOdataID          = accountServiceOdataID + "/Roles"
+
+	// contextKeyUser is the key of gin.Context to store the authenticated user
+	contextKeyUser = "user"
+)
+
+// authenticate is a middleware to authenticate users by a session token or basic authentication
+func (r *redfishServer) authenticate(c *gin.Context) {
+	if token := c.GetHeader(headerAuthToken); token != "" {
+		if u, ok := r.authenticateSession(token); ok && u.Privilege.allows(PrivilegeUser) {
+			c.Set(contextKeyUser, u)
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
+		return
+	}
+
+	name, password, ok := c.Request.BasicAuth()
+	if ok {
+		if u, ok := r.users.authenticate(name, password); ok && u.Privilege.allows(PrivilegeUser) {
+			c.Set(contextKeyUser, u)
+			c.Next()
+			return
+		}
+	}
+
+	c.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// requirePrivilege returns a middleware to reject users without the privilege level
+func requirePrivilege(p Privilege) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentUser(c).Privilege.allows(p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient privilege"})
+		}
+	}
+}
+
+func currentUser(c *gin.Context) bmcUser {
+	return c.MustGet(contextKeyUser).(bmcUser)
+}
+
+func handleAccountService(c *gin.Context) {
+	c.JSON(http.StatusOK, AccountService{
+		OdataContext:      "/redfish/v1/$metadata#AccountService.AccountService",
+		OdataID:           accountServiceOdataID,
+		OdataType:         "#AccountService.v1_5_0.AccountService",
+		Accounts:          OdataID{OdataID: accountsOdataID},
+		Description:       "BMC User Accounts",
+		ID:                "AccountService",
+		MaxPasswordLength: maxPasswordLength,
+		Name:              "Account Service",
+		Roles:             OdataID{OdataID: rolesOdataID},
+		ServiceEnabled:    true,
+	})
+}
+
+func (r *redfishServer) handleAccountCollection(c *gin.Context) {
+	users := r.users.list()
+	members := make([]OdataID, len(users))
+	for i, u := range users {
+		members[i] = OdataID{OdataID: fmt.Sprintf("%s/%d", accountsOdataID, u.ID)}
+	}
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#ManagerAccountCollection.ManagerAccountCollection",
+		OdataID:           accountsOdataID,
+		OdataType:         "#ManagerAccountCollection.ManagerAccountCollection",
+		Description:       "BMC User Accounts Collection",
+		Members:           members,
+		MembersOdataCount: len(members),
+		Name:              "Accounts Collection",
+	})
+}
+
+func (r *redfishServer) handleAccount(c *gin.Context) {
+	u, ok := r.findAccount(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, createManagerAccountResponse(u))
+}
+
+func (r *redfishServer) handleAccountCreate(c *gin.Context) {
+	var json ManagerAccountRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if json.UserName == nil || json.Password == nil || json.RoleID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "UserName, Password and RoleId are required"})
+		return
+	}
+	privilege, err := privilegeOf(*json.RoleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	enabled := true
+	if json.Enabled != nil {
+		enabled = *json.Enabled
+	}
+
+	id, err := r.users.createUser(User{Name: *json.UserName, Password: *json.Password, Privilege: privilege}, enabled)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, err := r.users.user(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := createManagerAccountResponse(u)
+	c.Header("Location", res.OdataID)
+	c.JSON(http.StatusCreated, res)
+}
+
+func (r *redfishServer) handleAccountPatch(c *gin.Context) {
+	u, ok := r.findAccount(c)
+	if !ok {
+		return
+	}
+
+	var json ManagerAccountRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// users other than administrators can only change their own passwords
+	current := currentUser(c)
+	if !current.Privilege.allows(PrivilegeAdministrator) {
+		if current.ID != u.ID || json.UserName != nil || json.RoleID != nil || json.Enabled != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient privilege"})
+			return
+		}
+	}
+
+	if err := r.applyAccountPatch(u.ID, &json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := r.users.user(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, createManagerAccountResponse(u))
+}
+
+func (r *redfishServer) applyAccountPatch(id uint8, patch *ManagerAccountRequestBody) error {
+	var privilege Privilege
+	if patch.RoleID != nil {
+		p, err := privilegeOf(*patch.RoleID)
+		if err != nil {
+			return err
+		}
+		privilege = p
+	}
+	if patch.UserName != nil && *patch.UserName == "" {
+		return errors.New("UserName must not be empty")
+	}
+	if patch.Password != nil && len(*patch.Password) > maxPasswordLength {
+		return errors.New("password is too long")
+	}
+
+	if patch.UserName != nil {
+		if err := r.users.setUserName(id, *patch.UserName); err != nil {
+			return err
+		}
+	}
+	if patch.Password != nil {
+		if err := r.users.setUserPassword(id, *patch.Password); err != nil {
+			return err
+		}
+	}
+	if patch.RoleID != nil {
+		if err := r.users.setUserPrivilege(id, privilege); err != nil {
+			return err
+		}
+	}
+	if patch.Enabled != nil {
+		if err := r.users.setUserEnabled(id, *patch.Enabled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *redfishServer) handleAccountDelete(c *gin.Context) {
+	u, ok := r.findAccount(c)
+	if !ok {
+		return
+	}
+
+	if err := r.users.setUserName(u.ID, ""); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// findAccount returns the user of the account ID in the URL, or responds 404 Not Found
+func (r *redfishServer) findAccount(c *gin.Context) (bmcUser, bool) {
+	id := c.Param("id")
+	n, err := strconv.ParseUint(id, 10, 8)
+	if err == nil && n > nullUserID {
+		u, err := r.users.user(uint8(n))
+		if err == nil && u.Username != "" {
+			return u, true
+		}
+	}
+
+	c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+	return bmcUser{}, false
+}
+
+func createManagerAccountResponse(u bmcUser) ManagerAccount {
+	role := roleOf(u.Privilege)
+	return ManagerAccount{
+		OdataContext: "/redfish/v1/$metadata#ManagerAccount.ManagerAccount",
+		OdataID:      fmt.Sprintf("%s/%d", accountsOdataID, u.ID),
+		OdataType:    "#ManagerAccount.v1_4_0.ManagerAccount",
+		Description:  "User Account",
+		Enabled:      u.Enabled,
+		ID:           strconv.Itoa(int(u.ID)),
+		Links: ManagerAccountLinks{
+			Role: OdataID{OdataID: fmt.Sprintf("%s/%s", rolesOdataID, role)},
+		},
+		Locked:   false,
+		Name:     "User Account",
+		Password: nil,
+		RoleID:   role,
+		UserName: u.Username,
+	}
+}
+
+func handleRoleCollection(c *gin.Context) {
+	members := make([]OdataID, len(roles))
+	for i, r := range roles {
+		members[i] = OdataID{OdataID: fmt.Sprintf("%s/%s", rolesOdataID, r.id)}
+	}
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#RoleCollection.RoleCollection",
+		OdataID:           rolesOdataID,
+		OdataType:         "#RoleCollection.RoleCollection",
+		Description:       "BMC User Roles",
+		Members:           members,
+		MembersOdataCount: len(members),
+		Name:              "Roles Collection",
+	})
+}
+
+func (r *redfishServer) handleRole(c *gin.Context) {
+	id := c.Param("id")
+	for _, role := range roles {
+		if string(role.id) != id {
+			continue
+		}
+		c.JSON(http.StatusOK, Role{
+			OdataContext:       "/redfish/v1/$metadata#Role.Role",
+			OdataID:            fmt.Sprintf("%s/%s", rolesOdataID, role.id),
+			OdataType:          "#Role.v1_2_1.Role",
+			AssignedPrivileges: role.privileges,
+			Description:        fmt.Sprintf("%s User Role", role.id),
+			ID:                 string(role.id),
+			IsPredefined:       true,
+			Name:               "User Role",
+			RoleID:             role.id,
+		})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+}
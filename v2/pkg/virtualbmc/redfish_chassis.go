@@ -106,27 +106,25 @@ type PhysicalSecurity struct {
 	IntrusionSensorReArm  string `json:"IntrusionSensorReArm"`
 }
 
-var chassisCollectionResponse = ResourceCollection{
-	OdataContext: "/redfish/v1/$metadata#ChassisCollection.ChassisCollection",
-	OdataID:      "/redfish/v1/Chassis/",
-	OdataType:    "#ChassisCollection.ChassisCollection",
-	Description:  "Collection of Chassis",
-	Members: []OdataID{
-		{OdataID: fmt.Sprintf("/redfish/v1/Chassis/%s", systemID)},
-	},
-	MembersOdataCount: 1,
-	Name:              "Chassis Collection",
-}
-
-func handleChassisCollection(c *gin.Context) {
-	c.JSON(http.StatusOK, chassisCollectionResponse)
+func (r *redfishServer) handleChassisCollection(c *gin.Context) {
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext: "/redfish/v1/$metadata#ChassisCollection.ChassisCollection",
+		OdataID:      "/redfish/v1/Chassis/",
+		OdataType:    "#ChassisCollection.ChassisCollection",
+		Description:  "Collection of Chassis",
+		Members: []OdataID{
+			{OdataID: fmt.Sprintf("/redfish/v1/Chassis/%s", r.profile.systemID)},
+		},
+		MembersOdataCount: 1,
+		Name:              "Chassis Collection",
+	})
 }
 
 func (r *redfishServer) handleChassis(c *gin.Context) {
 	id := c.Param("id")
 	_, ok := r.systemIDs[id]
 	if !ok {
-		c.JSON(http.StatusNotFound, createChassisNotFoundErrorResponse(id))
+		c.JSON(http.StatusNotFound, r.profile.createChassisNotFoundErrorResponse(id))
 		return
 	}
 
@@ -135,22 +133,24 @@ func (r *redfishServer) handleChassis(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, nil)
 		return
 	}
+	inv, err := r.machine.Inventory()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
 
-	c.JSON(http.StatusOK, createChassisResponse(id, status))
+	c.JSON(http.StatusOK, createChassisResponse(id, r.profile.managerID, status, inv))
 }
 
-func createChassisResponse(chassisID string, powerState PowerStatus) Chassis {
+func createChassisResponse(chassisID, managerID string, powerState PowerStatus, inv Inventory) Chassis {
 	return Chassis{
 		OdataContext: "/redfish/v1/$metadata#Chassis.Chassis",
 		OdataID:      fmt.Sprintf("/redfish/v1/Chassis/%s", chassisID),
 		OdataType:    "#Chassis.v1_6_0.Chassis",
 		Actions: ChassisActions{
 			ChassisReset: ChassisReset{
-				ResetTypeRedfishAllowableValues: []ResetType{
-					ResetTypeOn,
-					ResetTypeForceOff,
-				},
-				Target: fmt.Sprintf("/redfish/v1/Chassis/%s/Actions/Chassis.Reset", chassisID),
+				ResetTypeRedfishAllowableValues: machineResetTypes,
+				Target:                          fmt.Sprintf("/redfish/v1/Chassis/%s/Actions/Chassis.Reset", chassisID),
 			},
 		},
 		Assembly: OdataID{
@@ -183,13 +183,13 @@ func createChassisResponse(chassisID string, powerState PowerStatus) Chassis {
 			DrivesOdataCount:   0,
 			ManagedBy: []OdataID{
 				{
-					OdataID: "/redfish/v1/Managers/1",
+					OdataID: managerOdataID(managerID),
 				},
 			},
 			ManagedByOdataCount: 1,
 			ManagersInChassis: []OdataID{
 				{
-					OdataID: "/redfish/v1/Managers/1",
+					OdataID: managerOdataID(managerID),
 				},
 			},
 			ManagersInChassisOdataCount: 1,
@@ -207,7 +207,7 @@ func createChassisResponse(chassisID string, powerState PowerStatus) Chassis {
 			PoweredByOdataCount: 1,
 			Storage: []OdataID{
 				{
-					OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/Storage/CPU.1", chassisID),
+					OdataID: storageOdataID(chassisID, storageID),
 				},
 			},
 			StorageOdataCount: 1,
@@ -224,8 +224,8 @@ func createChassisResponse(chassisID string, powerState PowerStatus) Chassis {
 				Room:     "",
 			},
 		},
-		Manufacturer: "Placemat Inc.",
-		Model:        "Placemat XXX",
+		Manufacturer: inv.Manufacturer,
+		Model:        inv.Model,
 		Name:         "Computer System Chassis",
 		NetworkAdapters: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/NetworkAdapters", chassisID),
@@ -241,7 +241,7 @@ func createChassisResponse(chassisID string, powerState PowerStatus) Chassis {
 		},
 		PowerState:   powerState,
 		SKU:          "XXXXXX",
-		SerialNumber: "XXXXXX",
+		SerialNumber: inv.SerialNumber,
 		Status: MachineStatus{
 			Health:       "OK",
 			HealthRollup: "OK",
@@ -253,34 +253,32 @@ func createChassisResponse(chassisID string, powerState PowerStatus) Chassis {
 	}
 }
 
-func createChassisNotFoundErrorResponse(chassisID string) ErrorResponse {
-	return ErrorResponse{
-		Error: Error{
-			MessageExtendedInfo: []MessageExtendedInfo{
-				{
-					Message:                     fmt.Sprintf("Unable to complete the operation because the resource %s entered in not found.", chassisID),
-					MessageArgs:                 []string{chassisID},
-					MessageArgsOdataCount:       1,
-					MessageID:                   "X.X.X",
-					RelatedProperties:           []interface{}{},
-					RelatedPropertiesOdataCount: 0,
-					Resolution:                  "Enter the correct resource and retry the operation. For information about valid resource, see the Redfish Users Guide available on the support site.",
-					Severity:                    "Critical",
-				},
-				{
-					Message:                     fmt.Sprintf("The resource at the URI %s was not found.", chassisID),
-					MessageArgs:                 []string{chassisID},
-					MessageArgsOdataCount:       1,
-					MessageID:                   "Base.X.X.ResourceMissingAtURI",
-					RelatedProperties:           []interface{}{""},
-					RelatedPropertiesOdataCount: 1,
-					Resolution:                  "Place a valid resource at the URI or correct the URI and resubmit the request.",
-					Severity:                    "Critical",
-				},
-			},
-			Code:    "Base.X.X.GeneralError",
-			Message: "A general error has occurred. See ExtendedInfo for more information",
-		}}
+// createChassisNotFoundErrorResponse creates the response for a missing chassis, which includes the vendor specific message if any
+func (v *vendorProfile) createChassisNotFoundErrorResponse(chassisID string) ErrorResponse {
+	var infos []MessageExtendedInfo
+	if v.resourceMissingMessageID != "" {
+		infos = append(infos, MessageExtendedInfo{
+			Message:                     fmt.Sprintf("Unable to complete the operation because the resource %s entered in not found.", chassisID),
+			MessageArgs:                 []string{chassisID},
+			MessageArgsOdataCount:       1,
+			MessageID:                   v.resourceMissingMessageID,
+			RelatedProperties:           []interface{}{},
+			RelatedPropertiesOdataCount: 0,
+			Resolution:                  "Enter the correct resource and retry the operation. For information about valid resource, see the Redfish Users Guide available on the support site.",
+			Severity:                    "Critical",
+		})
+	}
+	infos = append(infos, MessageExtendedInfo{
+		Message:                     fmt.Sprintf("The resource at the URI %s was not found.", chassisID),
+		MessageArgs:                 []string{chassisID},
+		MessageArgsOdataCount:       1,
+		MessageID:                   v.baseRegistry + ".ResourceMissingAtURI",
+		RelatedProperties:           []interface{}{""},
+		RelatedPropertiesOdataCount: 1,
+		Resolution:                  "Place a valid resource at the URI or correct the URI and resubmit the request.",
+		Severity:                    "Critical",
+	})
+	return v.errorResponse(infos...)
 }
 
 func (r *redfishServer) handleChassisActionsReset(c *gin.Context) {
@@ -290,42 +288,6 @@ func (r *redfishServer) handleChassisActionsReset(c *gin.Context) {
 		return
 	}
 
-	resetType := json.ResetType
-	if resetType != ResetTypeOn && resetType != ResetTypeForceOff {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ""})
-		return
-	}
-
-	switch resetType {
-	case ResetTypeOn:
-		powerStatus, err := r.machine.PowerStatus()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, nil)
-			return
-		}
-		if powerStatus == PowerStatusOn || powerStatus == PowerStatusPoweringOn {
-			c.JSON(http.StatusConflict, nil)
-			return
-		}
-		if err := r.machine.PowerOn(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	case ResetTypeForceOff:
-		powerStatus, err := r.machine.PowerStatus()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, nil)
-			return
-		}
-		if powerStatus == PowerStatusOff || powerStatus == PowerStatusPoweringOff {
-			c.JSON(http.StatusConflict, nil)
-			return
-		}
-		if err := r.machine.PowerOff(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	}
-
-	c.JSON(http.StatusNoContent, nil)
+	// the chassis contains only the machine, so resetting the chassis resets the machine
+	r.resetMachine(c, json.ResetType)
 }
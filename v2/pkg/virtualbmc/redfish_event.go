@@ -0,0 +1,559 @@
+package virtualbmc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/gin-gonic/gin"
+)
+
+// EventService represents EventService resource
+type EventService struct {
+	OdataContext                 string              `json:"@odata.context"`
+	OdataID                      string              `json:"@odata.id"`
+	OdataType                    string              `json:"@odata.type"`
+	Actions                      EventServiceActions `json:"Actions"`
+	DeliveryRetryAttempts        int                 `json:"DeliveryRetryAttempts"`
+	DeliveryRetryIntervalSeconds int                 `json:"DeliveryRetryIntervalSeconds"`
+	Description                  string              `json:"Description"`
+	EventTypesForSubscription    []EventType         `json:"EventTypesForSubscription"`
+	ID                           string              `json:"Id"`
+	Name                         string              `json:"Name"`
+	ServiceEnabled               bool                `json:"ServiceEnabled"`
+	Status                       Status              `json:"Status"`
+	Subscriptions                OdataID             `json:"Subscriptions"`
+}
+
+// EventServiceActions represents EventService's Actions field
+type EventServiceActions struct {
+	SubmitTestEvent EventServiceSubmitTestEvent `json:"#EventService.SubmitTestEvent"`
+}
+
+// EventServiceSubmitTestEvent represents EventService's SubmitTestEvent field
+type EventServiceSubmitTestEvent struct {
+	EventTypeRedfishAllowableValues []EventType `json:"EventType@Redfish.AllowableValues"`
+	Target                          string      `json:"target"`
+}
+
+// EventDestination represents EventDestination resource
+type EventDestination struct {
+	OdataContext string      `json:"@odata.context"`
+	OdataID      string      `json:"@odata.id"`
+	OdataType    string      `json:"@odata.type"`
+	Context      string      `json:"Context"`
+	Description  string      `json:"Description"`
+	Destination  string      `json:"Destination"`
+	EventTypes   []EventType `json:"EventTypes"`
+	ID           string      `json:"Id"`
+	Name         string      `json:"Name"`
+	Protocol     string      `json:"Protocol"`
+}
+
+// EventDestinationRequestBody represents the request body to create EventDestination resource
+type EventDestinationRequestBody struct {
+	Context     string      `json:"Context"`
+	Destination string      `json:"Destination"`
+	EventTypes  []EventType `json:"EventTypes"`
+	Protocol    string      `json:"Protocol"`
+}
+
+// SubmitTestEventRequestBody represents the request body of SubmitTestEvent action
+type SubmitTestEventRequestBody struct {
+	EventType EventType `json:"EventType"`
+	MessageID string    `json:"MessageId"`
+	Message   string    `json:"Message"`
+	Severity  string    `json:"Severity"`
+}
+
+// EventRecord represents an event in the Events field of Event
+type EventRecord struct {
+	EventID           string    `json:"EventId"`
+	EventTimestamp    time.Time `json:"EventTimestamp"`
+	EventType         EventType `json:"EventType"`
+	MemberID          string    `json:"MemberId"`
+	Message           string    `json:"Message"`
+	MessageArgs       []string  `json:"MessageArgs"`
+	MessageID         string    `json:"MessageId"`
+	OriginOfCondition OdataID   `json:"OriginOfCondition"`
+	Severity          string    `json:"Severity"`
+}
+
+// Event represents Event resource sent to the subscribers
+type Event struct {
+	OdataType string        `json:"@odata.type"`
+	Context   string        `json:"Context"`
+	Events    []EventRecord `json:"Events"`
+	ID        string        `json:"Id"`
+	Name      string        `json:"Name"`
+}
+
+// EventType represents the type of a Redfish event
+type EventType string
+
+const (
+	EventTypeStatusChange    = EventType("StatusChange")
+	EventTypeResourceUpdated = EventType("ResourceUpdated")
+	EventTypeResourceAdded   = EventType("ResourceAdded")
+	EventTypeResourceRemoved = EventType("ResourceRemoved")
+	EventTypeAlert           = EventType("Alert")
+)
+
+var eventTypes = []EventType{
+	EventTypeStatusChange,
+	EventTypeResourceUpdated,
+	EventTypeResourceAdded,
+	EventTypeResourceRemoved,
+	EventTypeAlert,
+}
+
+const (
+	eventServiceOdataID  = "/redfish/v1/EventService"
+	subscriptionsOdataID = eventServiceOdataID + "/Subscriptions"
+
+	maxEventSubscriptions = 16
+	eventQueueSize        = 64
+	eventDeliveryTimeout  = 10 * time.Second
+
+	defaultEventRetryAttempts = 3
+	defaultEventRetryInterval = 5 * time.Second
+)
+
+// EventDispatcher holds the Redfish event subscriptions of a BMC, and sends events to them.
+// It is shared by the Redfish servers of the BMC so that the subscriptions are kept when the BMC is reset.
+type EventDispatcher struct {
+	mu            sync.Mutex
+	subscriptions map[string]*eventSubscription
+	// origin is the resource the power events of the machine originate from
+	origin      string
+	lastID      uint64
+	lastEventID uint64
+
+	queue  chan EventRecord
+	client *http.Client
+	// retryAttempts and retryInterval control the retries of failed deliveries
+	retryAttempts int
+	retryInterval time.Duration
+}
+
+type eventSubscription struct {
+	id          string
+	seq         uint64
+	destination string
+	eventTypes  []EventType
+	context     string
+
+	// queue holds the events to be sent to the subscriber in order
+	queue chan EventRecord
+	// cancel stops the goroutine sending the events, which is nil while it is not running
+	cancel context.CancelFunc
+}
+
+// NewEventDispatcher creates an EventDispatcher for a BMC of the profile. Run must be called to send events.
+func NewEventDispatcher(profile Profile) *EventDispatcher {
+	return &EventDispatcher{
+		subscriptions: make(map[string]*eventSubscription),
+		origin:        computerSystemOdataID(lookupProfile(profile).systemID),
+		queue:         make(chan EventRecord, eventQueueSize),
+		client: &http.Client{
+			Timeout: eventDeliveryTimeout,
+			Transport: &http.Transport{
+				// event receivers usually have self-signed certificates as well as BMCs
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		retryAttempts: defaultEventRetryAttempts,
+		retryInterval: defaultEventRetryInterval,
+	}
+}
+
+// Run sends the events to the subscribers until ctx is canceled.
+// Each subscriber receives the events in order, independently of the other subscribers.
+func (d *EventDispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case record := <-d.queue:
+			d.enqueue(ctx, &wg, record)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// PowerStatusChanged sends an event for a change of the power status of the machine
+func (d *EventDispatcher) PowerStatusChanged(status PowerStatus) {
+	switch status {
+	case PowerStatusOn:
+		d.dispatch(EventTypeStatusChange, "Placemat.1.0.PowerOn", "The server is powered on.", "OK", d.origin)
+	case PowerStatusOff:
+		d.dispatch(EventTypeStatusChange, "Placemat.1.0.PowerOff", "The server is powered off.", "OK", d.origin)
+	}
+}
+
+// MachineReset sends an event for a reset of the machine
+func (d *EventDispatcher) MachineReset() {
+	d.dispatch(EventTypeStatusChange, "Placemat.1.0.Reset", "The server is reset.", "OK", d.origin)
+}
+
+// SELEntryAdded sends an alert for an entry added to the SEL
+func (d *EventDispatcher) SELEntryAdded(message, severity string) {
+	d.dispatch(EventTypeAlert, "Placemat.1.0.SELEntry", message, severity, d.origin)
+}
+
+// dispatch queues an event. Events are dropped if the queue is full so that callers never block.
+func (d *EventDispatcher) dispatch(eventType EventType, messageID, message, severity, origin string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lastEventID++
+	record := EventRecord{
+		EventID:           strconv.FormatUint(d.lastEventID, 10),
+		EventTimestamp:    time.Now().UTC().Truncate(time.Second),
+		EventType:         eventType,
+		MemberID:          "0",
+		Message:           message,
+		MessageArgs:       []string{},
+		MessageID:         messageID,
+		OriginOfCondition: OdataID{OdataID: origin},
+		Severity:          severity,
+	}
+	select {
+	case d.queue <- record:
+	default:
+		log.Warn("Redfish: dropped an event", map[string]interface{}{"message_id": messageID})
+	}
+}
+
+// enqueue queues an event for each subscriber, and starts the goroutine sending the events to the subscriber if needed.
+// Events are dropped if the queue of the subscriber is full so that a dead subscriber never blocks the others.
+func (d *EventDispatcher) enqueue(ctx context.Context, wg *sync.WaitGroup, record EventRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, s := range d.subscriptions {
+		if !s.subscribes(record.EventType) {
+			continue
+		}
+		if s.cancel == nil {
+			var subCtx context.Context
+			subCtx, s.cancel = context.WithCancel(ctx)
+			wg.Add(1)
+			go func(s *eventSubscription) {
+				defer wg.Done()
+				d.sendEvents(subCtx, s)
+			}(s)
+		}
+		select {
+		case s.queue <- record:
+		default:
+			log.Warn("Redfish: dropped an event", map[string]interface{}{
+				"message_id":   record.MessageID,
+				"subscription": s.id,
+			})
+		}
+	}
+}
+
+// sendEvents sends the queued events to the subscriber until ctx is canceled
+func (d *EventDispatcher) sendEvents(ctx context.Context, s *eventSubscription) {
+	defer func() {
+		d.mu.Lock()
+		s.cancel()
+		s.cancel = nil
+		d.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case record := <-s.queue:
+			d.deliver(ctx, s, record)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *EventDispatcher) deliver(ctx context.Context, s *eventSubscription, record EventRecord) {
+	body, err := json.Marshal(Event{
+		OdataType: "#Event.v1_2_0.Event",
+		Context:   s.context,
+		Events:    []EventRecord{record},
+		ID:        record.EventID,
+		Name:      "Event Array",
+	})
+	if err != nil {
+		log.Error("Redfish: failed to marshal an event", map[string]interface{}{log.FnError: err})
+		return
+	}
+
+	for i := 0; ; i++ {
+		err = d.post(ctx, s.destination, body)
+		if err == nil {
+			return
+		}
+		if i >= d.retryAttempts {
+			break
+		}
+		select {
+		case <-time.After(d.retryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+	log.Warn("Redfish: failed to send an event", map[string]interface{}{
+		log.FnError:    err,
+		"subscription": s.id,
+		"destination":  s.destination,
+	})
+}
+
+func (d *EventDispatcher) post(ctx context.Context, destination string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, destination, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (d *EventDispatcher) subscribe(req *EventDestinationRequestBody) (eventSubscription, error) {
+	u, err := url.Parse(req.Destination)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return eventSubscription{}, fmt.Errorf("invalid Destination: %s", req.Destination)
+	}
+	if req.Protocol != "" && req.Protocol != "Redfish" {
+		return eventSubscription{}, fmt.Errorf("unsupported Protocol: %s", req.Protocol)
+	}
+	types := req.EventTypes
+	if len(types) == 0 {
+		types = eventTypes
+	}
+	for _, t := range types {
+		if !isEventType(t) {
+			return eventSubscription{}, fmt.Errorf("unsupported EventType: %s", t)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.subscriptions) >= maxEventSubscriptions {
+		return eventSubscription{}, errors.New("too many subscriptions")
+	}
+	d.lastID++
+	s := &eventSubscription{
+		id:          strconv.FormatUint(d.lastID, 10),
+		seq:         d.lastID,
+		destination: req.Destination,
+		eventTypes:  append([]EventType(nil), types...),
+		context:     req.Context,
+		queue:       make(chan EventRecord, eventQueueSize),
+	}
+	d.subscriptions[s.id] = s
+	log.Info("Redfish: Create event subscription", map[string]interface{}{"subscription": s.id, "destination": s.destination})
+	return *s, nil
+}
+
+func (d *EventDispatcher) get(id string) (eventSubscription, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.subscriptions[id]
+	if !ok {
+		return eventSubscription{}, false
+	}
+	return *s, true
+}
+
+// list returns the subscriptions in the order of creation
+func (d *EventDispatcher) list() []eventSubscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subscriptions := make([]eventSubscription, 0, len(d.subscriptions))
+	for _, s := range d.subscriptions {
+		subscriptions = append(subscriptions, *s)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].seq < subscriptions[j].seq
+	})
+	return subscriptions
+}
+
+func (d *EventDispatcher) unsubscribe(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if s, ok := d.subscriptions[id]; ok && s.cancel != nil {
+		s.cancel()
+	}
+	delete(d.subscriptions, id)
+	log.Info("Redfish: Delete event subscription", map[string]interface{}{"subscription": id})
+}
+
+func (s eventSubscription) subscribes(t EventType) bool {
+	for _, et := range s.eventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isEventType(t EventType) bool {
+	for _, et := range eventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redfishServer) handleEventService(c *gin.Context) {
+	c.JSON(http.StatusOK, EventService{
+		OdataContext: "/redfish/v1/$metadata#EventService.EventService",
+		OdataID:      eventServiceOdataID,
+		OdataType:    "#EventService.v1_0_6.EventService",
+		Actions: EventServiceActions{
+			SubmitTestEvent: EventServiceSubmitTestEvent{
+				EventTypeRedfishAllowableValues: eventTypes,
+				Target:                          eventServiceOdataID + "/Actions/EventService.SubmitTestEvent",
+			},
+		},
+		DeliveryRetryAttempts:        r.events.retryAttempts,
+		DeliveryRetryIntervalSeconds: int(r.events.retryInterval / time.Second),
+		Description:                  "Event Service represents the properties for the service",
+		EventTypesForSubscription:    eventTypes,
+		ID:                           "EventService",
+		Name:                         "Event Service",
+		ServiceEnabled:               true,
+		Status:                       Status{State: "Enabled"},
+		Subscriptions:                OdataID{OdataID: subscriptionsOdataID},
+	})
+}
+
+func (r *redfishServer) handleEventServiceActionsSubmitTestEvent(c *gin.Context) {
+	var json SubmitTestEventRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if json.EventType == "" {
+		json.EventType = EventTypeAlert
+	}
+	if !isEventType(json.EventType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported EventType: %s", json.EventType)})
+		return
+	}
+	if json.MessageID == "" {
+		json.MessageID = "Placemat.1.0.TestEvent"
+	}
+	if json.Message == "" {
+		json.Message = "This is a test event."
+	}
+	if json.Severity == "" {
+		json.Severity = "OK"
+	}
+
+	r.events.dispatch(json.EventType, json.MessageID, json.Message, json.Severity, eventServiceOdataID)
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (r *redfishServer) handleEventSubscriptionCollection(c *gin.Context) {
+	subscriptions := r.events.list()
+	members := make([]OdataID, len(subscriptions))
+	for i, s := range subscriptions {
+		members[i] = OdataID{OdataID: subscriptionsOdataID + "/" + s.id}
+	}
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#EventDestinationCollection.EventDestinationCollection",
+		OdataID:           subscriptionsOdataID,
+		OdataType:         "#EventDestinationCollection.EventDestinationCollection",
+		Description:       "List of Event subscriptions",
+		Members:           members,
+		MembersOdataCount: len(members),
+		Name:              "Event Subscriptions Collection",
+	})
+}
+
+func (r *redfishServer) handleEventSubscriptionCreate(c *gin.Context) {
+	var json EventDestinationRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s, err := r.events.subscribe(&json)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := createEventDestinationResponse(s)
+	c.Header("Location", res.OdataID)
+	c.JSON(http.StatusCreated, res)
+}
+
+func (r *redfishServer) handleEventSubscription(c *gin.Context) {
+	s, ok := r.findEventSubscription(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, createEventDestinationResponse(s))
+}
+
+func (r *redfishServer) handleEventSubscriptionDelete(c *gin.Context) {
+	s, ok := r.findEventSubscription(c)
+	if !ok {
+		return
+	}
+	r.events.unsubscribe(s.id)
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// findEventSubscription returns the subscription of the ID in the URL, or responds 404 Not Found
+func (r *redfishServer) findEventSubscription(c *gin.Context) (eventSubscription, bool) {
+	id := c.Param("id")
+	s, ok := r.events.get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return eventSubscription{}, false
+	}
+	return s, true
+}
+
+func createEventDestinationResponse(s eventSubscription) EventDestination {
+	return EventDestination{
+		OdataContext: "/redfish/v1/$metadata#EventDestination.EventDestination",
+		OdataID:      subscriptionsOdataID + "/" + s.id,
+		OdataType:    "#EventDestination.v1_2_0.EventDestination",
+		Context:      s.context,
+		Description:  "Event Subscription Details",
+		Destination:  s.destination,
+		EventTypes:   s.eventTypes,
+		ID:           s.id,
+		Name:         "EventSubscription " + s.id,
+		Protocol:     "Redfish",
+	}
+}
@@ -0,0 +1,144 @@
+package virtualbmc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redfish events", func() {
+	var (
+		events   *EventDispatcher
+		router   http.Handler
+		receiver *httptest.Server
+		received chan Event
+		fail     chan struct{}
+		cancel   context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		users, err := NewUserHolder([]User{
+			{Name: "admin", Password: "admin-password", Privilege: PrivilegeAdministrator},
+			{Name: "viewer", Password: "viewer-password", Privilege: PrivilegeUser},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		events = NewEventDispatcher(ProfileDefault)
+		events.retryInterval = 10 * time.Millisecond
+		router = prepareRouter(redfishOptions{machine: &MachineMock{status: PowerStatusOn}, bmc: &BMCMock{}, users: users, events: events})
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go events.Run(ctx)
+
+		received = make(chan Event, 10)
+		fail = make(chan struct{}, 10)
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			select {
+			case <-fail:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			default:
+			}
+			var ev Event
+			if err := json.NewDecoder(req.Body).Decode(&ev); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received <- ev
+		}))
+	})
+
+	AfterEach(func() {
+		cancel()
+		receiver.Close()
+	})
+
+	request := func(method, path, user, password, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth(user, password)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	It("should send events to the subscribers", func() {
+		By("subscribing events")
+		body := `{"Destination": "` + receiver.URL + `/events", "EventTypes": ["StatusChange"], "Context": "my-context", "Protocol": "Redfish"}`
+		Expect(request(http.MethodPost, "/redfish/v1/EventService/Subscriptions", "viewer", "viewer-password", body).Code).To(Equal(http.StatusForbidden))
+		w := request(http.MethodPost, "/redfish/v1/EventService/Subscriptions", "admin", "admin-password", body)
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		Expect(w.Header().Get("Location")).To(Equal("/redfish/v1/EventService/Subscriptions/1"))
+		Expect(request(http.MethodPost, "/redfish/v1/EventService/Subscriptions", "admin", "admin-password", `{"Destination": "ftp://example.com/"}`).Code).To(Equal(http.StatusBadRequest))
+		Expect(request(http.MethodPost, "/redfish/v1/EventService/Subscriptions", "admin", "admin-password", `{"Destination": "http://example.com/", "EventTypes": ["Unknown"]}`).Code).To(Equal(http.StatusBadRequest))
+
+		w = request(http.MethodGet, "/redfish/v1/EventService/Subscriptions/1", "viewer", "viewer-password", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var destination EventDestination
+		Expect(json.Unmarshal(w.Body.Bytes(), &destination)).To(Succeed())
+		Expect(destination.Destination).To(Equal(receiver.URL + "/events"))
+		Expect(destination.EventTypes).To(Equal([]EventType{EventTypeStatusChange}))
+
+		By("sending power events in order")
+		events.PowerStatusChanged(PowerStatusPoweringOff)
+		events.PowerStatusChanged(PowerStatusOff)
+		events.PowerStatusChanged(PowerStatusOn)
+		events.MachineReset()
+		for _, id := range []string{"Placemat.1.0.PowerOff", "Placemat.1.0.PowerOn", "Placemat.1.0.Reset"} {
+			var ev Event
+			Eventually(received).Should(Receive(&ev))
+			Expect(ev.Context).To(Equal("my-context"))
+			Expect(ev.Events).To(HaveLen(1))
+			Expect(ev.Events[0].EventType).To(Equal(EventTypeStatusChange))
+			Expect(ev.Events[0].MessageID).To(Equal(id))
+			Expect(ev.Events[0].OriginOfCondition.OdataID).To(Equal("/redfish/v1/Systems/System.Embedded.1"))
+		}
+
+		By("filtering events by the event types")
+		Expect(request(http.MethodPost, "/redfish/v1/EventService/Actions/EventService.SubmitTestEvent", "admin", "admin-password", `{"EventType": "Alert"}`).Code).To(Equal(http.StatusNoContent))
+		Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+
+		By("retrying failed deliveries")
+		fail <- struct{}{}
+		fail <- struct{}{}
+		Expect(request(http.MethodPost, "/redfish/v1/EventService/Actions/EventService.SubmitTestEvent", "admin", "admin-password", `{"EventType": "StatusChange", "MessageId": "Test.1.0.Test"}`).Code).To(Equal(http.StatusNoContent))
+		var ev Event
+		Eventually(received).Should(Receive(&ev))
+		Expect(ev.Events[0].MessageID).To(Equal("Test.1.0.Test"))
+
+		By("unsubscribing events")
+		Expect(request(http.MethodDelete, "/redfish/v1/EventService/Subscriptions/1", "admin", "admin-password", "").Code).To(Equal(http.StatusNoContent))
+		Expect(request(http.MethodGet, "/redfish/v1/EventService/Subscriptions/1", "admin", "admin-password", "").Code).To(Equal(http.StatusNotFound))
+		events.PowerStatusChanged(PowerStatusOff)
+		Consistently(received, 200*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should not block the other subscribers by a dead subscriber", func() {
+		stuck := make(chan struct{})
+		dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			<-stuck
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer dead.Close()
+		defer close(stuck)
+
+		for _, destination := range []string{dead.URL + "/events", receiver.URL + "/events"} {
+			body := `{"Destination": "` + destination + `", "EventTypes": ["StatusChange"]}`
+			Expect(request(http.MethodPost, "/redfish/v1/EventService/Subscriptions", "admin", "admin-password", body).Code).To(Equal(http.StatusCreated))
+		}
+
+		events.PowerStatusChanged(PowerStatusOff)
+		events.PowerStatusChanged(PowerStatusOn)
+		for _, id := range []string{"Placemat.1.0.PowerOff", "Placemat.1.0.PowerOn"} {
+			var ev Event
+			Eventually(received).Should(Receive(&ev))
+			Expect(ev.Events[0].MessageID).To(Equal(id))
+		}
+	})
+})
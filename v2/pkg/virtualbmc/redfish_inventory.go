@@ -0,0 +1,476 @@
+package virtualbmc
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Processor represents Processor resource
+type Processor struct {
+	OdataContext          string        `json:"@odata.context"`
+	OdataID               string        `json:"@odata.id"`
+	OdataType             string        `json:"@odata.type"`
+	Description           string        `json:"Description"`
+	ID                    string        `json:"Id"`
+	InstructionSet        string        `json:"InstructionSet"`
+	Model                 string        `json:"Model"`
+	Name                  string        `json:"Name"`
+	ProcessorArchitecture string        `json:"ProcessorArchitecture"`
+	ProcessorType         string        `json:"ProcessorType"`
+	Socket                string        `json:"Socket"`
+	Status                MachineStatus `json:"Status"`
+	TotalCores            int           `json:"TotalCores"`
+	TotalThreads          int           `json:"TotalThreads"`
+}
+
+// Memory represents Memory resource
+type Memory struct {
+	OdataContext  string        `json:"@odata.context"`
+	OdataID       string        `json:"@odata.id"`
+	OdataType     string        `json:"@odata.type"`
+	CapacityMiB   int64         `json:"CapacityMiB"`
+	Description   string        `json:"Description"`
+	DeviceLocator string        `json:"DeviceLocator"`
+	ID            string        `json:"Id"`
+	MemoryType    string        `json:"MemoryType"`
+	Name          string        `json:"Name"`
+	Status        MachineStatus `json:"Status"`
+}
+
+// Storage represents Storage resource
+type Storage struct {
+	OdataContext       string              `json:"@odata.context"`
+	OdataID            string              `json:"@odata.id"`
+	OdataType          string              `json:"@odata.type"`
+	Description        string              `json:"Description"`
+	Drives             []OdataID           `json:"Drives"`
+	DrivesOdataCount   int                 `json:"Drives@odata.count"`
+	ID                 string              `json:"Id"`
+	Name               string              `json:"Name"`
+	Status             MachineStatus       `json:"Status"`
+	StorageControllers []StorageController `json:"StorageControllers"`
+}
+
+// StorageController represents Storage's StorageControllers field
+type StorageController struct {
+	OdataID  string        `json:"@odata.id"`
+	MemberID string        `json:"MemberId"`
+	Name     string        `json:"Name"`
+	Status   MachineStatus `json:"Status"`
+}
+
+// Drive represents Drive resource
+type Drive struct {
+	OdataContext string `json:"@odata.context"`
+	OdataID      string `json:"@odata.id"`
+	OdataType    string `json:"@odata.type"`
+	// CapacityBytes is null if the size of the disk is unknown
+	CapacityBytes *int64        `json:"CapacityBytes"`
+	Description   string        `json:"Description"`
+	ID            string        `json:"Id"`
+	MediaType     string        `json:"MediaType"`
+	Name          string        `json:"Name"`
+	Status        MachineStatus `json:"Status"`
+}
+
+// Bios represents Bios resource
+type Bios struct {
+	OdataContext string         `json:"@odata.context"`
+	OdataID      string         `json:"@odata.id"`
+	OdataType    string         `json:"@odata.type"`
+	Attributes   BiosAttributes `json:"Attributes"`
+	Description  string         `json:"Description"`
+	ID           string         `json:"Id"`
+	Name         string         `json:"Name"`
+}
+
+// BiosAttributes represents Bios's Attributes field
+type BiosAttributes struct {
+	BootMode           string `json:"BootMode"`
+	LogicalProc        string `json:"LogicalProc"`
+	ProcCoreCount      int    `json:"ProcCoreCount"`
+	ProcSocketCount    int    `json:"ProcSocketCount"`
+	SysMemSize         string `json:"SysMemSize"`
+	SystemManufacturer string `json:"SystemManufacturer"`
+	SystemModelName    string `json:"SystemModelName"`
+	SystemSerialNumber string `json:"SystemSerialNumber"`
+	TpmSecurity        string `json:"TpmSecurity"`
+}
+
+const (
+	// storageID is the ID of the only storage subsystem of the machine
+	storageID = "1"
+	// memoryID is the ID of the only memory module of the machine
+	memoryID = "DIMM.1"
+)
+
+func computerSystemOdataID(id string) string {
+	return fmt.Sprintf("/redfish/v1/Systems/%s", id)
+}
+
+func storageOdataID(systemID, storage string) string {
+	return fmt.Sprintf("%s/Storage/%s", computerSystemOdataID(systemID), storage)
+}
+
+func processorID(socket int) string {
+	return fmt.Sprintf("CPU.Socket.%d", socket+1)
+}
+
+// biosVersion returns the name of the firmware as QEMU does not tell its version
+func biosVersion(uefi bool) string {
+	if uefi {
+		return "OVMF"
+	}
+	return "SeaBIOS"
+}
+
+// onlineThreads returns the number of online logical processors of the socket.
+// vCPUs are plugged into the sockets in order.
+func onlineThreads(p ProcessorInventory, socket int) int {
+	perSocket := p.CoresPerSocket * p.ThreadsPerCore
+	n := p.Threads - socket*perSocket
+	switch {
+	case n < 0:
+		return 0
+	case n > perSocket:
+		return perSocket
+	}
+	return n
+}
+
+// presentSockets returns the number of sockets that have online logical processors
+func presentSockets(p ProcessorInventory) int {
+	var count int
+	for i := 0; i < p.Sockets; i++ {
+		if onlineThreads(p, i) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// systemInventory returns the inventory of the system specified by the id parameter.
+// It writes an error response and returns false if it fails.
+func (r *redfishServer) systemInventory(c *gin.Context) (Inventory, bool) {
+	id := c.Param("id")
+	if _, ok := r.systemIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return Inventory{}, false
+	}
+
+	inv, err := r.machine.Inventory()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return Inventory{}, false
+	}
+	return inv, true
+}
+
+func (r *redfishServer) handleProcessorCollection(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	odataID := computerSystemOdataID(c.Param("id")) + "/Processors"
+	members := []OdataID{}
+	for i := 0; i < inv.Processors.Sockets; i++ {
+		members = append(members, OdataID{OdataID: odataID + "/" + processorID(i)})
+	}
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#ProcessorCollection.ProcessorCollection",
+		OdataID:           odataID,
+		OdataType:         "#ProcessorCollection.ProcessorCollection",
+		Description:       "Collection of Processors",
+		Members:           members,
+		MembersOdataCount: len(members),
+		Name:              "Processors Collection",
+	})
+}
+
+func (r *redfishServer) handleProcessor(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	processor := c.Param("processor")
+	socket := -1
+	for i := 0; i < inv.Processors.Sockets; i++ {
+		if processorID(i) == processor {
+			socket = i
+		}
+	}
+	if socket < 0 {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(processor))
+		return
+	}
+
+	status := MachineStatus{Health: "OK", HealthRollup: "OK", State: "Enabled"}
+	if onlineThreads(inv.Processors, socket) == 0 {
+		status = MachineStatus{State: "Absent"}
+	}
+	c.JSON(http.StatusOK, Processor{
+		OdataContext:          "/redfish/v1/$metadata#Processor.Processor",
+		OdataID:               fmt.Sprintf("%s/Processors/%s", computerSystemOdataID(c.Param("id")), processor),
+		OdataType:             "#Processor.v1_3_1.Processor",
+		Description:           "Represents the properties of a Processor attached to this System",
+		ID:                    processor,
+		InstructionSet:        "x86-64",
+		Model:                 inv.Processors.Model,
+		Name:                  "CPU " + strconv.Itoa(socket+1),
+		ProcessorArchitecture: "x86",
+		ProcessorType:         "CPU",
+		Socket:                processor,
+		Status:                status,
+		TotalCores:            inv.Processors.CoresPerSocket,
+		TotalThreads:          inv.Processors.CoresPerSocket * inv.Processors.ThreadsPerCore,
+	})
+}
+
+func (r *redfishServer) handleMemoryCollection(c *gin.Context) {
+	if _, ok := r.systemInventory(c); !ok {
+		return
+	}
+
+	odataID := computerSystemOdataID(c.Param("id")) + "/Memory"
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#MemoryCollection.MemoryCollection",
+		OdataID:           odataID,
+		OdataType:         "#MemoryCollection.MemoryCollection",
+		Description:       "Collection of memory devices for this system",
+		Members:           []OdataID{{OdataID: odataID + "/" + memoryID}},
+		MembersOdataCount: 1,
+		Name:              "Memory Devices Collection",
+	})
+}
+
+// handleMemory responds the memory of the machine as a single module
+func (r *redfishServer) handleMemory(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	memory := c.Param("memory")
+	if memory != memoryID {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(memory))
+		return
+	}
+
+	c.JSON(http.StatusOK, Memory{
+		OdataContext:  "/redfish/v1/$metadata#Memory.Memory",
+		OdataID:       fmt.Sprintf("%s/Memory/%s", computerSystemOdataID(c.Param("id")), memory),
+		OdataType:     "#Memory.v1_6_0.Memory",
+		CapacityMiB:   inv.MemoryBytes >> 20,
+		Description:   "DIMM Object",
+		DeviceLocator: "DIMM 1",
+		ID:            memory,
+		MemoryType:    "DRAM",
+		Name:          "DIMM 1",
+		Status: MachineStatus{
+			Health:       "OK",
+			HealthRollup: "OK",
+			State:        "Enabled",
+		},
+	})
+}
+
+func (r *redfishServer) handleStorageCollection(c *gin.Context) {
+	if _, ok := r.systemInventory(c); !ok {
+		return
+	}
+
+	id := c.Param("id")
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#StorageCollection.StorageCollection",
+		OdataID:           computerSystemOdataID(id) + "/Storage",
+		OdataType:         "#StorageCollection.StorageCollection",
+		Description:       "Collection Of Storage entities",
+		Members:           []OdataID{{OdataID: storageOdataID(id, storageID)}},
+		MembersOdataCount: 1,
+		Name:              "Storage Collection",
+	})
+}
+
+func (r *redfishServer) handleStorage(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	storage := c.Param("storage")
+	if storage != storageID {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(storage))
+		return
+	}
+
+	odataID := storageOdataID(c.Param("id"), storage)
+	drives := []OdataID{}
+	for _, d := range inv.Drives {
+		drives = append(drives, OdataID{OdataID: odataID + "/Drives/" + d.Name})
+	}
+	status := MachineStatus{
+		Health:       "OK",
+		HealthRollup: "OK",
+		State:        "Enabled",
+	}
+	c.JSON(http.StatusOK, Storage{
+		OdataContext:     "/redfish/v1/$metadata#Storage.Storage",
+		OdataID:          odataID,
+		OdataType:        "#Storage.v1_4_0.Storage",
+		Description:      "Virtual disk controller",
+		Drives:           drives,
+		DrivesOdataCount: len(drives),
+		ID:               storage,
+		Name:             "Virtual Disk Controller",
+		Status:           status,
+		StorageControllers: []StorageController{
+			{
+				OdataID:  odataID + "#/StorageControllers/0",
+				MemberID: "0",
+				Name:     "Virtual Disk Controller",
+				Status:   status,
+			},
+		},
+	})
+}
+
+func (r *redfishServer) handleDrive(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	storage := c.Param("storage")
+	if storage != storageID {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(storage))
+		return
+	}
+	name := c.Param("drive")
+	for _, d := range inv.Drives {
+		if d.Name != name {
+			continue
+		}
+
+		var capacity *int64
+		if d.CapacityBytes != 0 {
+			size := d.CapacityBytes
+			capacity = &size
+		}
+		c.JSON(http.StatusOK, Drive{
+			OdataContext:  "/redfish/v1/$metadata#Drive.Drive",
+			OdataID:       fmt.Sprintf("%s/Drives/%s", storageOdataID(c.Param("id"), storage), name),
+			OdataType:     "#Drive.v1_5_0.Drive",
+			CapacityBytes: capacity,
+			Description:   "Virtual disk",
+			ID:            name,
+			MediaType:     "HDD",
+			Name:          name,
+			Status: MachineStatus{
+				Health:       "OK",
+				HealthRollup: "OK",
+				State:        "Enabled",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(name))
+}
+
+func (r *redfishServer) handleSystemEthernetInterfaceCollection(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	odataID := computerSystemOdataID(c.Param("id")) + "/EthernetInterfaces"
+	members := []OdataID{}
+	for i := range inv.NICs {
+		members = append(members, OdataID{OdataID: odataID + "/" + strconv.Itoa(i+1)})
+	}
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#EthernetInterfaceCollection.EthernetInterfaceCollection",
+		OdataID:           odataID,
+		OdataType:         "#EthernetInterfaceCollection.EthernetInterfaceCollection",
+		Description:       "Collection of Ethernet Interfaces for this System",
+		Members:           members,
+		MembersOdataCount: len(members),
+		Name:              "System Ethernet Interface Collection",
+	})
+}
+
+func (r *redfishServer) handleSystemEthernetInterface(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	nic := c.Param("nic")
+	i, err := strconv.Atoi(nic)
+	if err != nil || i < 1 || i > len(inv.NICs) || strconv.Itoa(i) != nic {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(nic))
+		return
+	}
+
+	c.JSON(http.StatusOK, EthernetInterface{
+		OdataContext:        "/redfish/v1/$metadata#EthernetInterface.EthernetInterface",
+		OdataID:             fmt.Sprintf("%s/EthernetInterfaces/%s", computerSystemOdataID(c.Param("id")), nic),
+		OdataType:           "#EthernetInterface.v1_4_1.EthernetInterface",
+		Description:         "Interface connected to " + inv.NICs[i-1].Network,
+		ID:                  nic,
+		IPv4Addresses:       []IPv4Address{},
+		InterfaceEnabled:    true,
+		MACAddress:          inv.NICs[i-1].MACAddress,
+		Name:                "System Ethernet Interface",
+		PermanentMACAddress: inv.NICs[i-1].MACAddress,
+		Status: MachineStatus{
+			Health:       "OK",
+			HealthRollup: "OK",
+			State:        "Enabled",
+		},
+	})
+}
+
+func (r *redfishServer) handleBios(c *gin.Context) {
+	inv, ok := r.systemInventory(c)
+	if !ok {
+		return
+	}
+
+	bootMode := "Bios"
+	if inv.UEFI {
+		bootMode = "Uefi"
+	}
+	logicalProc := "Disabled"
+	if inv.Processors.ThreadsPerCore > 1 {
+		logicalProc = "Enabled"
+	}
+	tpm := "Off"
+	if inv.TPM {
+		tpm = "On"
+	}
+	c.JSON(http.StatusOK, Bios{
+		OdataContext: "/redfish/v1/$metadata#Bios.Bios",
+		OdataID:      computerSystemOdataID(c.Param("id")) + "/Bios",
+		OdataType:    "#Bios.v1_0_1.Bios",
+		Attributes: BiosAttributes{
+			BootMode:           bootMode,
+			LogicalProc:        logicalProc,
+			ProcCoreCount:      inv.Processors.CoresPerSocket,
+			ProcSocketCount:    presentSockets(inv.Processors),
+			SysMemSize:         fmt.Sprintf("%d MB", inv.MemoryBytes>>20),
+			SystemManufacturer: inv.Manufacturer,
+			SystemModelName:    inv.Model,
+			SystemSerialNumber: inv.SerialNumber,
+			TpmSecurity:        tpm,
+		},
+		Description: "BIOS Configuration Current Settings",
+		ID:          "Bios",
+		Name:        "BIOS Configuration Current Settings",
+	})
+}
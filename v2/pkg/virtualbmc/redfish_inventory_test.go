@@ -0,0 +1,129 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redfish inventory", func() {
+	It("should describe the hardware of the machine", func() {
+		machine := &MachineMock{
+			status: PowerStatusOn,
+			inventory: Inventory{
+				Manufacturer: "Cybozu",
+				Model:        "Neco",
+				SerialNumber: "abcd",
+				UEFI:         true,
+				Processors: ProcessorInventory{
+					Model:          "Virtual CPU",
+					Sockets:        2,
+					CoresPerSocket: 4,
+					ThreadsPerCore: 2,
+					Threads:        8,
+				},
+				MemoryBytes: 6 << 30,
+				Drives: []DriveInventory{
+					{Name: "root", CapacityBytes: 10 << 30},
+					{Name: "seed"},
+				},
+				NICs: []NICInventory{
+					{Network: "net0", MACAddress: "52:54:00:00:00:01"},
+					{Network: "net1", MACAddress: "52:54:00:00:00:02"},
+				},
+			},
+		}
+		users, err := NewUserHolder([]User{
+			{Name: "viewer", Password: "viewer-password", Privilege: PrivilegeUser},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		router := prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{}, users: users})
+		get := func(path string, v interface{}) int {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.SetBasicAuth("viewer", "viewer-password")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code == http.StatusOK && v != nil {
+				Expect(json.Unmarshal(w.Body.Bytes(), v)).To(Succeed())
+			}
+			return w.Code
+		}
+		system := "/redfish/v1/Systems/System.Embedded.1"
+
+		By("getting the system summary")
+		var cs ComputerSystem
+		Expect(get(system, &cs)).To(Equal(http.StatusOK))
+		Expect(cs.Manufacturer).To(Equal("Cybozu"))
+		Expect(cs.Model).To(Equal("Neco"))
+		Expect(cs.SerialNumber).To(Equal("abcd"))
+		Expect(cs.BiosVersion).To(Equal("OVMF"))
+		Expect(cs.ProcessorSummary.Count).To(Equal(1))
+		Expect(cs.ProcessorSummary.LogicalProcessorCount).To(Equal(8))
+		Expect(cs.MemorySummary.TotalSystemMemoryGiB).To(Equal(6.0))
+		Expect(cs.TrustedModules).To(BeEmpty())
+
+		var chassis Chassis
+		Expect(get("/redfish/v1/Chassis/System.Embedded.1", &chassis)).To(Equal(http.StatusOK))
+		Expect(chassis.SerialNumber).To(Equal("abcd"))
+
+		By("getting the processors")
+		var collection ResourceCollection
+		Expect(get(system+"/Processors", &collection)).To(Equal(http.StatusOK))
+		Expect(collection.Members).To(Equal([]OdataID{
+			{OdataID: system + "/Processors/CPU.Socket.1"},
+			{OdataID: system + "/Processors/CPU.Socket.2"},
+		}))
+		var processor Processor
+		Expect(get(system+"/Processors/CPU.Socket.1", &processor)).To(Equal(http.StatusOK))
+		Expect(processor.Model).To(Equal("Virtual CPU"))
+		Expect(processor.TotalCores).To(Equal(4))
+		Expect(processor.TotalThreads).To(Equal(8))
+		Expect(processor.Status.State).To(Equal("Enabled"))
+		Expect(get(system+"/Processors/CPU.Socket.2", &processor)).To(Equal(http.StatusOK))
+		Expect(processor.Status.State).To(Equal("Absent"))
+		Expect(get(system+"/Processors/CPU.Socket.3", nil)).To(Equal(http.StatusNotFound))
+
+		By("getting the memory")
+		Expect(get(system+"/Memory", &collection)).To(Equal(http.StatusOK))
+		Expect(collection.Members).To(HaveLen(1))
+		var memory Memory
+		Expect(get(collection.Members[0].OdataID, &memory)).To(Equal(http.StatusOK))
+		Expect(memory.CapacityMiB).To(Equal(int64(6144)))
+
+		By("getting the drives")
+		Expect(get(system+"/Storage", &collection)).To(Equal(http.StatusOK))
+		Expect(collection.Members).To(HaveLen(1))
+		var storage Storage
+		Expect(get(collection.Members[0].OdataID, &storage)).To(Equal(http.StatusOK))
+		Expect(storage.Drives).To(Equal([]OdataID{
+			{OdataID: system + "/Storage/1/Drives/root"},
+			{OdataID: system + "/Storage/1/Drives/seed"},
+		}))
+		var drive Drive
+		Expect(get(storage.Drives[0].OdataID, &drive)).To(Equal(http.StatusOK))
+		Expect(drive.CapacityBytes).To(HaveValue(Equal(int64(10 << 30))))
+		drive = Drive{}
+		Expect(get(storage.Drives[1].OdataID, &drive)).To(Equal(http.StatusOK))
+		Expect(drive.CapacityBytes).To(BeNil())
+		Expect(get(system+"/Storage/1/Drives/none", nil)).To(Equal(http.StatusNotFound))
+
+		By("getting the network interfaces")
+		Expect(get(system+"/EthernetInterfaces", &collection)).To(Equal(http.StatusOK))
+		Expect(collection.Members).To(HaveLen(2))
+		var nic EthernetInterface
+		Expect(get(collection.Members[1].OdataID, &nic)).To(Equal(http.StatusOK))
+		Expect(nic.MACAddress).To(Equal("52:54:00:00:00:02"))
+		Expect(get(system+"/EthernetInterfaces/3", nil)).To(Equal(http.StatusNotFound))
+
+		By("getting the BIOS settings")
+		var bios Bios
+		Expect(get(system+"/Bios", &bios)).To(Equal(http.StatusOK))
+		Expect(bios.Attributes.BootMode).To(Equal("Uefi"))
+		Expect(bios.Attributes.LogicalProc).To(Equal("Enabled"))
+		Expect(bios.Attributes.SystemSerialNumber).To(Equal("abcd"))
+		Expect(get("/redfish/v1/Systems/System.Embedded.2/Bios", nil)).To(Equal(http.StatusNotFound))
+	})
+})
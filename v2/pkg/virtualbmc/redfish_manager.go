@@ -0,0 +1,273 @@
+package virtualbmc
+
+import (
+	"fmt"
+	"net/http"
+
+	v2 "github.com/cybozu-go/placemat/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// Manager represents Manager resource
+type Manager struct {
+	OdataContext       string         `json:"@odata.context"`
+	OdataID            string         `json:"@odata.id"`
+	OdataType          string         `json:"@odata.type"`
+	Actions            ManagerActions `json:"Actions"`
+	Description        string         `json:"Description"`
+	EthernetInterfaces OdataID        `json:"EthernetInterfaces"`
+	FirmwareVersion    string         `json:"FirmwareVersion"`
+	ID                 string         `json:"Id"`
+	Links              ManagerLinks   `json:"Links"`
+	ManagerType        string         `json:"ManagerType"`
+	Model              string         `json:"Model"`
+	Name               string         `json:"Name"`
+	NetworkProtocol    OdataID        `json:"NetworkProtocol"`
+	Oem                *ManagerOem    `json:"Oem,omitempty"`
+	PowerState         PowerStatus    `json:"PowerState"`
+	Status             MachineStatus  `json:"Status"`
+	VirtualMedia       OdataID        `json:"VirtualMedia"`
+}
+
+// ManagerActions represents Manager's Actions field
+type ManagerActions struct {
+	ManagerReset ManagerReset `json:"#Manager.Reset"`
+}
+
+// ManagerReset represents Manager's ManagerReset field
+type ManagerReset struct {
+	ResetTypeRedfishAllowableValues []ResetType `json:"ResetType@Redfish.AllowableValues"`
+	Target                          string      `json:"target"`
+}
+
+// ManagerLinks represents Manager's Links field
+type ManagerLinks struct {
+	ManagerForChassis []OdataID `json:"ManagerForChassis"`
+	ManagerForServers []OdataID `json:"ManagerForServers"`
+}
+
+// ManagerOem represents Manager's Oem field, which has the section of the vendor profile
+type ManagerOem struct {
+	Dell *DellManagerOem `json:"Dell,omitempty"`
+	Hpe  *HpeManagerOem  `json:"Hpe,omitempty"`
+}
+
+// DellManagerOem represents Manager's Oem field of iDRAC
+type DellManagerOem struct {
+	DelliDRACCard DelliDRACCard `json:"DelliDRACCard"`
+}
+
+// DelliDRACCard represents DellManagerOem's DelliDRACCard field
+type DelliDRACCard struct {
+	OdataType   string `json:"@odata.type"`
+	IPMIVersion string `json:"IPMIVersion"`
+	URLString   string `json:"URLString"`
+}
+
+// HpeManagerOem represents Manager's Oem field of iLO
+type HpeManagerOem struct {
+	OdataType string `json:"@odata.type"`
+}
+
+// ManagerNetworkProtocol represents ManagerNetworkProtocol resource
+type ManagerNetworkProtocol struct {
+	OdataContext string   `json:"@odata.context"`
+	OdataID      string   `json:"@odata.id"`
+	OdataType    string   `json:"@odata.type"`
+	Description  string   `json:"Description"`
+	HTTPS        Protocol `json:"HTTPS"`
+	ID           string   `json:"Id"`
+	IPMI         Protocol `json:"IPMI"`
+	Name         string   `json:"Name"`
+	SSH          Protocol `json:"SSH"`
+	Status       Status   `json:"Status"`
+}
+
+// Protocol represents ManagerNetworkProtocol's protocol fields
+type Protocol struct {
+	Port            int  `json:"Port"`
+	ProtocolEnabled bool `json:"ProtocolEnabled"`
+}
+
+// EthernetInterface represents EthernetInterface resource
+type EthernetInterface struct {
+	OdataContext     string        `json:"@odata.context"`
+	OdataID          string        `json:"@odata.id"`
+	OdataType        string        `json:"@odata.type"`
+	Description      string        `json:"Description"`
+	ID               string        `json:"Id"`
+	IPv4Addresses    []IPv4Address `json:"IPv4Addresses"`
+	InterfaceEnabled bool          `json:"InterfaceEnabled"`
+	// MACAddress and PermanentMACAddress are omitted for the BMC
+	MACAddress          string        `json:"MACAddress,omitempty"`
+	Name                string        `json:"Name"`
+	PermanentMACAddress string        `json:"PermanentMACAddress,omitempty"`
+	Status              MachineStatus `json:"Status"`
+}
+
+// IPv4Address represents EthernetInterface's IPv4Addresses field
+type IPv4Address struct {
+	Address       string `json:"Address"`
+	AddressOrigin string `json:"AddressOrigin"`
+}
+
+const (
+	// ethernetInterfaceID is the ID of the only network interface of the BMC
+	ethernetInterfaceID = "1"
+	redfishPort         = 443
+)
+
+func managerOdataID(id string) string {
+	return fmt.Sprintf("/redfish/v1/Managers/%s", id)
+}
+
+func (r *redfishServer) handleManagerCollection(c *gin.Context) {
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext: "/redfish/v1/$metadata#ManagerCollection.ManagerCollection",
+		OdataID:      "/redfish/v1/Managers",
+		OdataType:    "#ManagerCollection.ManagerCollection",
+		Description:  "BMC",
+		Members: []OdataID{
+			{OdataID: managerOdataID(r.profile.managerID)},
+		},
+		MembersOdataCount: 1,
+		Name:              "Manager",
+	})
+}
+
+func (r *redfishServer) handleManager(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := r.managerIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return
+	}
+
+	odataID := managerOdataID(id)
+	c.JSON(http.StatusOK, Manager{
+		OdataContext: "/redfish/v1/$metadata#Manager.Manager",
+		OdataID:      odataID,
+		OdataType:    "#Manager.v1_5_0.Manager",
+		Actions: ManagerActions{
+			ManagerReset: ManagerReset{
+				ResetTypeRedfishAllowableValues: []ResetType{ResetTypeGracefulRestart, ResetTypeForceRestart},
+				Target:                          odataID + "/Actions/Manager.Reset",
+			},
+		},
+		Description:        "BMC",
+		EthernetInterfaces: OdataID{OdataID: odataID + "/EthernetInterfaces"},
+		FirmwareVersion:    v2.Version(),
+		ID:                 id,
+		Links: ManagerLinks{
+			ManagerForChassis: []OdataID{{OdataID: fmt.Sprintf("/redfish/v1/Chassis/%s", r.profile.systemID)}},
+			ManagerForServers: []OdataID{{OdataID: computerSystemOdataID(r.profile.systemID)}},
+		},
+		ManagerType:     "BMC",
+		Model:           r.profile.managerModel,
+		Name:            "Manager",
+		NetworkProtocol: OdataID{OdataID: odataID + "/NetworkProtocol"},
+		Oem:             r.profile.managerOem(r.bmc.Address()),
+		PowerState:      PowerStatusOn,
+		Status: MachineStatus{
+			Health:       "OK",
+			HealthRollup: "OK",
+			State:        "Enabled",
+		},
+		VirtualMedia: OdataID{OdataID: odataID + "/VirtualMedia"},
+	})
+}
+
+// handleManagerActionsReset restarts the IPMI and Redfish servers of the BMC
+func (r *redfishServer) handleManagerActionsReset(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := r.managerIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return
+	}
+
+	var json RequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if json.ResetType != ResetTypeGracefulRestart && json.ResetType != ResetTypeForceRestart {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported ResetType: %s", json.ResetType)})
+		return
+	}
+
+	if err := r.bmc.Reset(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (r *redfishServer) handleManagerNetworkProtocol(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := r.managerIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return
+	}
+
+	c.JSON(http.StatusOK, ManagerNetworkProtocol{
+		OdataContext: "/redfish/v1/$metadata#ManagerNetworkProtocol.ManagerNetworkProtocol",
+		OdataID:      managerOdataID(id) + "/NetworkProtocol",
+		OdataType:    "#ManagerNetworkProtocol.v1_4_0.ManagerNetworkProtocol",
+		Description:  "Manager Network Service",
+		HTTPS:        Protocol{Port: redfishPort, ProtocolEnabled: true},
+		ID:           "NetworkProtocol",
+		IPMI:         Protocol{Port: rmcpPort, ProtocolEnabled: true},
+		Name:         "Manager Network Protocol",
+		SSH:          Protocol{Port: 22, ProtocolEnabled: false},
+		Status:       Status{State: "Enabled"},
+	})
+}
+
+func (r *redfishServer) handleEthernetInterfaceCollection(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := r.managerIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return
+	}
+
+	odataID := managerOdataID(id) + "/EthernetInterfaces"
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#EthernetInterfaceCollection.EthernetInterfaceCollection",
+		OdataID:           odataID,
+		OdataType:         "#EthernetInterfaceCollection.EthernetInterfaceCollection",
+		Description:       "Collection of EthernetInterfaces for this Manager",
+		Members:           []OdataID{{OdataID: odataID + "/" + ethernetInterfaceID}},
+		MembersOdataCount: 1,
+		Name:              "Ethernet Network Interface Collection",
+	})
+}
+
+func (r *redfishServer) handleEthernetInterface(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := r.managerIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return
+	}
+	nic := c.Param("nic")
+	if nic != ethernetInterfaceID {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(nic))
+		return
+	}
+
+	c.JSON(http.StatusOK, EthernetInterface{
+		OdataContext: "/redfish/v1/$metadata#EthernetInterface.EthernetInterface",
+		OdataID:      fmt.Sprintf("%s/EthernetInterfaces/%s", managerOdataID(id), nic),
+		OdataType:    "#EthernetInterface.v1_4_1.EthernetInterface",
+		Description:  "Manager Network Interface",
+		ID:           nic,
+		IPv4Addresses: []IPv4Address{
+			{Address: r.bmc.Address(), AddressOrigin: "Static"},
+		},
+		InterfaceEnabled: true,
+		Name:             "Manager Ethernet Interface",
+		Status: MachineStatus{
+			Health:       "OK",
+			HealthRollup: "OK",
+			State:        "Enabled",
+		},
+	})
+}
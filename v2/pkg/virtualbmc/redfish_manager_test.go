@@ -0,0 +1,90 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	v2 "github.com/cybozu-go/placemat/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BMC manager", func() {
+	var (
+		machine *MachineMock
+		bmc     *BMCMock
+		users   *UserHolder
+	)
+
+	BeforeEach(func() {
+		machine = &MachineMock{status: PowerStatusOn}
+		bmc = &BMCMock{address: "10.0.0.5"}
+		var err error
+		users, err = NewUserHolder([]User{
+			{Name: "admin", Password: "admin-password", Privilege: PrivilegeAdministrator},
+			{Name: "operator", Password: "operator-password", Privilege: PrivilegeOperator},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should describe and reset the BMC via Redfish", func() {
+		router := prepareRouter(redfishOptions{machine: machine, bmc: bmc, users: users})
+		request := func(method, path, user, password, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.SetBasicAuth(user, password)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		w := request(http.MethodGet, "/redfish/v1/Managers", "operator", "operator-password", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var collection ResourceCollection
+		Expect(json.Unmarshal(w.Body.Bytes(), &collection)).To(Succeed())
+		Expect(collection.Members).To(Equal([]OdataID{{OdataID: "/redfish/v1/Managers/1"}}))
+
+		w = request(http.MethodGet, "/redfish/v1/Managers/1", "operator", "operator-password", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var manager Manager
+		Expect(json.Unmarshal(w.Body.Bytes(), &manager)).To(Succeed())
+		Expect(manager.FirmwareVersion).To(Equal(v2.Version()))
+		Expect(manager.Actions.ManagerReset.Target).To(Equal("/redfish/v1/Managers/1/Actions/Manager.Reset"))
+		Expect(request(http.MethodGet, "/redfish/v1/Managers/2", "operator", "operator-password", "").Code).To(Equal(http.StatusNotFound))
+
+		w = request(http.MethodGet, "/redfish/v1/Managers/1/NetworkProtocol", "operator", "operator-password", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var protocol ManagerNetworkProtocol
+		Expect(json.Unmarshal(w.Body.Bytes(), &protocol)).To(Succeed())
+		Expect(protocol.IPMI).To(Equal(Protocol{Port: 623, ProtocolEnabled: true}))
+		Expect(protocol.HTTPS).To(Equal(Protocol{Port: 443, ProtocolEnabled: true}))
+
+		w = request(http.MethodGet, "/redfish/v1/Managers/1/EthernetInterfaces/1", "operator", "operator-password", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var nic EthernetInterface
+		Expect(json.Unmarshal(w.Body.Bytes(), &nic)).To(Succeed())
+		Expect(nic.IPv4Addresses).To(Equal([]IPv4Address{{Address: "10.0.0.5", AddressOrigin: "Static"}}))
+
+		target := "/redfish/v1/Managers/1/Actions/Manager.Reset"
+		Expect(request(http.MethodPost, target, "operator", "operator-password", `{"ResetType": "GracefulRestart"}`).Code).To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodPost, target, "admin", "admin-password", `{"ResetType": "On"}`).Code).To(Equal(http.StatusBadRequest))
+		Expect(bmc.resets).To(BeZero())
+		Expect(request(http.MethodPost, target, "admin", "admin-password", `{"ResetType": "GracefulRestart"}`).Code).To(Equal(http.StatusNoContent))
+		Expect(bmc.resets).To(Equal(1))
+	})
+
+	It("should reset the BMC via IPMI", func() {
+		suite := supportedCipherSuites[len(supportedCipherSuites)-1]
+		client := newRMCPPlusClient(machine)
+		client.holder = newRMCPPlusSessionHolder(nil, bmc)
+		client.activate(suite)
+
+		code, _ := client.command(ipmiNetFNApp, ipmiCmdColdReset)
+		Expect(code).To(Equal(completionCodeOK))
+		code, _ = client.command(ipmiNetFNApp, ipmiCmdWarmReset)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(bmc.resets).To(Equal(2))
+	})
+})
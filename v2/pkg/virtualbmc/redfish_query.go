@@ -0,0 +1,582 @@
+package virtualbmc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expandType represents the hyperlinks to be expanded by $expand
+type expandType string
+
+const (
+	// expandAll expands all hyperlinks
+	expandAll = expandType("*")
+	// expandSubordinate expands the hyperlinks not in the Links properties
+	expandSubordinate = expandType(".")
+	// expandLinks expands the hyperlinks in the Links properties
+	expandLinks = expandType("~")
+
+	// maxExpandLevels is the MaxLevels of ExpandQuery in the service root
+	maxExpandLevels = 1
+)
+
+// queryOptions represents the OData query options of a request
+type queryOptions struct {
+	expand expandType
+	// selects is the property paths specified by $select
+	selects [][]string
+	filter  filterExpr
+}
+
+// parseQueryOptions parses the query options of the URL query.
+// It returns nil if no options are specified.
+func parseQueryOptions(query url.Values) (*queryOptions, error) {
+	var opts queryOptions
+	var found bool
+
+	if v, ok := query["$expand"]; ok {
+		found = true
+		expand, levels, _ := strings.Cut(v[0], "(")
+		opts.expand = expandType(expand)
+		switch opts.expand {
+		case expandAll, expandSubordinate, expandLinks:
+		default:
+			return nil, fmt.Errorf("unsupported $expand: %s", v[0])
+		}
+		if levels != "" {
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(levels, "$levels="), ")"))
+			if err != nil || !strings.HasSuffix(levels, ")") || n < 1 {
+				return nil, fmt.Errorf("invalid $expand: %s", v[0])
+			}
+			if n > maxExpandLevels {
+				return nil, fmt.Errorf("$levels exceeds %d: %d", maxExpandLevels, n)
+			}
+		}
+	}
+
+	if v, ok := query["$select"]; ok {
+		found = true
+		for _, p := range strings.Split(v[0], ",") {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				return nil, fmt.Errorf("invalid $select: %s", v[0])
+			}
+			opts.selects = append(opts.selects, strings.Split(p, "/"))
+		}
+	}
+
+	if v, ok := query["$filter"]; ok {
+		found = true
+		f, err := parseFilter(v[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid $filter: %w", err)
+		}
+		opts.filter = f
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return &opts, nil
+}
+
+// bufferedWriter holds the response body so that it can be rewritten
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// handleQueryOptions is a middleware to apply $expand, $select and $filter to the responses of GET requests
+func (r *redfishServer) handleQueryOptions(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		return
+	}
+	opts, err := parseQueryOptions(c.Request.URL.Query())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if opts == nil {
+		return
+	}
+
+	w := &bufferedWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	c.Writer = w.ResponseWriter
+
+	var resource map[string]interface{}
+	if w.Status() != http.StatusOK || json.Unmarshal(w.body.Bytes(), &resource) != nil {
+		c.Writer.Write(w.body.Bytes())
+		return
+	}
+
+	r.applyQueryOptions(c.Request, resource, opts)
+	data, err := json.Marshal(resource)
+	if err != nil {
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.Writer.Write(data)
+}
+
+// applyQueryOptions rewrites the resource with the query options.
+// $filter chooses the members of a collection, and $select is applied to the expanded members of a collection.
+func (r *redfishServer) applyQueryOptions(req *http.Request, resource map[string]interface{}, opts *queryOptions) {
+	members, isCollection := resource["Members"].([]interface{})
+
+	if isCollection && opts.filter != nil {
+		filtered := []interface{}{}
+		for _, m := range members {
+			member, ok := r.fetchLink(req, m)
+			if !ok || !opts.filter.eval(member) {
+				continue
+			}
+			if opts.expand == expandAll || opts.expand == expandSubordinate {
+				m = member
+			}
+			filtered = append(filtered, m)
+		}
+		resource["Members"] = filtered
+		resource["Members@odata.count"] = len(filtered)
+	} else if opts.expand != "" {
+		r.expand(req, resource, opts.expand, false)
+	}
+
+	if opts.selects == nil {
+		return
+	}
+	if !isCollection {
+		selectProperties(resource, opts.selects)
+		return
+	}
+	for _, m := range resource["Members"].([]interface{}) {
+		if member, ok := m.(map[string]interface{}); ok {
+			selectProperties(member, opts.selects)
+		}
+	}
+}
+
+// expand replaces the hyperlinks in the value with the resources.
+// inLinks is true if the value is in a Links property.
+func (r *redfishServer) expand(req *http.Request, v interface{}, t expandType, inLinks bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childInLinks := inLinks || key == "Links"
+			if t == expandAll || (t == expandLinks) == childInLinks {
+				if resource, ok := r.fetchLink(req, child); ok {
+					v[key] = resource
+					continue
+				}
+			}
+			r.expand(req, child, t, childInLinks)
+		}
+	case []interface{}:
+		for i, child := range v {
+			if t == expandAll || (t == expandLinks) == inLinks {
+				if resource, ok := r.fetchLink(req, child); ok {
+					v[i] = resource
+					continue
+				}
+			}
+			r.expand(req, child, t, inLinks)
+		}
+	}
+}
+
+// fetchLink returns the resource if the value is a hyperlink to an existing resource.
+// The resource is got with the credentials of the request.
+func (r *redfishServer) fetchLink(req *http.Request, v interface{}) (map[string]interface{}, bool) {
+	link, ok := v.(map[string]interface{})
+	if !ok || len(link) != 1 {
+		return nil, false
+	}
+	path, ok := link["@odata.id"].(string)
+	if !ok || !strings.HasPrefix(path, "/redfish/v1/") || strings.Contains(path, "#") {
+		return nil, false
+	}
+
+	sub, err := http.NewRequestWithContext(req.Context(), http.MethodGet, path, nil)
+	if err != nil {
+		return nil, false
+	}
+	for _, h := range []string{"Authorization", headerAuthToken} {
+		if value := req.Header.Get(h); value != "" {
+			sub.Header.Set(h, value)
+		}
+	}
+	w := &responseBuffer{header: make(http.Header), status: http.StatusOK}
+	r.router.ServeHTTP(w, sub)
+	if w.status != http.StatusOK {
+		return nil, false
+	}
+
+	var resource map[string]interface{}
+	if err := json.Unmarshal(w.body.Bytes(), &resource); err != nil {
+		return nil, false
+	}
+	return resource, true
+}
+
+// responseBuffer is an http.ResponseWriter to receive the responses of internal requests
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseBuffer) Header() http.Header {
+	return w.header
+}
+
+func (w *responseBuffer) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *responseBuffer) WriteHeader(status int) {
+	w.status = status
+}
+
+// selectProperties removes the properties not specified by the paths.
+// The annotations such as @odata.id are always kept.
+func selectProperties(resource map[string]interface{}, paths [][]string) {
+	children := make(map[string][][]string)
+	for _, p := range paths {
+		if len(p) == 1 {
+			children[p[0]] = nil
+			continue
+		}
+		if sub, ok := children[p[0]]; !ok || sub != nil {
+			children[p[0]] = append(sub, p[1:])
+		}
+	}
+
+	for key, v := range resource {
+		if strings.HasPrefix(key, "@odata.") {
+			continue
+		}
+		sub, ok := children[key]
+		if !ok {
+			delete(resource, key)
+			continue
+		}
+		if sub == nil {
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			selectProperties(v, sub)
+		case []interface{}:
+			for _, e := range v {
+				if e, ok := e.(map[string]interface{}); ok {
+					selectProperties(e, sub)
+				}
+			}
+		}
+	}
+}
+
+// filterExpr represents a boolean expression of $filter
+type filterExpr interface {
+	eval(resource map[string]interface{}) bool
+}
+
+type filterAnd struct {
+	left, right filterExpr
+}
+
+func (f filterAnd) eval(resource map[string]interface{}) bool {
+	return f.left.eval(resource) && f.right.eval(resource)
+}
+
+type filterOr struct {
+	left, right filterExpr
+}
+
+func (f filterOr) eval(resource map[string]interface{}) bool {
+	return f.left.eval(resource) || f.right.eval(resource)
+}
+
+type filterNot struct {
+	expr filterExpr
+}
+
+func (f filterNot) eval(resource map[string]interface{}) bool {
+	return !f.expr.eval(resource)
+}
+
+// filterOperand is either a property path or a literal
+type filterOperand struct {
+	property []string
+	literal  interface{}
+}
+
+func (o filterOperand) value(resource map[string]interface{}) interface{} {
+	if o.property == nil {
+		return o.literal
+	}
+	var v interface{} = resource
+	for _, p := range o.property {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+type filterCompare struct {
+	op          string
+	left, right filterOperand
+}
+
+func (f filterCompare) eval(resource map[string]interface{}) bool {
+	left := f.left.value(resource)
+	right := f.right.value(resource)
+
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return f.op == "ne"
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return f.op == "ne"
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		// booleans and null can only be tested for equality
+		switch f.op {
+		case "eq":
+			return left == right
+		case "ne":
+			return left != right
+		}
+		return false
+	}
+
+	switch f.op {
+	case "eq":
+		return cmp == 0
+	case "ne":
+		return cmp != 0
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "le":
+		return cmp <= 0
+	}
+	return false
+}
+
+// filterParser is a recursive descent parser of $filter.
+//
+//	or         = and *("or" and)
+//	and        = not *("and" not)
+//	not        = "not" not / "(" or ")" / comparison
+//	comparison = operand ("eq" / "ne" / "gt" / "ge" / "lt" / "le") operand
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseFilter(s string) (filterExpr, error) {
+	tokens, err := tokenizeFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func tokenizeFilter(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			// a quote in a string literal is escaped by doubling it
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] != '\'' {
+					continue
+				}
+				if j+1 < len(s) && s[j+1] == '\'' {
+					j++
+					continue
+				}
+				break
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && s[j] != ' ' && s[j] != '(' && s[j] != ')' && s[j] != '\'' {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", errors.New("unexpected end of expression")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = filterAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterExpr, error) {
+	switch p.peek() {
+	case "not":
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{expr: expr}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t != ")" {
+			return nil, errors.New("missing )")
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "eq", "ne", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unsupported operator: %s", op)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return filterCompare{op: op, left: left, right: right}, nil
+}
+
+func (p *filterParser) parseOperand() (filterOperand, error) {
+	t, err := p.next()
+	if err != nil {
+		return filterOperand{}, err
+	}
+
+	switch t {
+	case "true":
+		return filterOperand{literal: true}, nil
+	case "false":
+		return filterOperand{literal: false}, nil
+	case "null":
+		return filterOperand{}, nil
+	case "(", ")", "and", "or", "not":
+		return filterOperand{}, fmt.Errorf("unexpected %s", t)
+	}
+	if strings.HasPrefix(t, "'") {
+		return filterOperand{literal: strings.ReplaceAll(t[1:len(t)-1], "''", "'")}, nil
+	}
+	if n, err := strconv.ParseFloat(t, 64); err == nil {
+		return filterOperand{literal: n}, nil
+	}
+	return filterOperand{property: strings.Split(t, "/")}, nil
+}
@@ -0,0 +1,111 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redfish query options", func() {
+	var router http.Handler
+
+	BeforeEach(func() {
+		machine := &MachineMock{
+			status: PowerStatusOn,
+			inventory: Inventory{
+				Manufacturer: "Cybozu",
+				Model:        "Neco",
+				Processors: ProcessorInventory{
+					Sockets:        2,
+					CoresPerSocket: 4,
+					ThreadsPerCore: 1,
+					Threads:        4,
+				},
+			},
+		}
+		users, err := NewUserHolder([]User{
+			{Name: "viewer", Password: "viewer-password", Privilege: PrivilegeUser},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		router = prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{}, users: users})
+	})
+
+	get := func(path string, query url.Values) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil)
+		req.SetBasicAuth("viewer", "viewer-password")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resource map[string]interface{}
+		if w.Code == http.StatusOK {
+			Expect(json.Unmarshal(w.Body.Bytes(), &resource)).To(Succeed())
+		}
+		return w.Code, resource
+	}
+	system := "/redfish/v1/Systems/System.Embedded.1"
+
+	It("should expand hyperlinks", func() {
+		code, collection := get(system+"/Processors", url.Values{"$expand": {"."}})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(collection["Members"]).To(HaveLen(2))
+		Expect(collection["Members"]).To(HaveEach(HaveKeyWithValue("TotalCores", 4.0)))
+
+		code, resource := get(system, url.Values{"$expand": {"~"}})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(resource).To(HaveKeyWithValue("Processors", map[string]interface{}{"@odata.id": system + "/Processors"}))
+		links := resource["Links"].(map[string]interface{})
+		Expect(links["ManagedBy"]).To(ContainElement(HaveKeyWithValue("ManagerType", "BMC")))
+
+		code, resource = get(system, url.Values{"$expand": {"*($levels=1)"}})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(resource["Processors"]).To(HaveKeyWithValue("Members@odata.count", 2.0))
+		links = resource["Links"].(map[string]interface{})
+		Expect(links["ManagedBy"]).To(ContainElement(HaveKeyWithValue("ManagerType", "BMC")))
+
+		code, _ = get(system, url.Values{"$expand": {".($levels=2)"}})
+		Expect(code).To(Equal(http.StatusBadRequest))
+		code, _ = get(system, url.Values{"$expand": {"all"}})
+		Expect(code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should select properties", func() {
+		code, resource := get(system, url.Values{"$select": {"Model,Status/Health"}})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(resource).To(HaveLen(5))
+		Expect(resource).To(HaveKeyWithValue("@odata.id", system))
+		Expect(resource).To(HaveKeyWithValue("Model", "Neco"))
+		Expect(resource).To(HaveKeyWithValue("Status", map[string]interface{}{"Health": "OK"}))
+
+		code, collection := get(system+"/Processors", url.Values{"$expand": {"."}, "$select": {"Id"}})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(collection["Members"]).To(ConsistOf(
+			HaveLen(4),
+			HaveLen(4),
+		))
+		Expect(collection["Members"]).To(HaveEach(HaveKey("Id")))
+	})
+
+	It("should filter members of collections", func() {
+		code, collection := get(system+"/Processors", url.Values{"$filter": {"Status/State eq 'Enabled'"}})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(collection["Members"]).To(Equal([]interface{}{
+			map[string]interface{}{"@odata.id": system + "/Processors/CPU.Socket.1"},
+		}))
+		Expect(collection).To(HaveKeyWithValue("Members@odata.count", 1.0))
+
+		code, collection = get(system+"/Processors", url.Values{
+			"$filter": {"TotalCores ge 4 and not (Id eq 'CPU.Socket.1' or Id eq 'it''s')"},
+			"$expand": {"."},
+		})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(collection["Members"]).To(ConsistOf(HaveKeyWithValue("Id", "CPU.Socket.2")))
+
+		for _, f := range []string{"Id", "Id eq", "Id like 'a'", "(Id eq 'a'", "Id eq 'a"} {
+			code, _ = get(system+"/Processors", url.Values{"$filter": {f}})
+			Expect(code).To(Equal(http.StatusBadRequest), f)
+		}
+	})
+})
@@ -0,0 +1,341 @@
+package virtualbmc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionService represents SessionService resource
+type SessionService struct {
+	OdataContext   string  `json:"@odata.context"`
+	OdataID        string  `json:"@odata.id"`
+	OdataType      string  `json:"@odata.type"`
+	Description    string  `json:"Description"`
+	ID             string  `json:"Id"`
+	Name           string  `json:"Name"`
+	ServiceEnabled bool    `json:"ServiceEnabled"`
+	SessionTimeout int     `json:"SessionTimeout"`
+	Sessions       OdataID `json:"Sessions"`
+}
+
+// SessionServiceRequestBody represents the request body to update SessionService resource
+type SessionServiceRequestBody struct {
+	SessionTimeout *int `json:"SessionTimeout,omitempty"`
+}
+
+// Session represents Session resource
+type Session struct {
+	OdataContext string  `json:"@odata.context"`
+	OdataID      string  `json:"@odata.id"`
+	OdataType    string  `json:"@odata.type"`
+	Description  string  `json:"Description"`
+	ID           string  `json:"Id"`
+	Name         string  `json:"Name"`
+	Password     *string `json:"Password"`
+	UserName     string  `json:"UserName"`
+}
+
+// SessionRequestBody represents the request body to create Session resource
+type SessionRequestBody struct {
+	UserName *string `json:"UserName"`
+	Password *string `json:"Password"`
+}
+
+const (
+	sessionServiceOdataID = "/redfish/v1/SessionService"
+	sessionsOdataID       = sessionServiceOdataID + "/Sessions"
+
+	// headerAuthToken is the HTTP header to authenticate requests by a session
+	headerAuthToken = "X-Auth-Token"
+
+	defaultSessionTimeout = 30 * time.Minute
+	minSessionTimeout     = 30 * time.Second
+	maxSessionTimeout     = 24 * time.Hour
+	maxRedfishSessions    = 64
+)
+
+var errTooManySessions = errors.New("too many sessions")
+
+type redfishSessionHolder struct {
+	mu       sync.Mutex
+	sessions map[string]*redfishSession
+	lastID   uint64
+	// timeout is the duration after which idle sessions expire
+	timeout time.Duration
+}
+
+type redfishSession struct {
+	id       string
+	seq      uint64
+	token    string
+	userID   uint8
+	userName string
+	// lastAccess is the time of the last request with the session
+	lastAccess time.Time
+}
+
+func newRedfishSessionHolder() *redfishSessionHolder {
+	return &redfishSessionHolder{
+		sessions: make(map[string]*redfishSession),
+		timeout:  defaultSessionTimeout,
+	}
+}
+
+// create creates a new session for the user
+func (h *redfishSessionHolder) create(u bmcUser) (redfishSession, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return redfishSession{}, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeExpired()
+	if len(h.sessions) >= maxRedfishSessions {
+		return redfishSession{}, errTooManySessions
+	}
+	h.lastID++
+	s := &redfishSession{
+		id:         strconv.FormatUint(h.lastID, 10),
+		seq:        h.lastID,
+		token:      hex.EncodeToString(token),
+		userID:     u.ID,
+		userName:   u.Username,
+		lastAccess: time.Now(),
+	}
+	h.sessions[s.id] = s
+	log.Info("Redfish: Create session", map[string]interface{}{"session": s.id, "user": u.Username})
+	return *s, nil
+}
+
+// authenticate returns the session of the token, and extends its expiration
+func (h *redfishSessionHolder) authenticate(token string) (redfishSession, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeExpired()
+	for _, s := range h.sessions {
+		if subtle.ConstantTimeCompare([]byte(s.token), []byte(token)) == 1 {
+			s.lastAccess = time.Now()
+			return *s, true
+		}
+	}
+	return redfishSession{}, false
+}
+
+func (h *redfishSessionHolder) get(id string) (redfishSession, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeExpired()
+	s, ok := h.sessions[id]
+	if !ok {
+		return redfishSession{}, false
+	}
+	return *s, true
+}
+
+// list returns the sessions in the order of creation
+func (h *redfishSessionHolder) list() []redfishSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeExpired()
+	sessions := make([]redfishSession, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, *s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].seq < sessions[j].seq
+	})
+	return sessions
+}
+
+func (h *redfishSessionHolder) remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.sessions, id)
+	log.Info("Redfish: Delete session", map[string]interface{}{"session": id})
+}
+
+func (h *redfishSessionHolder) getTimeout() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.timeout
+}
+
+func (h *redfishSessionHolder) setTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.timeout = timeout
+}
+
+// removeExpired removes the idle sessions. The caller must hold the lock.
+func (h *redfishSessionHolder) removeExpired() {
+	now := time.Now()
+	for id, s := range h.sessions {
+		if now.Sub(s.lastAccess) > h.timeout {
+			delete(h.sessions, id)
+		}
+	}
+}
+
+// authenticateSession returns the user of the session token
+func (r *redfishServer) authenticateSession(token string) (bmcUser, bool) {
+	s, ok := r.sessions.authenticate(token)
+	if !ok {
+		return bmcUser{}, false
+	}
+	// the session is invalidated if its user is disabled or deleted
+	u, err := r.users.user(s.userID)
+	if err != nil || !u.Enabled || u.Username != s.userName {
+		r.sessions.remove(s.id)
+		return bmcUser{}, false
+	}
+	return u, true
+}
+
+func (r *redfishServer) handleSessionService(c *gin.Context) {
+	c.JSON(http.StatusOK, SessionService{
+		OdataContext:   "/redfish/v1/$metadata#SessionService.SessionService",
+		OdataID:        sessionServiceOdataID,
+		OdataType:      "#SessionService.v1_1_3.SessionService",
+		Description:    "Session Service",
+		ID:             "SessionService",
+		Name:           "Session Service",
+		ServiceEnabled: true,
+		SessionTimeout: int(r.sessions.getTimeout() / time.Second),
+		Sessions:       OdataID{OdataID: sessionsOdataID},
+	})
+}
+
+func (r *redfishServer) handleSessionServicePatch(c *gin.Context) {
+	var json SessionServiceRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if json.SessionTimeout != nil {
+		timeout := time.Duration(*json.SessionTimeout) * time.Second
+		if timeout < minSessionTimeout || timeout > maxSessionTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "SessionTimeout must be between 30 and 86400"})
+			return
+		}
+		r.sessions.setTimeout(timeout)
+	}
+	r.handleSessionService(c)
+}
+
+func (r *redfishServer) handleSessionCollection(c *gin.Context) {
+	sessions := r.sessions.list()
+	members := make([]OdataID, len(sessions))
+	for i, s := range sessions {
+		members[i] = OdataID{OdataID: sessionsOdataID + "/" + s.id}
+	}
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#SessionCollection.SessionCollection",
+		OdataID:           sessionsOdataID,
+		OdataType:         "#SessionCollection.SessionCollection",
+		Description:       "Session Collection",
+		Members:           members,
+		MembersOdataCount: len(members),
+		Name:              "Session Collection",
+	})
+}
+
+// handleSessionCreate creates a session. This does not require authentication.
+func (r *redfishServer) handleSessionCreate(c *gin.Context) {
+	var json SessionRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if json.UserName == nil || json.Password == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "UserName and Password are required"})
+		return
+	}
+
+	u, ok := r.users.authenticate(*json.UserName, *json.Password)
+	if !ok || !u.Privilege.allows(PrivilegeUser) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user name or password"})
+		return
+	}
+
+	s, err := r.sessions.create(u)
+	if errors.Is(err, errTooManySessions) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := createSessionResponse(s)
+	c.Header(headerAuthToken, s.token)
+	c.Header("Location", res.OdataID)
+	c.JSON(http.StatusCreated, res)
+}
+
+func (r *redfishServer) handleSession(c *gin.Context) {
+	s, ok := r.findSession(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, createSessionResponse(s))
+}
+
+// handleSessionDelete deletes a session. Users other than administrators can only delete their own sessions.
+func (r *redfishServer) handleSessionDelete(c *gin.Context) {
+	s, ok := r.findSession(c)
+	if !ok {
+		return
+	}
+
+	current := currentUser(c)
+	if current.ID != s.userID && !current.Privilege.allows(PrivilegeAdministrator) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient privilege"})
+		return
+	}
+
+	r.sessions.remove(s.id)
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// findSession returns the session of the session ID in the URL, or responds 404 Not Found
+func (r *redfishServer) findSession(c *gin.Context) (redfishSession, bool) {
+	id := c.Param("id")
+	s, ok := r.sessions.get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return redfishSession{}, false
+	}
+	return s, true
+}
+
+func createSessionResponse(s redfishSession) Session {
+	return Session{
+		OdataContext: "/redfish/v1/$metadata#Session.Session",
+		OdataID:      sessionsOdataID + "/" + s.id,
+		OdataType:    "#Session.v1_1_0.Session",
+		Description:  "User Session",
+		ID:           s.id,
+		Name:         "User Session",
+		Password:     nil,
+		UserName:     s.userName,
+	}
+}
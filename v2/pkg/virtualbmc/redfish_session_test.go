@@ -0,0 +1,108 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redfish sessions", func() {
+	var (
+		users  *UserHolder
+		router http.Handler
+	)
+
+	BeforeEach(func() {
+		var err error
+		users, err = NewUserHolder([]User{
+			{Name: "admin", Password: "admin-password", Privilege: PrivilegeAdministrator},
+			{Name: "viewer", Password: "viewer-password", Privilege: PrivilegeUser},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		router = prepareRouter(redfishOptions{machine: &MachineMock{status: PowerStatusOn}, bmc: &BMCMock{}, users: users})
+	})
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(headerAuthToken, token)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(user, password string) (string, string) {
+		w := request(http.MethodPost, "/redfish/v1/SessionService/Sessions", "", `{"UserName": "`+user+`", "Password": "`+password+`"}`)
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		var session Session
+		Expect(json.Unmarshal(w.Body.Bytes(), &session)).To(Succeed())
+		Expect(session.UserName).To(Equal(user))
+		Expect(w.Header().Get("Location")).To(Equal(session.OdataID))
+		token := w.Header().Get(headerAuthToken)
+		Expect(token).NotTo(BeEmpty())
+		return session.OdataID, token
+	}
+
+	It("should authenticate requests by sessions", func() {
+		By("creating sessions")
+		Expect(request(http.MethodPost, "/redfish/v1/SessionService/Sessions", "", `{"UserName": "admin", "Password": "wrong"}`).Code).To(Equal(http.StatusUnauthorized))
+		adminSession, adminToken := login("admin", "admin-password")
+		viewerSession, viewerToken := login("viewer", "viewer-password")
+		Expect(adminSession).To(Equal("/redfish/v1/SessionService/Sessions/1"))
+		Expect(viewerSession).To(Equal("/redfish/v1/SessionService/Sessions/2"))
+
+		By("accessing resources with the tokens")
+		Expect(request(http.MethodGet, "/redfish/v1/Systems", adminToken, "").Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodGet, "/redfish/v1/Systems", "invalid", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodPost, "/redfish/v1/Systems/System.Embedded.1/Actions/ComputerSystem.Reset", viewerToken, `{"ResetType": "ForceOff"}`).Code).To(Equal(http.StatusForbidden))
+
+		w := request(http.MethodGet, "/redfish/v1/SessionService/Sessions", viewerToken, "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var collection ResourceCollection
+		Expect(json.Unmarshal(w.Body.Bytes(), &collection)).To(Succeed())
+		Expect(collection.Members).To(Equal([]OdataID{{OdataID: adminSession}, {OdataID: viewerSession}}))
+
+		By("deleting sessions")
+		Expect(request(http.MethodDelete, adminSession, viewerToken, "").Code).To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodDelete, viewerSession, viewerToken, "").Code).To(Equal(http.StatusNoContent))
+		Expect(request(http.MethodGet, "/redfish/v1/Systems", viewerToken, "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodGet, viewerSession, adminToken, "").Code).To(Equal(http.StatusNotFound))
+
+		By("invalidating sessions of disabled users")
+		_, viewerToken = login("viewer", "viewer-password")
+		Expect(request(http.MethodPatch, "/redfish/v1/AccountService/Accounts/3", adminToken, `{"Enabled": false}`).Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodGet, "/redfish/v1/Systems", viewerToken, "").Code).To(Equal(http.StatusUnauthorized))
+
+		By("changing the session timeout")
+		Expect(request(http.MethodPatch, "/redfish/v1/SessionService", adminToken, `{"SessionTimeout": 10}`).Code).To(Equal(http.StatusBadRequest))
+		w = request(http.MethodPatch, "/redfish/v1/SessionService", adminToken, `{"SessionTimeout": 600}`)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var service SessionService
+		Expect(json.Unmarshal(w.Body.Bytes(), &service)).To(Succeed())
+		Expect(service.SessionTimeout).To(Equal(600))
+	})
+
+	It("should expire idle sessions", func() {
+		h := newRedfishSessionHolder()
+		u, ok := users.getBMCUser("admin")
+		Expect(ok).To(BeTrue())
+		idle, err := h.create(u)
+		Expect(err).NotTo(HaveOccurred())
+		active, err := h.create(u)
+		Expect(err).NotTo(HaveOccurred())
+
+		h.sessions[idle.id].lastAccess = time.Now().Add(-defaultSessionTimeout - time.Second)
+		h.sessions[active.id].lastAccess = time.Now().Add(-defaultSessionTimeout + time.Minute)
+		_, ok = h.authenticate(active.token)
+		Expect(ok).To(BeTrue())
+		_, ok = h.authenticate(idle.token)
+		Expect(ok).To(BeFalse())
+		Expect(h.list()).To(HaveLen(1))
+	})
+})
@@ -118,8 +118,34 @@ type MachineStatus struct {
 	State        string `json:"State"`
 }
 
-// ComputerSystemOem represents ComputerSystem resource's Oem field
+// ComputerSystemOem represents ComputerSystem resource's Oem field, which has the section of the vendor profile
 type ComputerSystemOem struct {
+	Dell       *DellComputerSystemOem       `json:"Dell,omitempty"`
+	Hpe        *HpeComputerSystemOem        `json:"Hpe,omitempty"`
+	Supermicro *SupermicroComputerSystemOem `json:"Supermicro,omitempty"`
+}
+
+// DellComputerSystemOem represents ComputerSystem resource's Oem field of iDRAC
+type DellComputerSystemOem struct {
+	DellSystem DellSystem `json:"DellSystem"`
+}
+
+// DellSystem represents DellComputerSystemOem's DellSystem field
+type DellSystem struct {
+	OdataType         string `json:"@odata.type"`
+	ChassisServiceTag string `json:"ChassisServiceTag"`
+	SystemGeneration  string `json:"SystemGeneration"`
+}
+
+// HpeComputerSystemOem represents ComputerSystem resource's Oem field of iLO
+type HpeComputerSystemOem struct {
+	OdataType string `json:"@odata.type"`
+	PostState string `json:"PostState"`
+}
+
+// SupermicroComputerSystemOem represents ComputerSystem resource's Oem field of Supermicro BMC
+type SupermicroComputerSystemOem struct {
+	OdataType string `json:"@odata.type"`
 }
 
 // ProcessorSummary represents ComputerSystem resource's ProcessorSummary field
@@ -137,61 +163,75 @@ type TrustedModule struct {
 	Status          Status `json:"Status"`
 }
 
-var computerSystemCollectionResponse = ResourceCollection{
-	OdataContext: "/redfish/v1/$metadata#ComputerSystemCollection.ComputerSystemCollection",
-	OdataID:      "/redfish/v1/Systems",
-	OdataType:    "#ComputerSystemCollection.ComputerSystemCollection",
-	Description:  "Collection of Computer Systems",
-	Members: []OdataID{
-		{OdataID: fmt.Sprintf("/redfish/v1/Systems/%s", systemID)},
-	},
-	MembersOdataCount: 1,
-	Name:              "Computer System Collection",
+func (r *redfishServer) handleComputerSystemCollection(c *gin.Context) {
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext: "/redfish/v1/$metadata#ComputerSystemCollection.ComputerSystemCollection",
+		OdataID:      "/redfish/v1/Systems",
+		OdataType:    "#ComputerSystemCollection.ComputerSystemCollection",
+		Description:  "Collection of Computer Systems",
+		Members: []OdataID{
+			{OdataID: computerSystemOdataID(r.profile.systemID)},
+		},
+		MembersOdataCount: 1,
+		Name:              "Computer System Collection",
+	})
 }
 
-var serverIsAlreadyPoweredOffResponse = ErrorResponse{
-	Error: Error{
-		MessageExtendedInfo: []MessageExtendedInfo{
-			{
-				Message:                     "Server is already powered OFF",
-				MessageArgs:                 []string{},
-				MessageArgsOdataCount:       0,
-				MessageID:                   "X.X.X",
-				RelatedProperties:           []interface{}{},
-				RelatedPropertiesOdataCount: 0,
-				Resolution:                  "No response action is required.",
-				Severity:                    "Informational",
-			},
-		},
-		Code:    "Base.X.X.GeneralError",
-		Message: "A general error has occurred. See ExtendedInfo for more information",
-	},
+func (r *redfishServer) handleComputerSystem(c *gin.Context) {
+	id := c.Param("id")
+	_, ok := r.systemIDs[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	r.respondComputerSystem(c, id)
 }
 
-var serverIsAlreadyPoweredOnResponse = ErrorResponse{
-	Error: Error{
-		MessageExtendedInfo: []MessageExtendedInfo{
-			{
-				Message:                     "Server is already powered ON",
-				MessageArgs:                 []string{},
-				MessageArgsOdataCount:       0,
-				MessageID:                   "X.X.X",
-				RelatedProperties:           []interface{}{},
-				RelatedPropertiesOdataCount: 0,
-				Resolution:                  "No response action is required.",
-				Severity:                    "Informational",
-			},
-		},
-		Code:    "Base.X.X.GeneralError",
-		Message: "A general error has occurred. See ExtendedInfo for more information",
-	},
+func (r *redfishServer) respondComputerSystem(c *gin.Context, id string) {
+	status, err := r.machine.PowerStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+	boot, err := r.machine.BootOverride()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+	inv, err := r.machine.Inventory()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+
+	res := createComputerSystemResponse(id, r.profile.managerID, status, boot, inv)
+	res.Oem = r.profile.computerSystemOem(status, inv)
+	c.JSON(http.StatusOK, res)
 }
 
-func handleComputerSystemCollection(c *gin.Context) {
-	c.JSON(http.StatusOK, computerSystemCollectionResponse)
+// ComputerSystemPatchRequestBody represents ComputerSystem PATCH request body
+type ComputerSystemPatchRequestBody struct {
+	Boot *BootPatch `json:"Boot"`
 }
 
-func (r *redfishServer) handleComputerSystem(c *gin.Context) {
+// BootPatch represents Boot field of ComputerSystem PATCH request body
+type BootPatch struct {
+	BootSourceOverrideEnabled string     `json:"BootSourceOverrideEnabled"`
+	BootSourceOverrideMode    string     `json:"BootSourceOverrideMode"`
+	BootSourceOverrideTarget  BootDevice `json:"BootSourceOverrideTarget"`
+}
+
+const (
+	bootSourceOverrideEnabledDisabled   = "Disabled"
+	bootSourceOverrideEnabledOnce       = "Once"
+	bootSourceOverrideEnabledContinuous = "Continuous"
+
+	bootSourceOverrideModeUEFI   = "UEFI"
+	bootSourceOverrideModeLegacy = "Legacy"
+)
+
+func (r *redfishServer) handleComputerSystemPatch(c *gin.Context) {
 	id := c.Param("id")
 	_, ok := r.systemIDs[id]
 	if !ok {
@@ -199,64 +239,139 @@ func (r *redfishServer) handleComputerSystem(c *gin.Context) {
 		return
 	}
 
-	status, err := r.machine.PowerStatus()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, nil)
+	var json ComputerSystemPatchRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, createComputerSystemResponse(id, status))
+	if json.Boot != nil {
+		o, err := r.machine.BootOverride()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+		if err := applyBootPatch(&o, json.Boot); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := r.machine.SetBootOverride(o); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	r.respondComputerSystem(c, id)
 }
 
-func createComputerSystemResponse(systemID string, powerState PowerStatus) ComputerSystem {
+// applyBootPatch updates the boot override with the specified properties
+func applyBootPatch(o *BootOverride, patch *BootPatch) error {
+	switch patch.BootSourceOverrideTarget {
+	case "":
+	case BootDeviceNone, BootDevicePxe, BootDeviceHdd, BootDeviceCd, BootDeviceBiosSetup:
+		o.Device = patch.BootSourceOverrideTarget
+		if patch.BootSourceOverrideEnabled == "" && o.Device != BootDeviceNone {
+			// a new target is used only for the next boot unless specified
+			o.Persistent = false
+		}
+	default:
+		return fmt.Errorf("unsupported BootSourceOverrideTarget: %s", patch.BootSourceOverrideTarget)
+	}
+
+	switch patch.BootSourceOverrideEnabled {
+	case "":
+	case bootSourceOverrideEnabledDisabled:
+		o.Device = BootDeviceNone
+	case bootSourceOverrideEnabledOnce:
+		o.Persistent = false
+	case bootSourceOverrideEnabledContinuous:
+		o.Persistent = true
+	default:
+		return fmt.Errorf("unsupported BootSourceOverrideEnabled: %s", patch.BootSourceOverrideEnabled)
+	}
+
+	switch patch.BootSourceOverrideMode {
+	case "":
+	case bootSourceOverrideModeUEFI:
+		o.UEFI = true
+	case bootSourceOverrideModeLegacy:
+		o.UEFI = false
+	default:
+		return fmt.Errorf("unsupported BootSourceOverrideMode: %s", patch.BootSourceOverrideMode)
+	}
+
+	return nil
+}
+
+func createBootResponse(systemID string, o BootOverride) Boot {
+	enabled := bootSourceOverrideEnabledDisabled
+	switch {
+	case o.Device == BootDeviceNone || o.Device == "":
+	case o.Persistent:
+		enabled = bootSourceOverrideEnabledContinuous
+	default:
+		enabled = bootSourceOverrideEnabledOnce
+	}
+	mode := bootSourceOverrideModeLegacy
+	if o.UEFI {
+		mode = bootSourceOverrideModeUEFI
+	}
+	target := o.Device
+	if target == "" {
+		target = BootDeviceNone
+	}
+
+	return Boot{
+		BootOptions: OdataID{
+			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/BootOptions", systemID),
+		},
+		BootOrder: []string{
+			"Boot0000",
+			"Boot0001",
+		},
+		BootOrderOdataCount:       2,
+		BootSourceOverrideEnabled: enabled,
+		BootSourceOverrideMode:    mode,
+		BootSourceOverrideTarget:  string(target),
+		BootSourceOverrideTargetRedfishAllowableValues: []string{
+			string(BootDeviceNone),
+			string(BootDevicePxe),
+			string(BootDeviceCd),
+			string(BootDeviceHdd),
+			string(BootDeviceBiosSetup),
+		},
+		UefiTargetBootSourceOverride: "",
+	}
+}
+
+func createComputerSystemResponse(systemID, managerID string, powerState PowerStatus, boot BootOverride, inv Inventory) ComputerSystem {
+	trustedModules := []TrustedModule{}
+	if inv.TPM {
+		trustedModules = append(trustedModules, TrustedModule{
+			FirmwareVersion: "",
+			InterfaceType:   "TPM2_0",
+			Status: Status{
+				State: "Enabled",
+			},
+		})
+	}
+
 	return ComputerSystem{
 		OdataContext: "/redfish/v1/$metadata#ComputerSystem.ComputerSystem",
 		OdataID:      fmt.Sprintf("/redfish/v1/Systems/%s", systemID),
 		OdataType:    "#ComputerSystem.v1_5_0.ComputerSystem",
 		Actions: ComputerSystemActions{
 			ComputerSystemReset: ComputerSystemReset{
-				ResetTypeRedfishAllowableValues: []ResetType{
-					ResetTypeOn,
-					ResetTypeForceOff,
-					ResetTypeForceRestart,
-					ResetTypeGracefulShutdown,
-					ResetTypePushPowerButton,
-					ResetTypeNmi,
-				},
-				Target: fmt.Sprintf("/redfish/v1/Systems/%s/Actions/ComputerSystem.Reset", systemID),
+				ResetTypeRedfishAllowableValues: machineResetTypes,
+				Target:                          fmt.Sprintf("/redfish/v1/Systems/%s/Actions/ComputerSystem.Reset", systemID),
 			},
 		},
 		AssetTag: "",
 		Bios: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/Bios", systemID),
 		},
-		BiosVersion: "X.X.X",
-		Boot: Boot{
-			BootOptions: OdataID{
-				OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/BootOptions", systemID),
-			},
-			BootOrder: []string{
-				"Boot0000",
-				"Boot0001",
-			},
-			BootOrderOdataCount:       2,
-			BootSourceOverrideEnabled: "Once",
-			BootSourceOverrideMode:    "UEFI",
-			BootSourceOverrideTarget:  "None",
-			BootSourceOverrideTargetRedfishAllowableValues: []string{
-				"None",
-				"Pxe",
-				"Floppy",
-				"Cd",
-				"Hdd",
-				"BiosSetup",
-				"Utilities",
-				"UefiTarget",
-				"SDCard",
-				"UefiHttp",
-			},
-			UefiTargetBootSourceOverride: "",
-		},
+		BiosVersion: biosVersion(inv.UEFI),
+		Boot:        createBootResponse(systemID, boot),
 		Description: "Computer System which represents a machine (physical or virtual) and the local resources such as memory, cpu and other devices that can be accessed from that machine.",
 		EthernetInterfaces: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/EthernetInterfaces", systemID),
@@ -291,7 +406,7 @@ func createComputerSystemResponse(systemID string, powerState PowerStatus) Compu
 			CooledByOdataCount: 2,
 			ManagedBy: []OdataID{
 				{
-					OdataID: "/redfish/v1/Managers/1",
+					OdataID: managerOdataID(managerID),
 				},
 			},
 			ManagedByOdataCount: 1,
@@ -303,7 +418,7 @@ func createComputerSystemResponse(systemID string, powerState PowerStatus) Compu
 			},
 			PoweredByOdataCount: 1,
 		},
-		Manufacturer: "Placemat",
+		Manufacturer: inv.Manufacturer,
 		Memory: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/Memory", systemID),
 		},
@@ -314,9 +429,9 @@ func createComputerSystemResponse(systemID string, powerState PowerStatus) Compu
 				HealthRollup: "OK",
 				State:        "Enabled",
 			},
-			TotalSystemMemoryGiB: 300,
+			TotalSystemMemoryGiB: float64(inv.MemoryBytes) / (1 << 30),
 		},
-		Model: "XXX",
+		Model: inv.Model,
 		Name:  "System",
 		NetworkInterfaces: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/NetworkInterfaces", systemID),
@@ -337,9 +452,9 @@ func createComputerSystemResponse(systemID string, powerState PowerStatus) Compu
 		PartNumber:              "XXXX",
 		PowerState:              powerState,
 		ProcessorSummary: ProcessorSummary{
-			Count:                 2,
-			LogicalProcessorCount: 28,
-			Model:                 "XXXX",
+			Count:                 presentSockets(inv.Processors),
+			LogicalProcessorCount: inv.Processors.Threads,
+			Model:                 inv.Processors.Model,
 			Status: MachineStatus{
 				Health:       "OK",
 				HealthRollup: "OK",
@@ -353,7 +468,7 @@ func createComputerSystemResponse(systemID string, powerState PowerStatus) Compu
 		SecureBoot: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/SecureBoot", systemID),
 		},
-		SerialNumber: "XXXX",
+		SerialNumber: inv.SerialNumber,
 		SimpleStorage: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/SimpleStorage/Controllers", systemID),
 		},
@@ -365,20 +480,23 @@ func createComputerSystemResponse(systemID string, powerState PowerStatus) Compu
 		Storage: OdataID{
 			OdataID: fmt.Sprintf("/redfish/v1/Systems/%s/Storage", systemID),
 		},
-		SystemType: "Virtual",
-		TrustedModules: []TrustedModule{
-			{
-				FirmwareVersion: "X.X.X.X",
-				InterfaceType:   "TPM2_0",
-				Status: Status{
-					State: "Enabled",
-				},
-			},
-		},
-		UUID: "XXXX",
+		SystemType:     "Virtual",
+		TrustedModules: trustedModules,
+		UUID:           inv.UUID,
 	}
 }
 
+// machineResetTypes lists the reset types of the machine, which are accepted by both ComputerSystem.Reset and Chassis.Reset
+var machineResetTypes = []ResetType{
+	ResetTypeOn,
+	ResetTypeForceOff,
+	ResetTypeForceRestart,
+	ResetTypeGracefulShutdown,
+	ResetTypeGracefulRestart,
+	ResetTypePushPowerButton,
+	ResetTypeNmi,
+}
+
 func (r *redfishServer) handleComputerSystemActionsReset(c *gin.Context) {
 	var json RequestBody
 	if err := c.ShouldBindJSON(&json); err != nil {
@@ -386,15 +504,20 @@ func (r *redfishServer) handleComputerSystemActionsReset(c *gin.Context) {
 		return
 	}
 
-	switch json.ResetType {
+	r.resetMachine(c, json.ResetType)
+}
+
+// resetMachine controls the power of the machine, and responds to the Reset action
+func (r *redfishServer) resetMachine(c *gin.Context, resetType ResetType) {
+	switch resetType {
 	case ResetTypeOn:
 		powerStatus, err := r.machine.PowerStatus()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, nil)
 			return
 		}
-		if powerStatus == PowerStatusOn || powerStatus == PowerStatusPoweringOn {
-			c.JSON(http.StatusConflict, serverIsAlreadyPoweredOnResponse)
+		if powerStatus == PowerStatusOn || powerStatus == PowerStatusPoweringOn || powerStatus == PowerStatusPaused {
+			c.JSON(http.StatusConflict, r.profile.createNoOperationErrorResponse("Server is already powered ON"))
 			return
 		}
 		if err := r.machine.PowerOn(); err != nil {
@@ -408,7 +531,7 @@ func (r *redfishServer) handleComputerSystemActionsReset(c *gin.Context) {
 			return
 		}
 		if powerStatus == PowerStatusOff || powerStatus == PowerStatusPoweringOff {
-			c.JSON(http.StatusConflict, serverIsAlreadyPoweredOffResponse)
+			c.JSON(http.StatusConflict, r.profile.createNoOperationErrorResponse("Server is already powered OFF"))
 			return
 		}
 		if err := r.machine.PowerOff(); err != nil {
@@ -422,10 +545,24 @@ func (r *redfishServer) handleComputerSystemActionsReset(c *gin.Context) {
 			return
 		}
 		if powerStatus == PowerStatusOff || powerStatus == PowerStatusPoweringOff {
-			c.JSON(http.StatusConflict, serverIsAlreadyPoweredOffResponse)
+			c.JSON(http.StatusConflict, r.profile.createNoOperationErrorResponse("Server is already powered OFF"))
 			return
 		}
-		if err := r.machine.PowerOff(); err != nil {
+		if err := r.machine.GracefulShutdown(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	case ResetTypeGracefulRestart:
+		powerStatus, err := r.machine.PowerStatus()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+		if powerStatus != PowerStatusOn {
+			c.JSON(http.StatusConflict, r.profile.createNoOperationErrorResponse("Server is not running"))
+			return
+		}
+		if err := r.machine.GracefulRestart(); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -436,17 +573,48 @@ func (r *redfishServer) handleComputerSystemActionsReset(c *gin.Context) {
 			return
 		}
 		if powerStatus == PowerStatusOff || powerStatus == PowerStatusPoweringOff {
-			c.JSON(http.StatusConflict, serverIsAlreadyPoweredOffResponse)
+			c.JSON(http.StatusConflict, r.profile.createNoOperationErrorResponse("Server is already powered OFF"))
 			return
 		}
-		if err := r.machine.PowerOff(); err != nil {
+		if err := r.machine.Reset(); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if err := r.machine.PowerOn(); err != nil {
+	case ResetTypePushPowerButton:
+		powerStatus, err := r.machine.PowerStatus()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+		switch powerStatus {
+		case PowerStatusOff:
+			err = r.machine.PowerOn()
+		case PowerStatusOn, PowerStatusPaused:
+			err = r.machine.GracefulShutdown()
+		default:
+			// the machine is powering on or off; pushing the button does nothing
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+	case ResetTypeNmi:
+		powerStatus, err := r.machine.PowerStatus()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+		if powerStatus == PowerStatusOff || powerStatus == PowerStatusPoweringOff {
+			c.JSON(http.StatusConflict, r.profile.createNoOperationErrorResponse("Server is already powered OFF"))
+			return
+		}
+		if err := r.machine.InjectNMI(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported ResetType: %s", resetType)})
+		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
@@ -0,0 +1,79 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redfish reset", func() {
+	var (
+		machine *MachineMock
+		router  http.Handler
+	)
+
+	BeforeEach(func() {
+		machine = &MachineMock{status: PowerStatusOn}
+		users, err := NewUserHolder([]User{
+			{Name: "admin", Password: "admin-password", Privilege: PrivilegeAdministrator},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		router = prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{}, users: users})
+	})
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("admin", "admin-password")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, resource := range []string{"/redfish/v1/Systems/System.Embedded.1", "/redfish/v1/Chassis/System.Embedded.1"} {
+		target := resource + "/Actions/ComputerSystem.Reset"
+		if strings.Contains(resource, "Chassis") {
+			target = resource + "/Actions/Chassis.Reset"
+		}
+
+		It("should accept every reset type of the machine via "+target, func() {
+			w := request(http.MethodGet, resource, "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			var body struct {
+				Actions map[string]struct {
+					AllowableValues []ResetType `json:"ResetType@Redfish.AllowableValues"`
+					Target          string      `json:"target"`
+				} `json:"Actions"`
+			}
+			Expect(json.Unmarshal(w.Body.Bytes(), &body)).To(Succeed())
+			Expect(body.Actions).To(HaveLen(1))
+			for _, action := range body.Actions {
+				Expect(action.Target).To(Equal(target))
+				Expect(action.AllowableValues).To(ConsistOf(ResetTypeOn, ResetTypeForceOff, ResetTypeForceRestart,
+					ResetTypeGracefulShutdown, ResetTypeGracefulRestart, ResetTypePushPowerButton, ResetTypeNmi))
+			}
+
+			By("restarting gracefully")
+			Expect(request(http.MethodPost, target, `{"ResetType": "GracefulRestart"}`).Code).To(Equal(http.StatusNoContent))
+			Expect(machine.restarts).To(Equal(1))
+
+			By("turning off and on")
+			Expect(request(http.MethodPost, target, `{"ResetType": "GracefulShutdown"}`).Code).To(Equal(http.StatusNoContent))
+			Expect(machine.status).To(Equal(PowerStatusOff))
+			Expect(request(http.MethodPost, target, `{"ResetType": "GracefulRestart"}`).Code).To(Equal(http.StatusConflict))
+			Expect(machine.restarts).To(Equal(1))
+			Expect(request(http.MethodPost, target, `{"ResetType": "PushPowerButton"}`).Code).To(Equal(http.StatusNoContent))
+			Expect(machine.status).To(Equal(PowerStatusOn))
+			Expect(request(http.MethodPost, target, `{"ResetType": "ForceOff"}`).Code).To(Equal(http.StatusNoContent))
+			Expect(machine.status).To(Equal(PowerStatusOff))
+			Expect(request(http.MethodPost, target, `{"ResetType": "On"}`).Code).To(Equal(http.StatusNoContent))
+			Expect(machine.status).To(Equal(PowerStatusOn))
+
+			Expect(request(http.MethodPost, target, `{"ResetType": "PowerCycle"}`).Code).To(Equal(http.StatusBadRequest))
+		})
+	}
+})
@@ -0,0 +1,201 @@
+package virtualbmc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VirtualMediaResource represents a VirtualMedia resource
+type VirtualMediaResource struct {
+	OdataContext         string              `json:"@odata.context"`
+	OdataID              string              `json:"@odata.id"`
+	OdataType            string              `json:"@odata.type"`
+	Actions              VirtualMediaActions `json:"Actions"`
+	ConnectedVia         string              `json:"ConnectedVia"`
+	Description          string              `json:"Description"`
+	ID                   string              `json:"Id"`
+	Image                string              `json:"Image"`
+	ImageName            string              `json:"ImageName"`
+	Inserted             bool                `json:"Inserted"`
+	MediaTypes           []string            `json:"MediaTypes"`
+	Name                 string              `json:"Name"`
+	TransferProtocolType string              `json:"TransferProtocolType"`
+	WriteProtected       bool                `json:"WriteProtected"`
+}
+
+// VirtualMediaActions represents VirtualMedia resource's Actions field
+type VirtualMediaActions struct {
+	InsertMedia VirtualMediaAction `json:"#VirtualMedia.InsertMedia"`
+	EjectMedia  VirtualMediaAction `json:"#VirtualMedia.EjectMedia"`
+}
+
+// VirtualMediaAction represents an action of VirtualMedia resource
+type VirtualMediaAction struct {
+	Target string `json:"target"`
+}
+
+// InsertMediaRequestBody represents VirtualMedia.InsertMedia request body
+type InsertMediaRequestBody struct {
+	Image                string `json:"Image"`
+	Inserted             *bool  `json:"Inserted,omitempty"`
+	WriteProtected       *bool  `json:"WriteProtected,omitempty"`
+	TransferProtocolType string `json:"TransferProtocolType,omitempty"`
+}
+
+func (r *redfishServer) handleVirtualMediaCollection(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := r.managerIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return
+	}
+
+	media, err := r.machine.VirtualMedia()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	members := make([]OdataID, len(media))
+	for i, m := range media {
+		members[i] = OdataID{OdataID: virtualMediaOdataID(id, m.ID)}
+	}
+	c.JSON(http.StatusOK, ResourceCollection{
+		OdataContext:      "/redfish/v1/$metadata#VirtualMediaCollection.VirtualMediaCollection",
+		OdataID:           fmt.Sprintf("/redfish/v1/Managers/%s/VirtualMedia", id),
+		OdataType:         "#VirtualMediaCollection.VirtualMediaCollection",
+		Description:       "Collection of Virtual Media",
+		Members:           members,
+		MembersOdataCount: len(members),
+		Name:              "Virtual Media Collection",
+	})
+}
+
+func (r *redfishServer) handleVirtualMedia(c *gin.Context) {
+	m, ok := r.findVirtualMedia(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, createVirtualMediaResponse(c.Param("id"), m))
+}
+
+func (r *redfishServer) handleVirtualMediaActionsInsertMedia(c *gin.Context) {
+	m, ok := r.findVirtualMedia(c)
+	if !ok {
+		return
+	}
+
+	var json InsertMediaRequestBody
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if json.Inserted != nil && !*json.Inserted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Inserted must be true"})
+		return
+	}
+	if json.WriteProtected != nil && !*json.WriteProtected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "virtual media is read-only"})
+		return
+	}
+	u, err := url.Parse(json.Image)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported Image: %s", json.Image)})
+		return
+	}
+	if json.TransferProtocolType != "" && !strings.EqualFold(json.TransferProtocolType, u.Scheme) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported TransferProtocolType: %s", json.TransferProtocolType)})
+		return
+	}
+
+	// The media is downloaded in the background, and shown as inserted when the download finishes
+	if err := r.machine.InsertMedia(m.ID, json.Image); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (r *redfishServer) handleVirtualMediaActionsEjectMedia(c *gin.Context) {
+	m, ok := r.findVirtualMedia(c)
+	if !ok {
+		return
+	}
+
+	if err := r.machine.EjectMedia(m.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// findVirtualMedia returns the virtual media specified by the request path.
+// If it is not found, an error response is written.
+func (r *redfishServer) findVirtualMedia(c *gin.Context) (VirtualMedia, bool) {
+	id := c.Param("id")
+	if _, ok := r.managerIDs[id]; !ok {
+		c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(id))
+		return VirtualMedia{}, false
+	}
+
+	media, err := r.machine.VirtualMedia()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return VirtualMedia{}, false
+	}
+	mediaID := c.Param("media")
+	for _, m := range media {
+		if m.ID == mediaID {
+			return m, true
+		}
+	}
+
+	c.JSON(http.StatusNotFound, r.profile.createResourceNotFoundErrorResponse(mediaID))
+	return VirtualMedia{}, false
+}
+
+func virtualMediaOdataID(managerID, mediaID string) string {
+	return fmt.Sprintf("/redfish/v1/Managers/%s/VirtualMedia/%s", managerID, mediaID)
+}
+
+func createVirtualMediaResponse(managerID string, m VirtualMedia) VirtualMediaResource {
+	odataID := virtualMediaOdataID(managerID, m.ID)
+	res := VirtualMediaResource{
+		OdataContext: "/redfish/v1/$metadata#VirtualMedia.VirtualMedia",
+		OdataID:      odataID,
+		OdataType:    "#VirtualMedia.v1_3_0.VirtualMedia",
+		Actions: VirtualMediaActions{
+			InsertMedia: VirtualMediaAction{
+				Target: odataID + "/Actions/VirtualMedia.InsertMedia",
+			},
+			EjectMedia: VirtualMediaAction{
+				Target: odataID + "/Actions/VirtualMedia.EjectMedia",
+			},
+		},
+		ConnectedVia:   "NotConnected",
+		Description:    "Virtual Media",
+		ID:             m.ID,
+		MediaTypes:     []string{"CD", "DVD"},
+		Name:           "Virtual CD",
+		WriteProtected: true,
+	}
+
+	if m.Image != "" {
+		res.ConnectedVia = "URI"
+		res.Image = m.Image
+		res.ImageName = m.Image[strings.LastIndex(m.Image, "/")+1:]
+		res.Inserted = true
+		res.TransferProtocolType = "OEM"
+		if u, err := url.Parse(m.Image); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			res.TransferProtocolType = strings.ToUpper(u.Scheme)
+		}
+	}
+
+	return res
+}
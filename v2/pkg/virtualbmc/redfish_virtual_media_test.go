@@ -0,0 +1,90 @@
+package virtualbmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redfish VirtualMedia", func() {
+	var (
+		machine *MachineMock
+		router  http.Handler
+	)
+
+	BeforeEach(func() {
+		machine = &MachineMock{
+			status: PowerStatusOn,
+			media:  []VirtualMedia{{ID: "installer"}},
+		}
+		users, err := NewUserHolder(DefaultUsers)
+		Expect(err).NotTo(HaveOccurred())
+		router = prepareRouter(redfishOptions{machine: machine, bmc: &BMCMock{}, users: users})
+	})
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("cybozu", "cybozu")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	getMedia := func() VirtualMediaResource {
+		w := request(http.MethodGet, "/redfish/v1/Managers/1/VirtualMedia/installer", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var res VirtualMediaResource
+		Expect(json.Unmarshal(w.Body.Bytes(), &res)).To(Succeed())
+		return res
+	}
+
+	It("should list virtual media", func() {
+		w := request(http.MethodGet, "/redfish/v1/Managers/1/VirtualMedia", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var collection ResourceCollection
+		Expect(json.Unmarshal(w.Body.Bytes(), &collection)).To(Succeed())
+		Expect(collection.Members).To(Equal([]OdataID{{OdataID: "/redfish/v1/Managers/1/VirtualMedia/installer"}}))
+
+		w = request(http.MethodGet, "/redfish/v1/Managers/2/VirtualMedia", "")
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+		w = request(http.MethodGet, "/redfish/v1/Managers/1/VirtualMedia/floppy", "")
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should insert and eject media", func() {
+		res := getMedia()
+		Expect(res.Inserted).To(BeFalse())
+		Expect(res.ConnectedVia).To(Equal("NotConnected"))
+
+		w := request(http.MethodPost, res.Actions.InsertMedia.Target,
+			`{"Image": "http://example.com/images/ubuntu.iso", "Inserted": true, "WriteProtected": true}`)
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		res = getMedia()
+		Expect(res.Inserted).To(BeTrue())
+		Expect(res.Image).To(Equal("http://example.com/images/ubuntu.iso"))
+		Expect(res.ImageName).To(Equal("ubuntu.iso"))
+		Expect(res.TransferProtocolType).To(Equal("HTTP"))
+
+		w = request(http.MethodPost, res.Actions.EjectMedia.Target, `{}`)
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		Expect(getMedia().Inserted).To(BeFalse())
+	})
+
+	It("should reject unsupported media", func() {
+		target := "/redfish/v1/Managers/1/VirtualMedia/installer/Actions/VirtualMedia.InsertMedia"
+		for _, body := range []string{
+			`{"Image": "nfs://example.com/ubuntu.iso"}`,
+			`{"Image": "http://example.com/ubuntu.iso", "WriteProtected": false}`,
+			`{"Image": "http://example.com/ubuntu.iso", "TransferProtocolType": "CIFS"}`,
+		} {
+			w := request(http.MethodPost, target, body)
+			Expect(w.Code).To(Equal(http.StatusBadRequest), body)
+		}
+		Expect(machine.media[0].Image).To(BeEmpty())
+	})
+})
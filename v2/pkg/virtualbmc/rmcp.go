@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net"
 )
 
 type remoteManagementControlProtocolHeader struct {
@@ -24,12 +25,12 @@ const (
 	RmcpClassOem  = 0x08
 )
 
-func handleRMCPRequest(buf io.Reader, machine Machine, session *rmcpPlusSessionHolder, bmcUser *bmcUserHolder) ([]byte, error) {
+func handleRMCPRequest(buf io.Reader, addr net.Addr, machine Machine, session *rmcpPlusSessionHolder, bmcUser *UserHolder) ([]byte, error) {
 	rmcp, err := newRMCP(buf)
 	if err != nil {
 		return nil, err
 	}
-	res, err := rmcp.handle(buf, machine, session, bmcUser)
+	res, err := rmcp.handle(buf, addr, machine, session, bmcUser)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +47,7 @@ func newRMCP(buf io.Reader) (*remoteManagementControlProtocolHeader, error) {
 	return header, nil
 }
 
-func (r *remoteManagementControlProtocolHeader) handle(buf io.Reader, machine Machine, session *rmcpPlusSessionHolder, bmcUser *bmcUserHolder) ([]byte, error) {
+func (r *remoteManagementControlProtocolHeader) handle(buf io.Reader, addr net.Addr, machine Machine, session *rmcpPlusSessionHolder, bmcUser *UserHolder) ([]byte, error) {
 	var class string
 	switch r.Class {
 	case RmcpClassIpmi:
@@ -54,10 +55,13 @@ func (r *remoteManagementControlProtocolHeader) handle(buf io.Reader, machine Ma
 		if err != nil {
 			return nil, err
 		}
-		res, err := ipmiSession.handle(buf, machine, session, bmcUser)
+		res, err := ipmiSession.handle(buf, addr, machine, session, bmcUser)
 		if err != nil {
 			return nil, err
 		}
+		if res == nil {
+			return nil, nil
+		}
 
 		return appendRMCPHeader(res)
 	case RmcpClassAsf:
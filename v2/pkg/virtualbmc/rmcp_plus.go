@@ -6,20 +6,27 @@ import (
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha1"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 )
 
 const (
+	payloadTypeIPMI                        = 0x00
+	payloadTypeSOL                         = 0x01
 	payloadTypeRMCPPlusOpenSessionRequest  = 0x10
 	payloadTypeRMCPPlusOpenSessionResponse = 0x11
 	payloadTypeRAKPMessage1                = 0x12
 	payloadTypeRAKPMessage2                = 0x13
 	payloadTypeRAKPMessage3                = 0x14
 	payloadTypeRAKPMessage4                = 0x15
+
+	payloadTypeMask          = 0x3f
+	payloadTypeAuthenticated = 0x40
+	payloadTypeEncrypted     = 0x80
 )
 
 type maximumPrivilegeLevel uint8
@@ -31,36 +38,36 @@ const maximumPrivilegeLevelAdministrator maximumPrivilegeLevel = 0x04
 type rmcpStatus uint8
 
 const (
-	rmcpPlusStatusNoErrors rmcpStatus = 0x00
+	rmcpPlusStatusNoErrors                        rmcpStatus = 0x00
+	rmcpPlusStatusInvalidAuthenticationAlgorithm  rmcpStatus = 0x04
+	rmcpPlusStatusInvalidIntegrityAlgorithm       rmcpStatus = 0x05
+	rmcpPlusStatusInvalidConfidentialityAlgorithm rmcpStatus = 0x10
+	rmcpPlusStatusUnauthorizedRole                rmcpStatus = 0x09
+	rmcpPlusStatusUnauthorizedName                rmcpStatus = 0x0d
+	rmcpPlusStatusInvalidIntegrityCheckValue      rmcpStatus = 0x0f
+	rmcpPlusStatusNoCipherSuiteMatch              rmcpStatus = 0x11
 )
 
-type authenticationAlgorithm uint8
-
-// 0x00: RKAP-SHA1, 0x01: RKAP-HMAC-SHA1, 0x02: RKAP-HMAC-MD5, 0x03: RKAP-HMAC-SHA256
-// We only support RKAP-HMAC-SHA1 which is default authentication algorithm
-const authenticationAlgorithmRKAPHMACSHA1 authenticationAlgorithm = 0x01
-
-type integrityAlgorithm uint8
-
-// 0x01: HMAC-SHA1-196, 0x02: HMAC-MD5-128, 0x03: MD5-128, 0x04: HMAC-SHA-256-128
-// We only support HMAC-SHA1-196 which is default integrity algorithm
-const integrityAlgorithmHMACSHA1196 integrityAlgorithm = 0x01
-
-type confidentialityAlgorithm uint8
-
-// 0x01: AES-CBC-128, 0x02: XRC-4128, 0x03: XRC-440
-// We only support AES-CBC-128 which is default confidentiality algorithm
-const confidentialityAlgorithmAESCBC128 confidentialityAlgorithm = 0x01
+// privilegeLevelMask extracts the requested maximum privilege level from the role of RAKP Message 1
+const privilegeLevelMask = 0x0f
 
 const authenticationPayloadTypeAuthenticationAlgorithm = 0x00
 const integrityPayloadTypeIntegrityAlgorithm = 0x01
 const confidentialityPayloadTypeConfidentialityAlgorithm = 0x02
 
+// algorithmPayloadLength is the length of an algorithm payload in Open Session Request/Response.
+// 0 in the request means that the BMC can choose any algorithm.
+const algorithmPayloadLength = 0x08
+
+// rmcpPlusSessionHeaderLength is the length of the RMCP+ session header for IPMI and SOL payloads
+const rmcpPlusSessionHeaderLength = 12
+
 // rmcpPlus represents RMCP+
 type rmcpPlus struct {
 	header  *rmcpPlusSessionHeader
 	session *rmcpPlusSessionHolder
-	bmcUser *bmcUserHolder
+	bmcUser *UserHolder
+	addr    net.Addr
 }
 
 // rmcpPlusSessionHeader represents RMCP+ RMCPPlusSession Header
@@ -134,43 +141,46 @@ type rakpMessage1Request struct {
 	UserName                                        [20]byte
 }
 
-// rakpMessage2Response represents RAKP Message2 response
+// rakpMessage2Response represents RAKP Message2 response followed by the key exchange authentication code
 type rakpMessage2Response struct {
-	MessageTag                    uint8
-	RmcpPlusStatusCode            rmcpStatus
-	Reserved1                     [2]byte
-	RemoteConsoleSessionId        uint32
-	ManagedSystemRandomNumber     [16]byte
-	ManagedSystemGuid             [16]byte
-	KeyExchangeAuthenticationCode [20]byte
+	MessageTag                uint8
+	RmcpPlusStatusCode        rmcpStatus
+	Reserved1                 [2]byte
+	RemoteConsoleSessionId    uint32
+	ManagedSystemRandomNumber [16]byte
+	ManagedSystemGuid         [16]byte
 }
 
-// rakpMessage3Request represents RAKP Message3 request
+// rakpMessage3Request represents RAKP Message3 request followed by the key exchange authentication code
 type rakpMessage3Request struct {
-	MessageTag                    uint8
-	RmcpPlusStatusCode            rmcpStatus
-	Reserved1                     [2]byte
-	ManagedSystemSessionId        uint32
-	KeyExchangeAuthenticationCode [20]byte
+	MessageTag             uint8
+	RmcpPlusStatusCode     rmcpStatus
+	Reserved1              [2]byte
+	ManagedSystemSessionId uint32
 }
 
-// rakpMessage4Response represents RAKP Message4 response
+// rakpMessage4Response represents RAKP Message4 response followed by the integrity check value
 type rakpMessage4Response struct {
 	MessageTag             uint8
 	RmcpPlusStatusCode     rmcpStatus
 	Reserved1              [2]byte
 	RemoteConsoleSessionId uint32
-	IntegrityCheckValue    [12]byte
 }
 
-// ipmiSessionTrailer represents ipmi RMCPPlusSession Trailer added to the end of the encrypted packet
-type ipmiSessionTrailer struct {
-	IntegrityPad [2]byte
-	PadLength    uint8
-	NextHeader   uint8
+// rmcpPlusErrorResponse represents Open Session Response and RAKP messages with an error status
+type rmcpPlusErrorResponse struct {
+	MessageTag             uint8
+	RmcpPlusStatusCode     rmcpStatus
+	Reserved1              [2]byte
+	RemoteConsoleSessionId uint32
 }
 
-func newRMCPPlus(buf io.Reader, authType authenticationType, session *rmcpPlusSessionHolder, bmcUser *bmcUserHolder) (*rmcpPlus, error) {
+const (
+	sessionTrailerPad        = 0xff
+	sessionTrailerNextHeader = 0x07
+)
+
+func newRMCPPlus(buf io.Reader, addr net.Addr, authType authenticationType, session *rmcpPlusSessionHolder, bmcUser *UserHolder) (*rmcpPlus, error) {
 	header, err := deserializeRMCPPlusSessionHeader(buf, authType)
 	if err != nil {
 		return nil, err
@@ -180,26 +190,34 @@ func newRMCPPlus(buf io.Reader, authType authenticationType, session *rmcpPlusSe
 		header:  header,
 		session: session,
 		bmcUser: bmcUser,
+		addr:    addr,
 	}, nil
 }
 
 // handle handles RMCP+ format request
 func (r *rmcpPlus) handle(buf io.Reader, machine Machine) ([]byte, error) {
-	payloadType := r.header.PayloadType & 0x3f
-	authenticated := (r.header.PayloadType & 0x40) >> 6
-	encrypted := (r.header.PayloadType & 0x80) >> 7
-
-	if authenticated == 1 && encrypted == 1 {
-		return r.handleEncryptedRequest(buf, machine)
+	payload := make([]byte, r.header.IpmiPayloadLen)
+	if err := binary.Read(buf, binary.LittleEndian, payload); err != nil {
+		return nil, err
 	}
 
+	payloadType := r.header.PayloadType & payloadTypeMask
 	switch payloadType {
 	case payloadTypeRMCPPlusOpenSessionRequest:
-		return r.handleOpenSessionRequest(buf)
+		return r.handleOpenSessionRequest(bytes.NewReader(payload))
 	case payloadTypeRAKPMessage1:
-		return r.handleRAKPMessage1Request(buf)
+		// remote consoles may omit the trailing bytes of the user name field
+		if size := binary.Size(rakpMessage1Request{}); len(payload) < size {
+			payload = append(payload, make([]byte, size-len(payload))...)
+		}
+		return r.handleRAKPMessage1Request(bytes.NewReader(payload), machine)
 	case payloadTypeRAKPMessage3:
-		return r.handleRAKPMessage3Request(buf)
+		return r.handleRAKPMessage3Request(payload)
+	case payloadTypeIPMI, payloadTypeSOL:
+		if r.header.SessionId == 0 {
+			return r.handleSessionlessRequest(payload, machine)
+		}
+		return r.handleSessionRequest(buf, payload, machine)
 	}
 
 	return nil, errors.New("unsupported payload type")
@@ -228,30 +246,56 @@ func deserializeRMCPPlusSessionHeader(buf io.Reader, authType authenticationType
 	return header, nil
 }
 
-func (r *rmcpPlus) handleOpenSessionRequest(buf io.Reader) ([]byte, error) {
-	payload, err := deserializeOpenSessionRequestPayload(buf)
-	if err != nil {
+// serializeRMCPPlusPayload serializes a payload outside of a session
+func serializeRMCPPlusPayload(payloadType uint8, payload interface{}, extra []byte) ([]byte, error) {
+	pbuf := bytes.Buffer{}
+	if err := binary.Write(&pbuf, binary.LittleEndian, payload); err != nil {
 		return nil, err
 	}
+	pbuf.Write(extra)
 
-	// Serialize RMCP+ session header
 	obuf := bytes.Buffer{}
 	rmcpPlus := &rmcpPlusSessionHeader{
 		AuthenticationType:    authTypeRMCPPlus,
-		PayloadType:           payloadTypeRMCPPlusOpenSessionResponse,
+		PayloadType:           payloadType,
 		SessionId:             0,
 		SessionSequenceNumber: 0,
-		IpmiPayloadLen:        36,
+		IpmiPayloadLen:        uint16(pbuf.Len()),
 	}
 	if err := binary.Write(&obuf, binary.LittleEndian, rmcpPlus); err != nil {
 		return nil, err
 	}
+	obuf.Write(pbuf.Bytes())
+
+	return obuf.Bytes(), nil
+}
+
+func (r *rmcpPlus) handleOpenSessionRequest(buf io.Reader) ([]byte, error) {
+	payload, err := deserializeOpenSessionRequestPayload(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	suite, status := negotiateCipherSuite(r.session.cipherSuites(),
+		algorithmRequest{algorithm: uint8(payload.AuthenticationPayloadAlgorithm), any: payload.AuthenticationPayloadLength == 0},
+		algorithmRequest{algorithm: uint8(payload.IntegrityPayloadAlgorithm), any: payload.IntegrityPayloadLength == 0},
+		algorithmRequest{algorithm: uint8(payload.ConfidentialityPayloadAlgorithm), any: payload.ConfidentialityPayloadLength == 0},
+	)
+	if status != rmcpPlusStatusNoErrors {
+		response := &rmcpPlusErrorResponse{
+			MessageTag:             payload.MessageTag,
+			RmcpPlusStatusCode:     status,
+			RemoteConsoleSessionId: payload.RemoteConsoleSessionId,
+		}
+		return serializeRMCPPlusPayload(payloadTypeRMCPPlusOpenSessionResponse, response, nil)
+	}
 
 	// Serialize Open RMCPPlusSession Response Payload
 	session, err := r.session.getNewRMCPPlusSession(payload.RemoteConsoleSessionId)
 	if err != nil {
 		return nil, err
 	}
+	session.CipherSuite = suite
 	response := &openSessionResponsePayload{
 		MessageTag:                      payload.MessageTag,
 		RmcpPlusStatusCode:              rmcpPlusStatusNoErrors,
@@ -261,25 +305,22 @@ func (r *rmcpPlus) handleOpenSessionRequest(buf io.Reader) ([]byte, error) {
 		ManagedSystemSessionId:          session.ManagedSystemSessionId,
 		AuthenticationPayloadType:       authenticationPayloadTypeAuthenticationAlgorithm,
 		Reserved3:                       [2]byte{},
-		AuthenticationPayloadLength:     0x08,
-		AuthenticationPayloadAlgorithm:  authenticationAlgorithmRKAPHMACSHA1,
+		AuthenticationPayloadLength:     algorithmPayloadLength,
+		AuthenticationPayloadAlgorithm:  suite.authentication,
 		Reserved5:                       [3]byte{},
 		IntegrityPayloadType:            integrityPayloadTypeIntegrityAlgorithm,
 		Reserved6:                       [2]byte{},
-		IntegrityPayloadLength:          0x08,
-		IntegrityPayloadAlgorithm:       integrityAlgorithmHMACSHA1196,
+		IntegrityPayloadLength:          algorithmPayloadLength,
+		IntegrityPayloadAlgorithm:       suite.integrity,
 		Reserved8:                       [3]byte{},
 		ConfidentialityPayloadType:      confidentialityPayloadTypeConfidentialityAlgorithm,
 		Reserved9:                       [2]byte{},
-		ConfidentialityPayloadLength:    0x08,
-		ConfidentialityPayloadAlgorithm: confidentialityAlgorithmAESCBC128,
+		ConfidentialityPayloadLength:    algorithmPayloadLength,
+		ConfidentialityPayloadAlgorithm: suite.confidentiality,
 		Reserved11:                      [3]byte{},
 	}
-	if err := binary.Write(&obuf, binary.LittleEndian, response); err != nil {
-		return nil, err
-	}
 
-	return obuf.Bytes(), nil
+	return serializeRMCPPlusPayload(payloadTypeRMCPPlusOpenSessionResponse, response, nil)
 }
 
 func deserializeOpenSessionRequestPayload(buf io.Reader) (*openSessionRequestPayload, error) {
@@ -291,7 +332,7 @@ func deserializeOpenSessionRequestPayload(buf io.Reader) (*openSessionRequestPay
 	return payload, nil
 }
 
-func (r *rmcpPlus) handleRAKPMessage1Request(buf io.Reader) ([]byte, error) {
+func (r *rmcpPlus) handleRAKPMessage1Request(buf io.Reader, machine Machine) ([]byte, error) {
 	payload, err := deserializeRAKPMessage1RequestPayload(buf)
 	if err != nil {
 		return nil, err
@@ -303,33 +344,34 @@ func (r *rmcpPlus) handleRAKPMessage1Request(buf io.Reader) ([]byte, error) {
 		return nil, errors.New("session hasn't been activated")
 	}
 
-	// Serialize RMCP+ session header
-	obuf := bytes.Buffer{}
-	rmcpPlus := &rmcpPlusSessionHeader{
-		AuthenticationType:    authTypeRMCPPlus,
-		PayloadType:           payloadTypeRAKPMessage2,
-		SessionId:             0,
-		SessionSequenceNumber: 0,
-		IpmiPayloadLen:        60,
+	if int(payload.UserNameLength) > len(payload.UserName) {
+		return nil, errors.New("user name is too long")
 	}
-	if err := binary.Write(&obuf, binary.LittleEndian, rmcpPlus); err != nil {
-		return nil, err
-	}
-
 	userName := payload.UserName[:payload.UserNameLength]
 	user, ok := r.bmcUser.getBMCUser(string(userName))
 	if !ok {
-		return nil, errors.New("user not found")
+		return r.rakpMessage2Error(payload, session, rmcpPlusStatusUnauthorizedName)
+	}
+	// 0 requests the highest privilege level of the user
+	privilege := Privilege(payload.RequestedMaximumPrivilegeLevelAndNameOnlyLookup & privilegeLevelMask)
+	if privilege == 0 {
+		privilege = user.Privilege
+	}
+	if !user.Privilege.allows(privilege) {
+		return r.rakpMessage2Error(payload, session, rmcpPlusStatusUnauthorizedRole)
 	}
 
 	managedSystemRandomNumber, err := generateRandomNumber()
 	if err != nil {
 		return nil, err
 	}
-	managedSystemGuid, err := generateRandomNumber()
+	// remote consoles may check the GUID against Get System GUID
+	guid, err := systemGUID(machine)
 	if err != nil {
 		return nil, err
 	}
+	var managedSystemGuid [16]byte
+	copy(managedSystemGuid[:], guid)
 
 	session.RemoteConsoleRandomNumber = payload.RemoteConsoleRandomNumber
 	session.ManagedSystemRandomNumber = managedSystemRandomNumber
@@ -337,31 +379,36 @@ func (r *rmcpPlus) handleRAKPMessage1Request(buf io.Reader) ([]byte, error) {
 	session.RequestedPrivilegeLevel = payload.RequestedMaximumPrivilegeLevelAndNameOnlyLookup
 	session.UserNameLength = payload.UserNameLength
 	session.UserName = userName
+	session.MaxPrivilege = privilege
 
-	// Generate Authentication Code with specified Authentication algorithm
-	authCode, err := generateAuthCode(session.RemoteConsoleSessionId, session.ManagedSystemSessionId, payload.RemoteConsoleRandomNumber, managedSystemRandomNumber,
-		managedSystemGuid, payload.RequestedMaximumPrivilegeLevelAndNameOnlyLookup, payload.UserNameLength, userName, user.Password)
+	// Generate Authentication Code with the negotiated authentication algorithm
+	authCode, err := generateAuthCode(session, user.Password)
 	if err != nil {
 		return nil, err
 	}
 
 	// Serialize RAKP Message2 Payload
-	fixedAuthCode := [20]byte{}
-	copy(fixedAuthCode[:], authCode)
 	response := &rakpMessage2Response{
-		MessageTag:                    payload.MessageTag,
-		RmcpPlusStatusCode:            rmcpPlusStatusNoErrors,
-		Reserved1:                     [2]byte{},
-		RemoteConsoleSessionId:        session.RemoteConsoleSessionId,
-		ManagedSystemRandomNumber:     managedSystemRandomNumber,
-		ManagedSystemGuid:             managedSystemGuid,
-		KeyExchangeAuthenticationCode: fixedAuthCode,
-	}
-	if err := binary.Write(&obuf, binary.LittleEndian, response); err != nil {
-		return nil, err
+		MessageTag:                payload.MessageTag,
+		RmcpPlusStatusCode:        rmcpPlusStatusNoErrors,
+		Reserved1:                 [2]byte{},
+		RemoteConsoleSessionId:    session.RemoteConsoleSessionId,
+		ManagedSystemRandomNumber: managedSystemRandomNumber,
+		ManagedSystemGuid:         managedSystemGuid,
 	}
 
-	return obuf.Bytes(), nil
+	return serializeRMCPPlusPayload(payloadTypeRAKPMessage2, response, authCode)
+}
+
+// rakpMessage2Error responds to RAKP Message 1 with the error status, and closes the session
+func (r *rmcpPlus) rakpMessage2Error(payload *rakpMessage1Request, session *rmcpPlusSession, status rmcpStatus) ([]byte, error) {
+	r.session.removeRMCPPlusSession(session.ManagedSystemSessionId)
+	response := &rmcpPlusErrorResponse{
+		MessageTag:             payload.MessageTag,
+		RmcpPlusStatusCode:     status,
+		RemoteConsoleSessionId: session.RemoteConsoleSessionId,
+	}
+	return serializeRMCPPlusPayload(payloadTypeRAKPMessage2, response, nil)
 }
 
 func deserializeRAKPMessage1RequestPayload(buf io.Reader) (*rakpMessage1Request, error) {
@@ -373,44 +420,43 @@ func deserializeRAKPMessage1RequestPayload(buf io.Reader) (*rakpMessage1Request,
 	return payload, nil
 }
 
-func generateAuthCode(remoteConsoleSessionId, managedSystemSessionId uint32, remoteConsoleRandomNumber, managedSystemRandomNumber, managedSystemGuid [16]byte,
-	requestedPrivilegeLevel, usernameLength uint8, userName []byte, password string) ([]byte, error) {
+func generateAuthCode(session *rmcpPlusSession, password string) ([]byte, error) {
 	buf := bytes.Buffer{}
-	if err := binary.Write(&buf, binary.LittleEndian, remoteConsoleSessionId); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.RemoteConsoleSessionId); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, managedSystemSessionId); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.ManagedSystemSessionId); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, remoteConsoleRandomNumber); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.RemoteConsoleRandomNumber); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, managedSystemRandomNumber); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.ManagedSystemRandomNumber); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, managedSystemGuid); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.ManagedSystemGuid); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, requestedPrivilegeLevel); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.RequestedPrivilegeLevel); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, usernameLength); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.UserNameLength); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, userName); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, session.UserName); err != nil {
 		return nil, err
 	}
 
-	mac := hmac.New(sha1.New, []byte(password))
-	mac.Write(buf.Bytes())
-	return mac.Sum(nil), nil
+	return session.CipherSuite.authCode([]byte(password), buf.Bytes()), nil
 }
 
-func (r *rmcpPlus) handleRAKPMessage3Request(buf io.Reader) ([]byte, error) {
+func (r *rmcpPlus) handleRAKPMessage3Request(data []byte) ([]byte, error) {
+	buf := bytes.NewReader(data)
 	payload, err := deserializeRAKPMessage3RequestPayload(buf)
 	if err != nil {
 		return nil, err
 	}
+	authCode := data[len(data)-buf.Len():]
 
 	session, ok := r.session.getRMCPPlusSession(payload.ManagedSystemSessionId)
 	if !ok {
@@ -419,37 +465,27 @@ func (r *rmcpPlus) handleRAKPMessage3Request(buf io.Reader) ([]byte, error) {
 
 	user, ok := r.bmcUser.getBMCUser(string(session.UserName))
 	if !ok {
-		return nil, errors.New("user not found")
+		return r.rakpMessage4Error(payload, session, rmcpPlusStatusUnauthorizedName)
 	}
 
-	ok, err = validateAuthCode(payload.KeyExchangeAuthenticationCode, session, user.Password)
+	ok, err = validateAuthCode(authCode, session, user.Password)
 	if err != nil {
 		return nil, err
 	}
 	if !ok {
-		return nil, errors.New("authentication failed")
-	}
-
-	// Serialize RMCP+ session header
-	obuf := bytes.Buffer{}
-	rmcpPlus := &rmcpPlusSessionHeader{
-		AuthenticationType:    authTypeRMCPPlus,
-		PayloadType:           payloadTypeRAKPMessage4,
-		SessionId:             0,
-		SessionSequenceNumber: 0,
-		IpmiPayloadLen:        20,
-	}
-	if err := binary.Write(&obuf, binary.LittleEndian, rmcpPlus); err != nil {
-		return nil, err
+		return r.rakpMessage4Error(payload, session, rmcpPlusStatusInvalidIntegrityCheckValue)
 	}
 
+	suite := session.CipherSuite
 	sik, err := generateSessionIntegrityKey(session, user.Password)
 	if err != nil {
 		return nil, err
 	}
 	session.SessionIntegrityKey = sik
-	session.IntegrityKey = generateK1(sik)
-	session.ConfidentialityKey = generateK2(sik)
+	session.IntegrityKey = generateK1(suite, sik)
+	session.ConfidentialityKey = generateK2(suite, sik)
+	session.Privilege = session.MaxPrivilege
+	session.Established = true
 
 	checkValue, err := generateSessionIntegrityCheckValue(session, sik)
 	if err != nil {
@@ -457,20 +493,24 @@ func (r *rmcpPlus) handleRAKPMessage3Request(buf io.Reader) ([]byte, error) {
 	}
 
 	// Serialize RAKP Message4 Payload
-	fixedCheckValue := [12]byte{}
-	copy(fixedCheckValue[:], checkValue)
 	response := &rakpMessage4Response{
 		MessageTag:             payload.MessageTag,
 		RmcpPlusStatusCode:     rmcpPlusStatusNoErrors,
 		Reserved1:              [2]byte{},
 		RemoteConsoleSessionId: session.RemoteConsoleSessionId,
-		IntegrityCheckValue:    fixedCheckValue,
-	}
-	if err := binary.Write(&obuf, binary.LittleEndian, response); err != nil {
-		return nil, err
 	}
 
-	return obuf.Bytes(), nil
+	return serializeRMCPPlusPayload(payloadTypeRAKPMessage4, response, checkValue)
+}
+
+func (r *rmcpPlus) rakpMessage4Error(payload *rakpMessage3Request, session *rmcpPlusSession, status rmcpStatus) ([]byte, error) {
+	r.session.removeRMCPPlusSession(session.ManagedSystemSessionId)
+	response := &rmcpPlusErrorResponse{
+		MessageTag:             payload.MessageTag,
+		RmcpPlusStatusCode:     status,
+		RemoteConsoleSessionId: session.RemoteConsoleSessionId,
+	}
+	return serializeRMCPPlusPayload(payloadTypeRAKPMessage4, response, nil)
 }
 
 func deserializeRAKPMessage3RequestPayload(buf io.Reader) (*rakpMessage3Request, error) {
@@ -482,7 +522,7 @@ func deserializeRAKPMessage3RequestPayload(buf io.Reader) (*rakpMessage3Request,
 	return payload, nil
 }
 
-func validateAuthCode(authCode [20]byte, session *rmcpPlusSession, password string) (bool, error) {
+func validateAuthCode(authCode []byte, session *rmcpPlusSession, password string) (bool, error) {
 	buf := bytes.Buffer{}
 	if err := binary.Write(&buf, binary.LittleEndian, session.ManagedSystemRandomNumber); err != nil {
 		return false, err
@@ -500,10 +540,8 @@ func validateAuthCode(authCode [20]byte, session *rmcpPlusSession, password stri
 		return false, err
 	}
 
-	mac := hmac.New(sha1.New, []byte(password))
-	mac.Write(buf.Bytes())
-	code := mac.Sum(nil)
-	return bytes.Equal(authCode[:], code[:]), nil
+	code := session.CipherSuite.authCode([]byte(password), buf.Bytes())
+	return hmac.Equal(authCode, code), nil
 }
 
 func generateSessionIntegrityKey(session *rmcpPlusSession, password string) ([]byte, error) {
@@ -524,27 +562,27 @@ func generateSessionIntegrityKey(session *rmcpPlusSession, password string) ([]b
 		return nil, err
 	}
 
-	mac := hmac.New(sha1.New, []byte(password))
-	mac.Write(buf.Bytes())
-	return mac.Sum(nil), nil
+	return session.CipherSuite.authCode([]byte(password), buf.Bytes()), nil
 }
 
-func generateK1(sessionIntegrityKey []byte) []byte {
-	return generateAdditionalKeyingMaterials(sessionIntegrityKey, 0x01)
+func generateK1(suite cipherSuite, sessionIntegrityKey []byte) []byte {
+	return generateAdditionalKeyingMaterials(suite, sessionIntegrityKey, 0x01)
 }
 
-func generateK2(sessionIntegrityKey []byte) []byte {
-	return generateAdditionalKeyingMaterials(sessionIntegrityKey, 0x02)
+func generateK2(suite cipherSuite, sessionIntegrityKey []byte) []byte {
+	return generateAdditionalKeyingMaterials(suite, sessionIntegrityKey, 0x02)
 }
 
-func generateAdditionalKeyingMaterials(sessionIntegrityKey []byte, b byte) []byte {
-	mac := hmac.New(sha1.New, sessionIntegrityKey)
-	var cons []byte
-	for i := 0; i < sha1.Size; i++ {
-		cons = append(cons, b)
+// keyingMaterialConstantLength is the length of the constants to generate K1 and K2, which is independent of the algorithm
+const keyingMaterialConstantLength = 20
+
+func generateAdditionalKeyingMaterials(suite cipherSuite, sessionIntegrityKey []byte, b byte) []byte {
+	cons := bytes.Repeat([]byte{b}, keyingMaterialConstantLength)
+	if key := suite.authCode(sessionIntegrityKey, cons); key != nil {
+		return key
 	}
-	mac.Write(cons)
-	return mac.Sum(nil)
+	// RAKP-none uses the constants as they are
+	return cons
 }
 
 func generateSessionIntegrityCheckValue(session *rmcpPlusSession, sessionIntegrityKey []byte) ([]byte, error) {
@@ -559,15 +597,48 @@ func generateSessionIntegrityCheckValue(session *rmcpPlusSession, sessionIntegri
 		return nil, err
 	}
 
-	mac := hmac.New(sha1.New, sessionIntegrityKey)
-	mac.Write(buf.Bytes())
-	// HMAC-SHA1-96
-	return mac.Sum(nil)[:12], nil
+	return session.CipherSuite.integrityCheckValue(sessionIntegrityKey, buf.Bytes()), nil
+}
+
+// handleSessionlessRequest handles IPMI messages outside of a session.
+// Only the commands for discovering the capabilities of the BMC are allowed.
+func (r *rmcpPlus) handleSessionlessRequest(payload []byte, machine Machine) ([]byte, error) {
+	if r.header.PayloadType != payloadTypeIPMI {
+		return nil, errors.New("unsupported payload outside of a session")
+	}
+
+	ipmi, err := newIPMI(bytes.NewBuffer(payload), len(payload), machine, r.session, r.bmcUser, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ipmi.isSessionless() {
+		return nil, fmt.Errorf("command %x is not allowed outside of a session", ipmi.message.Command)
+	}
+	res, err := ipmi.handle()
+	if err != nil {
+		return nil, err
+	}
+
+	obuf := bytes.Buffer{}
+	rmcpPlus := &rmcpPlusSessionHeader{
+		AuthenticationType:    authTypeRMCPPlus,
+		PayloadType:           payloadTypeIPMI,
+		SessionId:             0,
+		SessionSequenceNumber: 0,
+		IpmiPayloadLen:        uint16(len(res)),
+	}
+	if err := binary.Write(&obuf, binary.LittleEndian, rmcpPlus); err != nil {
+		return nil, err
+	}
+	obuf.Write(res)
+
+	return obuf.Bytes(), nil
 }
 
-func (r *rmcpPlus) handleEncryptedRequest(buf io.Reader, machine Machine) ([]byte, error) {
+// handleSessionRequest handles IPMI and SOL payloads in an established session
+func (r *rmcpPlus) handleSessionRequest(buf io.Reader, payload []byte, machine Machine) ([]byte, error) {
 	session, ok := r.session.getRMCPPlusSession(r.header.SessionId)
-	if !ok {
+	if !ok || !session.Established {
 		return nil, errors.New("session hasn't been activated")
 	}
 
@@ -576,73 +647,138 @@ func (r *rmcpPlus) handleEncryptedRequest(buf io.Reader, machine Machine) ([]byt
 		return nil, errors.New("user not found")
 	}
 
-	payload := make([]byte, r.header.IpmiPayloadLen)
-	if err := binary.Read(buf, binary.LittleEndian, payload); err != nil {
-		return nil, err
+	suite := session.CipherSuite
+	authenticated := r.header.PayloadType&payloadTypeAuthenticated != 0
+	encrypted := r.header.PayloadType&payloadTypeEncrypted != 0
+	if authenticated != (suite.integrity != integrityAlgorithmNone) || encrypted != (suite.confidentiality != confidentialityAlgorithmNone) {
+		return nil, fmt.Errorf("payload is not protected as cipher suite %d", suite.id)
 	}
 
-	plain, err := decryptByCBCMode(session.ConfidentialityKey, payload)
-	if err != nil {
-		return nil, err
+	if authenticated {
+		if err := r.verifyIntegrity(buf, payload, session); err != nil {
+			return nil, err
+		}
 	}
 
-	ipmi, err := newIPMI(bytes.NewBuffer(plain), len(plain), machine, r.session)
-	if err != nil {
-		return nil, err
+	plain := payload
+	if encrypted {
+		var err error
+		plain, err = decryptByCBCMode(session.ConfidentialityKey, payload)
+		if err != nil {
+			return nil, err
+		}
 	}
-	ipmiResponse, err := ipmi.handle()
-	if err != nil {
-		return nil, err
+	session.setRemoteAddr(r.addr)
+
+	payloadType := r.header.PayloadType & payloadTypeMask
+	var res []byte
+	switch payloadType {
+	case payloadTypeIPMI:
+		ipmi, err := newIPMI(bytes.NewBuffer(plain), len(plain), machine, r.session, r.bmcUser, session)
+		if err != nil {
+			return nil, err
+		}
+		res, err = ipmi.handle()
+		if err != nil {
+			return nil, err
+		}
+	case payloadTypeSOL:
+		sol := r.session.activeSOL()
+		if sol == nil || sol.sessionID != session.ManagedSystemSessionId {
+			return nil, errors.New("SOL payload is not activated")
+		}
+		var err error
+		res, err = sol.handlePacket(plain)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			// no need to respond to ACK-only packets
+			return nil, nil
+		}
+	}
+
+	return encapsulatePayload(session, payloadType, res)
+}
+
+// integrityPadLength returns the length of the integrity pad to make the data covered by the AuthCode a multiple of 4 bytes
+func integrityPadLength(payloadLength int) int {
+	// the data consists of the session header, the payload, the integrity pad, the pad length and the next header
+	return (4 - (rmcpPlusSessionHeaderLength+payloadLength+2)%4) % 4
+}
+
+// verifyIntegrity reads the session trailer, and verifies the AuthCode
+func (r *rmcpPlus) verifyIntegrity(buf io.Reader, payload []byte, session *rmcpPlusSession) error {
+	data := bytes.Buffer{}
+	if err := binary.Write(&data, binary.LittleEndian, r.header); err != nil {
+		return err
 	}
-	ciphered, err := encryptByCBCMode(session.ConfidentialityKey, ipmiResponse)
-	if err != nil {
-		return nil, err
+	data.Write(payload)
+
+	// integrity pad, pad length and next header
+	trailer := make([]byte, integrityPadLength(len(payload))+2)
+	if _, err := io.ReadFull(buf, trailer); err != nil {
+		return err
+	}
+	data.Write(trailer)
+
+	expected := session.CipherSuite.integrityData(session.IntegrityKey, data.Bytes())
+	authCode := make([]byte, len(expected))
+	if _, err := io.ReadFull(buf, authCode); err != nil {
+		return err
+	}
+	if !hmac.Equal(authCode, expected) {
+		return errors.New("integrity check failed")
+	}
+	return nil
+}
+
+// encapsulatePayload protects the payload with the negotiated algorithms, and adds the RMCP+ session header and trailer
+func encapsulatePayload(session *rmcpPlusSession, payloadType uint8, payload []byte) ([]byte, error) {
+	suite := session.CipherSuite
+	if suite.confidentiality != confidentialityAlgorithmNone {
+		ciphered, err := encryptByCBCMode(session.ConfidentialityKey, payload)
+		if err != nil {
+			return nil, err
+		}
+		payloadType |= payloadTypeEncrypted
+		payload = ciphered
+	}
+	if suite.integrity != integrityAlgorithmNone {
+		payloadType |= payloadTypeAuthenticated
 	}
 
 	// Serialize RMCP+ session header
 	obuf := bytes.Buffer{}
 	rmcpPlus := &rmcpPlusSessionHeader{
 		AuthenticationType:    authTypeRMCPPlus,
-		PayloadType:           0xc0, // payload_type.encrypted(1b) + payload_type.authenticated(1b) + payload_type(6b) (11000000)
+		PayloadType:           payloadType, // payload_type.encrypted(1b) + payload_type.authenticated(1b) + payload_type(6b)
 		SessionId:             session.RemoteConsoleSessionId,
-		SessionSequenceNumber: r.header.SessionSequenceNumber,
-		IpmiPayloadLen:        uint16(len(ciphered)),
+		SessionSequenceNumber: session.nextSequenceNumber(),
+		IpmiPayloadLen:        uint16(len(payload)),
 	}
 	if err := binary.Write(&obuf, binary.LittleEndian, rmcpPlus); err != nil {
 		return nil, err
 	}
-	if err := binary.Write(&obuf, binary.LittleEndian, ciphered); err != nil {
-		return nil, err
-	}
+	obuf.Write(payload)
 
-	// IntegrityPad is fixed at size 2 since we only support HMAC-SHA1-96
-	trailer := &ipmiSessionTrailer{
-		IntegrityPad: [2]byte{0xff, 0xff},
-		PadLength:    0x02,
-		NextHeader:   0x07,
-	}
-	if err := binary.Write(&obuf, binary.LittleEndian, trailer); err != nil {
-		return nil, err
+	if suite.integrity == integrityAlgorithmNone {
+		return obuf.Bytes(), nil
 	}
 
+	padLength := integrityPadLength(len(payload))
+	obuf.Write(bytes.Repeat([]byte{sessionTrailerPad}, padLength))
+	obuf.WriteByte(uint8(padLength))
+	obuf.WriteByte(sessionTrailerNextHeader)
+
 	ret := obuf.Bytes()
 	// Generate Integrity data using fields from RMCP+ header up to and including the field that immediately precedes the AuthCode itself
-	authCode, err := generateIntegrityData(ret, session.IntegrityKey)
-	if err != nil {
-		return nil, err
-	}
+	authCode := suite.integrityData(session.IntegrityKey, ret)
 	ret = append(ret, authCode...)
 
 	return ret, nil
 }
 
-func generateIntegrityData(data, integrityKey []byte) ([]byte, error) {
-	mac := hmac.New(sha1.New, integrityKey)
-	mac.Write(data)
-	// HMAC-SHA1-96
-	return mac.Sum(nil)[:12], nil
-}
-
 func decryptByCBCMode(key []byte, payload []byte) ([]byte, error) {
 	if len(payload) < aes.BlockSize {
 		return nil, errors.New("payload must be longer that block size")
@@ -662,8 +798,12 @@ func decryptByCBCMode(key []byte, payload []byte) ([]byte, error) {
 	cbc := cipher.NewCBCDecrypter(block, iv)
 	cbc.CryptBlocks(plain, payload)
 
-	padLength := plain[len(plain)-1]
-	return plain[:aes.BlockSize-(padLength+1)], nil
+	// The confidentiality trailer consists of the pad bytes and the pad length
+	padLength := int(plain[len(plain)-1])
+	if padLength+1 > len(plain) {
+		return nil, errors.New("invalid pad length")
+	}
+	return plain[:len(plain)-(padLength+1)], nil
 }
 
 func encryptByCBCMode(key []byte, plain []byte) ([]byte, error) {
@@ -673,16 +813,17 @@ func encryptByCBCMode(key []byte, plain []byte) ([]byte, error) {
 	}
 
 	paddedPlaintext := padPKCS7(plain)
-	iv, err := generateRandomNumber()
-	if err != nil {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
 		return nil, err
 	}
-	cbc := cipher.NewCBCEncrypter(block, iv[:])
-	ciphered := make([]byte, aes.BlockSize)
+	cbc := cipher.NewCBCEncrypter(block, iv)
+	ciphered := make([]byte, len(paddedPlaintext))
 	cbc.CryptBlocks(ciphered, paddedPlaintext)
-	return append(iv[:], ciphered...), nil
+	return append(iv, ciphered...), nil
 }
 
+// padPKCS7 appends the confidentiality trailer, the pad bytes 1, 2, 3... followed by the pad length
 func padPKCS7(data []byte) []byte {
 	padSize := aes.BlockSize - (len(data) % aes.BlockSize)
 	pad := make([]byte, padSize)
@@ -690,7 +831,7 @@ func padPKCS7(data []byte) []byte {
 		pad[i] = byte(i + 1)
 	}
 	pad[padSize-1] = byte(padSize - 1)
-	return append(data, pad...)
+	return append(data[:len(data):len(data)], pad...)
 }
 
 const randomNumberSize = 16
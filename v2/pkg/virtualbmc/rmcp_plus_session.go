@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/binary"
+	"net"
+	"sync"
 )
 
 type rmcpPlusSessionHolder struct {
 	sessions map[uint32]*rmcpPlusSession
+	// conn is used to send SOL packets which are not responses to requests
+	conn net.PacketConn
+	// sol is the SOL payload activated by one of the sessions
+	sol *solSession
+	// bmc is reset by Cold Reset and Warm Reset commands
+	bmc BMC
 }
 
 type rmcpPlusSession struct {
@@ -22,10 +30,31 @@ type rmcpPlusSession struct {
 	SessionIntegrityKey       []byte
 	IntegrityKey              []byte
 	ConfidentialityKey        []byte
+	CipherSuite               cipherSuite
+	// MaxPrivilege is the privilege level requested in RAKP Message 1, which the user is allowed to use
+	MaxPrivilege Privilege
+	// Privilege is the current privilege level of the session
+	Privilege Privilege
+	// Established is true after the remote console is authenticated by RAKP Message 3
+	Established bool
+
+	// mu protects the fields below, which are also used by the SOL goroutines
+	mu                     sync.Mutex
+	remoteAddr             net.Addr
+	outboundSequenceNumber uint32
+}
+
+func newRMCPPlusSessionHolder(conn net.PacketConn, bmc BMC) *rmcpPlusSessionHolder {
+	return &rmcpPlusSessionHolder{
+		sessions: make(map[uint32]*rmcpPlusSession),
+		conn:     conn,
+		bmc:      bmc,
+	}
 }
 
-func newRMCPPlusSessionHolder() *rmcpPlusSessionHolder {
-	return &rmcpPlusSessionHolder{sessions: make(map[uint32]*rmcpPlusSession)}
+// cipherSuites returns the cipher suites available for the sessions of the BMC
+func (r *rmcpPlusSessionHolder) cipherSuites() []cipherSuite {
+	return availableCipherSuites(r.bmc.CipherSuiteZero())
 }
 
 func (r *rmcpPlusSessionHolder) getNewRMCPPlusSession(remoteConsoleSessionId uint32) (*rmcpPlusSession, error) {
@@ -62,6 +91,55 @@ func (r *rmcpPlusSessionHolder) removeRMCPPlusSession(id uint32) {
 	if ok {
 		delete(r.sessions, id)
 	}
+	if r.sol != nil && r.sol.sessionID == id {
+		r.deactivateSOL()
+	}
+}
+
+// activeSOL returns the SOL payload if it is active
+func (r *rmcpPlusSessionHolder) activeSOL() *solSession {
+	if r.sol == nil || r.sol.isClosed() {
+		return nil
+	}
+	return r.sol
+}
+
+func (r *rmcpPlusSessionHolder) deactivateSOL() {
+	if r.sol != nil {
+		r.sol.close()
+		r.sol = nil
+	}
+}
+
+// close deactivates the SOL payload
+func (r *rmcpPlusSessionHolder) close() {
+	r.deactivateSOL()
+}
+
+func (s *rmcpPlusSession) setRemoteAddr(addr net.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remoteAddr = addr
+}
+
+func (s *rmcpPlusSession) getRemoteAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remoteAddr
+}
+
+// nextSequenceNumber returns the session sequence number for the next packet sent to the remote console
+func (s *rmcpPlusSession) nextSequenceNumber() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outboundSequenceNumber++
+	if s.outboundSequenceNumber == 0 {
+		s.outboundSequenceNumber++
+	}
+	return s.outboundSequenceNumber
 }
 
 func generateRandomUint32() (*uint32, error) {
@@ -0,0 +1,367 @@
+package virtualbmc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// rmcpPlusClient is a minimal remote console to test RMCP+ sessions
+type rmcpPlusClient struct {
+	machine   Machine
+	holder    *rmcpPlusSessionHolder
+	users     *UserHolder
+	user      string
+	password  string
+	role      uint8
+	suite     cipherSuite
+	sessionID uint32
+	bmcID     uint32
+	seq       uint32
+	k1        []byte
+	k2        []byte
+	// guid is the managed system GUID in RAKP Message 2
+	guid []byte
+}
+
+func newRMCPPlusClient(machine Machine) *rmcpPlusClient {
+	users, err := NewUserHolder(DefaultUsers)
+	Expect(err).NotTo(HaveOccurred())
+	return &rmcpPlusClient{
+		machine:   machine,
+		holder:    newRMCPPlusSessionHolder(nil, &BMCMock{}),
+		users:     users,
+		user:      "cybozu",
+		password:  "cybozu",
+		role:      0x10 | uint8(PrivilegeAdministrator),
+		sessionID: 0x12345678,
+	}
+}
+
+func (c *rmcpPlusClient) send(payloadType uint8, sessionID uint32, payload []byte) []byte {
+	buf := []byte{RmcpVersion1, 0, 0xff, RmcpClassIpmi, byte(authTypeRMCPPlus), payloadType}
+	buf = binary.LittleEndian.AppendUint32(buf, sessionID)
+	buf = binary.LittleEndian.AppendUint32(buf, c.seq)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(payload)))
+	buf = append(buf, payload...)
+	if payloadType&payloadTypeAuthenticated != 0 {
+		padLength := (4 - (len(buf)-4+2)%4) % 4
+		buf = append(buf, bytes.Repeat([]byte{0xff}, padLength)...)
+		buf = append(buf, byte(padLength), 0x07)
+		buf = append(buf, c.integrityData(buf[4:])...)
+	}
+	c.seq++
+
+	res, err := handleRMCPRequest(bytes.NewBuffer(buf), &net.UDPAddr{}, c.machine, c.holder, c.users)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(res[:4]).To(Equal([]byte{RmcpVersion1, 0, 0xff, RmcpClassIpmi}))
+	return res[4:]
+}
+
+// payload returns the payload of a response, and verifies its integrity
+func (c *rmcpPlusClient) payload(res []byte) (uint8, []byte) {
+	payloadType := res[1]
+	length := int(binary.LittleEndian.Uint16(res[10:12]))
+	payload := res[12 : 12+length]
+	if payloadType&payloadTypeAuthenticated != 0 {
+		padLength := (4 - (12+length+2)%4) % 4
+		end := 12 + length + padLength + 2
+		Expect(res[end-1]).To(Equal(byte(0x07)))
+		Expect(res[end:]).To(Equal(c.integrityData(res[:end])))
+	} else {
+		Expect(res).To(HaveLen(12 + length))
+	}
+	if payloadType&payloadTypeEncrypted != 0 {
+		block, err := aes.NewCipher(c.k2[:16])
+		Expect(err).NotTo(HaveOccurred())
+		plain := make([]byte, len(payload)-16)
+		cipher.NewCBCDecrypter(block, payload[:16]).CryptBlocks(plain, payload[16:])
+		payload = plain[:len(plain)-int(plain[len(plain)-1])-1]
+	}
+	return payloadType & payloadTypeMask, payload
+}
+
+func (c *rmcpPlusClient) hash() func() hash.Hash {
+	if c.suite.authentication == authenticationAlgorithmRAKPHMACSHA256 {
+		return sha256.New
+	}
+	return sha1.New
+}
+
+func (c *rmcpPlusClient) hmac(key []byte, data ...[]byte) []byte {
+	if c.suite.authentication == authenticationAlgorithmRAKPNone {
+		return nil
+	}
+	mac := hmac.New(c.hash(), key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func (c *rmcpPlusClient) integrityData(data []byte) []byte {
+	switch c.suite.integrity {
+	case integrityAlgorithmHMACSHA1196:
+		mac := hmac.New(sha1.New, c.k1)
+		mac.Write(data)
+		return mac.Sum(nil)[:12]
+	case integrityAlgorithmHMACSHA256128:
+		mac := hmac.New(sha256.New, c.k1)
+		mac.Write(data)
+		return mac.Sum(nil)[:16]
+	}
+	return nil
+}
+
+func (c *rmcpPlusClient) openSession(auth, integrity, confidentiality uint8, length uint8) []byte {
+	payload := []byte{0x01, 0x04, 0, 0}
+	payload = binary.LittleEndian.AppendUint32(payload, c.sessionID)
+	payload = append(payload, 0x00, 0, 0, length, auth, 0, 0, 0)
+	payload = append(payload, 0x01, 0, 0, length, integrity, 0, 0, 0)
+	payload = append(payload, 0x02, 0, 0, length, confidentiality, 0, 0, 0)
+	payloadType, res := c.payload(c.send(payloadTypeRMCPPlusOpenSessionRequest, 0, payload))
+	Expect(payloadType).To(Equal(uint8(payloadTypeRMCPPlusOpenSessionResponse)))
+	return res
+}
+
+func (c *rmcpPlusClient) activate(suite cipherSuite) {
+	Expect(c.authenticate(suite)).To(Equal(rmcpPlusStatusNoErrors))
+}
+
+// authenticate establishes a session, and returns the status of RAKP Message 2 or 4
+func (c *rmcpPlusClient) authenticate(suite cipherSuite) rmcpStatus {
+	res := c.openSession(uint8(suite.authentication), uint8(suite.integrity), uint8(suite.confidentiality), 8)
+	Expect(res[1]).To(Equal(uint8(rmcpPlusStatusNoErrors)))
+	c.suite = cipherSuite{
+		id:              suite.id,
+		authentication:  authenticationAlgorithm(res[16]),
+		integrity:       integrityAlgorithm(res[24]),
+		confidentiality: confidentialityAlgorithm(res[32]),
+	}
+	Expect(c.suite).To(Equal(suite))
+	c.bmcID = binary.LittleEndian.Uint32(res[8:12])
+
+	// RAKP Message 1 and 2
+	rc := make([]byte, 16)
+	_, err := rand.Read(rc)
+	Expect(err).NotTo(HaveOccurred())
+	role := c.role
+	user := []byte(c.user)
+	password := []byte(c.password)
+	payload := []byte{0x02, 0, 0, 0}
+	payload = binary.LittleEndian.AppendUint32(payload, c.bmcID)
+	payload = append(payload, rc...)
+	payload = append(payload, role, 0, 0, byte(len(user)))
+	payload = append(payload, user...)
+	payloadType, res := c.payload(c.send(payloadTypeRAKPMessage1, 0, payload))
+	Expect(payloadType).To(Equal(uint8(payloadTypeRAKPMessage2)))
+	if status := rmcpStatus(res[1]); status != rmcpPlusStatusNoErrors {
+		return status
+	}
+	rm, guid := res[8:24], res[24:40]
+	c.guid = guid
+	sid := binary.LittleEndian.AppendUint32(nil, c.sessionID)
+	bmcID := binary.LittleEndian.AppendUint32(nil, c.bmcID)
+	// the BMC is verified after RAKP Message 4 so that the BMC can reject a wrong password
+	bmcAuthCode := res[40:]
+
+	// RAKP Message 3 and 4
+	payload = []byte{0x03, 0, 0, 0}
+	payload = append(payload, bmcID...)
+	payload = append(payload, c.hmac(password, rm, sid, []byte{role, byte(len(user))}, user)...)
+	payloadType, res = c.payload(c.send(payloadTypeRAKPMessage3, 0, payload))
+	Expect(payloadType).To(Equal(uint8(payloadTypeRAKPMessage4)))
+	if status := rmcpStatus(res[1]); status != rmcpPlusStatusNoErrors {
+		return status
+	}
+	Expect(bmcAuthCode).To(Equal(c.hmac(password, sid, bmcID, rc, rm, guid, []byte{role, byte(len(user))}, user)))
+	sik := c.hmac(password, rc, rm, []byte{role, byte(len(user))}, user)
+	switch suite.authentication {
+	case authenticationAlgorithmRKAPHMACSHA1:
+		Expect(res[8:]).To(Equal(c.hmac(sik, rc, bmcID, guid)[:12]))
+	case authenticationAlgorithmRAKPHMACSHA256:
+		Expect(res[8:]).To(Equal(c.hmac(sik, rc, bmcID, guid)[:16]))
+	default:
+		Expect(res[8:]).To(BeEmpty())
+	}
+	c.k1 = c.hmac(sik, bytes.Repeat([]byte{0x01}, 20))
+	c.k2 = c.hmac(sik, bytes.Repeat([]byte{0x02}, 20))
+	return rmcpPlusStatusNoErrors
+}
+
+// command sends an IPMI command in the session, and returns the completion code and the response data
+func (c *rmcpPlusClient) command(netFunction, command uint8, data ...byte) (completionCode, []byte) {
+	message := []byte{0x20, netFunction << 2, byte(0x100 - (0x20+int(netFunction<<2))&0xff), 0x81, 0x04, command}
+	message = append(message, data...)
+	sum := 0
+	for _, b := range message[3:] {
+		sum += int(b)
+	}
+	message = append(message, byte(0x100-sum&0xff))
+
+	payloadType := uint8(payloadTypeIPMI)
+	if c.suite.confidentiality != confidentialityAlgorithmNone {
+		payloadType |= payloadTypeEncrypted
+		block, err := aes.NewCipher(c.k2[:16])
+		Expect(err).NotTo(HaveOccurred())
+		// the confidentiality pad and the pad length make the message a multiple of the block size
+		padLength := (16 - (len(message)+1)%16) % 16
+		plain := append([]byte{}, message...)
+		for i := 1; i <= padLength; i++ {
+			plain = append(plain, byte(i))
+		}
+		plain = append(plain, byte(padLength))
+		iv := make([]byte, 16)
+		ciphered := make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphered, plain)
+		message = append(iv, ciphered...)
+	}
+	if c.suite.integrity != integrityAlgorithmNone {
+		payloadType |= payloadTypeAuthenticated
+	}
+
+	resType, res := c.payload(c.send(payloadType, c.bmcID, message))
+	Expect(resType).To(Equal(uint8(payloadTypeIPMI)))
+	Expect(res[5]).To(Equal(command))
+	return completionCode(res[6]), res[7 : len(res)-1]
+}
+
+// getChassisStatus sends Get Chassis Status in the session, and returns the response data
+func (c *rmcpPlusClient) getChassisStatus() []byte {
+	code, data := c.command(ipmiNetFNChassis, ipmiCmdGetChassisStatus)
+	Expect(code).To(Equal(completionCodeOK))
+	return data
+}
+
+var _ = Describe("RMCP+", func() {
+	It("should establish sessions with the supported cipher suites", func() {
+		for _, suite := range supportedCipherSuites {
+			By(fmt.Sprintf("using cipher suite %d", suite.id), func() {
+				client := newRMCPPlusClient(&MachineMock{status: PowerStatusOn})
+				client.holder = newRMCPPlusSessionHolder(nil, &BMCMock{cipherSuiteZero: true})
+				client.activate(suite)
+				Expect(client.getChassisStatus()[0] & chassisPowerStateBitmaskPowerOn).NotTo(BeZero())
+			})
+		}
+	})
+
+	It("should reject a wrong password with every available cipher suite", func() {
+		for _, suite := range availableCipherSuites(false) {
+			By(fmt.Sprintf("using cipher suite %d", suite.id), func() {
+				client := newRMCPPlusClient(&MachineMock{status: PowerStatusOn})
+				client.password = "wrong-password"
+				Expect(client.authenticate(suite)).To(Equal(rmcpPlusStatusInvalidIntegrityCheckValue))
+				_, ok := client.holder.getRMCPPlusSession(client.bmcID)
+				Expect(ok).To(BeFalse())
+			})
+		}
+	})
+
+	It("should not accept cipher suite 0 unless it is enabled", func() {
+		client := newRMCPPlusClient(&MachineMock{})
+		res := client.openSession(byte(authenticationAlgorithmRAKPNone), byte(integrityAlgorithmNone), byte(confidentialityAlgorithmNone), 8)
+		Expect(res[1]).To(Equal(uint8(rmcpPlusStatusInvalidAuthenticationAlgorithm)))
+
+		// cipher suite 0 authenticates anyone when it is enabled
+		client.holder = newRMCPPlusSessionHolder(nil, &BMCMock{cipherSuiteZero: true})
+		client.password = "wrong-password"
+		client.activate(supportedCipherSuites[0])
+	})
+
+	It("should send the system GUID in RAKP Message 2", func() {
+		client := newRMCPPlusClient(&MachineMock{status: PowerStatusOn})
+		client.activate(supportedCipherSuites[len(supportedCipherSuites)-1])
+
+		code, guid := client.command(ipmiNetFNApp, ipmiCmdGetSystemGUID)
+		Expect(code).To(Equal(completionCodeOK))
+		Expect(client.guid).To(Equal(guid))
+	})
+
+	It("should negotiate the cipher suite", func() {
+		client := newRMCPPlusClient(&MachineMock{})
+
+		// the BMC chooses the strongest one
+		res := client.openSession(0, 0, 0, 0)
+		Expect(res[1]).To(Equal(uint8(rmcpPlusStatusNoErrors)))
+		Expect(res[16:17]).To(Equal([]byte{byte(authenticationAlgorithmRAKPHMACSHA256)}))
+		Expect(res[24:25]).To(Equal([]byte{byte(integrityAlgorithmHMACSHA256128)}))
+		Expect(res[32:33]).To(Equal([]byte{byte(confidentialityAlgorithmAESCBC128)}))
+
+		res = client.openSession(byte(authenticationAlgorithmRKAPHMACSHA1), byte(integrityAlgorithmHMACSHA256128), 0, 8)
+		Expect(res[1]).To(Equal(uint8(rmcpPlusStatusNoCipherSuiteMatch)))
+		res = client.openSession(0x02, 0, 0, 8)
+		Expect(res[1]).To(Equal(uint8(rmcpPlusStatusInvalidAuthenticationAlgorithm)))
+	})
+
+	It("should reject packets not protected as negotiated", func() {
+		client := newRMCPPlusClient(&MachineMock{})
+		client.activate(supportedCipherSuites[len(supportedCipherSuites)-1])
+
+		message := []byte{0x20, 0x00, 0xe0, 0x81, 0x04, ipmiCmdGetChassisStatus, 0x7a}
+		buf := []byte{RmcpVersion1, 0, 0xff, RmcpClassIpmi, byte(authTypeRMCPPlus), payloadTypeIPMI}
+		buf = binary.LittleEndian.AppendUint32(buf, client.bmcID)
+		buf = binary.LittleEndian.AppendUint32(buf, 1)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(message)))
+		buf = append(buf, message...)
+		_, err := handleRMCPRequest(bytes.NewBuffer(buf), &net.UDPAddr{}, client.machine, client.holder, client.users)
+		Expect(err).To(HaveOccurred())
+
+		// wrong integrity key
+		client.k1 = bytes.Repeat([]byte{0}, 32)
+		buf = []byte{RmcpVersion1, 0, 0xff, RmcpClassIpmi, byte(authTypeRMCPPlus), payloadTypeIPMI | payloadTypeAuthenticated | payloadTypeEncrypted}
+		buf = binary.LittleEndian.AppendUint32(buf, client.bmcID)
+		buf = binary.LittleEndian.AppendUint32(buf, 1)
+		buf = binary.LittleEndian.AppendUint16(buf, 32)
+		buf = append(buf, make([]byte, 32)...)
+		buf = append(buf, 0xff, 0xff, 0x02, 0x07)
+		buf = append(buf, client.integrityData(buf[4:])...)
+		_, err = handleRMCPRequest(bytes.NewBuffer(buf), &net.UDPAddr{}, client.machine, client.holder, client.users)
+		Expect(err).To(MatchError("integrity check failed"))
+	})
+
+	It("should list cipher suites outside of a session", func() {
+		client := newRMCPPlusClient(&MachineMock{})
+
+		var records []byte
+		for index := byte(0); ; index++ {
+			data := []byte{0x0e, 0x00, 0x80 | index}
+			message := []byte{0x20, ipmiNetFNApp << 2, 0xc8, 0x81, 0x04, ipmiCmdGetChannelCipherSuites}
+			message = append(message, data...)
+			sum := 0
+			for _, b := range message[3:] {
+				sum += int(b)
+			}
+			message = append(message, byte(0x100-sum&0xff))
+
+			payloadType, res := client.payload(client.send(payloadTypeIPMI, 0, message))
+			Expect(payloadType).To(Equal(uint8(payloadTypeIPMI)))
+			Expect(res[6]).To(Equal(uint8(completionCodeOK)))
+			chunk := res[8 : len(res)-1]
+			records = append(records, chunk...)
+			if len(chunk) < 16 {
+				break
+			}
+		}
+		Expect(records).To(HaveLen(5 * len(availableCipherSuites(false))))
+		Expect(records[:5]).To(Equal([]byte{0xc0, 1, 0x01, 0x40, 0x80}))
+		Expect(records[len(records)-5:]).To(Equal([]byte{0xc0, 17, 0x03, 0x44, 0x81}))
+
+		// commands other than discovery are not allowed outside of a session
+		message := []byte{0x20, 0x00, 0xe0, 0x81, 0x04, ipmiCmdGetChassisStatus, 0x7a}
+		buf := []byte{RmcpVersion1, 0, 0xff, RmcpClassIpmi, byte(authTypeRMCPPlus), payloadTypeIPMI, 0, 0, 0, 0, 0, 0, 0, 0, byte(len(message)), 0}
+		buf = append(buf, message...)
+		_, err := handleRMCPRequest(bytes.NewBuffer(buf), &net.UDPAddr{}, client.machine, client.holder, client.users)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,447 @@
+package virtualbmc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSELEntries is the capacity of the SEL. The oldest entries are overwritten when it is full.
+	maxSELEntries = 1024
+	selEntrySize  = 16
+
+	selRecordTypeSystemEvent = 0x02
+	// SELGeneratorBMC is the generator ID of the events logged by the BMC itself
+	SELGeneratorBMC = 0x0020
+	selEvMRev       = 0x04
+
+	selFirstEntry = 0x0000
+	selLastEntry  = 0xffff
+)
+
+// Sensor types
+const (
+	SensorTypeTemperature    = 0x01
+	SensorTypeVoltage        = 0x02
+	SensorTypeCurrent        = 0x03
+	SensorTypeFan            = 0x04
+	SensorTypeSystemRestart  = 0x1d
+	SensorTypeACPIPowerState = 0x22
+)
+
+// Event/reading types
+const (
+	// EventReadingTypeThreshold means that the offset in EventData1 is a threshold crossing
+	EventReadingTypeThreshold = 0x01
+	// EventReadingTypeSensorSpecific means that the offset in EventData1 is specific to the sensor type
+	EventReadingTypeSensorSpecific = 0x6f
+)
+
+// Event offsets of the sensors for the power events
+const (
+	acpiPowerStateS0 = 0x00
+	acpiPowerStateS5 = 0x05
+
+	systemRestartChassisControl = 0x01
+	systemRestartSystemRestart  = 0x07
+)
+
+// SELEntry represents a system event record of the SEL
+type SELEntry struct {
+	RecordID     uint16    `json:"record_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	GeneratorID  uint16    `json:"generator_id"`
+	SensorType   uint8     `json:"sensor_type"`
+	SensorNumber uint8     `json:"sensor_number"`
+	EventType    uint8     `json:"event_type"`
+	// Deassertion is true if the event is the deassertion of the offset
+	Deassertion bool     `json:"deassertion"`
+	EventData   [3]uint8 `json:"event_data"`
+}
+
+// SEL is the System Event Log of a BMC.
+// It is shared by the IPMI servers of the BMC and kept across BMC resets.
+// If the path is not empty, the entries are saved to the file so that they are also kept across restarts of placemat.
+type SEL struct {
+	mu      sync.Mutex
+	path    string
+	entries []SELEntry
+	lastID  uint16
+	// overflow is true if entries have been overwritten
+	overflow    bool
+	lastAdded   time.Time
+	lastErased  time.Time
+	reservation uint16
+	// notify is called with every added entry
+	notify func(SELEntry)
+}
+
+type selFile struct {
+	Entries    []SELEntry `json:"entries"`
+	LastID     uint16     `json:"last_id"`
+	Overflow   bool       `json:"overflow"`
+	LastAdded  time.Time  `json:"last_added"`
+	LastErased time.Time  `json:"last_erased"`
+}
+
+// NewSEL creates a SEL and loads its entries from the file at the path if it exists.
+// notify is called with every added entry if it is not nil.
+func NewSEL(path string, notify func(SELEntry)) (*SEL, error) {
+	s := &SEL{
+		path:   path,
+		notify: notify,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	default:
+		return nil, err
+	}
+
+	var f selFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to load SEL from %s: %w", path, err)
+	}
+	s.entries = f.Entries
+	s.lastID = f.LastID
+	s.overflow = f.Overflow
+	s.lastAdded = f.LastAdded
+	s.lastErased = f.LastErased
+	return s, nil
+}
+
+// Entries returns the entries of the SEL from the oldest
+func (s *SEL) Entries() []SELEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SELEntry(nil), s.entries...)
+}
+
+// Add adds an entry to the SEL. RecordID is assigned, and Timestamp is set to the current time if it is zero.
+func (s *SEL) Add(e SELEntry) (SELEntry, error) {
+	e, err := s.add(e)
+	if err != nil {
+		return SELEntry{}, err
+	}
+	if s.notify != nil {
+		s.notify(e)
+	}
+	return e, nil
+}
+
+func (s *SEL) add(e SELEntry) (SELEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	if s.lastID == selFirstEntry || s.lastID == selLastEntry {
+		s.lastID = 1
+	}
+	e.RecordID = s.lastID
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	e.Timestamp = e.Timestamp.Truncate(time.Second)
+
+	if len(s.entries) >= maxSELEntries {
+		s.entries = s.entries[len(s.entries)-maxSELEntries+1:]
+		s.overflow = true
+	}
+	s.entries = append(s.entries, e)
+	s.lastAdded = e.Timestamp
+
+	if err := s.saveLocked(); err != nil {
+		return SELEntry{}, err
+	}
+	return e, nil
+}
+
+// Clear deletes all entries of the SEL
+func (s *SEL) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = nil
+	s.overflow = false
+	s.lastErased = time.Now().Truncate(time.Second)
+	s.reservation = 0
+	return s.saveLocked()
+}
+
+// delete deletes the entry. selFirstEntry and selLastEntry select the first and the last entries.
+func (s *SEL) delete(id uint16) (uint16, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.indexLocked(id)
+	if !ok {
+		return 0, errSELEntryNotFound
+	}
+	id = s.entries[i].RecordID
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	s.lastErased = time.Now().Truncate(time.Second)
+	s.reservation = 0
+	return id, s.saveLocked()
+}
+
+var errSELEntryNotFound = errors.New("SEL entry not found")
+
+// get returns the entry and the record ID of the next entry
+func (s *SEL) get(id uint16) (SELEntry, uint16, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.indexLocked(id)
+	if !ok {
+		return SELEntry{}, 0, errSELEntryNotFound
+	}
+	next := uint16(selLastEntry)
+	if i+1 < len(s.entries) {
+		next = s.entries[i+1].RecordID
+	}
+	return s.entries[i], next, nil
+}
+
+func (s *SEL) indexLocked(id uint16) (int, bool) {
+	if len(s.entries) == 0 {
+		return 0, false
+	}
+	switch id {
+	case selFirstEntry:
+		return 0, true
+	case selLastEntry:
+		return len(s.entries) - 1, true
+	}
+	for i, e := range s.entries {
+		if e.RecordID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// reserve cancels the current reservation and returns a new one, which is required to delete entries
+func (s *SEL) reserve() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reservation++
+	if s.reservation == 0 {
+		s.reservation = 1
+	}
+	return s.reservation
+}
+
+func (s *SEL) validReservation(id uint16) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reservation != 0 && s.reservation == id
+}
+
+type selInfo struct {
+	entries    int
+	overflow   bool
+	lastAdded  time.Time
+	lastErased time.Time
+}
+
+func (s *SEL) info() selInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return selInfo{
+		entries:    len(s.entries),
+		overflow:   s.overflow,
+		lastAdded:  s.lastAdded,
+		lastErased: s.lastErased,
+	}
+}
+
+// saveLocked writes the SEL to the file atomically. The caller must hold mu.
+func (s *SEL) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(selFile{
+		Entries:    s.entries,
+		LastID:     s.lastID,
+		Overflow:   s.overflow,
+		LastAdded:  s.lastAdded,
+		LastErased: s.lastErased,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// PowerStatusChanged logs the change of the ACPI power state of the machine
+func (s *SEL) PowerStatusChanged(status PowerStatus) error {
+	var offset uint8
+	switch status {
+	case PowerStatusOn:
+		offset = acpiPowerStateS0
+	case PowerStatusOff:
+		offset = acpiPowerStateS5
+	default:
+		return nil
+	}
+	_, err := s.Add(SELEntry{
+		GeneratorID:  SELGeneratorBMC,
+		SensorType:   SensorTypeACPIPowerState,
+		SensorNumber: sensorNumberACPIPowerState,
+		EventType:    EventReadingTypeSensorSpecific,
+		EventData:    [3]uint8{offset, 0xff, 0xff},
+	})
+	return err
+}
+
+// MachineReset logs a restart of the machine
+func (s *SEL) MachineReset() error {
+	_, err := s.Add(SELEntry{
+		GeneratorID:  SELGeneratorBMC,
+		SensorType:   SensorTypeSystemRestart,
+		SensorNumber: sensorNumberSystemRestart,
+		EventType:    EventReadingTypeSensorSpecific,
+		EventData:    [3]uint8{systemRestartSystemRestart, 0xff, 0xff},
+	})
+	return err
+}
+
+// encode returns the SEL record of the entry
+func (e SELEntry) encode() []byte {
+	buf := make([]byte, selEntrySize)
+	binary.LittleEndian.PutUint16(buf[0:], e.RecordID)
+	buf[2] = selRecordTypeSystemEvent
+	binary.LittleEndian.PutUint32(buf[3:], uint32(e.Timestamp.Unix()))
+	binary.LittleEndian.PutUint16(buf[7:], e.GeneratorID)
+	buf[9] = selEvMRev
+	buf[10] = e.SensorType
+	buf[11] = e.SensorNumber
+	buf[12] = e.EventType & 0x7f
+	if e.Deassertion {
+		buf[12] |= 0x80
+	}
+	copy(buf[13:], e.EventData[:])
+	return buf
+}
+
+// decodeSELEntry reads a system event record. RecordID and Timestamp are ignored because they are assigned on addition.
+func decodeSELEntry(data []byte) (SELEntry, error) {
+	if len(data) < selEntrySize {
+		return SELEntry{}, fmt.Errorf("too short SEL record: %d", len(data))
+	}
+	if data[2] != selRecordTypeSystemEvent {
+		return SELEntry{}, fmt.Errorf("unsupported SEL record type: %x", data[2])
+	}
+	e := SELEntry{
+		GeneratorID:  binary.LittleEndian.Uint16(data[7:]),
+		SensorType:   data[10],
+		SensorNumber: data[11],
+		EventType:    data[12] & 0x7f,
+		Deassertion:  data[12]&0x80 != 0,
+	}
+	copy(e.EventData[:], data[13:16])
+	return e, nil
+}
+
+// Severity returns the severity of the entry in Redfish
+func (e SELEntry) Severity() string {
+	if e.EventType != EventReadingTypeThreshold || e.Deassertion {
+		return "OK"
+	}
+	switch e.EventData[0] & 0x0f {
+	case thresholdLowerCriticalGoingLow, thresholdUpperCriticalGoingHigh:
+		return "Critical"
+	case thresholdLowerNonCriticalGoingLow, thresholdUpperNonCriticalGoingHigh:
+		return "Warning"
+	}
+	return "OK"
+}
+
+// Message returns the description of the entry
+func (e SELEntry) Message() string {
+	direction := "asserted"
+	if e.Deassertion {
+		direction = "deasserted"
+	}
+	return fmt.Sprintf("%s sensor #%d: %s %s", sensorTypeName(e.SensorType), e.SensorNumber, e.eventName(), direction)
+}
+
+func (e SELEntry) eventName() string {
+	offset := e.EventData[0] & 0x0f
+	switch {
+	case e.EventType == EventReadingTypeThreshold:
+		switch offset {
+		case thresholdLowerNonCriticalGoingLow:
+			return "Lower Non-critical going low"
+		case thresholdLowerCriticalGoingLow:
+			return "Lower Critical going low"
+		case thresholdUpperNonCriticalGoingHigh:
+			return "Upper Non-critical going high"
+		case thresholdUpperCriticalGoingHigh:
+			return "Upper Critical going high"
+		}
+	case e.EventType == EventReadingTypeSensorSpecific && e.SensorType == SensorTypeACPIPowerState:
+		switch offset {
+		case acpiPowerStateS0:
+			return "S0/G0: working"
+		case acpiPowerStateS5:
+			return "S5/G2: soft-off"
+		}
+	case e.EventType == EventReadingTypeSensorSpecific && e.SensorType == SensorTypeSystemRestart:
+		switch offset {
+		case systemRestartChassisControl:
+			return "Chassis control command"
+		case systemRestartSystemRestart:
+			return "System Restart"
+		}
+	}
+	return fmt.Sprintf("Event offset 0x%02x", offset)
+}
+
+func sensorTypeName(t uint8) string {
+	switch t {
+	case SensorTypeTemperature:
+		return "Temperature"
+	case SensorTypeVoltage:
+		return "Voltage"
+	case SensorTypeCurrent:
+		return "Current"
+	case SensorTypeFan:
+		return "Fan"
+	case SensorTypeSystemRestart:
+		return "System Boot Initiated"
+	case SensorTypeACPIPowerState:
+		return "System ACPI Power State"
+	}
+	return fmt.Sprintf("Sensor type 0x%02x", t)
+}
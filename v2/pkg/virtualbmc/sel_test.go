@@ -0,0 +1,71 @@
+package virtualbmc
+
+import (
+	"encoding/binary"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SEL", func() {
+	It("should keep entries across restarts", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "node1.json")
+		var notified []SELEntry
+		sel, err := NewSEL(path, func(e SELEntry) {
+			notified = append(notified, e)
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sel.PowerStatusChanged(PowerStatusOn)).To(Succeed())
+		Expect(sel.PowerStatusChanged(PowerStatusPoweringOff)).To(Succeed())
+		Expect(sel.MachineReset()).To(Succeed())
+		Expect(notified).To(HaveLen(2))
+		Expect(notified[0].RecordID).To(Equal(uint16(1)))
+		Expect(notified[0].Message()).To(Equal("System ACPI Power State sensor #48: S0/G0: working asserted"))
+		Expect(notified[1].Message()).To(Equal("System Boot Initiated sensor #49: System Restart asserted"))
+
+		sel, err = NewSEL(path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sel.Entries()).To(HaveLen(2))
+		e, err := sel.Add(SELEntry{SensorType: SensorTypeFan, SensorNumber: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(e.RecordID).To(Equal(uint16(3)))
+	})
+
+	It("should overwrite the oldest entries when it is full", func() {
+		sel, err := NewSEL("", nil)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i <= maxSELEntries; i++ {
+			_, err := sel.Add(SELEntry{SensorType: SensorTypeTemperature, SensorNumber: 1})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		entries := sel.Entries()
+		Expect(entries).To(HaveLen(maxSELEntries))
+		Expect(entries[0].RecordID).To(Equal(uint16(2)))
+		Expect(sel.info().overflow).To(BeTrue())
+	})
+
+	It("should encode and decode system event records", func() {
+		e := SELEntry{
+			GeneratorID:  0x0041,
+			SensorType:   SensorTypeVoltage,
+			SensorNumber: 5,
+			EventType:    EventReadingTypeThreshold,
+			Deassertion:  true,
+			EventData:    [3]uint8{0x52, 0xb4, 0xb4},
+		}
+		data := e.encode()
+		Expect(data).To(HaveLen(selEntrySize))
+		Expect(data[12]).To(Equal(uint8(0x81)))
+		Expect(binary.LittleEndian.Uint16(data[7:])).To(Equal(uint16(0x0041)))
+
+		decoded, err := decodeSELEntry(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(e))
+		Expect(decoded.Severity()).To(Equal("OK"))
+		decoded.Deassertion = false
+		Expect(decoded.Severity()).To(Equal("Critical"))
+	})
+})
@@ -0,0 +1,234 @@
+package virtualbmc
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// SensorUnit represents the base unit of a sensor. The values are the same as IPMI sensor unit type codes.
+type SensorUnit uint8
+
+const (
+	SensorUnitDegreesC = SensorUnit(1)
+	SensorUnitVolts    = SensorUnit(4)
+	SensorUnitWatts    = SensorUnit(6)
+	SensorUnitRPM      = SensorUnit(18)
+)
+
+func (u SensorUnit) String() string {
+	switch u {
+	case SensorUnitDegreesC:
+		return "degrees C"
+	case SensorUnitVolts:
+		return "Volts"
+	case SensorUnitWatts:
+		return "Watts"
+	case SensorUnitRPM:
+		return "RPM"
+	}
+	return "unspecified"
+}
+
+// Threshold offsets of the threshold based sensors
+const (
+	thresholdLowerNonCriticalGoingLow  = 0x00
+	thresholdLowerCriticalGoingLow     = 0x02
+	thresholdUpperNonCriticalGoingHigh = 0x07
+	thresholdUpperCriticalGoingHigh    = 0x09
+)
+
+// Threshold masks, which are also the bits of the threshold status of Get Sensor Reading
+const (
+	thresholdMaskLowerNonCritical = 0x01
+	thresholdMaskLowerCritical    = 0x02
+	thresholdMaskUpperNonCritical = 0x08
+	thresholdMaskUpperCritical    = 0x10
+)
+
+// Sensor numbers of the event-only sensors for the power events
+const (
+	sensorNumberACPIPowerState = 0x30
+	sensorNumberSystemRestart  = 0x31
+)
+
+// Sensor represents a threshold based analog sensor
+type Sensor struct {
+	Number uint8      `json:"number"`
+	Name   string     `json:"name"`
+	Type   uint8      `json:"type"`
+	Unit   SensorUnit `json:"unit"`
+	Value  float64    `json:"value"`
+	// The thresholds are ignored if they are zero
+	LowerCritical    float64 `json:"lower_critical,omitempty"`
+	LowerNonCritical float64 `json:"lower_non_critical,omitempty"`
+	UpperNonCritical float64 `json:"upper_non_critical,omitempty"`
+	UpperCritical    float64 `json:"upper_critical,omitempty"`
+
+	// resolution is the value of a raw reading of 1, which must be M * 10^exponent where M is 1 to 511
+	m        uint16
+	exponent int8
+}
+
+// defaultSensors resemble the sensors of a rack server
+var defaultSensors = []Sensor{
+	{Number: 0x01, Name: "Inlet Temp", Type: SensorTypeTemperature, Unit: SensorUnitDegreesC, Value: 23,
+		LowerCritical: 3, LowerNonCritical: 8, UpperNonCritical: 42, UpperCritical: 47, m: 1},
+	{Number: 0x02, Name: "CPU Temp", Type: SensorTypeTemperature, Unit: SensorUnitDegreesC, Value: 45,
+		LowerCritical: 3, LowerNonCritical: 8, UpperNonCritical: 85, UpperCritical: 90, m: 1},
+	{Number: 0x03, Name: "Fan1", Type: SensorTypeFan, Unit: SensorUnitRPM, Value: 5400,
+		LowerCritical: 600, LowerNonCritical: 840, m: 120},
+	{Number: 0x04, Name: "Fan2", Type: SensorTypeFan, Unit: SensorUnitRPM, Value: 5400,
+		LowerCritical: 600, LowerNonCritical: 840, m: 120},
+	{Number: 0x05, Name: "12V", Type: SensorTypeVoltage, Unit: SensorUnitVolts, Value: 12,
+		LowerCritical: 10.8, LowerNonCritical: 11.4, UpperNonCritical: 12.6, UpperCritical: 13.2, m: 6, exponent: -2},
+	{Number: 0x06, Name: "3.3V", Type: SensorTypeVoltage, Unit: SensorUnitVolts, Value: 3.3,
+		LowerCritical: 2.98, LowerNonCritical: 3.14, UpperNonCritical: 3.46, UpperCritical: 3.62, m: 2, exponent: -2},
+	{Number: 0x07, Name: "Pwr Consumption", Type: SensorTypeCurrent, Unit: SensorUnitWatts, Value: 120,
+		UpperNonCritical: 600, UpperCritical: 700, m: 4},
+}
+
+// raw converts the value to a raw reading
+func (s *Sensor) raw(v float64) uint8 {
+	r := math.Round(v / (float64(s.m) * math.Pow10(int(s.exponent))))
+	return uint8(math.Max(0, math.Min(math.MaxUint8, r)))
+}
+
+// thresholdMask returns the mask of the thresholds of the sensor
+func (s *Sensor) thresholdMask() uint8 {
+	var mask uint8
+	if s.LowerNonCritical != 0 {
+		mask |= thresholdMaskLowerNonCritical
+	}
+	if s.LowerCritical != 0 {
+		mask |= thresholdMaskLowerCritical
+	}
+	if s.UpperNonCritical != 0 {
+		mask |= thresholdMaskUpperNonCritical
+	}
+	if s.UpperCritical != 0 {
+		mask |= thresholdMaskUpperCritical
+	}
+	return mask
+}
+
+// thresholdStatus returns the thresholds crossed by the value
+func (s *Sensor) thresholdStatus(v float64) uint8 {
+	mask := s.thresholdMask()
+	var status uint8
+	if mask&thresholdMaskLowerNonCritical != 0 && v <= s.LowerNonCritical {
+		status |= thresholdMaskLowerNonCritical
+	}
+	if mask&thresholdMaskLowerCritical != 0 && v <= s.LowerCritical {
+		status |= thresholdMaskLowerCritical
+	}
+	if mask&thresholdMaskUpperNonCritical != 0 && v >= s.UpperNonCritical {
+		status |= thresholdMaskUpperNonCritical
+	}
+	if mask&thresholdMaskUpperCritical != 0 && v >= s.UpperCritical {
+		status |= thresholdMaskUpperCritical
+	}
+	return status
+}
+
+// SensorHolder holds the sensors of a BMC.
+// Crossing a threshold by changing a value logs an event in the SEL as real BMCs do.
+type SensorHolder struct {
+	mu      sync.Mutex
+	sensors []Sensor
+	sel     *SEL
+	created time.Time
+}
+
+// NewSensorHolder creates a SensorHolder with the default sensors, which logs threshold events in sel
+func NewSensorHolder(sel *SEL) *SensorHolder {
+	return &SensorHolder{
+		sensors: append([]Sensor(nil), defaultSensors...),
+		sel:     sel,
+		created: time.Now(),
+	}
+}
+
+// Sensors returns the sensors
+func (h *SensorHolder) Sensors() []Sensor {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]Sensor(nil), h.sensors...)
+}
+
+// sensor returns the sensor with the number
+func (h *SensorHolder) sensor(number uint8) (Sensor, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, s := range h.sensors {
+		if s.Number == number {
+			return s, true
+		}
+	}
+	return Sensor{}, false
+}
+
+// SetValue changes the value of the sensor with the name
+func (h *SensorHolder) SetValue(name string, value float64) error {
+	h.mu.Lock()
+	var sensor *Sensor
+	for i := range h.sensors {
+		if h.sensors[i].Name == name {
+			sensor = &h.sensors[i]
+			break
+		}
+	}
+	if sensor == nil {
+		h.mu.Unlock()
+		return fmt.Errorf("sensor not found: %s", name)
+	}
+	if value < 0 {
+		h.mu.Unlock()
+		return fmt.Errorf("negative value for sensor %s: %g", name, value)
+	}
+	before := sensor.thresholdStatus(sensor.Value)
+	sensor.Value = value
+	s := *sensor
+	h.mu.Unlock()
+
+	return h.logThresholdEvents(s, before, s.thresholdStatus(value))
+}
+
+// logThresholdEvents logs the assertions and the deassertions of the thresholds crossed by the change of the value
+func (h *SensorHolder) logThresholdEvents(s Sensor, before, after uint8) error {
+	if h.sel == nil {
+		return nil
+	}
+
+	thresholds := []struct {
+		mask   uint8
+		offset uint8
+		value  float64
+	}{
+		{thresholdMaskLowerNonCritical, thresholdLowerNonCriticalGoingLow, s.LowerNonCritical},
+		{thresholdMaskLowerCritical, thresholdLowerCriticalGoingLow, s.LowerCritical},
+		{thresholdMaskUpperNonCritical, thresholdUpperNonCriticalGoingHigh, s.UpperNonCritical},
+		{thresholdMaskUpperCritical, thresholdUpperCriticalGoingHigh, s.UpperCritical},
+	}
+	for _, t := range thresholds {
+		if (before^after)&t.mask == 0 {
+			continue
+		}
+		_, err := h.sel.Add(SELEntry{
+			GeneratorID:  SELGeneratorBMC,
+			SensorType:   s.Type,
+			SensorNumber: s.Number,
+			EventType:    EventReadingTypeThreshold,
+			Deassertion:  after&t.mask == 0,
+			// the trigger reading and the trigger threshold are in the event data 2 and 3
+			EventData: [3]uint8{0x50 | t.offset, s.raw(s.Value), s.raw(t.value)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
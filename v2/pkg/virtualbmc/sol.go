@@ -0,0 +1,293 @@
+package virtualbmc
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+const (
+	solPayloadInstance = 1
+	solHeaderLength    = 4
+	// solMaxPayloadSize is the maximum size of SOL payloads including the header.
+	// The number of characters in a packet must fit in the 1 byte accepted character count.
+	solMaxPayloadSize = 255
+	// solBufferSize is the maximum number of characters from the serial console waiting to be sent
+	solBufferSize = 64 * 1024
+
+	solRetryInterval     = 500 * time.Millisecond
+	solMaxRetries        = 10
+	solReconnectInterval = time.Second
+)
+
+// SOL operation (remote console to BMC) and status (BMC to remote console)
+const (
+	solOperationFlushOutbound = 0x01
+	solOperationFlushInbound  = 0x02
+
+	solStatusCharacterTransferUnavailable = 0x20
+	solStatusNack                         = 0x40
+)
+
+// solSession relays characters between the serial console of the machine and the remote console
+type solSession struct {
+	sessionID uint32
+	machine   Machine
+	send      func(payload []byte) error
+	done      chan struct{}
+	kick      chan struct{}
+
+	// mu protects the fields below
+	mu      sync.Mutex
+	closed  bool
+	console io.ReadWriteCloser
+	// pending holds the characters read from the serial console that have not been acknowledged
+	pending []byte
+	// seq is the sequence number of the last packet sent to the remote console
+	seq uint8
+	// outSeq is the sequence number of the packet waiting for an ACK, or 0 if there is none
+	outSeq  uint8
+	outLen  int
+	sentAt  time.Time
+	retries int
+	// inSeq and inAccepted are the sequence number and the accepted character count of the last packet from the remote console
+	inSeq      uint8
+	inAccepted uint8
+}
+
+func newSOLSession(sessionID uint32, machine Machine, send func(payload []byte) error) *solSession {
+	return &solSession{
+		sessionID: sessionID,
+		machine:   machine,
+		send:      send,
+		done:      make(chan struct{}),
+		kick:      make(chan struct{}, 1),
+	}
+}
+
+// start starts relaying characters until the session is closed
+func (s *solSession) start() {
+	go s.readConsole()
+	go s.transmit()
+}
+
+func (s *solSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.console != nil {
+		s.console.Close()
+		s.console = nil
+	}
+	close(s.done)
+}
+
+func (s *solSession) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+func (s *solSession) notify() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits for d, and returns false if the session is closed in the meantime
+func (s *solSession) wait(d time.Duration) bool {
+	select {
+	case <-s.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// readConsole reads characters from the serial console.
+// It reconnects to the console because the connection is closed when the machine is powered off.
+func (s *solSession) readConsole() {
+	buf := make([]byte, 1024)
+	for {
+		console, err := s.connect()
+		if err != nil {
+			if !s.wait(solReconnectInterval) {
+				return
+			}
+			continue
+		}
+
+		for {
+			n, err := console.Read(buf)
+			if n > 0 {
+				s.mu.Lock()
+				if room := solBufferSize - len(s.pending); n > room {
+					n = room
+				}
+				s.pending = append(s.pending, buf[:n]...)
+				s.mu.Unlock()
+				s.notify()
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		s.mu.Lock()
+		if s.console == console {
+			s.console = nil
+		}
+		s.mu.Unlock()
+		console.Close()
+		if !s.wait(solReconnectInterval) {
+			return
+		}
+	}
+}
+
+func (s *solSession) connect() (io.ReadWriteCloser, error) {
+	console, err := s.machine.SerialConsole()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		console.Close()
+		return nil, errors.New("SOL session is closed")
+	}
+	s.console = console
+	return console, nil
+}
+
+// transmit sends the characters from the serial console, and retransmits them until they are acknowledged
+func (s *solSession) transmit() {
+	ticker := time.NewTicker(solRetryInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.kick:
+		case <-ticker.C:
+		}
+
+		packet, err := s.nextPacket()
+		if err != nil {
+			log.Warn("deactivating SOL", map[string]interface{}{
+				log.FnError: err,
+			})
+			s.close()
+			return
+		}
+		if packet == nil {
+			continue
+		}
+		if err := s.send(packet); err != nil {
+			log.Warn("failed to send SOL packet", map[string]interface{}{
+				log.FnError: err,
+			})
+		}
+	}
+}
+
+// nextPacket returns the packet to be sent, or nil if there is nothing to send
+func (s *solSession) nextPacket() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.outSeq != 0 {
+		if time.Since(s.sentAt) < solRetryInterval {
+			return nil, nil
+		}
+		s.retries++
+		if s.retries > solMaxRetries {
+			return nil, errors.New("no ACK from the remote console")
+		}
+	} else {
+		if len(s.pending) == 0 {
+			return nil, nil
+		}
+		// sequence numbers cycle from 1 to 15, and 0 is reserved for ACK-only packets
+		s.seq = s.seq%15 + 1
+		s.outSeq = s.seq
+		s.outLen = len(s.pending)
+		if s.outLen > solMaxPayloadSize-solHeaderLength {
+			s.outLen = solMaxPayloadSize - solHeaderLength
+		}
+		s.retries = 0
+	}
+	s.sentAt = time.Now()
+
+	packet := make([]byte, solHeaderLength, solHeaderLength+s.outLen)
+	packet[0] = s.outSeq
+	return append(packet, s.pending[:s.outLen]...), nil
+}
+
+// handlePacket handles a SOL packet from the remote console, and returns the ACK packet.
+// It returns nil if the packet does not need an ACK.
+func (s *solSession) handlePacket(payload []byte) ([]byte, error) {
+	if len(payload) < solHeaderLength {
+		return nil, errors.New("SOL payload is too short")
+	}
+	seq, ack, accepted, operation := payload[0], payload[1], payload[2], payload[3]
+	data := payload[solHeaderLength:]
+	if len(data) > solMaxPayloadSize-solHeaderLength {
+		// accept characters up to the inbound payload size
+		data = data[:solMaxPayloadSize-solHeaderLength]
+	}
+
+	s.mu.Lock()
+	if ack != 0 && ack == s.outSeq {
+		// characters not accepted are sent again in the next packet
+		n := int(accepted)
+		if n > s.outLen {
+			n = s.outLen
+		}
+		s.pending = s.pending[n:]
+		s.outSeq = 0
+		s.outLen = 0
+	}
+	if operation&solOperationFlushOutbound != 0 {
+		s.pending = nil
+		s.outSeq = 0
+		s.outLen = 0
+	}
+	console := s.console
+	duplicated := seq != 0 && seq == s.inSeq
+	inAccepted := s.inAccepted
+	s.mu.Unlock()
+	s.notify()
+
+	if seq == 0 {
+		return nil, nil
+	}
+	if duplicated {
+		// the ACK was lost, so the remote console resent the packet
+		return []byte{0, seq, inAccepted, 0}, nil
+	}
+
+	if console == nil {
+		return []byte{0, seq, 0, solStatusNack | solStatusCharacterTransferUnavailable}, nil
+	}
+	if _, err := console.Write(data); err != nil {
+		return []byte{0, seq, 0, solStatusNack | solStatusCharacterTransferUnavailable}, nil
+	}
+
+	s.mu.Lock()
+	s.inSeq = seq
+	s.inAccepted = uint8(len(data))
+	s.mu.Unlock()
+	return []byte{0, seq, uint8(len(data)), 0}, nil
+}
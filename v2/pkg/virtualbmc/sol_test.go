@@ -0,0 +1,109 @@
+package virtualbmc
+
+import (
+	"bytes"
+	"io"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SOL", func() {
+	var (
+		sol     *solSession
+		serial  net.Conn
+		packets chan []byte
+	)
+
+	BeforeEach(func() {
+		var console net.Conn
+		console, serial = net.Pipe()
+		packets = make(chan []byte, 100)
+		sol = newSOLSession(1, &MachineMock{console: console}, func(payload []byte) error {
+			packets <- payload
+			return nil
+		})
+		sol.start()
+		Eventually(func() io.ReadWriteCloser {
+			sol.mu.Lock()
+			defer sol.mu.Unlock()
+			return sol.console
+		}).ShouldNot(BeNil())
+	})
+
+	AfterEach(func() {
+		sol.close()
+		serial.Close()
+	})
+
+	It("should write characters from the remote console to the serial console", func() {
+		received := make(chan []byte, 1)
+		go func() {
+			buf := make([]byte, 16)
+			n, _ := serial.Read(buf)
+			received <- buf[:n]
+		}()
+
+		ack, err := sol.handlePacket([]byte{1, 0, 0, 0, 'l', 's'})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ack).To(Equal([]byte{0, 1, 2, 0}))
+		Eventually(received).Should(Receive(Equal([]byte("ls"))))
+
+		// resent packets are acknowledged without writing them again
+		ack, err = sol.handlePacket([]byte{1, 0, 0, 0, 'l', 's'})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ack).To(Equal([]byte{0, 1, 2, 0}))
+
+		ack, err = sol.handlePacket([]byte{0, 0, 0, 0})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ack).To(BeNil())
+	})
+
+	It("should send characters from the serial console until they are acknowledged", func() {
+		_, err := serial.Write([]byte("login: "))
+		Expect(err).NotTo(HaveOccurred())
+
+		var packet []byte
+		Eventually(packets).Should(Receive(&packet))
+		Expect(packet).To(Equal(append([]byte{1, 0, 0, 0}, "login: "...)))
+
+		// retransmitted without an ACK
+		Eventually(packets).Should(Receive(&packet))
+		Expect(packet).To(Equal(append([]byte{1, 0, 0, 0}, "login: "...)))
+
+		// partially accepted
+		_, err = sol.handlePacket([]byte{0, 1, 3, 0})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(packets).Should(Receive(Equal(append([]byte{2, 0, 0, 0}, "in: "...))))
+
+		_, err = sol.handlePacket([]byte{0, 2, 4, 0})
+		Expect(err).NotTo(HaveOccurred())
+		for len(packets) > 0 {
+			<-packets
+		}
+		Consistently(packets, 2*solRetryInterval).ShouldNot(Receive())
+	})
+
+	It("should deactivate when the remote console does not respond", func() {
+		_, err := serial.Write([]byte("a"))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(sol.isClosed, 2*solRetryInterval*(solMaxRetries+2)).Should(BeTrue())
+	})
+})
+
+var _ = Describe("RMCP+ confidentiality", func() {
+	It("should encrypt and decrypt payloads longer than the block size", func() {
+		key := bytes.Repeat([]byte{0x5a}, 20)
+		for _, size := range []int{0, 1, 15, 16, 17, 40, 255} {
+			plain := bytes.Repeat([]byte{0xa5}, size)
+			ciphered, err := encryptByCBCMode(key, plain)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(ciphered) % 16).To(Equal(0))
+
+			decrypted, err := decryptByCBCMode(key, ciphered)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decrypted).To(Equal(plain), "size %d", size)
+		}
+	})
+})
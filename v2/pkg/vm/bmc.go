@@ -6,9 +6,12 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/placemat/v2/pkg/dcnet"
+	"github.com/cybozu-go/placemat/v2/pkg/event"
 	"github.com/cybozu-go/placemat/v2/pkg/types"
 	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
 	"github.com/cybozu-go/well"
@@ -41,6 +44,8 @@ func NewBMCServer(vms map[string]VM, networks []dcnet.Network, ch <-chan BMCInfo
 }
 
 func (s *bmcServer) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	env := well.NewEnvironment(ctx)
 
 OUTER:
@@ -57,42 +62,28 @@ OUTER:
 				})
 			}
 
-			// Start IPMI server
-			serverAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", info.bmcAddress, 623))
-			if err != nil {
-				log.Error("failed to resolve UDP address", map[string]interface{}{
-					log.FnError: err,
-					"address":   info.bmcAddress,
-				})
-			}
-			conn, err := net.ListenUDP("udp", serverAddr)
-			if err != nil {
-				log.Error("failed to listen UDP address", map[string]interface{}{
-					log.FnError: err,
-					"address":   info.bmcAddress,
-				})
-			}
+			events := virtualbmc.NewEventDispatcher(info.profile)
+			env.Go(events.Run)
 			env.Go(func(ctx context.Context) error {
-				return virtualbmc.StartIPMIServer(ctx, conn, s.vms[info.serial])
+				return forwardEvents(ctx, info.node, events)
 			})
-
-			// Start Redfish server
-			addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", info.bmcAddress, 443))
-			if err != nil {
-				log.Error("failed to resolve TCP address", map[string]interface{}{
-					log.FnError: err,
-					"address":   info.bmcAddress,
-				})
-			}
-			listener, err := net.ListenTCP("tcp", addr)
-			if err != nil {
-				log.Error("failed to listen TCP address", map[string]interface{}{
-					log.FnError: err,
-					"address":   info.bmcAddress,
-				})
-			}
 			env.Go(func(ctx context.Context) error {
-				return virtualbmc.StartRedfishServer(ctx, listener, s.vms[info.serial])
+				err := s.runBMC(ctx, info, events)
+				if err != nil {
+					// stop the BMC server with the error of the node
+					env.Cancel(err)
+					cancel()
+				}
+				return err
+			})
+
+			event.Publish(event.Event{
+				Type: event.TypeBMCRegistered,
+				Node: info.node,
+				Details: map[string]string{
+					"serial":      info.serial,
+					"bmc_address": info.bmcAddress,
+				},
 			})
 
 		case <-ctx.Done():
@@ -104,6 +95,119 @@ OUTER:
 	return env.Wait()
 }
 
+// runBMC runs the IPMI and Redfish servers of a node, and restarts them when the BMC is reset
+func (s *bmcServer) runBMC(ctx context.Context, info BMCInfo, events *virtualbmc.EventDispatcher) error {
+	bmc := &nodeBMC{
+		address:         info.bmcAddress,
+		profile:         info.profile,
+		cipherSuiteZero: info.cipherSuiteZero,
+		sensors:         info.sensors,
+		sel:             info.sel,
+		resetCh:         make(chan struct{}, 1),
+	}
+
+	for {
+		env := well.NewEnvironment(ctx)
+		if err := s.startBMCServers(env, info, bmc, events); err != nil {
+			env.Cancel(err)
+			return err
+		}
+
+		select {
+		case <-bmc.resetCh:
+		case <-ctx.Done():
+			env.Cancel(nil)
+			return env.Wait()
+		}
+
+		// wait for the response to the reset request to be sent
+		select {
+		case <-time.After(bmcResetDelay):
+		case <-ctx.Done():
+			env.Cancel(nil)
+			return env.Wait()
+		}
+
+		log.Info("resetting BMC", map[string]interface{}{
+			"serial":      info.serial,
+			"bmc_address": info.bmcAddress,
+		})
+		env.Cancel(nil)
+		// the servers return errors of the closed connections
+		env.Wait()
+
+		event.Publish(event.Event{
+			Type: event.TypeBMCReset,
+			Node: info.node,
+			Details: map[string]string{
+				"serial":      info.serial,
+				"bmc_address": info.bmcAddress,
+			},
+		})
+	}
+}
+
+// startBMCServers listens on the BMC address, and starts the IPMI and Redfish servers in the environment
+func (s *bmcServer) startBMCServers(env *well.Environment, info BMCInfo, bmc *nodeBMC, events *virtualbmc.EventDispatcher) error {
+	// Start IPMI server
+	serverAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", info.bmcAddress, 623))
+	if err != nil {
+		return fmt.Errorf("failed to resolve UDP address %s: %w", info.bmcAddress, err)
+	}
+	conn, err := net.ListenUDP("udp", serverAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen UDP address %s: %w", info.bmcAddress, err)
+	}
+
+	// Start Redfish server
+	addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", info.bmcAddress, 443))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to resolve TCP address %s: %w", info.bmcAddress, err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to listen TCP address %s: %w", info.bmcAddress, err)
+	}
+
+	env.Go(func(ctx context.Context) error {
+		return virtualbmc.StartIPMIServer(ctx, conn, s.vms[info.serial], bmc, info.users)
+	})
+	env.Go(func(ctx context.Context) error {
+		return virtualbmc.StartRedfishServer(ctx, listener, s.vms[info.serial], bmc, info.users, events)
+	})
+	return nil
+}
+
+// forwardEvents sends the lifecycle events of the node to the Redfish event subscribers of its BMC
+func forwardEvents(ctx context.Context, node string, events *virtualbmc.EventDispatcher) error {
+	ch, cancel := event.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if ev.Node != node {
+				continue
+			}
+			switch ev.Type {
+			case event.TypePowerStatusChanged:
+				events.PowerStatusChanged(virtualbmc.PowerStatus(ev.Details["power_status"]))
+			case event.TypeGuestReset:
+				events.MachineReset()
+			case event.TypeSELEntryAdded:
+				events.SELEntryAdded(ev.Details["message"], ev.Details["severity"])
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
 func (s *bmcServer) addBMCAddrToNetwork(info BMCInfo) error {
 	br, err := s.findBridge(info.bmcAddress)
 	if err != nil {
@@ -135,34 +239,126 @@ func (s *bmcServer) findBridge(address string) (dcnet.Network, error) {
 }
 
 type BMCInfo struct {
+	node       string
 	serial     string
 	bmcAddress string
+	// users is shared by the IPMI and Redfish servers of the node
+	users           *virtualbmc.UserHolder
+	profile         virtualbmc.Profile
+	cipherSuiteZero bool
+	sensors         *virtualbmc.SensorHolder
+	sel             *virtualbmc.SEL
+}
+
+// bmcResetDelay is the time to wait before the BMC is reset
+const bmcResetDelay = time.Second
+
+// nodeBMC implements virtualbmc.BMC
+type nodeBMC struct {
+	address         string
+	profile         virtualbmc.Profile
+	cipherSuiteZero bool
+	sensors         *virtualbmc.SensorHolder
+	sel             *virtualbmc.SEL
+	resetCh         chan struct{}
+}
+
+func (b *nodeBMC) Address() string {
+	return b.address
+}
+
+func (b *nodeBMC) Profile() virtualbmc.Profile {
+	return b.profile
+}
+
+func (b *nodeBMC) CipherSuiteZero() bool {
+	return b.cipherSuiteZero
+}
+
+func (b *nodeBMC) Sensors() *virtualbmc.SensorHolder {
+	return b.sensors
+}
+
+func (b *nodeBMC) SEL() *virtualbmc.SEL {
+	return b.sel
+}
+
+func (b *nodeBMC) Reset() error {
+	select {
+	case b.resetCh <- struct{}{}:
+	default:
+		// the BMC is already being reset
+	}
+	return nil
 }
 
 type guestConnection struct {
-	serial string
-	sent   bool
-	guest  net.Conn
-	ch     chan<- BMCInfo
+	node            string
+	serial          string
+	users           *virtualbmc.UserHolder
+	profile         virtualbmc.Profile
+	cipherSuiteZero bool
+	sensors         *virtualbmc.SensorHolder
+	sel             *virtualbmc.SEL
+	once            sync.Once
+	ch              chan<- BMCInfo
 }
 
-func (g *guestConnection) handle() {
-	bufr := bufio.NewReader(g.guest)
+// handle reads the BMC address from the guest.
+// It is called on every boot, but the address is sent only once because the BMC keeps running while the VM is powered off.
+func (g *guestConnection) handle(guest net.Conn) {
+	bufr := bufio.NewReader(guest)
 	for {
 		line, err := bufr.ReadBytes('\n')
 		if err != nil {
 			return
 		}
 
-		if g.sent {
-			continue
-		}
-
 		bmcAddress := string(bytes.TrimSpace(line))
-		g.ch <- BMCInfo{
-			serial:     g.serial,
-			bmcAddress: bmcAddress,
+		g.once.Do(func() {
+			g.ch <- BMCInfo{
+				node:            g.node,
+				serial:          g.serial,
+				bmcAddress:      bmcAddress,
+				users:           g.users,
+				profile:         g.profile,
+				cipherSuiteZero: g.cipherSuiteZero,
+				sensors:         g.sensors,
+				sel:             g.sel,
+			}
+		})
+	}
+}
+
+// newBMCUsers creates the BMC users of a node.
+// The users of the node take precedence over the cluster-wide ones, and the default users are used if neither is specified.
+func newBMCUsers(nodeSpec *types.NodeBMCSpec, clusterSpec *types.BMCSpec) (*virtualbmc.UserHolder, error) {
+	var specs []types.BMCUserSpec
+	switch {
+	case nodeSpec != nil && len(nodeSpec.Users) > 0:
+		specs = nodeSpec.Users
+	case clusterSpec != nil:
+		specs = clusterSpec.Users
+	default:
+		return virtualbmc.NewUserHolder(virtualbmc.DefaultUsers)
+	}
+
+	users := make([]virtualbmc.User, len(specs))
+	for i, u := range specs {
+		var privilege virtualbmc.Privilege
+		switch u.Privilege {
+		case types.BMCPrivilegeAdministrator, "":
+			privilege = virtualbmc.PrivilegeAdministrator
+		case types.BMCPrivilegeOperator:
+			privilege = virtualbmc.PrivilegeOperator
+		case types.BMCPrivilegeUser:
+			privilege = virtualbmc.PrivilegeUser
+		case types.BMCPrivilegeCallback:
+			privilege = virtualbmc.PrivilegeCallback
+		default:
+			return nil, fmt.Errorf("invalid privilege for BMC user %s: %s", u.Name, u.Privilege)
 		}
-		g.sent = true
+		users[i] = virtualbmc.User{Name: u.Name, Password: u.Password, Privilege: privilege}
 	}
+	return virtualbmc.NewUserHolder(users)
 }
@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"context"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BMC server", func() {
+	info := BMCInfo{node: "node1", serial: "1234", bmcAddress: "127.0.0.1"}
+
+	It("should return the error if it cannot listen on the BMC address", func() {
+		s := &bmcServer{vms: map[string]VM{}}
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(info.bmcAddress), Port: 623})
+		Expect(err).NotTo(HaveOccurred())
+		err = s.runBMC(context.Background(), info, nil)
+		Expect(err).To(MatchError(ContainSubstring("failed to listen UDP address")))
+		conn.Close()
+
+		listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP(info.bmcAddress), Port: 443})
+		Expect(err).NotTo(HaveOccurred())
+		err = s.runBMC(context.Background(), info, nil)
+		Expect(err).To(MatchError(ContainSubstring("failed to listen TCP address")))
+		listener.Close()
+
+		// the IPMI port is released on the failure
+		conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(info.bmcAddress), Port: 623})
+		Expect(err).NotTo(HaveOccurred())
+		conn.Close()
+	})
+
+	It("should stop with the error of the BMC of a node", func() {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(info.bmcAddress), Port: 623})
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		ch := make(chan BMCInfo, 1)
+		s := NewBMCServer(map[string]VM{}, nil, ch)
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Start(context.Background())
+		}()
+
+		ch <- info
+		Eventually(done).Should(Receive(MatchError(ContainSubstring("failed to listen UDP address"))))
+	})
+})
@@ -0,0 +1,106 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+)
+
+// defaultBootOrder is the boot order of QEMU when -boot order is not specified
+var defaultBootOrder = []types.NodeBootDevice{types.NodeBootDeviceDisk, types.NodeBootDeviceCDROM}
+
+// BootOverride returns the boot override set through the BMC
+func (n *vm) BootOverride() (virtualbmc.BootOverride, error) {
+	nd := n.node
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+
+	return nd.bootOverride, nil
+}
+
+// SetBootOverride sets the boot override which is applied at the next power-on.
+// Resetting the VM also applies it by restarting QEMU.
+func (n *vm) SetBootOverride(o virtualbmc.BootOverride) error {
+	switch o.Device {
+	case "":
+		o.Device = virtualbmc.BootDeviceNone
+	case virtualbmc.BootDeviceNone, virtualbmc.BootDevicePxe, virtualbmc.BootDeviceHdd, virtualbmc.BootDeviceCd, virtualbmc.BootDeviceBiosSetup:
+	default:
+		return fmt.Errorf("unsupported boot device: %s", o.Device)
+	}
+
+	nd := n.node
+	nd.mu.Lock()
+	// The boot mode is only reported back to clients, as QEMU boots in the mode of the firmware
+	if !reflect.DeepEqual(overrideBootSpec(nd.bootOrder, nd.bootOverride), overrideBootSpec(nd.bootOrder, o)) {
+		nd.bootOverrideChanged = true
+	}
+	nd.bootOverride = o
+	nd.mu.Unlock()
+
+	return nil
+}
+
+// bootOverridePending returns true if the boot override has been changed since the last power-on.
+func (n *node) bootOverridePending() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.bootOverrideChanged
+}
+
+// nextBootSpec returns the boot spec for the next power-on.
+// A boot override only for the next boot is cleared.
+func (n *node) nextBootSpec() bootSpec {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	o := n.bootOverride
+	n.bootOverrideChanged = false
+	if !o.Persistent {
+		n.bootOverride = virtualbmc.BootOverride{Device: virtualbmc.BootDeviceNone}
+	}
+	return overrideBootSpec(n.bootOrder, o)
+}
+
+// overrideBootSpec applies the boot override to the boot order.
+// A persistent override changes the boot order, and the other is applied only until the guest reboots.
+func overrideBootSpec(bootOrder []types.NodeBootDevice, o virtualbmc.BootOverride) bootSpec {
+	boot := bootSpec{order: bootOrder}
+
+	var first types.NodeBootDevice
+	switch o.Device {
+	case virtualbmc.BootDevicePxe:
+		first = types.NodeBootDeviceNetwork
+	case virtualbmc.BootDeviceHdd:
+		first = types.NodeBootDeviceDisk
+	case virtualbmc.BootDeviceCd:
+		first = types.NodeBootDeviceCDROM
+	case virtualbmc.BootDeviceBiosSetup:
+		// QEMU cannot enter the firmware setup directly, so the firmware prompts for its boot menu instead
+		boot.menu = true
+		return boot
+	default:
+		return boot
+	}
+
+	rest := bootOrder
+	if len(rest) == 0 {
+		rest = defaultBootOrder
+	}
+	order := []types.NodeBootDevice{first}
+	for _, d := range rest {
+		if d != first {
+			order = append(order, d)
+		}
+	}
+
+	if o.Persistent {
+		boot.order = order
+	} else {
+		boot.once = order
+	}
+	return boot
+}
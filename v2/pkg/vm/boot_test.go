@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Boot override", func() {
+	It("should apply a boot override to the boot order", func() {
+		net := types.NodeBootDeviceNetwork
+		disk := types.NodeBootDeviceDisk
+		cdrom := types.NodeBootDeviceCDROM
+
+		boot := overrideBootSpec(nil, virtualbmc.BootOverride{Device: virtualbmc.BootDeviceNone})
+		Expect(boot).To(Equal(bootSpec{}))
+		Expect(boot.args()).To(Equal("reboot-timeout=30000"))
+
+		boot = overrideBootSpec(nil, virtualbmc.BootOverride{Device: virtualbmc.BootDevicePxe})
+		Expect(boot).To(Equal(bootSpec{once: []types.NodeBootDevice{net, disk, cdrom}}))
+		Expect(boot.args()).To(Equal("once=ncd,reboot-timeout=30000"))
+
+		order := []types.NodeBootDevice{disk, net}
+		boot = overrideBootSpec(order, virtualbmc.BootOverride{Device: virtualbmc.BootDevicePxe, Persistent: true})
+		Expect(boot).To(Equal(bootSpec{order: []types.NodeBootDevice{net, disk}}))
+
+		boot = overrideBootSpec(order, virtualbmc.BootOverride{Device: virtualbmc.BootDeviceCd})
+		Expect(boot).To(Equal(bootSpec{order: order, once: []types.NodeBootDevice{cdrom, disk, net}}))
+		Expect(boot.args()).To(Equal("order=cn,once=dcn,reboot-timeout=30000"))
+
+		boot = overrideBootSpec(order, virtualbmc.BootOverride{Device: virtualbmc.BootDeviceBiosSetup})
+		Expect(boot).To(Equal(bootSpec{order: order, menu: true}))
+		Expect(boot.args()).To(Equal("order=cn,menu=on,reboot-timeout=30000"))
+	})
+
+	It("should clear a one-time boot override at the next power-on", func() {
+		nd := &node{
+			bootOverride:        virtualbmc.BootOverride{Device: virtualbmc.BootDeviceHdd},
+			bootOverrideChanged: true,
+		}
+		Expect(nd.bootOverridePending()).To(BeTrue())
+		Expect(nd.nextBootSpec().once).To(HaveLen(2))
+		Expect(nd.bootOverridePending()).To(BeFalse())
+		Expect(nd.nextBootSpec()).To(Equal(bootSpec{}))
+
+		nd.bootOverride = virtualbmc.BootOverride{Device: virtualbmc.BootDeviceHdd, Persistent: true}
+		Expect(nd.nextBootSpec().order).To(HaveLen(2))
+		Expect(nd.nextBootSpec().order).To(HaveLen(2))
+	})
+
+	It("should not restart QEMU for a boot override which does not change the boot spec", func() {
+		n := &vm{node: &node{
+			bootOrder:    []types.NodeBootDevice{types.NodeBootDeviceDisk},
+			bootOverride: virtualbmc.BootOverride{Device: virtualbmc.BootDeviceNone},
+		}}
+
+		Expect(n.SetBootOverride(virtualbmc.BootOverride{Device: virtualbmc.BootDeviceNone, UEFI: true})).To(Succeed())
+		Expect(n.node.bootOverridePending()).To(BeFalse())
+		Expect(n.BootOverride()).To(Equal(virtualbmc.BootOverride{Device: virtualbmc.BootDeviceNone, UEFI: true}))
+
+		o := virtualbmc.BootOverride{Device: virtualbmc.BootDevicePxe, Persistent: true}
+		Expect(n.SetBootOverride(o)).To(Succeed())
+		Expect(n.node.bootOverridePending()).To(BeTrue())
+
+		n.node.nextBootSpec()
+		Expect(n.SetBootOverride(o)).To(Succeed())
+		Expect(n.node.bootOverridePending()).To(BeFalse())
+		o.UEFI = true
+		Expect(n.SetBootOverride(o)).To(Succeed())
+		Expect(n.node.bootOverridePending()).To(BeFalse())
+
+		Expect(n.SetBootOverride(virtualbmc.BootOverride{Device: virtualbmc.BootDevicePxe})).To(Succeed())
+		Expect(n.node.bootOverridePending()).To(BeTrue())
+	})
+})
@@ -0,0 +1,165 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+)
+
+const hotplugNICIDPrefix = "nic-"
+
+// nicDeviceID returns the qdev id of the network device connected to the tap.
+// The netdev backend uses the tap name as its id.
+func nicDeviceID(tapName string) string {
+	return hotplugNICIDPrefix + tapName
+}
+
+// AttachInterface creates a tap on the network, and hot-plugs a network device connected to it into the VM.
+// The interface stays attached across power cycles.
+// If the VM is powered off, the interface is attached at the next power-on.
+// If the MAC address is not specified, it is derived from the node name and the interface index.
+func (n *vm) AttachInterface(spec types.NodeInterfaceSpec) (Interface, error) {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	nd := n.node
+	t, err := newTap(spec.Network)
+	if err != nil {
+		return Interface{}, err
+	}
+	nd.mu.Lock()
+	t.nicSpec, err = newNICSpec(spec, nd.name, nd.nextInterfaceIndex, nd.networkDeviceQueue)
+	if err == nil {
+		nd.nextInterfaceIndex++
+	}
+	nd.mu.Unlock()
+	if err != nil {
+		return Interface{}, err
+	}
+
+	info, err := t.create(nd.mtu, t.queues)
+	if err != nil {
+		return Interface{}, err
+	}
+
+	if n.currentStatus() != virtualbmc.PowerStatusOff {
+		if err := n.hotplugInterface(info); err != nil {
+			t.Cleanup()
+			return Interface{}, err
+		}
+	}
+
+	nd.mu.Lock()
+	nd.taps = append(nd.taps, t)
+	nd.tapInfos = append(nd.tapInfos, info)
+	nd.mu.Unlock()
+
+	return Interface{Network: spec.Network, Tap: info.tap, MAC: info.mac, Model: info.model}, nil
+}
+
+func (n *vm) hotplugInterface(info *tapInfo) error {
+	netdev := map[string]interface{}{
+		"type":       "tap",
+		"id":         info.tap,
+		"ifname":     info.tap,
+		"script":     "no",
+		"downscript": "no",
+	}
+	if vhostNetSupported && info.model == types.NodeInterfaceModelVirtio {
+		netdev["vhost"] = true
+	}
+	if info.queues > 1 {
+		netdev["queues"] = info.queues
+	}
+	if _, err := n.executeQMP("netdev_add", netdev); err != nil {
+		return fmt.Errorf("failed to add netdev %s: %w", info.tap, err)
+	}
+
+	device := map[string]interface{}{
+		"driver": nicDriver(info.model),
+		"id":     nicDeviceID(info.tap),
+		"netdev": info.tap,
+		"mac":    info.mac,
+	}
+	if info.model == types.NodeInterfaceModelVirtio {
+		device["host_mtu"] = info.mtu
+	}
+	if info.queues > 1 {
+		device["mq"] = true
+		device["vectors"] = 2*info.queues + 2
+	}
+	if info.bootIndex != nil {
+		device["bootindex"] = *info.bootIndex
+	}
+	n.mu.Lock()
+	boot := n.boot
+	n.mu.Unlock()
+	if n.node.uefi && !info.networkBoot(boot.devices()) {
+		// disable iPXE boot as the command line of QEMU does
+		device["romfile"] = ""
+	}
+	if _, err := n.executeQMP("device_add", device); err != nil {
+		if _, err2 := n.executeQMP("netdev_del", map[string]string{"id": info.tap}); err2 != nil {
+			return fmt.Errorf("failed to add network device %s: %w, and failed to delete netdev: %v", info.tap, err, err2)
+		}
+		return fmt.Errorf("failed to add network device %s: %w", info.tap, err)
+	}
+
+	return nil
+}
+
+// DetachInterface hot-unplugs the network device from the VM and deletes its tap.
+// name is either a tap name or a network name.
+// If a network name is given, the last interface connected to the network is detached.
+func (n *vm) DetachInterface(name string) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	nd := n.node
+	nd.mu.Lock()
+	index := -1
+	for i, t := range nd.taps {
+		if t.tapName == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		for i, t := range nd.taps {
+			if t.bridge.Attrs().Name == name {
+				index = i
+			}
+		}
+	}
+	var t *tap
+	if index >= 0 {
+		t = nd.taps[index]
+	}
+	nd.mu.Unlock()
+	if t == nil {
+		return fmt.Errorf("interface %s not found", name)
+	}
+
+	if n.currentStatus() != virtualbmc.PowerStatusOff {
+		if err := n.deleteDevice(nicDeviceID(t.tapName)); err != nil {
+			return err
+		}
+		if _, err := n.executeQMP("netdev_del", map[string]string{"id": t.tapName}); err != nil {
+			return fmt.Errorf("failed to delete netdev %s: %w", t.tapName, err)
+		}
+	}
+	t.Cleanup()
+
+	nd.mu.Lock()
+	nd.taps = append(nd.taps[:index:index], nd.taps[index+1:]...)
+	for i, info := range nd.tapInfos {
+		if info.tap == t.tapName {
+			nd.tapInfos = append(nd.tapInfos[:i:i], nd.tapInfos[i+1:]...)
+			break
+		}
+	}
+	nd.mu.Unlock()
+
+	return nil
+}
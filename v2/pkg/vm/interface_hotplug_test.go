@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+)
+
+var _ = Describe("Interface hotplug", func() {
+	newInfo := func(tapName string) *tapInfo {
+		return &tapInfo{
+			tap: tapName,
+			mtu: 1500,
+			nicSpec: nicSpec{
+				mac:    "52:54:00:00:00:01",
+				model:  types.NodeInterfaceModelVirtio,
+				queues: 4,
+			},
+		}
+	}
+
+	It("should add a netdev and a network device", func() {
+		f, c := newFakeQEMU(nil)
+		defer c.Close()
+		n := newFakeVM(&node{name: "node1"}, c)
+
+		Expect(n.hotplugInterface(newInfo("tap0"))).NotTo(HaveOccurred())
+		Expect(f.executed()).To(Equal([]string{"netdev_add", "device_add"}))
+
+		netdev := f.arguments("netdev_add")
+		Expect(netdev).To(HaveKeyWithValue("type", "tap"))
+		Expect(netdev).To(HaveKeyWithValue("id", "tap0"))
+		Expect(netdev).To(HaveKeyWithValue("ifname", "tap0"))
+		Expect(netdev).To(HaveKeyWithValue("queues", BeNumerically("==", 4)))
+
+		device := f.arguments("device_add")
+		Expect(device).To(HaveKeyWithValue("driver", "virtio-net-pci"))
+		Expect(device).To(HaveKeyWithValue("id", "nic-tap0"))
+		Expect(device).To(HaveKeyWithValue("netdev", "tap0"))
+		Expect(device).To(HaveKeyWithValue("mac", "52:54:00:00:00:01"))
+		Expect(device).To(HaveKeyWithValue("host_mtu", BeNumerically("==", 1500)))
+		Expect(device).To(HaveKeyWithValue("mq", true))
+		Expect(device).To(HaveKeyWithValue("vectors", BeNumerically("==", 10)))
+		Expect(device).NotTo(HaveKey("romfile"))
+	})
+
+	It("should decide the option ROM by the boot spec QEMU was started with", func() {
+		f, c := newFakeQEMU(nil)
+		defer c.Close()
+		nd := &node{name: "node1", uefi: true, bootOrder: []types.NodeBootDevice{types.NodeBootDeviceDisk}}
+		n := newFakeVM(nd, c)
+
+		n.boot = overrideBootSpec(nd.bootOrder, virtualbmc.BootOverride{Device: virtualbmc.BootDeviceNone})
+		Expect(n.hotplugInterface(newInfo("tap0"))).NotTo(HaveOccurred())
+		Expect(f.arguments("device_add")).To(HaveKeyWithValue("romfile", ""))
+
+		n.boot = overrideBootSpec(nd.bootOrder, virtualbmc.BootOverride{Device: virtualbmc.BootDevicePxe, Persistent: true})
+		Expect(n.hotplugInterface(newInfo("tap1"))).NotTo(HaveOccurred())
+		Expect(f.arguments("device_add")).NotTo(HaveKey("romfile"))
+
+		n.boot = overrideBootSpec(nd.bootOrder, virtualbmc.BootOverride{Device: virtualbmc.BootDevicePxe})
+		Expect(n.hotplugInterface(newInfo("tap2"))).NotTo(HaveOccurred())
+		Expect(f.arguments("device_add")).NotTo(HaveKey("romfile"))
+	})
+
+	It("should delete the netdev if the network device cannot be added", func() {
+		f, c := newFakeQEMU(map[string]func(map[string]interface{}) fakeQMPReply{
+			"device_add": func(map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{err: "GenericError"}
+			},
+		})
+		defer c.Close()
+		n := newFakeVM(&node{name: "node1"}, c)
+
+		err := n.hotplugInterface(newInfo("tap0"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("GenericError"))
+		Expect(f.executed()).To(Equal([]string{"netdev_add", "device_add", "netdev_del"}))
+		Expect(f.arguments("netdev_del")).To(HaveKeyWithValue("id", "tap0"))
+	})
+
+	It("should detach the last interface connected to the network", func() {
+		f, c := newFakeQEMU(map[string]func(map[string]interface{}) fakeQMPReply{
+			"device_del": func(args map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{events: []string{deviceDeletedEvent(args["id"].(string))}}
+			},
+		})
+		defer c.Close()
+
+		ext := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "ext-net"}}
+		bmc := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "bmc-net"}}
+		nd := &node{name: "node1"}
+		for i, t := range []*tap{
+			{bridge: ext, tapName: "placemat-test0"},
+			{bridge: ext, tapName: "placemat-test1"},
+			{bridge: bmc, tapName: "placemat-test2"},
+		} {
+			nd.taps = append(nd.taps, t)
+			nd.tapInfos = append(nd.tapInfos, newInfo(t.tapName))
+			nd.tapInfos[i].bridge = t.bridge.Attrs().Name
+		}
+		n := newFakeVM(nd, c)
+
+		Expect(n.DetachInterface("ext-net")).NotTo(HaveOccurred())
+		Expect(f.executed()).To(Equal([]string{"device_del", "netdev_del"}))
+		Expect(f.arguments("device_del")).To(HaveKeyWithValue("id", "nic-placemat-test1"))
+		Expect(f.arguments("netdev_del")).To(HaveKeyWithValue("id", "placemat-test1"))
+		Expect(nd.taps).To(HaveLen(2))
+		Expect(nd.taps[0].tapName).To(Equal("placemat-test0"))
+		Expect(nd.taps[1].tapName).To(Equal("placemat-test2"))
+		Expect(nd.tapInfos).To(HaveLen(2))
+		Expect(nd.tapInfos[1].tap).To(Equal("placemat-test2"))
+
+		Expect(n.DetachInterface("placemat-test2")).NotTo(HaveOccurred())
+		Expect(f.arguments("netdev_del")).To(HaveKeyWithValue("id", "placemat-test2"))
+		Expect(nd.taps).To(HaveLen(1))
+
+		Expect(n.DetachInterface("no-such-net")).To(MatchError(ContainSubstring("not found")))
+	})
+})
@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+)
+
+// The SMBIOS system information and the memory size which QEMU uses if they are not specified
+const (
+	defaultSMBIOSManufacturer = "QEMU"
+	defaultSMBIOSProduct      = "Standard PC (i440FX + PIIX, 1996)"
+	defaultMemorySize         = 128 * mebibyte
+)
+
+// Inventory returns the hardware configuration of the VM.
+// It reflects the current capacity changed by Resize and the hot-plugged devices.
+func (n *vm) Inventory() (virtualbmc.Inventory, error) {
+	nd := n.node
+	nd.mu.Lock()
+	smp := nd.smp
+	memory := nd.memory.size
+	var drives []virtualbmc.DriveInventory
+	for _, v := range nd.volumes {
+		if d, ok := driveInventory(v); ok {
+			drives = append(drives, d)
+		}
+	}
+	nd.mu.Unlock()
+
+	memSize := int64(defaultMemorySize)
+	if memory != "" {
+		size, err := types.ParseMemorySize(memory)
+		if err != nil {
+			return virtualbmc.Inventory{}, err
+		}
+		memSize = size
+	}
+
+	var nics []virtualbmc.NICInventory
+	for _, iface := range nd.Interfaces() {
+		nics = append(nics, virtualbmc.NICInventory{
+			Network:    iface.Network,
+			MACAddress: iface.MAC,
+		})
+	}
+
+	inv := virtualbmc.Inventory{
+		Manufacturer: nd.smbios.manufacturer,
+		Model:        nd.smbios.product,
+		SerialNumber: nd.smbios.serialNumber(nd.name),
+		UUID:         nd.smbios.systemUUID(nd.name),
+		UEFI:         nd.uefi,
+		TPM:          nd.tpm,
+		Processors:   smp.inventory(),
+		MemoryBytes:  memSize,
+		Drives:       drives,
+		NICs:         nics,
+	}
+	if inv.Manufacturer == "" {
+		inv.Manufacturer = defaultSMBIOSManufacturer
+	}
+	if inv.Model == "" {
+		inv.Model = defaultSMBIOSProduct
+	}
+	return inv, nil
+}
+
+// inventory returns the CPU topology in the same way as the -smp option of QEMU.
+// Unspecified cores are preferred over sockets.
+func (s smpSpec) inventory() virtualbmc.ProcessorInventory {
+	maxCPUs := s.maxCpus
+	if maxCPUs == 0 {
+		maxCPUs = s.cpus
+	}
+	threads := s.threads
+	if threads == 0 {
+		threads = 1
+	}
+	dies := s.dies
+	if dies == 0 {
+		dies = 1
+	}
+	sockets := s.sockets
+	if sockets == 0 {
+		sockets = 1
+	}
+	cores := s.cores
+	if cores == 0 {
+		cores = maxCPUs / (sockets * dies * threads)
+	}
+
+	return virtualbmc.ProcessorInventory{
+		Model:          hostCPUModel(),
+		Sockets:        sockets,
+		CoresPerSocket: dies * cores,
+		ThreadsPerCore: threads,
+		Threads:        s.cpus,
+	}
+}
+
+// driveInventory returns the disk information of the volume.
+// CD-ROM volumes are not disks.
+func driveInventory(v nodeVolume) (virtualbmc.DriveInventory, bool) {
+	d := virtualbmc.DriveInventory{Name: v.volumeName()}
+	switch v := v.(type) {
+	case *cdromVolume:
+		return d, false
+	case *rawVolume:
+		// the size has been validated by qemu-img when the volume was created
+		size, _ := parseImageSize(v.size)
+		d.CapacityBytes = size
+	}
+	return d, true
+}
+
+// parseImageSize parses an image size in the same way as qemu-img.
+// A size without a suffix is in bytes.
+func parseImageSize(size string) (int64, error) {
+	if size != "" && size[len(size)-1] >= '0' && size[len(size)-1] <= '9' {
+		return strconv.ParseInt(size, 10, 64)
+	}
+	return types.ParseMemorySize(size)
+}
+
+// hostCPUModel returns the model name of the host CPU, which the VMs use with -cpu host
+func hostCPUModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if found && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package vm
+
+import (
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory", func() {
+	It("should describe the hardware of the node", func() {
+		spec := &types.NodeSpec{
+			Name: "node1",
+			Volumes: []types.NodeVolumeSpec{
+				{Kind: types.NodeVolumeKindRaw, Name: "data", Size: "10G"},
+				{Kind: types.NodeVolumeKindRaw, Name: "log", Size: "1048576"},
+				{Kind: types.NodeVolumeKindCDROM, Name: "cdrom", Bus: types.NodeVolumeBusIDE},
+			},
+			SMP:         &types.SMPSpec{CPUs: 4, Threads: 2, Sockets: 2, MaxCPUs: 8},
+			Memory:      "4G",
+			MaxMemory:   "8G",
+			MemorySlots: 2,
+			UEFI:        true,
+			SMBIOS:      types.SMBIOSConfigSpec{Serial: "abcd"},
+		}
+		nd, err := NewNode(spec, nil, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		inv, err := (&vm{node: nd.(*node)}).Inventory()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inv.Manufacturer).To(Equal("QEMU"))
+		Expect(inv.Model).To(Equal("Standard PC (i440FX + PIIX, 1996)"))
+		Expect(inv.SerialNumber).To(Equal("abcd"))
+		Expect(inv.UUID).To(Equal("3c49b35a-4f29-5c1e-bf60-aa5fb2fa8635"))
+		Expect(inv.UEFI).To(BeTrue())
+		Expect(inv.TPM).To(BeFalse())
+		Expect(inv.Processors.Sockets).To(Equal(2))
+		Expect(inv.Processors.CoresPerSocket).To(Equal(2))
+		Expect(inv.Processors.ThreadsPerCore).To(Equal(2))
+		Expect(inv.Processors.Threads).To(Equal(4))
+		Expect(inv.MemoryBytes).To(Equal(int64(4 << 30)))
+		Expect(inv.Drives).To(Equal([]virtualbmc.DriveInventory{
+			{Name: "data", CapacityBytes: 10 << 30},
+			{Name: "log", CapacityBytes: 1 << 20},
+		}))
+		Expect(inv.NICs).To(BeEmpty())
+	})
+
+	It("should use the default topology and SMBIOS of QEMU", func() {
+		nd, err := NewNode(&types.NodeSpec{Name: "node1", SMP: &types.SMPSpec{CPUs: 2}}, nil, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		inv, err := (&vm{node: nd.(*node)}).Inventory()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inv.SerialNumber).To(Equal(smBIOSConfig{}.serialNumber("node1")))
+		Expect(inv.Processors.Sockets).To(Equal(1))
+		Expect(inv.Processors.CoresPerSocket).To(Equal(2))
+		Expect(inv.Processors.ThreadsPerCore).To(Equal(1))
+		Expect(inv.MemoryBytes).To(Equal(int64(128 << 20)))
+	})
+})
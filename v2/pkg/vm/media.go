@@ -0,0 +1,171 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+)
+
+// findCDROM returns the cdrom volume of the given name.
+func (n *node) findCDROM(name string) (*cdromVolume, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, v := range n.volumes {
+		if v.volumeName() != name {
+			continue
+		}
+		cd, ok := v.(*cdromVolume)
+		if !ok {
+			return nil, fmt.Errorf("volume %s is not a cdrom", name)
+		}
+		return cd, nil
+	}
+	return nil, fmt.Errorf("volume %s not found", name)
+}
+
+// ChangeMedia inserts a media into the cdrom volume, replacing the current one.
+// A media given by an Image resource or a URL is downloaded and cached in the same way as images.
+// The media stays inserted across power cycles.
+func (n *vm) ChangeMedia(name string, spec types.NodeMediaSpec) error {
+	nd := n.node
+	if _, err := nd.findCDROM(name); err != nil {
+		return err
+	}
+	m, err := newMedia(spec, nd.imageSpecs)
+	if err != nil {
+		return err
+	}
+	return n.changeMedia(name, m, false)
+}
+
+// changeMedia downloads the media and inserts it into the cdrom volume.
+// If pending is true, the media is inserted only if it is still the pending media of the volume,
+// i.e. it has been neither replaced by another media nor ejected while downloading.
+func (n *vm) changeMedia(name string, m *media, pending bool) error {
+	nd := n.node
+
+	// Download the media before locking, as it may take long
+	prepareErr := m.prepare(n.ctx, n.runtime.ImageCache)
+
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	// The volume may have been detached while downloading
+	cd, err := nd.findCDROM(name)
+	if err != nil {
+		return err
+	}
+
+	nd.mu.Lock()
+	if pending && cd.pending != m {
+		nd.mu.Unlock()
+		return nil
+	}
+	cd.pending = nil
+	nd.mu.Unlock()
+
+	if prepareErr != nil {
+		return prepareErr
+	}
+
+	if n.currentStatus() != virtualbmc.PowerStatusOff {
+		_, err := n.executeQMP("blockdev-change-medium", map[string]interface{}{
+			"id":             cdromDeviceID(name),
+			"filename":       m.path(),
+			"format":         "raw",
+			"read-only-mode": "read-only",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to change media of %s: %w", name, err)
+		}
+	}
+
+	nd.mu.Lock()
+	cd.media = m
+	nd.mu.Unlock()
+
+	return nil
+}
+
+// EjectMedia ejects the media from the cdrom volume even if the guest locks the tray.
+func (n *vm) EjectMedia(name string) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	nd := n.node
+	cd, err := nd.findCDROM(name)
+	if err != nil {
+		return err
+	}
+
+	if n.currentStatus() != virtualbmc.PowerStatusOff {
+		_, err := n.executeQMP("eject", map[string]interface{}{
+			"id":    cdromDeviceID(name),
+			"force": true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to eject media of %s: %w", name, err)
+		}
+	}
+
+	nd.mu.Lock()
+	cd.media = nil
+	cd.pending = nil
+	nd.mu.Unlock()
+
+	return nil
+}
+
+// VirtualMedia returns the cdrom volumes as virtual media devices.
+func (n *vm) VirtualMedia() ([]virtualbmc.VirtualMedia, error) {
+	nd := n.node
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+
+	var media []virtualbmc.VirtualMedia
+	for _, v := range nd.volumes {
+		cd, ok := v.(*cdromVolume)
+		if !ok {
+			continue
+		}
+		m := virtualbmc.VirtualMedia{ID: cd.name}
+		if cd.media != nil {
+			m.Image = cd.media.uri
+		}
+		media = append(media, m)
+	}
+	return media, nil
+}
+
+// InsertMedia starts downloading the image from the URL, and returns without waiting for it.
+// The image is inserted into the cdrom volume when the download finishes,
+// unless another media is inserted or the volume is ejected in the meantime.
+func (n *vm) InsertMedia(id, image string) error {
+	nd := n.node
+	cd, err := nd.findCDROM(id)
+	if err != nil {
+		return err
+	}
+	m, err := newMedia(types.NodeMediaSpec{URL: image}, nd.imageSpecs)
+	if err != nil {
+		return err
+	}
+
+	nd.mu.Lock()
+	cd.pending = m
+	nd.mu.Unlock()
+
+	go func() {
+		if err := n.changeMedia(id, m, true); err != nil {
+			log.Error("failed to insert virtual media", map[string]interface{}{
+				log.FnError: err,
+				"volume":    id,
+				"image":     image,
+			})
+		}
+	}()
+	return nil
+}
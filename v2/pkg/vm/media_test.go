@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/util"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Virtual media", func() {
+	var (
+		release chan struct{}
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The download does not finish until released
+			<-release
+			body := []byte("iso")
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body)
+		}))
+	})
+
+	AfterEach(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+		server.Close()
+	})
+
+	// newMediaVM returns a running VM with an empty cdrom volume named "installer".
+	newMediaVM := func(c *qmpClient) *vm {
+		nd := &node{
+			name:    "node1",
+			volumes: []nodeVolume{newCDROMVolume("installer", types.NodeVolumeBusIDE, nil)},
+		}
+		n := newFakeVM(nd, c)
+		n.runtime = &Runtime{ImageCache: util.NewCache(GinkgoT().TempDir())}
+		return n
+	}
+
+	It("should insert the media when the download finishes", func() {
+		f, c := newFakeQEMU(nil)
+		defer c.Close()
+		n := newMediaVM(c)
+
+		image := server.URL + "/ubuntu.iso"
+		Expect(n.InsertMedia("installer", image)).NotTo(HaveOccurred())
+
+		// The media is not inserted while downloading
+		Consistently(n.VirtualMedia).Should(Equal([]virtualbmc.VirtualMedia{{ID: "installer"}}))
+		Expect(f.executed()).To(BeEmpty())
+
+		close(release)
+		Eventually(n.VirtualMedia).Should(Equal([]virtualbmc.VirtualMedia{{ID: "installer", Image: image}}))
+		Expect(f.executed()).To(Equal([]string{"blockdev-change-medium"}))
+		Expect(f.arguments("blockdev-change-medium")).To(HaveKeyWithValue("id", "cd-installer"))
+	})
+
+	It("should not insert the media ejected while downloading", func() {
+		f, c := newFakeQEMU(nil)
+		defer c.Close()
+		n := newMediaVM(c)
+
+		Expect(n.InsertMedia("installer", server.URL+"/ubuntu.iso")).NotTo(HaveOccurred())
+		Expect(n.EjectMedia("installer")).NotTo(HaveOccurred())
+
+		close(release)
+		Eventually(func() bool {
+			return n.runtime.ImageCache.Contains(server.URL + "/ubuntu.iso")
+		}).Should(BeTrue())
+		Consistently(n.VirtualMedia).Should(Equal([]virtualbmc.VirtualMedia{{ID: "installer"}}))
+		Expect(f.executed()).To(Equal([]string{"eject"}))
+	})
+
+	It("should reject a volume that is not a cdrom", func() {
+		_, c := newFakeQEMU(nil)
+		defer c.Close()
+		n := newMediaVM(c)
+
+		Expect(n.InsertMedia("data", server.URL+"/ubuntu.iso")).To(HaveOccurred())
+	})
+})
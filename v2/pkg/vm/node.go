@@ -1,16 +1,20 @@
 package vm
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/placemat/v2/pkg/event"
 	"github.com/cybozu-go/placemat/v2/pkg/types"
 	"github.com/cybozu-go/placemat/v2/pkg/util"
 	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
@@ -25,24 +29,54 @@ type Node interface {
 	Setup(context.Context, *Runtime, int, chan<- BMCInfo) (VM, string, error)
 	// Taps returns Tap information
 	Taps() map[string]string
+	// Interfaces returns the network interfaces
+	Interfaces() []Interface
+	// CPU returns the number of vCPUs
+	CPU() int
+	// Memory returns the memory size
+	Memory() string
+	// Volumes returns the names of volumes
+	Volumes() []string
 	// Cleanup removes taps placemat added
 	Cleanup()
 	// CleanupGarbage cleanups all garbage
 	CleanupGarbage(*Runtime)
 }
 
+// Interface represents a network interface of a node
+type Interface struct {
+	Network string                   `json:"network"`
+	Tap     string                   `json:"tap"`
+	MAC     string                   `json:"mac"`
+	Model   types.NodeInterfaceModel `json:"model"`
+}
+
 type node struct {
 	name               string
+	imageSpecs         []*types.ImageSpec
+	deviceClassSpecs   []*types.DeviceClassSpec
+	mtu                int
+	mu                 sync.Mutex
 	taps               []*tap
+	tapInfos           []*tapInfo
+	nextInterfaceIndex int
 	volumes            []nodeVolume
+	volumePaths        map[string]string
 	ignitionFile       string
 	smp                smpSpec
-	memory             string
+	memory             memorySpec
 	numa               numaSpec
 	networkDeviceQueue int
 	uefi               bool
 	tpm                bool
 	smbios             smBIOSConfig
+	bootOrder          []types.NodeBootDevice
+	bootOverride       virtualbmc.BootOverride
+	// bootOverrideChanged is true if bootOverride has not been applied yet
+	bootOverrideChanged bool
+	bmcUsers            *virtualbmc.UserHolder
+	bmcProfile          virtualbmc.Profile
+	bmcCipherSuiteZero  bool
 }
 
 type smBIOSConfig struct {
@@ -60,15 +94,25 @@ type smpSpec struct {
 	maxCpus int
 }
 
+type memorySpec struct {
+	size    string
+	maxSize string
+	slots   int
+}
+
 type numaSpec struct {
 	nodes int
 }
 
 // NewNode creates a Node from spec.
-func NewNode(spec *types.NodeSpec, imageSpecs []*types.ImageSpec, deviceClassSpecs []*types.DeviceClassSpec) (Node, error) {
+// bmcSpec is used for the BMC users if spec does not specify them, and can be nil.
+func NewNode(spec *types.NodeSpec, imageSpecs []*types.ImageSpec, deviceClassSpecs []*types.DeviceClassSpec, bmcSpec *types.BMCSpec) (Node, error) {
 	n := &node{
-		name:         spec.Name,
-		ignitionFile: spec.IgnitionFile,
+		name:             spec.Name,
+		volumePaths:      make(map[string]string),
+		imageSpecs:       imageSpecs,
+		deviceClassSpecs: deviceClassSpecs,
+		ignitionFile:     spec.IgnitionFile,
 		smp: smpSpec{
 			cpus:    spec.SMP.CPUs,
 			cores:   spec.SMP.Cores,
@@ -77,11 +121,17 @@ func NewNode(spec *types.NodeSpec, imageSpecs []*types.ImageSpec, deviceClassSpe
 			sockets: spec.SMP.Sockets,
 			maxCpus: spec.SMP.MaxCPUs,
 		},
-		memory: spec.Memory,
+		memory: memorySpec{
+			size:    spec.Memory,
+			maxSize: spec.MaxMemory,
+			slots:   spec.MemorySlots,
+		},
 		numa: numaSpec{
 			nodes: spec.NUMA.Nodes,
 		},
 		networkDeviceQueue: spec.NetworkDeviceQueue,
+		bootOrder:          spec.BootOrder,
+		bootOverride:       virtualbmc.BootOverride{Device: virtualbmc.BootDeviceNone},
 		uefi:               spec.UEFI,
 		tpm:                spec.TPM,
 		smbios: smBIOSConfig{
@@ -91,6 +141,19 @@ func NewNode(spec *types.NodeSpec, imageSpecs []*types.ImageSpec, deviceClassSpe
 		},
 	}
 
+	bmcUsers, err := newBMCUsers(spec.BMC, bmcSpec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BMC users: %w", err)
+	}
+	n.bmcUsers = bmcUsers
+	if spec.BMC != nil {
+		if err := spec.BMC.Profile.Validate(); err != nil {
+			return nil, err
+		}
+		n.bmcProfile = virtualbmc.Profile(spec.BMC.Profile)
+		n.bmcCipherSuiteZero = spec.BMC.CipherSuiteZero
+	}
+
 	for _, v := range spec.Volumes {
 		vol, err := newNodeVolume(v, imageSpecs, deviceClassSpecs)
 		if err != nil {
@@ -100,10 +163,15 @@ func NewNode(spec *types.NodeSpec, imageSpecs []*types.ImageSpec, deviceClassSpe
 	}
 
 	for _, i := range spec.Interfaces {
-		tap, err := newTap(i)
+		tap, err := newTap(i.Network)
+		if err != nil {
+			return nil, fmt.Errorf("failed to new type tap: bridge is %s: %w", i.Network, err)
+		}
+		tap.nicSpec, err = newNICSpec(i, n.name, n.nextInterfaceIndex, n.networkDeviceQueue)
 		if err != nil {
-			return nil, fmt.Errorf("failed to new type tap: bridge is %s: %w", i, err)
+			return nil, fmt.Errorf("invalid interface %s: %w", i.Network, err)
 		}
+		n.nextInterfaceIndex++
 		n.taps = append(n.taps, tap)
 	}
 
@@ -125,21 +193,14 @@ func (n *node) Setup(ctx context.Context, r *Runtime, mtu int, nodeCh chan<- BMC
 		n.CleanupGarbage(r)
 	}
 
-	if n.tpm {
-		err := n.startSWTPM(ctx, r)
-		if err != nil {
-			return nil, "", err
-		}
-	}
-	vArgs, err := n.createVolumes(ctx, r.DataDir)
-	if err != nil {
-		return nil, "", err
-	}
-
+	n.mtu = mtu
 	tapInfos, err := n.createTaps(mtu)
 	if err != nil {
 		return nil, "", err
 	}
+	n.mu.Lock()
+	n.tapInfos = tapInfos
+	n.mu.Unlock()
 
 	if n.uefi {
 		p := r.nvramPath(n.name)
@@ -152,81 +213,101 @@ func (n *node) Setup(ctx context.Context, r *Runtime, mtu int, nodeCh chan<- BMC
 		}
 	}
 
-	qemu := newQemu(n.name, tapInfos, vArgs, n.ignitionFile, n.smp, n.memory, n.numa, n.networkDeviceQueue, n.uefi, n.tpm, n.smbios)
-	c := qemu.command(r)
-	qemuCommand := well.CommandContext(ctx, c[0], c[1:]...)
-	qemuCommand.Stdout = util.NewColoredLogWriter("qemu", n.name, os.Stdout)
-	qemuCommand.Stderr = util.NewColoredLogWriter("qemu", n.name, os.Stderr)
-
-	if err := qemuCommand.Start(); err != nil {
-		return nil, "", fmt.Errorf("failed to start qemuCommand: %w", err)
-	}
-
-	guest := r.guestSocketPath(n.name)
-	qmp := r.qmpSocketPath(n.name)
-	for {
-		_, err := os.Stat(qmp)
-		if err != nil && !os.IsNotExist(err) {
-			return nil, "", err
-		}
-
-		_, err2 := os.Stat(guest)
-		if err2 != nil && !os.IsNotExist(err2) {
-			return nil, "", err2
-		}
-
-		if err == nil && err2 == nil {
-			break
-		}
-
-		select {
-		case <-time.After(100 * time.Millisecond):
-		case <-ctx.Done():
-			return nil, "", nil
-		}
-	}
-
-	connGuest, err := net.Dial("unix", guest)
+	// The SEL is kept across restarts of placemat as the SEL of a real BMC is kept in its flash
+	sel, err := virtualbmc.NewSEL(r.selPath(n.name), func(e virtualbmc.SELEntry) {
+		event.Publish(event.Event{
+			Time: e.Timestamp,
+			Type: event.TypeSELEntryAdded,
+			Node: n.name,
+			Details: map[string]string{
+				"record_id": strconv.Itoa(int(e.RecordID)),
+				"message":   e.Message(),
+				"severity":  e.Severity(),
+			},
+		})
+	})
 	if err != nil {
 		return nil, "", err
 	}
-	gc := &guestConnection{
-		serial: n.smbios.serial,
-		guest:  connGuest,
-		ch:     nodeCh,
-	}
-	go gc.handle()
+	sensors := virtualbmc.NewSensorHolder(sel)
 
 	vm := &vm{
-		cmd:       qemuCommand,
-		qmp:       qmp,
-		connGuest: connGuest,
-		guest:     guest,
-		socket:    r.socketPath(n.name),
-		swtpmDir:  r.swtpmSocketDirPath(n.name),
+		ctx:      ctx,
+		node:     n,
+		runtime:  r,
+		qmp:      r.qmpSocketPath(n.name),
+		guest:    r.guestSocketPath(n.name),
+		socket:   r.socketPath(n.name),
+		swtpmDir: r.swtpmSocketDirPath(n.name),
+		sensors:  sensors,
+		sel:      sel,
+		guestConn: &guestConnection{
+			node:            n.name,
+			serial:          n.smbios.serial,
+			users:           n.bmcUsers,
+			profile:         n.bmcProfile,
+			cipherSuiteZero: n.bmcCipherSuiteZero,
+			sensors:         sensors,
+			sel:             sel,
+			ch:              nodeCh,
+		},
+		status: virtualbmc.PowerStatusOff,
+	}
+
+	vm.powerMu.Lock()
+	defer vm.powerMu.Unlock()
+	if err := vm.start(); err != nil {
+		return nil, "", err
 	}
 
 	return vm, n.smbios.serial, nil
 }
 
 func (n *node) createVolumes(ctx context.Context, dataDir string) ([]volumeArgs, error) {
-	volumePathLastPart := filepath.Join("volumes", n.name)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	var argsList []volumeArgs
 	for _, v := range n.volumes {
-		args, err := v.create(ctx, dataDir, volumePathLastPart)
+		args, err := v.create(ctx, dataDir, n.volumePathLastPart())
 		if err != nil {
 			return nil, fmt.Errorf("failed to create the volume: %w", err)
 		}
+		n.volumePaths[v.volumeName()] = blockVolumePath(args)
 		argsList = append(argsList, args)
 	}
 
 	return argsList, nil
 }
 
+func (n *node) volumePathLastPart() string {
+	return filepath.Join("volumes", n.name)
+}
+
+func (n *node) Volumes() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	names := make([]string, len(n.volumes))
+	for i, v := range n.volumes {
+		names[i] = v.volumeName()
+	}
+	return names
+}
+
+func (n *node) hasVolume(name string) bool {
+	for _, v := range n.Volumes() {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (n *node) createTaps(mtu int) ([]*tapInfo, error) {
 	var tapInfos []*tapInfo
 	for _, tap := range n.taps {
-		tapInfo, err := tap.create(mtu, n.networkDeviceQueue)
+		tapInfo, err := tap.create(mtu, tap.queues)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create the tap: %w", err)
 		}
@@ -245,10 +326,15 @@ func createNVRAM(ctx context.Context, p string) error {
 	return well.CommandContext(ctx, "cp", defaultOVMFVarsPath, p).Run()
 }
 
-func (n *node) startSWTPM(ctx context.Context, r *Runtime) error {
-	err := os.Mkdir(r.swtpmSocketDirPath(n.name), 0755)
+func (n *node) startSWTPM(ctx context.Context, r *Runtime) (*well.LogCmd, error) {
+	// The TPM state is kept across power cycles as a real TPM keeps its NVRAM.
+	err := os.MkdirAll(r.swtpmSocketDirPath(n.name), 0755)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	err = os.Remove(r.swtpmSocketPath(n.name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
 
 	log.Info("Starting swtpm for node", map[string]interface{}{
@@ -265,13 +351,13 @@ func (n *node) startSWTPM(ctx context.Context, r *Runtime) error {
 	c.Stderr = os.Stderr
 	err = c.Start()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for {
 		_, err := os.Stat(r.swtpmSocketPath(n.name))
 		if err != nil && !os.IsNotExist(err) {
-			return err
+			return c, err
 		}
 		if err == nil {
 			break
@@ -280,14 +366,17 @@ func (n *node) startSWTPM(ctx context.Context, r *Runtime) error {
 		select {
 		case <-time.After(100 * time.Millisecond):
 		case <-ctx.Done():
-			return nil
+			return c, nil
 		}
 	}
 
-	return nil
+	return c, nil
 }
 
 func (n *node) Taps() map[string]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	var taps = make(map[string]string)
 	for _, tap := range n.taps {
 		taps[tap.bridge.Attrs().Name] = tap.tapName
@@ -296,7 +385,26 @@ func (n *node) Taps() map[string]string {
 	return taps
 }
 
+func (n *node) Interfaces() []Interface {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ifaces := make([]Interface, len(n.taps))
+	for i, tap := range n.taps {
+		ifaces[i] = Interface{
+			Network: tap.bridge.Attrs().Name,
+			Tap:     tap.tapName,
+			MAC:     tap.mac,
+			Model:   tap.model,
+		}
+	}
+	return ifaces
+}
+
 func (n *node) Cleanup() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	for _, tap := range n.taps {
 		tap.Cleanup()
 	}
@@ -335,7 +443,37 @@ func (n *node) CleanupGarbage(r *Runtime) {
 
 type VM interface {
 	virtualbmc.Machine
-	// Wait waits until VM process exits
+	// Pause suspends the vCPUs of the running VM
+	Pause() error
+	// Resume resumes the vCPUs of the paused VM
+	Resume() error
+	// AttachVolume creates a volume and hot-plugs it into the VM
+	AttachVolume(spec types.NodeVolumeSpec) error
+	// DetachVolume hot-unplugs the volume from the VM
+	DetachVolume(name string) error
+	// AttachInterface hot-plugs a network interface connected to the network into the VM
+	AttachInterface(spec types.NodeInterfaceSpec) (Interface, error)
+	// DetachInterface hot-unplugs the network interface from the VM
+	DetachInterface(name string) error
+	// Resize changes the number of vCPUs and the memory size of the VM
+	Resize(cpus int, memory string) error
+	// ChangeMedia inserts a media into the cdrom volume
+	ChangeMedia(name string, spec types.NodeMediaSpec) error
+	// EjectMedia ejects the media from the cdrom volume
+	EjectMedia(name string) error
+	// SaveSnapshot saves the disks and the RAM of the VM as an internal snapshot
+	SaveSnapshot(name string) error
+	// LoadSnapshot rewinds the VM to the snapshot
+	LoadSnapshot(name string) error
+	// DeleteSnapshot deletes the snapshot
+	DeleteSnapshot(name string) error
+	// ListSnapshots returns the snapshots of the VM
+	ListSnapshots() ([]Snapshot, error)
+	// Sensors returns the sensors monitored by the BMC of the VM
+	Sensors() *virtualbmc.SensorHolder
+	// SEL returns the System Event Log of the BMC of the VM
+	SEL() *virtualbmc.SEL
+	// Wait waits until the context is done and VM process exits
 	Wait() error
 	// SocketPath returns socket path
 	SocketPath() string
@@ -344,22 +482,37 @@ type VM interface {
 }
 
 type vm struct {
-	cmd       *well.LogCmd
+	ctx       context.Context
+	node      *node
+	runtime   *Runtime
 	qmp       string
-	connGuest net.Conn
 	guest     string
 	socket    string
 	swtpmDir  string
+	sensors   *virtualbmc.SensorHolder
+	sel       *virtualbmc.SEL
+	guestConn *guestConnection
+
+	// powerMu serializes power operations
+	powerMu sync.Mutex
+
+	// mu protects the fields below
+	mu        sync.Mutex
+	status    virtualbmc.PowerStatus
+	cmd       *well.LogCmd
+	swtpm     *well.LogCmd
+	exited    chan struct{}
+	connGuest net.Conn
+	qmpClient *qmpClient
+	// boot is the boot spec the running QEMU was started with
+	boot bootSpec
 }
 
 // ExecuteCommand represents QMP's execute command
 type ExecuteCommand struct {
-	Execute string `json:"execute"`
-}
-
-// QueryStatusResponse represents QMP's query-status command response
-type QueryStatusResponse struct {
-	Return QueryStatusReturn `json:"return"`
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+	ID        string      `json:"id,omitempty"`
 }
 
 // QueryStatusReturn represents QMP's Return field
@@ -369,188 +522,556 @@ type QueryStatusReturn struct {
 	Running    bool   `json:"running"`
 }
 
-const readTimeout = 5 * time.Second
+const (
+	readTimeout     = 5 * time.Second
+	powerOffTimeout = 30 * time.Second
+)
 
-// When a new QMP connection is established, QMP sends its greeting message and enters capabilities negotiation mode.
-// In this mode, only the qmp_capabilities command works.
-// To exit capabilities negotiation mode and enter command mode, the qmp_capabilities command must be issued.
-// See https://wiki.qemu.org/Documentation/QMP for more information
-func (n *vm) PowerStatus() (virtualbmc.PowerStatus, error) {
-	conn, err := net.Dial("unix", n.qmp)
-	if err != nil {
-		return virtualbmc.PowerStatusUnknown, err
+// gracefulShutdownTimeout is a variable to be shortened in tests
+var gracefulShutdownTimeout = 3 * time.Minute
+
+// start creates volumes, launches swtpm and QEMU, and waits until the sockets are ready.
+// Every call boots the VM from disk like a cold boot of real hardware.
+// The caller must hold powerMu.
+func (n *vm) start() error {
+	n.setStatus(virtualbmc.PowerStatusPoweringOn)
+
+	var swtpm *well.LogCmd
+	if n.node.tpm {
+		c, err := n.node.startSWTPM(n.ctx, n.runtime)
+		if err != nil {
+			n.setStatus(virtualbmc.PowerStatusOff)
+			return err
+		}
+		swtpm = c
 	}
-	err = conn.SetDeadline(time.Now().Add(readTimeout))
+
+	vArgs, err := n.node.createVolumes(n.ctx, n.runtime.DataDir)
 	if err != nil {
-		return virtualbmc.PowerStatusUnknown, err
+		killCommand(swtpm)
+		n.setStatus(virtualbmc.PowerStatusOff)
+		return err
 	}
-	defer conn.Close()
-
-	bufr := bufio.NewReader(conn)
 
-	if _, err := read(bufr); err != nil {
-		return virtualbmc.PowerStatusUnknown, err
+	// remove sockets left by the previous boot so that we can detect new ones
+	for _, f := range []string{n.qmp, n.guest} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			killCommand(swtpm)
+			n.setStatus(virtualbmc.PowerStatusOff)
+			return err
+		}
 	}
 
-	if err := writeCommand(conn, "qmp_capabilities"); err != nil {
-		return virtualbmc.PowerStatusUnknown, err
-	}
+	nd := n.node
+	nd.mu.Lock()
+	tapInfos := append([]*tapInfo(nil), nd.tapInfos...)
+	smp, memory := nd.smp, nd.memory
+	nd.mu.Unlock()
+	boot := nd.nextBootSpec()
+	qemu := newQemu(nd.name, tapInfos, vArgs, nd.ignitionFile, smp, memory, nd.numa, nd.uefi, nd.tpm, nd.smbios, boot)
+	c := qemu.command(n.runtime)
+	qemuCommand := well.CommandContext(n.ctx, c[0], c[1:]...)
+	qemuCommand.Stdout = util.NewColoredLogWriter("qemu", nd.name, os.Stdout)
+	qemuCommand.Stderr = util.NewColoredLogWriter("qemu", nd.name, os.Stderr)
 
-	if _, err := read(bufr); err != nil {
-		return virtualbmc.PowerStatusUnknown, err
+	if err := qemuCommand.Start(); err != nil {
+		killCommand(swtpm)
+		n.setStatus(virtualbmc.PowerStatusOff)
+		return fmt.Errorf("failed to start qemuCommand: %w", err)
 	}
 
-	if err := writeCommand(conn, "query-status"); err != nil {
-		return virtualbmc.PowerStatusUnknown, err
+	event.Publish(event.Event{
+		Type:    event.TypeQEMUStarted,
+		Node:    nd.name,
+		Details: map[string]string{"pid": strconv.Itoa(qemuCommand.Process.Pid)},
+	})
+
+	exited := make(chan struct{})
+	n.mu.Lock()
+	n.cmd = qemuCommand
+	n.swtpm = swtpm
+	n.exited = exited
+	n.boot = boot
+	n.mu.Unlock()
+
+	go n.monitor(qemuCommand, swtpm, exited)
+
+	return n.connect(qemuCommand, exited)
+}
+
+// connect waits until QEMU creates the sockets, connects to them, and marks the VM as powered on.
+// QEMU is killed if it fails.
+func (n *vm) connect(qemuCommand *well.LogCmd, exited <-chan struct{}) error {
+	if err := n.waitSockets(exited); err != nil {
+		killCommand(qemuCommand)
+		<-exited
+		return err
 	}
 
-	res, err := read(bufr)
+	qc, err := dialQMP(n.ctx, n.qmp)
 	if err != nil {
-		return virtualbmc.PowerStatusUnknown, err
+		killCommand(qemuCommand)
+		<-exited
+		return err
 	}
+	events, _ := qc.subscribe()
+	go n.handleEvents(events)
 
-	status := &QueryStatusResponse{}
-	if err := json.Unmarshal(res, status); err != nil {
-		return virtualbmc.PowerStatusUnknown, err
+	connGuest, err := net.Dial("unix", n.guest)
+	if err != nil {
+		qc.Close()
+		killCommand(qemuCommand)
+		<-exited
+		return err
 	}
+	go n.guestConn.handle(connGuest)
 
-	if status.Return.Running {
-		return virtualbmc.PowerStatusOn, nil
+	n.mu.Lock()
+	n.connGuest = connGuest
+	n.qmpClient = qc
+	if n.status == virtualbmc.PowerStatusPoweringOn {
+		n.updateStatusLocked(virtualbmc.PowerStatusOn)
 	}
+	n.mu.Unlock()
 
-	return virtualbmc.PowerStatusOff, nil
+	return nil
 }
 
-func read(reader *bufio.Reader) ([]byte, error) {
-	line, err := reader.ReadBytes('\n')
+// monitor waits for the QEMU process to exit and marks the VM as powered off.
+func (n *vm) monitor(qemuCommand, swtpm *well.LogCmd, exited chan<- struct{}) {
+	err := qemuCommand.Wait()
+	fields := map[string]interface{}{
+		"name": n.node.name,
+	}
+	if qemuCommand.ProcessState != nil {
+		fields["status"] = qemuCommand.ProcessState.String()
+	}
+	if err != nil && n.ctx.Err() == nil {
+		fields[log.FnError] = err
+		log.Warn("QEMU exited unexpectedly", fields)
+	} else {
+		log.Info("QEMU exited", fields)
+	}
+	killCommand(swtpm)
+
+	ev := event.Event{
+		Type: event.TypeQEMUExited,
+		Node: n.node.name,
+	}
 	if err != nil {
-		return line, err
+		ev.Details = map[string]string{"error": err.Error()}
 	}
-	log.Info("QMP response", map[string]interface{}{"response": string(line)})
+	event.Publish(ev)
 
-	return line, nil
+	n.mu.Lock()
+	if n.connGuest != nil {
+		n.connGuest.Close()
+		n.connGuest = nil
+	}
+	if n.qmpClient != nil {
+		n.qmpClient.Close()
+		n.qmpClient = nil
+	}
+	n.updateStatusLocked(virtualbmc.PowerStatusOff)
+	n.mu.Unlock()
+
+	close(exited)
 }
 
-func writeCommand(conn net.Conn, command string) error {
-	exec := ExecuteCommand{
-		Execute: command,
+func (n *vm) waitSockets(exited <-chan struct{}) error {
+	for {
+		_, err := os.Stat(n.qmp)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		_, err2 := os.Stat(n.guest)
+		if err2 != nil && !os.IsNotExist(err2) {
+			return err2
+		}
+
+		if err == nil && err2 == nil {
+			return nil
+		}
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-exited:
+			return fmt.Errorf("QEMU exited before creating sockets: %s", n.node.name)
+		case <-n.ctx.Done():
+			return n.ctx.Err()
+		}
 	}
-	j, err := json.Marshal(exec)
-	if err != nil {
-		return err
+}
+
+func killCommand(c *well.LogCmd) {
+	if c == nil || c.Process == nil {
+		return
 	}
-	if _, err = conn.Write(j); err != nil {
-		return err
+	if err := c.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		log.Warn("failed to kill process", map[string]interface{}{
+			"path":      c.Path,
+			log.FnError: err,
+		})
 	}
+}
 
-	return nil
+func (n *vm) setStatus(status virtualbmc.PowerStatus) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.updateStatusLocked(status)
 }
 
-func (n *vm) PowerOn() error {
-	conn, err := net.Dial("unix", n.qmp)
-	if err != nil {
-		return err
+// updateStatusLocked updates the power status and publishes the change.
+// The caller must hold mu.
+func (n *vm) updateStatusLocked(status virtualbmc.PowerStatus) {
+	if n.status == status {
+		return
 	}
-	err = conn.SetDeadline(time.Now().Add(readTimeout))
-	if err != nil {
-		return err
+	n.status = status
+	event.Publish(event.Event{
+		Type:    event.TypePowerStatusChanged,
+		Node:    n.node.name,
+		Details: map[string]string{"power_status": string(status)},
+	})
+	if err := n.sel.PowerStatusChanged(status); err != nil {
+		log.Error("failed to add SEL entry", map[string]interface{}{
+			"name":      n.node.name,
+			log.FnError: err,
+		})
 	}
-	defer conn.Close()
+}
 
-	bufr := bufio.NewReader(conn)
+func (n *vm) Sensors() *virtualbmc.SensorHolder {
+	return n.sensors
+}
 
-	// Read Greeting response
-	if _, err := read(bufr); err != nil {
-		return err
-	}
+func (n *vm) SEL() *virtualbmc.SEL {
+	return n.sel
+}
 
-	if err := writeCommand(conn, "qmp_capabilities"); err != nil {
-		return err
+func (n *vm) currentStatus() virtualbmc.PowerStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.status
+}
+
+func (n *vm) PowerStatus() (virtualbmc.PowerStatus, error) {
+	status := n.currentStatus()
+	if status != virtualbmc.PowerStatusOn {
+		return status, nil
 	}
-	if _, err := read(bufr); err != nil {
-		return err
+
+	res, err := n.executeQMP("query-status", nil)
+	if err != nil {
+		// QEMU may have exited while querying
+		if status := n.currentStatus(); status != virtualbmc.PowerStatusOn {
+			return status, nil
+		}
+		return virtualbmc.PowerStatusUnknown, err
 	}
 
-	if err := writeCommand(conn, "system_reset"); err != nil {
-		return err
+	qs := &QueryStatusReturn{}
+	if err := json.Unmarshal(res, qs); err != nil {
+		return virtualbmc.PowerStatusUnknown, err
 	}
-	// Read success and event log response
-	if _, err := read(bufr); err != nil {
-		return err
+
+	switch {
+	case qs.Running:
+		return virtualbmc.PowerStatusOn, nil
+	case qs.Status == "shutdown":
+		return virtualbmc.PowerStatusPoweringOff, nil
+	default:
+		return virtualbmc.PowerStatusPaused, nil
 	}
-	if _, err := read(bufr); err != nil {
-		return err
+}
+
+// executeQMP executes a QMP command on the running QEMU and returns the value of its "return" field.
+func (n *vm) executeQMP(command string, arguments interface{}) (json.RawMessage, error) {
+	n.mu.Lock()
+	c := n.qmpClient
+	n.mu.Unlock()
+	if c == nil {
+		return nil, errQMPClosed
 	}
 
-	if err := writeCommand(conn, "cont"); err != nil {
-		return err
+	ctx, cancel := context.WithTimeout(n.ctx, readTimeout)
+	defer cancel()
+	return c.execute(ctx, command, arguments)
+}
+
+// handleEvents handles QMP events of a QEMU process until its QMP connection is closed.
+func (n *vm) handleEvents(events <-chan qmpEvent) {
+	for ev := range events {
+		log.Info("QMP event", map[string]interface{}{
+			"name":  n.node.name,
+			"event": ev.Event,
+			"data":  string(ev.Data),
+		})
+
+		switch ev.Event {
+		case qmpEventReset:
+			event.Publish(event.Event{
+				Time: ev.Time(),
+				Type: event.TypeGuestReset,
+				Node: n.node.name,
+			})
+			if err := n.sel.MachineReset(); err != nil {
+				log.Error("failed to add SEL entry", map[string]interface{}{
+					"name":      n.node.name,
+					log.FnError: err,
+				})
+			}
+		case qmpEventStop, qmpEventResume:
+			// Paused is not kept in the status because it is queried from QEMU
+			status := virtualbmc.PowerStatusPaused
+			if ev.Event == qmpEventResume {
+				status = virtualbmc.PowerStatusOn
+			}
+			if n.currentStatus() == virtualbmc.PowerStatusOn {
+				event.Publish(event.Event{
+					Time:    ev.Time(),
+					Type:    event.TypePowerStatusChanged,
+					Node:    n.node.name,
+					Details: map[string]string{"power_status": string(status)},
+				})
+			}
+		case qmpEventShutdown:
+			n.mu.Lock()
+			if n.status == virtualbmc.PowerStatusOn {
+				n.updateStatusLocked(virtualbmc.PowerStatusPoweringOff)
+			}
+			n.mu.Unlock()
+		case qmpEventBlockIOError, qmpEventGuestPanicked:
+			log.Warn("QEMU reported an error", map[string]interface{}{
+				"name":  n.node.name,
+				"event": ev.Event,
+				"data":  string(ev.Data),
+			})
+		}
 	}
-	// Read success and event log response
-	if _, err := read(bufr); err != nil {
+}
+
+// PowerOn boots the VM from disk if it is powered off.
+// It resumes the VM if it is paused, and does nothing if it is already running.
+func (n *vm) PowerOn() error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	status, err := n.PowerStatus()
+	if err != nil {
 		return err
 	}
-	if _, err := read(bufr); err != nil {
+
+	switch status {
+	case virtualbmc.PowerStatusOff:
+		return n.start()
+	case virtualbmc.PowerStatusPaused:
+		_, err := n.executeQMP("cont", nil)
 		return err
 	}
 
 	return nil
 }
 
+// PowerOff terminates the QEMU process like pulling the power cord.
+// The process is killed if it does not exit in time.
 func (n *vm) PowerOff() error {
-	conn, err := net.Dial("unix", n.qmp)
-	if err != nil {
-		return err
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	return n.powerOff()
+}
+
+// powerOff terminates the QEMU process. The caller must hold powerMu.
+func (n *vm) powerOff() error {
+	n.mu.Lock()
+	if n.status == virtualbmc.PowerStatusOff {
+		n.mu.Unlock()
+		return nil
 	}
-	err = conn.SetDeadline(time.Now().Add(readTimeout))
-	if err != nil {
-		return err
+	n.updateStatusLocked(virtualbmc.PowerStatusPoweringOff)
+	cmd := n.cmd
+	exited := n.exited
+	n.mu.Unlock()
+
+	if _, err := n.executeQMP("quit", nil); err != nil {
+		log.Warn("failed to quit QEMU; killing the process", map[string]interface{}{
+			"name":      n.node.name,
+			log.FnError: err,
+		})
+		killCommand(cmd)
 	}
-	defer conn.Close()
 
-	bufr := bufio.NewReader(conn)
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(powerOffTimeout):
+		killCommand(cmd)
+	}
+	<-exited
 
-	// Read Greeting response
-	if _, err := read(bufr); err != nil {
-		return err
+	return nil
+}
+
+// GracefulShutdown presses the ACPI power button of the VM.
+// If the guest does not shut down within gracefulShutdownTimeout, the VM is forcibly powered off.
+func (n *vm) GracefulShutdown() error {
+	return n.gracefulShutdown(false)
+}
+
+// GracefulRestart presses the ACPI power button of the VM, and powers on the VM again after the guest shuts down.
+// If the guest does not shut down within gracefulShutdownTimeout, the VM is forcibly powered off before that.
+func (n *vm) GracefulRestart() error {
+	return n.gracefulShutdown(true)
+}
+
+func (n *vm) gracefulShutdown(restart bool) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	n.mu.Lock()
+	status := n.status
+	cmd := n.cmd
+	exited := n.exited
+	n.mu.Unlock()
+	if status != virtualbmc.PowerStatusOn {
+		return fmt.Errorf("VM is not running: %s", status)
 	}
 
-	if err := writeCommand(conn, "qmp_capabilities"); err != nil {
+	if _, err := n.executeQMP("system_powerdown", nil); err != nil {
 		return err
 	}
-	if _, err := read(bufr); err != nil {
-		return err
+	n.setStatus(virtualbmc.PowerStatusPoweringOff)
+
+	timeout := gracefulShutdownTimeout
+	go func() {
+		select {
+		case <-exited:
+		case <-time.After(timeout):
+			log.Warn("guest did not shut down in time; powering off", map[string]interface{}{
+				"name": n.node.name,
+			})
+			killCommand(cmd)
+			<-exited
+		}
+		if restart {
+			n.powerOnAfterShutdown()
+		}
+	}()
+
+	return nil
+}
+
+// powerOnAfterShutdown powers on the VM unless it has been powered on by others or placemat is stopping
+func (n *vm) powerOnAfterShutdown() {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if n.ctx.Err() != nil || n.currentStatus() != virtualbmc.PowerStatusOff {
+		return
 	}
+	if err := n.start(); err != nil {
+		log.Error("failed to power on the VM after graceful restart", map[string]interface{}{
+			"name":      n.node.name,
+			log.FnError: err,
+		})
+	}
+}
 
-	if err := writeCommand(conn, "stop"); err != nil {
-		return err
+// Reset resets the VM like pressing the reset button.
+// If a boot override is pending, QEMU is restarted to apply it.
+func (n *vm) Reset() error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if status := n.currentStatus(); status != virtualbmc.PowerStatusOn {
+		return fmt.Errorf("VM is not running: %s", status)
 	}
-	// Read success and event log response
-	if _, err := read(bufr); err != nil {
-		return err
+	if n.node.bootOverridePending() {
+		if err := n.powerOff(); err != nil {
+			return err
+		}
+		return n.start()
 	}
-	if _, err := read(bufr); err != nil {
-		return err
+	_, err := n.executeQMP("system_reset", nil)
+	return err
+}
+
+// InjectNMI injects a non-maskable interrupt to all vCPUs.
+func (n *vm) InjectNMI() error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if status := n.currentStatus(); status != virtualbmc.PowerStatusOn {
+		return fmt.Errorf("VM is not running: %s", status)
 	}
+	_, err := n.executeQMP("inject-nmi", nil)
+	return err
+}
 
-	return nil
+func (n *vm) Pause() error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if status := n.currentStatus(); status != virtualbmc.PowerStatusOn {
+		return fmt.Errorf("VM is not running: %s", status)
+	}
+	_, err := n.executeQMP("stop", nil)
+	return err
+}
+
+func (n *vm) Resume() error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if status := n.currentStatus(); status != virtualbmc.PowerStatusOn {
+		return fmt.Errorf("VM is not running: %s", status)
+	}
+	_, err := n.executeQMP("cont", nil)
+	return err
 }
 
+// Wait blocks until placemat is stopping, i.e. the context of the VM is done, and QEMU exits.
+// Powering off the VM does not end the wait as the VM can be powered on again.
+// It always returns nil, and the exit status of QEMU is logged on every power-off instead.
 func (n *vm) Wait() error {
-	return n.cmd.Wait()
+	<-n.ctx.Done()
+
+	n.mu.Lock()
+	exited := n.exited
+	n.mu.Unlock()
+	if exited != nil {
+		<-exited
+	}
+
+	return nil
 }
 
 func (n *vm) SocketPath() string {
 	return n.socket
 }
 
+// SerialConsole connects to the serial console socket.
+// QEMU serves one connection at a time, so the connection waits while another client such as pmctl2 node enter is connected.
+func (n *vm) SerialConsole() (io.ReadWriteCloser, error) {
+	if n.runtime.Graphic {
+		return nil, errors.New("serial console is not available in graphic mode")
+	}
+	return net.Dial("unix", n.socket)
+}
+
 func (n *vm) Cleanup() {
-	if _, err := os.Stat(n.guest); err == nil {
+	n.mu.Lock()
+	if n.connGuest != nil {
 		if err := n.connGuest.Close(); err != nil {
 			log.Warn("failed to close guest connection", map[string]interface{}{
 				log.FnError: err,
 			})
 		}
+		n.connGuest = nil
 	}
+	n.mu.Unlock()
 
 	files := []string{
 		n.guest,
@@ -0,0 +1,240 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/cybozu-go/placemat/v2/pkg/event"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	"github.com/cybozu-go/well"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const shutdownEvent = `{"timestamp": {"seconds": 1700000000, "microseconds": 1}, "event": "SHUTDOWN", "data": {"guest": true, "reason": "guest-shutdown"}}`
+
+// killFakeProcess kills the process emulating QEMU as QEMU exits.
+func killFakeProcess(n *vm) {
+	n.mu.Lock()
+	cmd := n.cmd
+	n.mu.Unlock()
+	killCommand(cmd)
+}
+
+// runFakeVM boots a VM whose QEMU is emulated by a sleep process and fakeQEMU.
+// The guest reports the BMC address 192.0.2.1 to the returned channel.
+func runFakeVM(ctx context.Context, f *fakeQEMU) (*vm, <-chan BMCInfo) {
+	dir := GinkgoT().TempDir()
+	ch := make(chan BMCInfo, 1)
+	n := newFakeVM(&node{name: "node1"}, nil)
+	n.ctx = ctx
+	n.qmp = filepath.Join(dir, "node1.qmp")
+	n.guest = filepath.Join(dir, "node1.guest")
+	n.guestConn = &guestConnection{node: "node1", ch: ch}
+	n.status = virtualbmc.PowerStatusPoweringOn
+
+	qmpListener, err := net.Listen("unix", n.qmp)
+	Expect(err).NotTo(HaveOccurred())
+	guestListener, err := net.Listen("unix", n.guest)
+	Expect(err).NotTo(HaveOccurred())
+	go func() {
+		defer qmpListener.Close()
+		conn, err := qmpListener.Accept()
+		if err != nil {
+			return
+		}
+		f.serve(conn)
+	}()
+	go func() {
+		defer guestListener.Close()
+		conn, err := guestListener.Accept()
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(conn, "192.0.2.1")
+	}()
+
+	cmd := well.CommandContext(ctx, "sleep", "600")
+	Expect(cmd.Start()).To(Succeed())
+	exited := make(chan struct{})
+	n.mu.Lock()
+	n.cmd = cmd
+	n.exited = exited
+	n.mu.Unlock()
+	go n.monitor(cmd, nil, exited)
+
+	Expect(n.connect(cmd, exited)).To(Succeed())
+	return n, ch
+}
+
+// receivePowerStatuses receives the power statuses of node1 until the last one is published.
+func receivePowerStatuses(events <-chan event.Event, last virtualbmc.PowerStatus) []virtualbmc.PowerStatus {
+	var statuses []virtualbmc.PowerStatus
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type != event.TypePowerStatusChanged || ev.Node != "node1" {
+				continue
+			}
+			status := virtualbmc.PowerStatus(ev.Details["power_status"])
+			statuses = append(statuses, status)
+			if status == last {
+				return statuses
+			}
+		case <-timeout:
+			Fail(fmt.Sprintf("power status %s was not published: %v", last, statuses))
+		}
+	}
+}
+
+var _ = Describe("Power control", func() {
+	var ctx context.Context
+	var events <-chan event.Event
+
+	BeforeEach(func() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+
+		var unsubscribe func()
+		events, unsubscribe = event.Subscribe()
+		DeferCleanup(unsubscribe)
+	})
+
+	It("should be powered on when QEMU is ready", func() {
+		f := &fakeQEMU{handlers: map[string]func(map[string]interface{}) fakeQMPReply{
+			"query-status": func(map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{ret: `{"status": "running", "singlestep": false, "running": true}`}
+			},
+		}}
+		n, ch := runFakeVM(ctx, f)
+
+		Expect(receivePowerStatuses(events, virtualbmc.PowerStatusOn)).To(Equal([]virtualbmc.PowerStatus{virtualbmc.PowerStatusOn}))
+		Expect(n.PowerStatus()).To(Equal(virtualbmc.PowerStatusOn))
+
+		var info BMCInfo
+		Eventually(ch).Should(Receive(&info))
+		Expect(info.bmcAddress).To(Equal("192.0.2.1"))
+	})
+
+	It("should power off the VM by quitting QEMU", func() {
+		var n *vm
+		f := &fakeQEMU{handlers: map[string]func(map[string]interface{}) fakeQMPReply{
+			"quit": func(map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{after: func() { killFakeProcess(n) }}
+			},
+		}}
+		n, _ = runFakeVM(ctx, f)
+		receivePowerStatuses(events, virtualbmc.PowerStatusOn)
+
+		Expect(n.PowerOff()).To(Succeed())
+		Expect(receivePowerStatuses(events, virtualbmc.PowerStatusOff)).To(Equal([]virtualbmc.PowerStatus{
+			virtualbmc.PowerStatusPoweringOff,
+			virtualbmc.PowerStatusOff,
+		}))
+		Expect(f.executed()).To(Equal([]string{"quit"}))
+		Expect(n.PowerStatus()).To(Equal(virtualbmc.PowerStatusOff))
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		Expect(n.exited).To(BeClosed())
+		Expect(n.qmpClient).To(BeNil())
+	})
+
+	It("should kill QEMU if it fails to quit", func() {
+		f := &fakeQEMU{handlers: map[string]func(map[string]interface{}) fakeQMPReply{
+			"quit": func(map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{err: "GenericError"}
+			},
+		}}
+		n, _ := runFakeVM(ctx, f)
+		receivePowerStatuses(events, virtualbmc.PowerStatusOn)
+
+		Expect(n.PowerOff()).To(Succeed())
+		Expect(receivePowerStatuses(events, virtualbmc.PowerStatusOff)).To(Equal([]virtualbmc.PowerStatus{
+			virtualbmc.PowerStatusPoweringOff,
+			virtualbmc.PowerStatusOff,
+		}))
+		Expect(f.executed()).To(Equal([]string{"quit"}))
+
+		Expect(n.PowerOff()).To(Succeed())
+	})
+
+	It("should shut down the guest gracefully", func() {
+		var n *vm
+		f := &fakeQEMU{handlers: map[string]func(map[string]interface{}) fakeQMPReply{
+			"system_powerdown": func(map[string]interface{}) fakeQMPReply {
+				// the guest takes a while to shut down
+				return fakeQMPReply{events: []string{shutdownEvent}, after: func() {
+					time.AfterFunc(100*time.Millisecond, func() { killFakeProcess(n) })
+				}}
+			},
+		}}
+		n, _ = runFakeVM(ctx, f)
+		receivePowerStatuses(events, virtualbmc.PowerStatusOn)
+
+		Expect(n.GracefulShutdown()).To(Succeed())
+		Expect(receivePowerStatuses(events, virtualbmc.PowerStatusOff)).To(Equal([]virtualbmc.PowerStatus{
+			virtualbmc.PowerStatusPoweringOff,
+			virtualbmc.PowerStatusOff,
+		}))
+		Expect(f.executed()).To(Equal([]string{"system_powerdown"}))
+
+		Expect(n.GracefulShutdown()).To(MatchError(ContainSubstring("not running")))
+	})
+
+	It("should power off the VM if the guest does not shut down in time", func() {
+		timeout := gracefulShutdownTimeout
+		gracefulShutdownTimeout = 100 * time.Millisecond
+		DeferCleanup(func() { gracefulShutdownTimeout = timeout })
+
+		f := &fakeQEMU{}
+		n, _ := runFakeVM(ctx, f)
+		receivePowerStatuses(events, virtualbmc.PowerStatusOn)
+
+		Expect(n.GracefulShutdown()).To(Succeed())
+		Expect(receivePowerStatuses(events, virtualbmc.PowerStatusOff)).To(Equal([]virtualbmc.PowerStatus{
+			virtualbmc.PowerStatusPoweringOff,
+			virtualbmc.PowerStatusOff,
+		}))
+		Expect(f.executed()).To(Equal([]string{"system_powerdown"}))
+	})
+
+	It("should reset the VM without restarting QEMU", func() {
+		f := &fakeQEMU{}
+		n, _ := runFakeVM(ctx, f)
+		receivePowerStatuses(events, virtualbmc.PowerStatusOn)
+
+		n.mu.Lock()
+		cmd := n.cmd
+		n.mu.Unlock()
+
+		Expect(n.Reset()).To(Succeed())
+		Expect(f.executed()).To(Equal([]string{"system_reset"}))
+		Expect(n.currentStatus()).To(Equal(virtualbmc.PowerStatusOn))
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		Expect(n.cmd).To(BeIdenticalTo(cmd))
+	})
+
+	It("should wait until the context is done and QEMU exits", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		n, _ := runFakeVM(ctx, &fakeQEMU{})
+		receivePowerStatuses(events, virtualbmc.PowerStatusOn)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- n.Wait()
+		}()
+		Consistently(done, 200*time.Millisecond).ShouldNot(Receive())
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(n.currentStatus()).To(Equal(virtualbmc.PowerStatusOff))
+	})
+})
@@ -1,9 +1,9 @@
 package vm
 
 import (
-	"crypto/rand"
 	"crypto/sha1"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -18,35 +18,47 @@ const (
 )
 
 type qemu struct {
-	name               string
-	taps               []*tapInfo
-	volumes            []volumeArgs
-	ignitionFile       string
-	smp                smpSpec
-	memory             string
-	numa               numaSpec
-	networkDeviceQueue int
-	uefi               bool
-	tpm                bool
-	smbios             smBIOSConfig
-	macGenerator
+	name         string
+	taps         []*tapInfo
+	volumes      []volumeArgs
+	ignitionFile string
+	smp          smpSpec
+	memory       memorySpec
+	numa         numaSpec
+	uefi         bool
+	tpm          bool
+	smbios       smBIOSConfig
+	boot         bootSpec
+}
+
+// bootSpec represents the -boot option
+type bootSpec struct {
+	order []types.NodeBootDevice
+	// once is used instead of order only for the first boot after QEMU starts
+	once []types.NodeBootDevice
+	menu bool
+}
+
+// devices returns all the boot devices in the spec
+func (b bootSpec) devices() []types.NodeBootDevice {
+	return append(append([]types.NodeBootDevice(nil), b.order...), b.once...)
 }
 
 func newQemu(nodeName string, taps []*tapInfo, volumes []volumeArgs, ignitionFile string, smp smpSpec,
-	memory string, numa numaSpec, networkDeviceQueue int, uefi bool, tpm bool, smbios smBIOSConfig) *qemu {
+	memory memorySpec, numa numaSpec, uefi bool, tpm bool, smbios smBIOSConfig,
+	boot bootSpec) *qemu {
 	return &qemu{
-		name:               nodeName,
-		taps:               taps,
-		volumes:            volumes,
-		ignitionFile:       ignitionFile,
-		smp:                smp,
-		memory:             memory,
-		numa:               numa,
-		networkDeviceQueue: networkDeviceQueue,
-		uefi:               uefi,
-		tpm:                tpm,
-		smbios:             smbios,
-		macGenerator:       &macGeneratorForKVM{},
+		name:         nodeName,
+		taps:         taps,
+		volumes:      volumes,
+		ignitionFile: ignitionFile,
+		smp:          smp,
+		memory:       memory,
+		numa:         numa,
+		uefi:         uefi,
+		tpm:          tpm,
+		smbios:       smbios,
+		boot:         boot,
 	}
 }
 
@@ -54,30 +66,9 @@ func (c *qemu) command(r *Runtime) []string {
 	params := c.qemuParams(r)
 
 	for _, t := range c.taps {
-		netdev := fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", t.bridge, t.tap)
-		if vhostNetSupported {
-			netdev += ",vhost=on"
-		}
-		if c.networkDeviceQueue > 1 {
-			netdev += fmt.Sprintf(",queues=%d", c.networkDeviceQueue)
-		}
-
-		params = append(params, "-netdev", netdev)
-
-		devParams := []string{
-			"virtio-net-pci",
-			fmt.Sprintf("host_mtu=%d", t.mtu),
-			fmt.Sprintf("netdev=%s", t.bridge),
-			fmt.Sprintf("mac=%s", c.generate()),
-		}
-		if c.networkDeviceQueue > 1 {
-			devParams = append(devParams, "mq=on", fmt.Sprintf("vectors=%d", 2*c.networkDeviceQueue+2))
-		}
-		if c.uefi {
-			// disable iPXE boot
-			devParams = append(devParams, "romfile=")
-		}
-		params = append(params, "-device", strings.Join(devParams, ","))
+		params = append(params, "-netdev", t.netdevArgs())
+		// Option ROMs of NICs slow down UEFI boot, so they are loaded only for network boot
+		params = append(params, "-device", t.deviceArgs(c.uefi && !t.networkBoot(c.boot.devices())))
 	}
 
 	// With virtfs option, cloud-init doesn't work when volume options are placed before network options
@@ -91,7 +82,7 @@ func (c *qemu) command(r *Runtime) []string {
 		params = append(params, "-device", "tpm-tis,tpmdev=tpm0")
 	}
 
-	params = append(params, "-boot", fmt.Sprintf("reboot-timeout=%d", int64(defaultRebootTimeout/time.Millisecond)))
+	params = append(params, "-boot", c.boot.args())
 
 	guest := r.guestSocketPath(c.name)
 	params = append(params, "-chardev", fmt.Sprintf("socket,id=char0,path=%s,server,nowait", guest))
@@ -105,6 +96,11 @@ func (c *qemu) command(r *Runtime) []string {
 	params = append(params, "-object", "rng-random,id=rng0,filename=/dev/urandom")
 	params = append(params, "-device", "virtio-rng-pci,rng=rng0")
 
+	// Memory balloon to shrink the memory of a running VM
+	if c.memory.maxSize != "" {
+		params = append(params, "-device", "virtio-balloon-pci,id=balloon0")
+	}
+
 	// Use host CPU flags for stability
 	params = append(params, "-cpu", "host")
 
@@ -138,13 +134,31 @@ func (c *qemu) qemuParams(r *Runtime) []string {
 		}
 		params = append(params, "-smp", smpParams)
 	}
-	if c.memory != "" {
-		params = append(params, "-m", c.memory)
+	if c.memory.size != "" {
+		memParams := c.memory.size
+		if c.memory.maxSize != "" {
+			memParams += fmt.Sprintf(",slots=%d,maxmem=%s", c.memory.slots, c.memory.maxSize)
+		}
+		params = append(params, "-m", memParams)
 	}
 	if c.numa.nodes != 0 {
-		cpuPerNode := c.smp.cpus / c.numa.nodes
+		// distribute all the possible vCPUs including hot-pluggable ones
+		cpus := c.smp.cpus
+		if c.smp.maxCpus > cpus {
+			cpus = c.smp.maxCpus
+		}
+		first := 0
 		for i := 0; i < c.numa.nodes; i++ {
-			params = append(params, "-numa", fmt.Sprintf("node,cpus=%d-%d", cpuPerNode*i, cpuPerNode*(i+1)-1))
+			n := cpus / c.numa.nodes
+			if i < cpus%c.numa.nodes {
+				n++
+			}
+			if n == 0 {
+				params = append(params, "-numa", "node")
+				continue
+			}
+			params = append(params, "-numa", fmt.Sprintf("node,cpus=%d-%d", first, first+n-1))
+			first += n
 		}
 	}
 	if !r.Graphic {
@@ -165,29 +179,173 @@ func (c *qemu) qemuParams(r *Runtime) []string {
 	if c.smbios.product != "" {
 		smbios += ",product=" + c.smbios.product
 	}
-	if c.smbios.serial == "" {
-		c.smbios.serial = fmt.Sprintf("%x", sha1.Sum([]byte(c.name)))
-	}
-	smbios += ",serial=" + c.smbios.serial
+	smbios += ",serial=" + c.smbios.serialNumber(c.name)
 	params = append(params, "-smbios", smbios)
+	params = append(params, "-uuid", c.smbios.systemUUID(c.name))
 	return params
 }
 
-type macGenerator interface {
-	generate() string
+// serialNumber returns the serial number of the node.
+// It is generated from the node name if it is not specified.
+func (c smBIOSConfig) serialNumber(name string) string {
+	if c.serial != "" {
+		return c.serial
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(name)))
+}
+
+// systemUUID returns the SMBIOS system UUID of the node.
+// It is derived from the SHA-1 hash of the node name so that it is kept across restarts of placemat.
+// It has the version and variant bits of a version 5 UUID, but is not an RFC 4122 name-based UUID as no namespace UUID is hashed.
+func (c smBIOSConfig) systemUUID(name string) string {
+	u := sha1.Sum([]byte("placemat:" + name))
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// nicSpec represents the configuration of a network device connected to a tap
+type nicSpec struct {
+	mac       string
+	model     types.NodeInterfaceModel
+	queues    int
+	bootIndex *int
+}
+
+// newNICSpec creates the configuration of a network device from the interface spec.
+// index is used to generate the MAC address if it is not specified.
+// defaultQueues is used for virtio devices if the number of queues is not specified.
+func newNICSpec(spec types.NodeInterfaceSpec, nodeName string, index, defaultQueues int) (nicSpec, error) {
+	nic := nicSpec{
+		model:     spec.Model,
+		queues:    spec.Queues,
+		bootIndex: spec.BootIndex,
+	}
+
+	switch nic.model {
+	case "":
+		nic.model = types.NodeInterfaceModelVirtio
+	case types.NodeInterfaceModelVirtio, types.NodeInterfaceModelE1000, types.NodeInterfaceModelIGB:
+	default:
+		return nicSpec{}, fmt.Errorf("unsupported NIC model: %s", nic.model)
+	}
+	if nic.queues == 0 && nic.model == types.NodeInterfaceModelVirtio {
+		nic.queues = defaultQueues
+	}
+	if nic.queues > 1 && nic.model != types.NodeInterfaceModelVirtio {
+		return nicSpec{}, fmt.Errorf("multi queue is not supported by %s", nic.model)
+	}
+
+	if spec.MAC == "" {
+		nic.mac = generateMAC(nodeName, index)
+	} else {
+		mac, err := net.ParseMAC(spec.MAC)
+		if err != nil {
+			return nicSpec{}, err
+		}
+		nic.mac = mac.String()
+	}
+
+	return nic, nil
+}
+
+func (t *tapInfo) netdevArgs() string {
+	netdev := fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", t.tap, t.tap)
+	if vhostNetSupported && t.model == types.NodeInterfaceModelVirtio {
+		netdev += ",vhost=on"
+	}
+	if t.queues > 1 {
+		netdev += fmt.Sprintf(",queues=%d", t.queues)
+	}
+	return netdev
+}
+
+// networkBoot returns true if the NIC is used for network boot
+func (t *tapInfo) networkBoot(bootOrder []types.NodeBootDevice) bool {
+	if t.bootIndex != nil {
+		return true
+	}
+	for _, d := range bootOrder {
+		if d == types.NodeBootDeviceNetwork {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tapInfo) deviceArgs(disableROM bool) string {
+	devParams := []string{
+		nicDriver(t.model),
+		fmt.Sprintf("id=%s", nicDeviceID(t.tap)),
+	}
+	if t.model == types.NodeInterfaceModelVirtio {
+		devParams = append(devParams, fmt.Sprintf("host_mtu=%d", t.mtu))
+	}
+	devParams = append(devParams,
+		fmt.Sprintf("netdev=%s", t.tap),
+		fmt.Sprintf("mac=%s", t.mac),
+	)
+	if t.queues > 1 {
+		devParams = append(devParams, "mq=on", fmt.Sprintf("vectors=%d", 2*t.queues+2))
+	}
+	if t.bootIndex != nil {
+		devParams = append(devParams, fmt.Sprintf("bootindex=%d", *t.bootIndex))
+	}
+	if disableROM {
+		// disable iPXE boot
+		devParams = append(devParams, "romfile=")
+	}
+	return strings.Join(devParams, ",")
 }
 
-type macGeneratorForKVM struct {
+func (b bootSpec) args() string {
+	var params []string
+	if len(b.order) > 0 {
+		params = append(params, "order="+bootOrderString(b.order))
+	}
+	if len(b.once) > 0 {
+		params = append(params, "once="+bootOrderString(b.once))
+	}
+	if b.menu {
+		params = append(params, "menu=on")
+	}
+	params = append(params, fmt.Sprintf("reboot-timeout=%d", int64(defaultRebootTimeout/time.Millisecond)))
+	return strings.Join(params, ",")
 }
 
-func (m *macGeneratorForKVM) generate() string {
-	vendorPrefix := "52:54:00" // QEMU's vendor prefix
-	buf := make([]byte, 3)
-	_, err := rand.Read(buf)
-	if err != nil {
-		panic(err)
+// bootOrderString converts the boot devices into drive letters for the -boot option
+func bootOrderString(bootOrder []types.NodeBootDevice) string {
+	var order string
+	for _, d := range bootOrder {
+		switch d {
+		case types.NodeBootDeviceDisk:
+			order += "c"
+		case types.NodeBootDeviceCDROM:
+			order += "d"
+		case types.NodeBootDeviceNetwork:
+			order += "n"
+		}
 	}
-	return fmt.Sprintf("%s:%02x:%02x:%02x", vendorPrefix, buf[0], buf[1], buf[2])
+	return order
+}
+
+// nicDriver returns the QEMU device driver for the NIC model
+func nicDriver(model types.NodeInterfaceModel) string {
+	switch model {
+	case types.NodeInterfaceModelE1000:
+		return "e1000"
+	case types.NodeInterfaceModelIGB:
+		return "igb"
+	}
+	return "virtio-net-pci"
+}
+
+// generateMAC returns a MAC address derived from the node name and the interface index.
+// It is stable across restarts, so that the guest can identify its NICs by MAC addresses.
+func generateMAC(nodeName string, index int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s/%d", nodeName, index)))
+	// 52:54 is the prefix of locally administered addresses used by QEMU
+	return fmt.Sprintf("52:54:%02x:%02x:%02x:%02x", sum[0], sum[1], sum[2], sum[3])
 }
 
 type volumeArgs interface {
@@ -255,3 +413,44 @@ func (v *hostPathVolumeArgs) args() []string {
 		fmt.Sprintf("local,path=%s,mount_tag=%s,security_model=none%s", v.volumePath, v.mountTag, readonly),
 	}
 }
+
+const (
+	cdromDriveIDPrefix  = "cdrom-"
+	cdromDeviceIDPrefix = "cd-"
+)
+
+// cdromDeviceID returns the qdev id of the CD drive of the volume.
+func cdromDeviceID(name string) string {
+	return cdromDeviceIDPrefix + name
+}
+
+type cdromVolumeArgs struct {
+	name       string
+	volumePath string
+	bus        types.NodeVolumeBus
+}
+
+func (v *cdromVolumeArgs) args() []string {
+	drive := fmt.Sprintf("if=none,id=%s%s,media=cdrom,readonly=on", cdromDriveIDPrefix, v.name)
+	if v.volumePath != "" {
+		drive += ",format=raw,file=" + v.volumePath
+	}
+	params := []string{"-drive", drive}
+
+	device := fmt.Sprintf("drive=%s%s,id=%s", cdromDriveIDPrefix, v.name, cdromDeviceID(v.name))
+	// Each drive on SATA or SCSI has its own controller, so that drives can be configured independently
+	switch v.bus {
+	case types.NodeVolumeBusSATA:
+		controller := "ahci-" + v.name
+		params = append(params, "-device", "ahci,id="+controller)
+		device = fmt.Sprintf("ide-cd,bus=%s.0,%s", controller, device)
+	case types.NodeVolumeBusSCSI:
+		controller := "scsi-" + v.name
+		params = append(params, "-device", "virtio-scsi-pci,id="+controller)
+		device = fmt.Sprintf("scsi-cd,bus=%s.0,%s", controller, device)
+	default:
+		device = "ide-cd," + device
+	}
+
+	return append(params, "-device", device)
+}
@@ -56,12 +56,20 @@ smp:
   sockets: 4
   maxcpus: 100
 memory: 2G
+max-memory: 8G
+memory-slots: 4
 numa:
   nodes: 6
 network-device-queue: 16
 interfaces:
 - r0-node1
-- r0-node2
+- network: r0-node2
+  mac: 52:54:00:12:34:56
+  model: e1000
+  bootindex: 1
+boot-order:
+- network
+- disk
 volumes:
 - cache: writeback
   copy-on-write: true
@@ -125,12 +133,14 @@ use-nat: false
 		// Create taps
 		var taps []*tap
 		var tapInfos []*tapInfo
-		for _, i := range nodeSpec.Interfaces {
-			tap, err := newTap(i)
+		for idx, i := range nodeSpec.Interfaces {
+			tap, err := newTap(i.Network)
+			Expect(err).NotTo(HaveOccurred())
+			tap.nicSpec, err = newNICSpec(i, nodeSpec.Name, idx, nodeSpec.NetworkDeviceQueue)
 			Expect(err).NotTo(HaveOccurred())
 			taps = append(taps, tap)
 
-			tapInfo, err := tap.create(1460, nodeSpec.NetworkDeviceQueue)
+			tapInfo, err := tap.create(1460, tap.queues)
 			Expect(err).NotTo(HaveOccurred())
 			tapInfos = append(tapInfos, tapInfo)
 		}
@@ -147,44 +157,49 @@ use-nat: false
 			dies:    nodeSpec.SMP.Dies,
 			sockets: nodeSpec.SMP.Sockets,
 			maxCpus: nodeSpec.SMP.MaxCPUs,
-		}, nodeSpec.Memory, numaSpec{
+		}, memorySpec{
+			size:    nodeSpec.Memory,
+			maxSize: nodeSpec.MaxMemory,
+			slots:   nodeSpec.MemorySlots,
+		}, numaSpec{
 			nodes: nodeSpec.NUMA.Nodes,
-		}, nodeSpec.NetworkDeviceQueue, nodeSpec.UEFI, nodeSpec.TPM, smBIOSConfig{
+		}, nodeSpec.UEFI, nodeSpec.TPM, smBIOSConfig{
 			manufacturer: nodeSpec.SMBIOS.Manufacturer,
 			product:      nodeSpec.SMBIOS.Product,
 			serial:       nodeSpec.SMBIOS.Serial,
-		})
-		qemu.macGenerator = &macGeneratorMock{}
+		}, bootSpec{order: nodeSpec.BootOrder})
 		command := qemu.command(r)
 
 		expected := strings.ReplaceAll(fmt.Sprintf(`
 qemu-system-x86_64
  -enable-kvm
  -smp 72,cores=3,threads=2,dies=6,sockets=4,maxcpus=100
- -m 2G
- -numa node,cpus=0-11
- -numa node,cpus=12-23
- -numa node,cpus=24-35
- -numa node,cpus=36-47
- -numa node,cpus=48-59
- -numa node,cpus=60-71
+ -m 2G,slots=4,maxmem=8G
+ -numa node,cpus=0-16
+ -numa node,cpus=17-33
+ -numa node,cpus=34-50
+ -numa node,cpus=51-67
+ -numa node,cpus=68-83
+ -numa node,cpus=84-99
  -nographic
  -serial unix:%s/boot-0.socket,server,nowait
  -smbios type=1,serial=fb8f2417d0b4db30050719c31ce02a2e8141bbd8
- -netdev tap,id=r0-node1,ifname=%s,script=no,downscript=no,vhost=on,queues=16
- -device virtio-net-pci,host_mtu=1460,netdev=r0-node1,mac=placemat,mq=on,vectors=34
- -netdev tap,id=r0-node2,ifname=%s,script=no,downscript=no,vhost=on,queues=16
- -device virtio-net-pci,host_mtu=1460,netdev=r0-node2,mac=placemat,mq=on,vectors=34
+ -uuid 7b30fe03-757f-5975-823d-0f31fd9a1dba
+ -netdev tap,id=%[2]s,ifname=%[2]s,script=no,downscript=no,vhost=on,queues=16
+ -device virtio-net-pci,id=nic-%[2]s,host_mtu=1460,netdev=%[2]s,mac=52:54:a0:29:eb:8b,mq=on,vectors=34
+ -netdev tap,id=%[3]s,ifname=%[3]s,script=no,downscript=no
+ -device e1000,id=nic-%[3]s,netdev=%[3]s,mac=52:54:00:12:34:56,bootindex=1
  -drive if=virtio,cache=writeback,aio=threads,file=%s/root.img
  -drive if=virtio,cache=none,aio=native,format=qcow2,file=%s/seed.img
  -virtfs local,path=%s,mount_tag=sabakan,security_model=none,readonly
- -boot reboot-timeout=30000
+ -boot order=nc,reboot-timeout=30000
  -chardev socket,id=char0,path=%s/boot-0.guest,server,nowait
  -device virtio-serial
  -device virtserialport,chardev=char0,name=placemat
  -qmp unix:%s/boot-0.qmp,server,nowait
  -object rng-random,id=rng0,filename=/dev/urandom
  -device virtio-rng-pci,rng=rng0
+ -device virtio-balloon-pci,id=balloon0
  -cpu host
 `, r.RunDir, tapInfos[0].tap, tapInfos[1].tap, r.DataDir, r.DataDir, sharedDir, r.RunDir, r.RunDir), "\n", "")
 		actual := strings.Join(command, " ")
@@ -222,7 +237,8 @@ memory: 2G
 network-device-queue: 16
 interfaces:
 - r0-node1
-- r0-node2
+- network: r0-node2
+  bootindex: 0
 volumes:
 - cache: writeback
   copy-on-write: true
@@ -288,12 +304,14 @@ use-nat: false
 		// Create taps
 		var taps []*tap
 		var tapInfos []*tapInfo
-		for _, i := range nodeSpec.Interfaces {
-			tap, err := newTap(i)
+		for idx, i := range nodeSpec.Interfaces {
+			tap, err := newTap(i.Network)
+			Expect(err).NotTo(HaveOccurred())
+			tap.nicSpec, err = newNICSpec(i, nodeSpec.Name, idx, nodeSpec.NetworkDeviceQueue)
 			Expect(err).NotTo(HaveOccurred())
 			taps = append(taps, tap)
 
-			tapInfo, err := tap.create(1460, nodeSpec.NetworkDeviceQueue)
+			tapInfo, err := tap.create(1460, tap.queues)
 			Expect(err).NotTo(HaveOccurred())
 			tapInfos = append(tapInfos, tapInfo)
 		}
@@ -310,14 +328,17 @@ use-nat: false
 			dies:    nodeSpec.SMP.Dies,
 			sockets: nodeSpec.SMP.Sockets,
 			maxCpus: nodeSpec.SMP.MaxCPUs,
-		}, nodeSpec.Memory, numaSpec{
+		}, memorySpec{
+			size:    nodeSpec.Memory,
+			maxSize: nodeSpec.MaxMemory,
+			slots:   nodeSpec.MemorySlots,
+		}, numaSpec{
 			nodes: nodeSpec.NUMA.Nodes,
-		}, nodeSpec.NetworkDeviceQueue, nodeSpec.UEFI, nodeSpec.TPM, smBIOSConfig{
+		}, nodeSpec.UEFI, nodeSpec.TPM, smBIOSConfig{
 			manufacturer: nodeSpec.SMBIOS.Manufacturer,
 			product:      nodeSpec.SMBIOS.Product,
 			serial:       nodeSpec.SMBIOS.Serial,
-		})
-		qemu.macGenerator = &macGeneratorMock{}
+		}, bootSpec{order: nodeSpec.BootOrder})
 		command := qemu.command(r)
 
 		expected := strings.ReplaceAll(fmt.Sprintf(`
@@ -330,10 +351,11 @@ qemu-system-x86_64
  -drive if=pflash,file=/usr/share/OVMF/OVMF_CODE.fd,format=raw,readonly
  -drive if=pflash,file=%s/nvram/boot-0.fd,format=raw
  -smbios type=1,serial=fb8f2417d0b4db30050719c31ce02a2e8141bbd8
- -netdev tap,id=r0-node1,ifname=%s,script=no,downscript=no,vhost=on,queues=16
- -device virtio-net-pci,host_mtu=1460,netdev=r0-node1,mac=placemat,mq=on,vectors=34,romfile=
- -netdev tap,id=r0-node2,ifname=%s,script=no,downscript=no,vhost=on,queues=16
- -device virtio-net-pci,host_mtu=1460,netdev=r0-node2,mac=placemat,mq=on,vectors=34,romfile=
+ -uuid 7b30fe03-757f-5975-823d-0f31fd9a1dba
+ -netdev tap,id=%[3]s,ifname=%[3]s,script=no,downscript=no,vhost=on,queues=16
+ -device virtio-net-pci,id=nic-%[3]s,host_mtu=1460,netdev=%[3]s,mac=52:54:a0:29:eb:8b,mq=on,vectors=34,romfile=
+ -netdev tap,id=%[4]s,ifname=%[4]s,script=no,downscript=no,vhost=on,queues=16
+ -device virtio-net-pci,id=nic-%[4]s,host_mtu=1460,netdev=%[4]s,mac=52:54:ed:05:17:cc,mq=on,vectors=34,bootindex=0
  -drive if=virtio,cache=writeback,aio=threads,file=%s/root.img
  -drive if=virtio,cache=none,aio=native,format=qcow2,file=%s/seed.img
  -virtfs local,path=%s,mount_tag=sabakan,security_model=none,readonly
@@ -354,9 +376,11 @@ qemu-system-x86_64
 	})
 })
 
-type macGeneratorMock struct {
-}
-
-func (m *macGeneratorMock) generate() string {
-	return "placemat"
-}
+var _ = Describe("MAC address generator", func() {
+	It("should generate stable and distinct MAC addresses", func() {
+		Expect(generateMAC("boot-0", 0)).To(Equal("52:54:a0:29:eb:8b"))
+		Expect(generateMAC("boot-0", 0)).To(Equal(generateMAC("boot-0", 0)))
+		Expect(generateMAC("boot-0", 1)).NotTo(Equal(generateMAC("boot-0", 0)))
+		Expect(generateMAC("boot-1", 0)).NotTo(Equal(generateMAC("boot-0", 0)))
+	})
+})
@@ -0,0 +1,331 @@
+package vm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// QMP event names
+const (
+	qmpEventShutdown      = "SHUTDOWN"
+	qmpEventReset         = "RESET"
+	qmpEventStop          = "STOP"
+	qmpEventResume        = "RESUME"
+	qmpEventBlockIOError  = "BLOCK_IO_ERROR"
+	qmpEventGuestPanicked = "GUEST_PANICKED"
+	qmpEventJobStatus     = "JOB_STATUS_CHANGE"
+)
+
+const qmpEventBufferSize = 32
+
+var errQMPClosed = errors.New("QMP connection closed")
+
+// qmpEvent represents an asynchronous event sent by QEMU.
+type qmpEvent struct {
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp struct {
+		Seconds      int64 `json:"seconds"`
+		Microseconds int64 `json:"microseconds"`
+	} `json:"timestamp"`
+}
+
+// Time returns the time when the event occurred.
+func (e *qmpEvent) Time() time.Time {
+	return time.Unix(e.Timestamp.Seconds, e.Timestamp.Microseconds*1000)
+}
+
+type qmpError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *qmpError) Error() string {
+	return fmt.Sprintf("QMP error: %s: %s", e.Class, e.Desc)
+}
+
+// qmpMessage is a message sent by QEMU. It is either a command response or an event.
+type qmpMessage struct {
+	ID     string          `json:"id,omitempty"`
+	Return json.RawMessage `json:"return,omitempty"`
+	Error  *qmpError       `json:"error,omitempty"`
+	qmpEvent
+}
+
+// qmpBlockInfo represents an element of the query-block command response
+type qmpBlockInfo struct {
+	Device   string `json:"device"`
+	QDev     string `json:"qdev"`
+	Inserted *struct {
+		NodeName string `json:"node-name"`
+		Drv      string `json:"drv"`
+		RO       bool   `json:"ro"`
+		File     string `json:"file"`
+		Image    struct {
+			Snapshots []qmpSnapshotInfo `json:"snapshots"`
+		} `json:"image"`
+	} `json:"inserted"`
+}
+
+// qmpSnapshotInfo represents an internal snapshot of a block device
+type qmpSnapshotInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	VMStateSize int64  `json:"vm-state-size"`
+	DateSec     int64  `json:"date-sec"`
+	DateNsec    int64  `json:"date-nsec"`
+}
+
+// qmpJobInfo represents an element of the query-jobs command response
+type qmpJobInfo struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type qmpResponse struct {
+	ret json.RawMessage
+	err error
+}
+
+// qmpClient is a QMP client which keeps a connection to QEMU.
+// Replies are matched with commands by id, and events are dispatched to subscribers.
+type qmpClient struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	nextID      int
+	pending     map[string]chan qmpResponse
+	subscribers map[int]chan qmpEvent
+	nextSubID   int
+	closed      bool
+
+	done chan struct{}
+}
+
+// dialQMP connects to the QMP socket and enters command mode.
+func dialQMP(ctx context.Context, path string) (*qmpClient, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newQMPClient(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// When a new QMP connection is established, QMP sends its greeting message and enters capabilities negotiation mode.
+// In this mode, only the qmp_capabilities command works.
+// To exit capabilities negotiation mode and enter command mode, the qmp_capabilities command must be issued.
+// See https://wiki.qemu.org/Documentation/QMP for more information
+func newQMPClient(ctx context.Context, conn net.Conn) (*qmpClient, error) {
+	bufr := bufio.NewReader(conn)
+
+	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return nil, err
+	}
+	greeting, err := bufr.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read QMP greeting: %w", err)
+	}
+	var g struct {
+		QMP json.RawMessage `json:"QMP"`
+	}
+	if err := json.Unmarshal(greeting, &g); err != nil || g.QMP == nil {
+		return nil, fmt.Errorf("invalid QMP greeting: %s", string(greeting))
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	c := &qmpClient{
+		conn:        conn,
+		pending:     make(map[string]chan qmpResponse),
+		subscribers: make(map[int]chan qmpEvent),
+		done:        make(chan struct{}),
+	}
+	go c.readLoop(bufr)
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+	if _, err := c.execute(ctx, "qmp_capabilities", nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *qmpClient) readLoop(bufr *bufio.Reader) {
+	defer c.shutdown()
+
+	for {
+		line, err := bufr.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		msg := &qmpMessage{}
+		if err := json.Unmarshal(line, msg); err != nil {
+			log.Warn("failed to parse QMP message", map[string]interface{}{
+				"message":   string(line),
+				log.FnError: err,
+			})
+			continue
+		}
+
+		if msg.Event != "" {
+			c.dispatch(msg.qmpEvent)
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[msg.ID]
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+		if !ok {
+			log.Warn("unexpected QMP response", map[string]interface{}{
+				"response": string(line),
+			})
+			continue
+		}
+
+		res := qmpResponse{ret: msg.Return}
+		if msg.Error != nil {
+			res.err = msg.Error
+		}
+		ch <- res
+	}
+}
+
+func (c *qmpClient) dispatch(ev qmpEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ch := range c.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			log.Warn("dropped QMP event for a slow subscriber", map[string]interface{}{
+				"event": ev.Event,
+			})
+		}
+	}
+}
+
+func (c *qmpClient) shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for id, ch := range c.pending {
+		ch <- qmpResponse{err: errQMPClosed}
+		delete(c.pending, id)
+	}
+	for id, ch := range c.subscribers {
+		close(ch)
+		delete(c.subscribers, id)
+	}
+	close(c.done)
+}
+
+// execute sends a command and waits for its reply.
+// arguments may be nil if the command takes no argument.
+func (c *qmpClient) execute(ctx context.Context, command string, arguments interface{}) (json.RawMessage, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errQMPClosed
+	}
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	ch := make(chan qmpResponse, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	j, err := json.Marshal(ExecuteCommand{
+		Execute:   command,
+		Arguments: arguments,
+		ID:        id,
+	})
+	if err != nil {
+		c.cancel(id)
+		return nil, err
+	}
+
+	c.writeMu.Lock()
+	_, err = c.conn.Write(j)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.cancel(id)
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res.ret, res.err
+	case <-ctx.Done():
+		c.cancel(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (c *qmpClient) cancel(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// subscribe returns a channel which receives events, and a function to stop the subscription.
+// The channel is closed when the connection is closed.
+func (c *qmpClient) subscribe() (<-chan qmpEvent, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan qmpEvent, qmpEventBufferSize)
+	if c.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	id := c.nextSubID
+	c.nextSubID++
+	c.subscribers[id] = ch
+
+	return ch, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if ch, ok := c.subscribers[id]; ok {
+			close(ch)
+			delete(c.subscribers, id)
+		}
+	}
+}
+
+// Done returns a channel which is closed when the connection is closed.
+func (c *qmpClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection.
+func (c *qmpClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,271 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeQMPServer emulates QEMU's QMP server.
+// It emits a STOP event before replying to "stop", and answers "slow" after the reply of the next command.
+func fakeQMPServer(conn net.Conn) {
+	defer conn.Close()
+
+	fmt.Fprintln(conn, `{"QMP": {"version": {"qemu": {"micro": 0, "minor": 2, "major": 8}}, "capabilities": []}}`)
+
+	dec := json.NewDecoder(conn)
+	var slowID string
+	for {
+		cmd := &ExecuteCommand{}
+		if err := dec.Decode(cmd); err != nil {
+			return
+		}
+
+		switch cmd.Execute {
+		case "qmp_capabilities":
+			fmt.Fprintf(conn, `{"return": {}, "id": "%s"}`+"\n", cmd.ID)
+		case "stop":
+			fmt.Fprintln(conn, `{"timestamp": {"seconds": 1700000000, "microseconds": 1}, "event": "STOP"}`)
+			fmt.Fprintf(conn, `{"return": {}, "id": "%s"}`+"\n", cmd.ID)
+		case "query-status":
+			fmt.Fprintf(conn, `{"return": {"status": "paused", "singlestep": false, "running": false}, "id": "%s"}`+"\n", cmd.ID)
+		case "slow":
+			slowID = cmd.ID
+			continue
+		default:
+			fmt.Fprintf(conn, `{"error": {"class": "CommandNotFound", "desc": "The command %s has not been found"}, "id": "%s"}`+"\n", cmd.Execute, cmd.ID)
+		}
+
+		if slowID != "" {
+			fmt.Fprintf(conn, `{"return": {"slow": true}, "id": "%s"}`+"\n", slowID)
+			slowID = ""
+		}
+	}
+}
+
+func newFakeQMPClient() *qmpClient {
+	server, client := net.Pipe()
+	go fakeQMPServer(server)
+
+	c, err := newQMPClient(context.Background(), client)
+	Expect(err).NotTo(HaveOccurred())
+	return c
+}
+
+// fakeQMPReply is the reply of fakeQEMU to a QMP command.
+type fakeQMPReply struct {
+	// ret is the JSON of the return value in a line, or "{}" if empty
+	ret string
+	// err is the error class to be returned instead of ret
+	err string
+	// events are emitted after the reply, each in a line
+	events []string
+	// after is called after the reply and the events are sent if it is not nil
+	after func()
+}
+
+// fakeQEMU emulates QEMU's QMP server with scripted replies.
+// It records the executed commands, and replies "{}" to commands without a handler.
+type fakeQEMU struct {
+	handlers map[string]func(args map[string]interface{}) fakeQMPReply
+
+	wmu  sync.Mutex
+	conn net.Conn
+
+	mu       sync.Mutex
+	commands []ExecuteCommand
+}
+
+// newFakeQEMU starts fakeQEMU and returns a QMP client connected to it.
+func newFakeQEMU(handlers map[string]func(args map[string]interface{}) fakeQMPReply) (*fakeQEMU, *qmpClient) {
+	server, client := net.Pipe()
+	f := &fakeQEMU{handlers: handlers}
+	go f.serve(server)
+
+	c, err := newQMPClient(context.Background(), client)
+	Expect(err).NotTo(HaveOccurred())
+	return f, c
+}
+
+func (f *fakeQEMU) write(format string, args ...interface{}) {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+	fmt.Fprintf(f.conn, format+"\n", args...)
+}
+
+func (f *fakeQEMU) serve(conn net.Conn) {
+	defer conn.Close()
+
+	f.wmu.Lock()
+	f.conn = conn
+	f.wmu.Unlock()
+	f.write(`{"QMP": {"version": {"qemu": {"micro": 0, "minor": 2, "major": 8}}, "capabilities": []}}`)
+
+	dec := json.NewDecoder(conn)
+	for {
+		cmd := &ExecuteCommand{}
+		if err := dec.Decode(cmd); err != nil {
+			return
+		}
+		if cmd.Execute == "qmp_capabilities" {
+			f.write(`{"return": {}, "id": "%s"}`, cmd.ID)
+			continue
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, *cmd)
+		f.mu.Unlock()
+
+		reply := fakeQMPReply{}
+		if h := f.handlers[cmd.Execute]; h != nil {
+			args, _ := cmd.Arguments.(map[string]interface{})
+			reply = h(args)
+		}
+		switch {
+		case reply.err != "":
+			f.write(`{"error": {"class": "%s", "desc": "%s failed"}, "id": "%s"}`, reply.err, cmd.Execute, cmd.ID)
+		case reply.ret != "":
+			f.write(`{"return": %s, "id": "%s"}`, reply.ret, cmd.ID)
+		default:
+			f.write(`{"return": {}, "id": "%s"}`, cmd.ID)
+		}
+		for _, ev := range reply.events {
+			f.write("%s", ev)
+		}
+		if reply.after != nil {
+			reply.after()
+		}
+	}
+}
+
+// executed returns the names of the executed commands.
+func (f *fakeQEMU) executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+	for _, cmd := range f.commands {
+		names = append(names, cmd.Execute)
+	}
+	return names
+}
+
+// arguments returns the arguments of the last execution of the command.
+func (f *fakeQEMU) arguments(command string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := len(f.commands) - 1; i >= 0; i-- {
+		if f.commands[i].Execute == command {
+			args, _ := f.commands[i].Arguments.(map[string]interface{})
+			return args
+		}
+	}
+	return nil
+}
+
+// newFakeVM returns a running VM of the node connected to the QMP client.
+func newFakeVM(nd *node, c *qmpClient) *vm {
+	sel, err := virtualbmc.NewSEL("", nil)
+	Expect(err).NotTo(HaveOccurred())
+	return &vm{
+		ctx:       context.Background(),
+		node:      nd,
+		sel:       sel,
+		status:    virtualbmc.PowerStatusOn,
+		qmpClient: c,
+	}
+}
+
+// deviceDeletedEvent returns a DEVICE_DELETED event for the qdev id.
+func deviceDeletedEvent(qdev string) string {
+	return fmt.Sprintf(`{"timestamp": {"seconds": 1700000000, "microseconds": 1}, "event": "DEVICE_DELETED", "data": {"device": "%s", "path": "/machine/peripheral/%s"}}`, qdev, qdev)
+}
+
+var _ = Describe("QMP client", func() {
+	It("should execute commands and dispatch events", func() {
+		c := newFakeQMPClient()
+		defer c.Close()
+
+		events, unsubscribe := c.subscribe()
+		defer unsubscribe()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := c.execute(ctx, "stop", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		var ev qmpEvent
+		Eventually(events).Should(Receive(&ev))
+		Expect(ev.Event).To(Equal(qmpEventStop))
+		Expect(ev.Time()).To(Equal(time.Unix(1700000000, 1000)))
+
+		res, err := c.execute(ctx, "query-status", nil)
+		Expect(err).NotTo(HaveOccurred())
+		status := &QueryStatusReturn{}
+		Expect(json.Unmarshal(res, status)).NotTo(HaveOccurred())
+		Expect(status.Running).To(BeFalse())
+		Expect(status.Status).To(Equal("paused"))
+	})
+
+	It("should match replies by id", func() {
+		c := newFakeQMPClient()
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		slowCh := make(chan json.RawMessage, 1)
+		go func() {
+			defer GinkgoRecover()
+			res, err := c.execute(ctx, "slow", nil)
+			Expect(err).NotTo(HaveOccurred())
+			slowCh <- res
+		}()
+
+		// wait for the slow command to be sent
+		Eventually(func() int {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return len(c.pending)
+		}).Should(Equal(1))
+
+		res, err := c.execute(ctx, "query-status", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(res)).To(ContainSubstring("paused"))
+
+		Eventually(slowCh).Should(Receive(MatchJSON(`{"slow": true}`)))
+	})
+
+	It("should return QMP errors", func() {
+		c := newFakeQMPClient()
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := c.execute(ctx, "no-such-command", nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("CommandNotFound"))
+	})
+
+	It("should notify subscribers when the connection is closed", func() {
+		c := newFakeQMPClient()
+		events, _ := c.subscribe()
+
+		Expect(c.Close()).NotTo(HaveOccurred())
+		Eventually(c.Done()).Should(BeClosed())
+		Eventually(events).Should(BeClosed())
+
+		_, err := c.execute(context.Background(), "query-status", nil)
+		Expect(err).To(MatchError(errQMPClosed))
+	})
+})
@@ -0,0 +1,256 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+)
+
+const (
+	hotplugCPUIDPrefix    = "cpu-"
+	hotplugDIMMIDPrefix   = "dimm-"
+	hotplugMemdevIDPrefix = "mem-"
+
+	mebibyte = 1 << 20
+	// dimmAlignment is the alignment of the size of pc-dimm devices on x86
+	dimmAlignment = 2 * mebibyte
+)
+
+// qmpHotpluggableCPU represents an element of the query-hotpluggable-cpus command response
+type qmpHotpluggableCPU struct {
+	Type       string                 `json:"type"`
+	VCPUsCount int                    `json:"vcpus-count"`
+	Props      map[string]interface{} `json:"props"`
+	QOMPath    string                 `json:"qom-path,omitempty"`
+}
+
+// qmpMemorySizeSummary represents the query-memory-size-summary command response
+type qmpMemorySizeSummary struct {
+	BaseMemory    int64 `json:"base-memory"`
+	PluggedMemory int64 `json:"plugged-memory"`
+}
+
+// formatMemorySize formats a memory size for the -m option of QEMU.
+func formatMemorySize(size int64) string {
+	if size%(1<<30) == 0 {
+		return fmt.Sprintf("%dG", size>>30)
+	}
+	return fmt.Sprintf("%dM", size/mebibyte)
+}
+
+// CPU returns the number of vCPUs
+func (n *node) CPU() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.smp.cpus
+}
+
+// Memory returns the memory size
+func (n *node) Memory() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.memory.size
+}
+
+// Resize changes the number of vCPUs and the memory size of the VM.
+// Zero or an empty string leaves the corresponding resource unchanged.
+// vCPUs and DIMMs are hot-plugged into a running VM, and the memory is shrunk by the balloon.
+// The new capacity is also used at the next power-on.
+func (n *vm) Resize(cpus int, memory string) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	nd := n.node
+	nd.mu.Lock()
+	smp := nd.smp
+	mem := nd.memory
+	nd.mu.Unlock()
+
+	if cpus < 0 {
+		return fmt.Errorf("invalid number of vCPUs: %d", cpus)
+	}
+	if cpus != 0 {
+		if cpus < smp.cpus {
+			return fmt.Errorf("vCPUs cannot be removed: %d < %d", cpus, smp.cpus)
+		}
+		if cpus > smp.cpus && smp.maxCpus == 0 {
+			return errors.New("vCPU hotplug is disabled; maxcpus is not specified")
+		}
+		if cpus > smp.maxCpus && smp.maxCpus != 0 {
+			return fmt.Errorf("number of vCPUs exceeds maxcpus: %d > %d", cpus, smp.maxCpus)
+		}
+	}
+
+	var memSize int64
+	if memory != "" {
+		if mem.maxSize == "" {
+			return errors.New("memory hotplug is disabled; max-memory is not specified")
+		}
+		size, err := types.ParseMemorySize(memory)
+		if err != nil {
+			return err
+		}
+		if size%mebibyte != 0 {
+			return fmt.Errorf("memory size must be a multiple of 1M: %s", memory)
+		}
+		maxSize, err := types.ParseMemorySize(mem.maxSize)
+		if err != nil {
+			return err
+		}
+		if size > maxSize {
+			return fmt.Errorf("memory size exceeds max-memory: %s > %s", memory, mem.maxSize)
+		}
+		memSize = size
+	}
+
+	if n.currentStatus() != virtualbmc.PowerStatusOff {
+		// validate the memory size before changing the VM
+		var dimmSize int64
+		if memSize != 0 {
+			var err error
+			dimmSize, err = n.dimmSize(memSize)
+			if err != nil {
+				return err
+			}
+		}
+		if cpus > smp.cpus {
+			if err := n.hotplugCPUs(cpus); err != nil {
+				return err
+			}
+		}
+		if memSize != 0 {
+			if err := n.resizeMemory(memSize, dimmSize); err != nil {
+				return err
+			}
+		}
+	}
+
+	nd.mu.Lock()
+	if cpus != 0 {
+		nd.smp.cpus = cpus
+	}
+	if memSize != 0 {
+		nd.memory.size = formatMemorySize(memSize)
+	}
+	nd.mu.Unlock()
+
+	return nil
+}
+
+// hotplugCPUs adds vCPUs to empty CPU slots until the VM has the given number of vCPUs.
+func (n *vm) hotplugCPUs(cpus int) error {
+	res, err := n.executeQMP("query-hotpluggable-cpus", nil)
+	if err != nil {
+		return err
+	}
+	var slots []qmpHotpluggableCPU
+	if err := json.Unmarshal(res, &slots); err != nil {
+		return err
+	}
+
+	current := 0
+	var empty []qmpHotpluggableCPU
+	// QEMU lists the slots in the descending order
+	for i := len(slots) - 1; i >= 0; i-- {
+		if slots[i].QOMPath != "" {
+			current += slots[i].VCPUsCount
+			continue
+		}
+		empty = append(empty, slots[i])
+	}
+
+	for _, slot := range empty {
+		if current >= cpus {
+			return nil
+		}
+		args := map[string]interface{}{
+			"driver": slot.Type,
+			"id":     fmt.Sprintf("%s%d", hotplugCPUIDPrefix, current),
+		}
+		for k, v := range slot.Props {
+			args[k] = v
+		}
+		if _, err := n.executeQMP("device_add", args); err != nil {
+			return fmt.Errorf("failed to add vCPU: %w", err)
+		}
+		current += slot.VCPUsCount
+	}
+	if current < cpus {
+		return fmt.Errorf("no CPU slot is available: %d < %d", current, cpus)
+	}
+
+	return nil
+}
+
+// dimmSize returns the size of the DIMM to be plugged to resize the memory of the VM.
+func (n *vm) dimmSize(size int64) (int64, error) {
+	res, err := n.executeQMP("query-memory-size-summary", nil)
+	if err != nil {
+		return 0, err
+	}
+	var summary qmpMemorySizeSummary
+	if err := json.Unmarshal(res, &summary); err != nil {
+		return 0, err
+	}
+	return hotplugMemorySize(size, summary.BaseMemory+summary.PluggedMemory)
+}
+
+// resizeMemory plugs a DIMM of dimmSize if it is not zero, and then sets the balloon target.
+func (n *vm) resizeMemory(size, dimmSize int64) error {
+	if dimmSize > 0 {
+		res, err := n.executeQMP("query-memory-devices", nil)
+		if err != nil {
+			return err
+		}
+		var devices []json.RawMessage
+		if err := json.Unmarshal(res, &devices); err != nil {
+			return err
+		}
+
+		// DIMMs are never removed while the VM is running, so the number of devices makes a unique id.
+		id := strconv.Itoa(len(devices))
+		_, err = n.executeQMP("object-add", map[string]interface{}{
+			"qom-type": "memory-backend-ram",
+			"id":       hotplugMemdevIDPrefix + id,
+			"size":     dimmSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add memory backend: %w", err)
+		}
+		_, err = n.executeQMP("device_add", map[string]interface{}{
+			"driver": "pc-dimm",
+			"id":     hotplugDIMMIDPrefix + id,
+			"memdev": hotplugMemdevIDPrefix + id,
+		})
+		if err != nil {
+			if _, err2 := n.executeQMP("object-del", map[string]string{"id": hotplugMemdevIDPrefix + id}); err2 != nil {
+				return fmt.Errorf("failed to add DIMM: %w, and failed to delete memory backend: %v", err, err2)
+			}
+			return fmt.Errorf("failed to add DIMM: %w", err)
+		}
+	}
+
+	if _, err := n.executeQMP("balloon", map[string]interface{}{"value": size}); err != nil {
+		return fmt.Errorf("failed to set balloon target: %w", err)
+	}
+	return nil
+}
+
+// hotplugMemorySize returns the size of the DIMM to be plugged to make the total memory size of the VM the given size.
+// It returns 0 if the VM has enough memory.
+func hotplugMemorySize(size, total int64) (int64, error) {
+	if size <= total {
+		return 0, nil
+	}
+	dimmSize := size - total
+	if dimmSize%dimmAlignment != 0 {
+		return 0, fmt.Errorf("memory to be added must be a multiple of 2M: %s", formatMemorySize(dimmSize))
+	}
+	return dimmSize, nil
+}
@@ -0,0 +1,26 @@
+package vm
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory size", func() {
+	It("should format sizes for QEMU", func() {
+		Expect(formatMemorySize(4 << 30)).To(Equal("4G"))
+		Expect(formatMemorySize(1536 << 20)).To(Equal("1536M"))
+	})
+
+	It("should align the size of DIMMs", func() {
+		size, err := hotplugMemorySize(6<<30, 4<<30)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size).To(BeNumerically("==", 2<<30))
+
+		size, err = hotplugMemorySize(2<<30, 4<<30)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size).To(BeZero())
+
+		_, err = hotplugMemorySize(4097<<20, 4<<30)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -110,6 +110,12 @@ func NewRuntime(force, graphic bool, runDir, dataDir, cacheDir, listenAddr strin
 		return nil, err
 	}
 
+	selDir := filepath.Join(dataDir, "sel")
+	err = os.MkdirAll(selDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
 	return r, nil
 }
 
@@ -129,6 +135,10 @@ func (r *Runtime) nvramPath(host string) string {
 	return filepath.Join(r.DataDir, "nvram", host+".fd")
 }
 
+func (r *Runtime) selPath(host string) string {
+	return filepath.Join(r.DataDir, "sel", host+".json")
+}
+
 func (r *Runtime) swtpmSocketDirPath(host string) string {
 	return filepath.Join(r.RunDir, host)
 }
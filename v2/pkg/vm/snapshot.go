@@ -0,0 +1,248 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+)
+
+// Snapshot represents an internal snapshot of a node.
+type Snapshot struct {
+	Name        string    `json:"name"`
+	VMStateSize int64     `json:"vm_state_size"`
+	Date        time.Time `json:"date"`
+}
+
+const jobTimeout = 10 * time.Minute
+
+// pflashDevicePrefix is the prefix of the block devices of the firmware
+const pflashDevicePrefix = "pflash"
+
+var jobCounter int64
+
+// snapshotDevices returns the writable block nodes of the VM and the snapshots stored in them.
+func (n *vm) snapshotDevices() ([]string, []qmpSnapshotInfo, error) {
+	res, err := n.executeQMP("query-block", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []qmpBlockInfo
+	if err := json.Unmarshal(res, &blocks); err != nil {
+		return nil, nil, err
+	}
+	return selectSnapshotDevices(blocks)
+}
+
+// selectSnapshotDevices selects the block nodes to take internal snapshots.
+// Internal snapshots are only available for qcow2 images, so other writable disks are rejected
+// instead of leaving them out of the snapshots.
+func selectSnapshotDevices(blocks []qmpBlockInfo) ([]string, []qmpSnapshotInfo, error) {
+	var devices []string
+	var snapshots []qmpSnapshotInfo
+	for _, b := range blocks {
+		if b.Inserted == nil || b.Inserted.RO {
+			continue
+		}
+		// The UEFI variables are kept as they are like the NVRAM of a real machine.
+		if strings.HasPrefix(b.Device, pflashDevicePrefix) {
+			continue
+		}
+		if b.Inserted.Drv != "qcow2" {
+			return nil, nil, fmt.Errorf("block device %s does not support snapshots: %s is %s", b.Device, b.Inserted.File, b.Inserted.Drv)
+		}
+		if len(devices) == 0 {
+			// The VM state is saved in the first device.
+			snapshots = b.Inserted.Image.Snapshots
+		}
+		devices = append(devices, b.Inserted.NodeName)
+	}
+	if len(devices) == 0 {
+		return nil, nil, errors.New("no qcow2 volume to store snapshots")
+	}
+
+	return devices, snapshots, nil
+}
+
+func (n *vm) checkRunning() error {
+	switch status := n.currentStatus(); status {
+	case virtualbmc.PowerStatusOn:
+		return nil
+	default:
+		return fmt.Errorf("VM is not running: %s", status)
+	}
+}
+
+// SaveSnapshot saves the disks and the RAM of the VM as an internal snapshot.
+// An existing snapshot of the same name is replaced.
+func (n *vm) SaveSnapshot(name string) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if err := n.checkRunning(); err != nil {
+		return err
+	}
+	devices, snapshots, err := n.snapshotDevices()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range snapshots {
+		if s.Name == name {
+			err := n.runJob("snapshot-delete", map[string]interface{}{
+				"tag":     name,
+				"devices": devices,
+			})
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	return n.runJob("snapshot-save", map[string]interface{}{
+		"tag":     name,
+		"vmstate": devices[0],
+		"devices": devices,
+	})
+}
+
+// LoadSnapshot rewinds the VM to the snapshot.
+func (n *vm) LoadSnapshot(name string) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if err := n.checkRunning(); err != nil {
+		return err
+	}
+	devices, _, err := n.snapshotDevices()
+	if err != nil {
+		return err
+	}
+
+	return n.runJob("snapshot-load", map[string]interface{}{
+		"tag":     name,
+		"vmstate": devices[0],
+		"devices": devices,
+	})
+}
+
+// DeleteSnapshot deletes the snapshot.
+func (n *vm) DeleteSnapshot(name string) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if err := n.checkRunning(); err != nil {
+		return err
+	}
+	devices, _, err := n.snapshotDevices()
+	if err != nil {
+		return err
+	}
+
+	return n.runJob("snapshot-delete", map[string]interface{}{
+		"tag":     name,
+		"devices": devices,
+	})
+}
+
+// ListSnapshots returns the snapshots of the VM.
+func (n *vm) ListSnapshots() ([]Snapshot, error) {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	if err := n.checkRunning(); err != nil {
+		return nil, err
+	}
+	_, snapshots, err := n.snapshotDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Snapshot, len(snapshots))
+	for i, s := range snapshots {
+		list[i] = Snapshot{
+			Name:        s.Name,
+			VMStateSize: s.VMStateSize,
+			Date:        time.Unix(s.DateSec, s.DateNsec),
+		}
+	}
+
+	return list, nil
+}
+
+// runJob runs a QMP command which creates a background job, and waits for the job to conclude.
+func (n *vm) runJob(command string, arguments map[string]interface{}) error {
+	n.mu.Lock()
+	c := n.qmpClient
+	n.mu.Unlock()
+	if c == nil {
+		return errQMPClosed
+	}
+
+	events, unsubscribe := c.subscribe()
+	defer unsubscribe()
+
+	jobID := command + "-" + strconv.FormatInt(atomic.AddInt64(&jobCounter, 1), 10)
+	arguments["job-id"] = jobID
+	if _, err := n.executeQMP(command, arguments); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, jobTimeout)
+	defer cancel()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return errQMPClosed
+			}
+			if ev.Event != qmpEventJobStatus {
+				continue
+			}
+			var data struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal(ev.Data, &data); err != nil {
+				return err
+			}
+			if data.ID == jobID && data.Status == "concluded" {
+				return n.dismissJob(jobID)
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("job %s did not conclude: %w", jobID, ctx.Err())
+		}
+	}
+}
+
+// dismissJob removes the concluded job and returns its error if any.
+func (n *vm) dismissJob(jobID string) error {
+	res, err := n.executeQMP("query-jobs", nil)
+	if err != nil {
+		return err
+	}
+	var jobs []qmpJobInfo
+	if err := json.Unmarshal(res, &jobs); err != nil {
+		return err
+	}
+
+	if _, err := n.executeQMP("job-dismiss", map[string]string{"id": jobID}); err != nil {
+		return err
+	}
+
+	for _, j := range jobs {
+		if j.ID == jobID && j.Error != "" {
+			return fmt.Errorf("job %s failed: %s", jobID, j.Error)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot devices", func() {
+	parse := func(res string) []qmpBlockInfo {
+		var blocks []qmpBlockInfo
+		Expect(json.Unmarshal([]byte(res), &blocks)).To(Succeed())
+		return blocks
+	}
+
+	It("should select writable qcow2 volumes", func() {
+		devices, snapshots, err := selectSnapshotDevices(parse(`[
+{"device": "pflash0", "inserted": {"node-name": "#block091", "drv": "raw", "ro": true, "file": "/usr/share/OVMF/OVMF_CODE.fd"}},
+{"device": "pflash1", "inserted": {"node-name": "#block263", "drv": "raw", "ro": false, "file": "/var/scratch/placemat/nvram/boot-0.fd"}},
+{"device": "virtio0", "inserted": {"node-name": "#block434", "drv": "qcow2", "ro": false, "file": "/var/scratch/placemat/volumes/boot-0/root.img",
+  "image": {"snapshots": [{"id": "1", "name": "snap1", "vm-state-size": 1024, "date-sec": 1700000000, "date-nsec": 0}]}}},
+{"device": "virtio1", "inserted": {"node-name": "#block662", "drv": "qcow2", "ro": false, "file": "/var/scratch/placemat/volumes/boot-0/data.img"}},
+{"device": "cdrom-seed", "inserted": {"node-name": "#block857", "drv": "raw", "ro": true, "file": "/var/scratch/placemat/seed.iso"}},
+{"device": "cdrom-installer"}
+]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devices).To(Equal([]string{"#block434", "#block662"}))
+		Expect(snapshots).To(HaveLen(1))
+		Expect(snapshots[0].Name).To(Equal("snap1"))
+	})
+
+	It("should reject writable volumes which do not support snapshots", func() {
+		_, _, err := selectSnapshotDevices(parse(`[
+{"device": "virtio0", "inserted": {"node-name": "#block434", "drv": "qcow2", "ro": false, "file": "/var/scratch/placemat/volumes/boot-0/root.img"}},
+{"device": "virtio1", "inserted": {"node-name": "#block662", "drv": "raw", "ro": false, "file": "/dev/vg0/data"}}
+]`))
+		Expect(err).To(MatchError(ContainSubstring("virtio1")))
+
+		_, _, err = selectSnapshotDevices(parse(`[
+{"device": "cdrom-seed", "inserted": {"node-name": "#block857", "drv": "raw", "ro": true, "file": "/var/scratch/placemat/seed.iso"}}
+]`))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// jobStatusEvent returns a JOB_STATUS_CHANGE event
+func jobStatusEvent(id, status string) string {
+	return fmt.Sprintf(`{"timestamp": {"seconds": 1700000000, "microseconds": 1}, "event": "JOB_STATUS_CHANGE", "data": {"id": "%s", "status": "%s"}}`, id, status)
+}
+
+var _ = Describe("Snapshot jobs", func() {
+	// newSnapshotVM returns a running VM with a qcow2 volume having the snapshot "snap1".
+	// The snapshot jobs conclude with jobError.
+	newSnapshotVM := func(jobError string) (*vm, *fakeQEMU) {
+		var mu sync.Mutex
+		var lastJob string
+		job := func(args map[string]interface{}) fakeQMPReply {
+			id := args["job-id"].(string)
+			mu.Lock()
+			lastJob = id
+			mu.Unlock()
+			return fakeQMPReply{events: []string{
+				jobStatusEvent(id, "created"),
+				jobStatusEvent(id, "running"),
+				jobStatusEvent("other-job", "concluded"),
+				jobStatusEvent(id, "concluded"),
+			}}
+		}
+		f, c := newFakeQEMU(map[string]func(map[string]interface{}) fakeQMPReply{
+			"query-block": func(map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{ret: `[{"device": "virtio0", "inserted": {"node-name": "#block434", "drv": "qcow2", "ro": false, "file": "/var/scratch/placemat/volumes/boot-0/root.img", ` +
+					`"image": {"snapshots": [{"id": "1", "name": "snap1", "vm-state-size": 1024, "date-sec": 1700000000, "date-nsec": 0}]}}}]`}
+			},
+			"snapshot-save":   job,
+			"snapshot-load":   job,
+			"snapshot-delete": job,
+			"query-jobs": func(map[string]interface{}) fakeQMPReply {
+				mu.Lock()
+				defer mu.Unlock()
+				if jobError != "" {
+					return fakeQMPReply{ret: fmt.Sprintf(`[{"id": "%s", "type": "snapshot-save", "status": "concluded", "error": "%s"}]`, lastJob, jobError)}
+				}
+				return fakeQMPReply{ret: fmt.Sprintf(`[{"id": "%s", "type": "snapshot-save", "status": "concluded"}]`, lastJob)}
+			},
+		})
+		DeferCleanup(c.Close)
+		return newFakeVM(&node{name: "node1"}, c), f
+	}
+
+	It("should replace an existing snapshot", func() {
+		n, f := newSnapshotVM("")
+
+		Expect(n.SaveSnapshot("snap1")).To(Succeed())
+		Expect(f.executed()).To(Equal([]string{
+			"query-block",
+			"snapshot-delete", "query-jobs", "job-dismiss",
+			"snapshot-save", "query-jobs", "job-dismiss",
+		}))
+		save := f.arguments("snapshot-save")
+		Expect(save).To(HaveKeyWithValue("tag", "snap1"))
+		Expect(save).To(HaveKeyWithValue("vmstate", "#block434"))
+		Expect(save).To(HaveKeyWithValue("devices", []interface{}{"#block434"}))
+		Expect(f.arguments("job-dismiss")).To(HaveKeyWithValue("id", save["job-id"]))
+	})
+
+	It("should save a new snapshot", func() {
+		n, f := newSnapshotVM("")
+
+		Expect(n.SaveSnapshot("snap2")).To(Succeed())
+		Expect(f.executed()).To(Equal([]string{"query-block", "snapshot-save", "query-jobs", "job-dismiss"}))
+	})
+
+	It("should return the error of a failed job after dismissing it", func() {
+		n, f := newSnapshotVM("Snapshot 'snap2' does not exist")
+
+		err := n.LoadSnapshot("snap2")
+		Expect(err).To(MatchError(ContainSubstring("does not exist")))
+		Expect(f.executed()).To(Equal([]string{"query-block", "snapshot-load", "query-jobs", "job-dismiss"}))
+	})
+
+	It("should list snapshots", func() {
+		n, _ := newSnapshotVM("")
+
+		snapshots, err := n.ListSnapshots()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshots).To(Equal([]Snapshot{{Name: "snap1", VMStateSize: 1024, Date: time.Unix(1700000000, 0)}}))
+	})
+
+	It("should not take snapshots of a VM which is not running", func() {
+		n, f := newSnapshotVM("")
+		n.status = virtualbmc.PowerStatusOff
+
+		Expect(n.SaveSnapshot("snap1")).To(MatchError(ContainSubstring("not running")))
+		_, err := n.ListSnapshots()
+		Expect(err).To(HaveOccurred())
+		Expect(f.executed()).To(BeEmpty())
+	})
+})
@@ -11,12 +11,14 @@ import (
 type tap struct {
 	bridge  netlink.Link
 	tapName string
+	nicSpec
 }
 
 type tapInfo struct {
 	tap    string
 	bridge string
 	mtu    int
+	nicSpec
 }
 
 func newTap(bridgeName string) (*tap, error) {
@@ -66,16 +68,18 @@ func (t *tap) create(mtu, netDevQueue int) (*tapInfo, error) {
 		return nil, fmt.Errorf("failed to find the created tap: %w", err)
 	}
 	return &tapInfo{
-		tap:    tap.Name,
-		bridge: t.bridge.Attrs().Name,
-		mtu:    createdTap.Attrs().MTU,
+		tap:     tap.Name,
+		bridge:  t.bridge.Attrs().Name,
+		mtu:     createdTap.Attrs().MTU,
+		nicSpec: t.nicSpec,
 	}, nil
 }
 
 func (t *tap) TapInfo() tapInfo {
 	return tapInfo{
-		tap:    t.tapName,
-		bridge: t.bridge.Attrs().Name,
+		tap:     t.tapName,
+		bridge:  t.bridge.Attrs().Name,
+		nicSpec: t.nicSpec,
 	}
 }
 
@@ -15,6 +15,7 @@ import (
 )
 
 type nodeVolume interface {
+	volumeName() string
 	create(context.Context, string, string) (volumeArgs, error)
 	prepare(ctx context.Context, c *util.Cache) error
 }
@@ -67,6 +68,25 @@ func newNodeVolume(spec types.NodeVolumeSpec, imageSpecs []*types.ImageSpec, dev
 		return newRawVolume(spec.Name, cache, spec.Size, format, deviceClassDir), nil
 	case types.NodeVolumeKindHostPath:
 		return newHosPathVolume(spec.Name, spec.Path, spec.Writable), nil
+	case types.NodeVolumeKindCDROM:
+		var bus types.NodeVolumeBus
+		switch spec.Bus {
+		case "":
+			bus = types.NodeVolumeBusIDE
+		case types.NodeVolumeBusIDE, types.NodeVolumeBusSATA, types.NodeVolumeBusSCSI:
+			bus = spec.Bus
+		default:
+			return nil, errors.New("invalid bus for cdrom volume")
+		}
+		var m *media
+		if spec.Image != "" || spec.Path != "" {
+			var err error
+			m, err = newMedia(types.NodeMediaSpec{Image: spec.Image, Path: spec.Path}, imageSpecs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return newCDROMVolume(spec.Name, bus, m), nil
 	default:
 		return nil, errors.New("unknown volume kind: " + string(spec.Kind))
 	}
@@ -109,6 +129,10 @@ func newImageVolume(name string, cache types.NodeVolumeCache, image *image, cow
 	}
 }
 
+func (v *imageVolume) volumeName() string {
+	return v.name
+}
+
 func (v *imageVolume) create(ctx context.Context, dataDir, dataPathLastPart string) (volumeArgs, error) {
 	vPath, err := makeVolumeDir(dataDir, v.deviceClassDir, dataPathLastPart, v.name)
 	if err != nil {
@@ -185,25 +209,34 @@ func (v *imageVolume) create(ctx context.Context, dataDir, dataPathLastPart stri
 }
 
 func createCoWImageFromBase(ctx context.Context, base, dest string) error {
+	format, err := probeImageFormat(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	c := well.CommandContext(ctx, "qemu-img", "create", "-f", "qcow2", "-F", format, "-o", "backing_file="+base, dest)
+	return c.Run()
+}
+
+func probeImageFormat(ctx context.Context, p string) (string, error) {
 	var info struct {
 		Format string `json:"format"`
 	}
 
-	out, err := well.CommandContext(ctx, "qemu-img", "info", "--output=json", base).Output()
+	out, err := well.CommandContext(ctx, "qemu-img", "info", "--output=json", p).Output()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if err := json.Unmarshal(out, &info); err != nil {
-		return err
+		return "", err
 	}
 
 	if len(info.Format) == 0 {
-		return errors.New("failed to probe file format for " + base)
+		return "", errors.New("failed to probe file format for " + p)
 	}
 
-	c := well.CommandContext(ctx, "qemu-img", "create", "-f", "qcow2", "-F", info.Format, "-o", "backing_file="+base, dest)
-	return c.Run()
+	return info.Format, nil
 }
 
 func (v *imageVolume) prepare(ctx context.Context, c *util.Cache) error {
@@ -228,6 +261,10 @@ func newLocalDSVolume(name string, cache types.NodeVolumeCache, u, n, deviceClas
 	}
 }
 
+func (v *localDSVolume) volumeName() string {
+	return v.name
+}
+
 func (v *localDSVolume) create(ctx context.Context, dataDir, dataPathLastPart string) (volumeArgs, error) {
 	vPath, err := makeVolumeDir(dataDir, v.deviceClassDir, dataPathLastPart, v.name)
 	if err != nil {
@@ -281,6 +318,10 @@ func newRawVolume(name string, cache types.NodeVolumeCache, size string, format
 	}
 }
 
+func (v *rawVolume) volumeName() string {
+	return v.name
+}
+
 func (v *rawVolume) create(ctx context.Context, dataDir, dataPathLastPart string) (volumeArgs, error) {
 	vPath, err := makeVolumeDir(dataDir, v.deviceClassDir, dataPathLastPart, v.name)
 	if err != nil {
@@ -324,6 +365,10 @@ func newHosPathVolume(name string, path string, writable bool) nodeVolume {
 	}
 }
 
+func (v *hostPathVolume) volumeName() string {
+	return v.name
+}
+
 func (v *hostPathVolume) create(ctx context.Context, _, _ string) (volumeArgs, error) {
 	p, err := filepath.Abs(v.path)
 	if err != nil {
@@ -344,3 +389,122 @@ func (v *hostPathVolume) create(ctx context.Context, _, _ string) (volumeArgs, e
 func (v *hostPathVolume) prepare(ctx context.Context, c *util.Cache) error {
 	return nil
 }
+
+type cdromVolume struct {
+	name  string
+	bus   types.NodeVolumeBus
+	media *media
+	// pending is the media being downloaded to be inserted by InsertMedia
+	pending *media
+}
+
+func newCDROMVolume(name string, bus types.NodeVolumeBus, m *media) nodeVolume {
+	return &cdromVolume{
+		name:  name,
+		bus:   bus,
+		media: m,
+	}
+}
+
+func (v *cdromVolume) volumeName() string {
+	return v.name
+}
+
+func (v *cdromVolume) create(ctx context.Context, _, _ string) (volumeArgs, error) {
+	args := &cdromVolumeArgs{
+		name: v.name,
+		bus:  v.bus,
+	}
+	if v.media != nil {
+		args.volumePath = v.media.path()
+	}
+	return args, nil
+}
+
+func (v *cdromVolume) prepare(ctx context.Context, c *util.Cache) error {
+	if v.media == nil {
+		return nil
+	}
+	return v.media.prepare(ctx, c)
+}
+
+// media is a read-only disc image for a cdrom volume.
+type media struct {
+	image *image
+	file  string
+	// uri identifies where the media comes from
+	uri string
+}
+
+// newMedia creates a media from an Image resource, a local file, or a URL.
+func newMedia(spec types.NodeMediaSpec, imageSpecs []*types.ImageSpec) (*media, error) {
+	n := 0
+	for _, s := range []string{spec.Image, spec.Path, spec.URL} {
+		if s != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("exactly one of image, path, or url must be specified for media")
+	}
+
+	switch {
+	case spec.Image != "":
+		for _, imageSpec := range imageSpecs {
+			if spec.Image != imageSpec.Name {
+				continue
+			}
+			if imageSpec.CompressionMethod != "" && imageSpec.File != "" {
+				return nil, fmt.Errorf("compressed image file %s cannot be used as media", imageSpec.Name)
+			}
+			image, err := newImage(imageSpec)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create the image %s: %w", imageSpec.Name, err)
+			}
+			uri := imageSpec.URL
+			if uri == "" {
+				p, err := filepath.Abs(imageSpec.File)
+				if err != nil {
+					return nil, err
+				}
+				uri = "file://" + p
+			}
+			return &media{image: image, uri: uri}, nil
+		}
+		return nil, fmt.Errorf("failed to find the image %s", spec.Image)
+	case spec.Path != "":
+		p, err := filepath.Abs(spec.Path)
+		if err != nil {
+			return nil, err
+		}
+		return &media{file: p, uri: "file://" + p}, nil
+	default:
+		image, err := newImage(&types.ImageSpec{Name: spec.URL, URL: spec.URL})
+		if err != nil {
+			return nil, err
+		}
+		return &media{image: image, uri: spec.URL}, nil
+	}
+}
+
+func (m *media) prepare(ctx context.Context, c *util.Cache) error {
+	if m.image == nil {
+		return nil
+	}
+	return m.image.prepare(ctx, c)
+}
+
+// path returns the path of the disc image. It is valid after prepare.
+func (m *media) path() string {
+	if m.image == nil {
+		return m.file
+	}
+	if m.image.file != "" {
+		p, err := filepath.Abs(m.image.file)
+		if err != nil {
+			return m.image.file
+		}
+		return p
+	}
+	return m.image.path()
+}
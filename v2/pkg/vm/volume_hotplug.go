@@ -0,0 +1,274 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	"github.com/cybozu-go/placemat/v2/pkg/virtualbmc"
+)
+
+const (
+	qmpEventDeviceDeleted = "DEVICE_DELETED"
+
+	hotplugDriveNodePrefix = "drive-"
+	hotplugDiskIDPrefix    = "disk-"
+
+	deviceDeleteTimeout = 30 * time.Second
+)
+
+// AttachVolume creates a volume and hot-plugs it into the VM.
+// The volume stays attached across power cycles.
+// If the VM is powered off, the volume is attached at the next power-on.
+func (n *vm) AttachVolume(spec types.NodeVolumeSpec) error {
+	switch spec.Kind {
+	case types.NodeVolumeKindRaw:
+		if spec.Size == "" {
+			return errors.New("raw volume must specify size")
+		}
+	case types.NodeVolumeKindImage:
+	default:
+		return fmt.Errorf("volume kind %s cannot be attached", spec.Kind)
+	}
+	if spec.Name == "" {
+		return errors.New("volume name is empty")
+	}
+
+	nd := n.node
+	if nd.hasVolume(spec.Name) {
+		return fmt.Errorf("volume %s already exists", spec.Name)
+	}
+
+	vol, err := newNodeVolume(spec, nd.imageSpecs, nd.deviceClassSpecs)
+	if err != nil {
+		return err
+	}
+	// Download the image and create the volume before locking, as it may take long
+	if err := vol.prepare(n.ctx, n.runtime.ImageCache); err != nil {
+		return err
+	}
+	args, err := vol.create(n.ctx, n.runtime.DataDir, nd.volumePathLastPart())
+	if err != nil {
+		return err
+	}
+
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	// Another volume of the same name may have been attached while creating
+	if nd.hasVolume(spec.Name) {
+		return fmt.Errorf("volume %s already exists", spec.Name)
+	}
+
+	if n.currentStatus() != virtualbmc.PowerStatusOff {
+		if err := n.hotplugVolume(spec.Name, args); err != nil {
+			return err
+		}
+	}
+
+	nd.mu.Lock()
+	nd.volumes = append(nd.volumes, vol)
+	nd.volumePaths[spec.Name] = blockVolumePath(args)
+	nd.mu.Unlock()
+
+	return nil
+}
+
+func (n *vm) hotplugVolume(name string, args volumeArgs) error {
+	var format string
+	var cache types.NodeVolumeCache
+	var filePath string
+	switch a := args.(type) {
+	case *imageVolumeArgs:
+		f, err := probeImageFormat(n.ctx, a.volumePath)
+		if err != nil {
+			return err
+		}
+		format, cache, filePath = f, a.cache, a.volumePath
+	case *rawVolumeArgs:
+		format, cache, filePath = string(a.format), a.cache, a.volumePath
+	default:
+		return fmt.Errorf("unsupported volume type: %T", args)
+	}
+
+	direct := cache == types.NodeVolumeCacheNone || cache == types.NodeVolumeCacheDirectSync
+	cacheOpts := map[string]interface{}{
+		"direct":   direct,
+		"no-flush": cache == types.NodeVolumeCacheUnsafe,
+	}
+	writeCache := "on"
+	if cache == types.NodeVolumeCacheWritethrough || cache == types.NodeVolumeCacheDirectSync {
+		writeCache = "off"
+	}
+
+	nodeName := hotplugDriveNodePrefix + name
+	_, err := n.executeQMP("blockdev-add", map[string]interface{}{
+		"driver":    format,
+		"node-name": nodeName,
+		"cache":     cacheOpts,
+		"file": map[string]interface{}{
+			"driver":   "file",
+			"filename": filePath,
+			"aio":      selectAIOforCache(cache),
+			"cache":    cacheOpts,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add block device %s: %w", name, err)
+	}
+
+	_, err = n.executeQMP("device_add", map[string]interface{}{
+		"driver":      "virtio-blk-pci",
+		"id":          hotplugDiskIDPrefix + name,
+		"drive":       nodeName,
+		"write-cache": writeCache,
+	})
+	if err != nil {
+		if _, err2 := n.executeQMP("blockdev-del", map[string]string{"node-name": nodeName}); err2 != nil {
+			return fmt.Errorf("failed to add device %s: %w, and failed to delete block device: %v", name, err, err2)
+		}
+		return fmt.Errorf("failed to add device %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// DetachVolume hot-unplugs the volume from the VM.
+// The volume file is kept on the host.
+func (n *vm) DetachVolume(name string) error {
+	n.powerMu.Lock()
+	defer n.powerMu.Unlock()
+
+	nd := n.node
+	nd.mu.Lock()
+	index := -1
+	for i, v := range nd.volumes {
+		if v.volumeName() == name {
+			index = i
+			break
+		}
+	}
+	nd.mu.Unlock()
+	if index < 0 {
+		return fmt.Errorf("volume %s not found", name)
+	}
+
+	if n.currentStatus() != virtualbmc.PowerStatusOff {
+		if err := n.hotunplugVolume(name); err != nil {
+			return err
+		}
+	}
+
+	nd.mu.Lock()
+	nd.volumes = append(nd.volumes[:index:index], nd.volumes[index+1:]...)
+	delete(nd.volumePaths, name)
+	nd.mu.Unlock()
+
+	return nil
+}
+
+func (n *vm) hotunplugVolume(name string) error {
+	res, err := n.executeQMP("query-block", nil)
+	if err != nil {
+		return err
+	}
+	var blocks []qmpBlockInfo
+	if err := json.Unmarshal(res, &blocks); err != nil {
+		return err
+	}
+
+	n.node.mu.Lock()
+	p := n.node.volumePaths[name]
+	n.node.mu.Unlock()
+	var target *qmpBlockInfo
+	for i, b := range blocks {
+		if b.Inserted == nil {
+			continue
+		}
+		if b.Inserted.NodeName == hotplugDriveNodePrefix+name || (p != "" && b.Inserted.File == p) {
+			target = &blocks[i]
+			break
+		}
+	}
+	if target == nil || target.QDev == "" {
+		return fmt.Errorf("block device for volume %s not found", name)
+	}
+	qdev := strings.TrimSuffix(target.QDev, "/virtio-backend")
+
+	if err := n.deleteDevice(qdev); err != nil {
+		return err
+	}
+
+	// Drives added by -drive are deleted along with the device, but those added by blockdev-add are not.
+	if strings.HasPrefix(target.Inserted.NodeName, hotplugDriveNodePrefix) {
+		if _, err := n.executeQMP("blockdev-del", map[string]string{"node-name": target.Inserted.NodeName}); err != nil {
+			return fmt.Errorf("failed to delete block device %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteDevice requests the guest to release the device, and waits until it is deleted.
+func (n *vm) deleteDevice(qdev string) error {
+	n.mu.Lock()
+	c := n.qmpClient
+	n.mu.Unlock()
+	if c == nil {
+		return errQMPClosed
+	}
+	events, unsubscribe := c.subscribe()
+	defer unsubscribe()
+
+	if _, err := n.executeQMP("device_del", map[string]string{"id": qdev}); err != nil {
+		return fmt.Errorf("failed to delete device %s: %w", qdev, err)
+	}
+	return waitDeviceDeleted(n.ctx, events, qdev)
+}
+
+// waitDeviceDeleted waits until the guest releases the device.
+func waitDeviceDeleted(ctx context.Context, events <-chan qmpEvent, qdev string) error {
+	ctx, cancel := context.WithTimeout(ctx, deviceDeleteTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return errQMPClosed
+			}
+			if ev.Event != qmpEventDeviceDeleted {
+				continue
+			}
+			var data struct {
+				Device string `json:"device"`
+				Path   string `json:"path"`
+			}
+			if err := json.Unmarshal(ev.Data, &data); err != nil {
+				return err
+			}
+			if data.Path == qdev || data.Device == qdev {
+				return nil
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("device %s was not released by the guest: %w", qdev, ctx.Err())
+		}
+	}
+}
+
+// blockVolumePath returns the path of the volume file, or an empty string if the volume is not a block device.
+func blockVolumePath(args volumeArgs) string {
+	switch a := args.(type) {
+	case *imageVolumeArgs:
+		return a.volumePath
+	case *localDSVolumeArgs:
+		return a.volumePath
+	case *rawVolumeArgs:
+		return a.volumePath
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cybozu-go/placemat/v2/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Volume hotplug", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		dataDir = GinkgoT().TempDir()
+	})
+
+	// newVolumeVM returns a running VM with an existing volume file named "data",
+	// so that attaching it does not run qemu-img.
+	newVolumeVM := func(c *qmpClient) (*vm, string) {
+		nd := &node{name: "node1", volumePaths: make(map[string]string)}
+		p := volumePath(filepath.Join(dataDir, nd.volumePathLastPart()), "data")
+		Expect(os.MkdirAll(filepath.Dir(p), 0755)).NotTo(HaveOccurred())
+		Expect(os.WriteFile(p, nil, 0644)).NotTo(HaveOccurred())
+
+		n := newFakeVM(nd, c)
+		n.runtime = &Runtime{DataDir: dataDir}
+		return n, p
+	}
+
+	dataSpec := types.NodeVolumeSpec{
+		Kind:  types.NodeVolumeKindRaw,
+		Name:  "data",
+		Size:  "1G",
+		Cache: types.NodeVolumeCacheNone,
+	}
+
+	It("should add a block device and a disk", func() {
+		f, c := newFakeQEMU(nil)
+		defer c.Close()
+		n, p := newVolumeVM(c)
+
+		Expect(n.AttachVolume(dataSpec)).NotTo(HaveOccurred())
+		Expect(f.executed()).To(Equal([]string{"blockdev-add", "device_add"}))
+
+		blockdev := f.arguments("blockdev-add")
+		Expect(blockdev).To(HaveKeyWithValue("driver", "qcow2"))
+		Expect(blockdev).To(HaveKeyWithValue("node-name", "drive-data"))
+		Expect(blockdev).To(HaveKeyWithValue("cache", HaveKeyWithValue("direct", true)))
+		Expect(blockdev).To(HaveKeyWithValue("file", And(
+			HaveKeyWithValue("driver", "file"),
+			HaveKeyWithValue("filename", p),
+			HaveKeyWithValue("aio", "native"),
+		)))
+
+		device := f.arguments("device_add")
+		Expect(device).To(HaveKeyWithValue("driver", "virtio-blk-pci"))
+		Expect(device).To(HaveKeyWithValue("id", "disk-data"))
+		Expect(device).To(HaveKeyWithValue("drive", "drive-data"))
+		Expect(device).To(HaveKeyWithValue("write-cache", "on"))
+
+		Expect(n.node.Volumes()).To(Equal([]string{"data"}))
+		Expect(n.node.volumePaths).To(HaveKeyWithValue("data", p))
+
+		Expect(n.AttachVolume(dataSpec)).To(MatchError(ContainSubstring("already exists")))
+	})
+
+	It("should delete the block device if the disk cannot be added", func() {
+		f, c := newFakeQEMU(map[string]func(map[string]interface{}) fakeQMPReply{
+			"device_add": func(map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{err: "GenericError"}
+			},
+		})
+		defer c.Close()
+		n, _ := newVolumeVM(c)
+
+		Expect(n.AttachVolume(dataSpec)).To(MatchError(ContainSubstring("GenericError")))
+		Expect(f.executed()).To(Equal([]string{"blockdev-add", "device_add", "blockdev-del"}))
+		Expect(f.arguments("blockdev-del")).To(HaveKeyWithValue("node-name", "drive-data"))
+		Expect(n.node.Volumes()).To(BeEmpty())
+	})
+
+	It("should wait for DEVICE_DELETED of the disk before deleting the block device", func() {
+		f, c := newFakeQEMU(map[string]func(map[string]interface{}) fakeQMPReply{
+			"query-block": func(map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{ret: `[` +
+					`{"device": "", "qdev": "/machine/peripheral/disk-other/virtio-backend", "inserted": {"node-name": "drive-other"}}, ` +
+					`{"device": "", "qdev": "/machine/peripheral/disk-data/virtio-backend", "inserted": {"node-name": "drive-data"}}]`}
+			},
+			"device_del": func(args map[string]interface{}) fakeQMPReply {
+				return fakeQMPReply{events: []string{
+					deviceDeletedEvent("disk-other"),
+					deviceDeletedEvent(args["id"].(string)),
+				}}
+			},
+		})
+		defer c.Close()
+		n, _ := newVolumeVM(c)
+		Expect(n.AttachVolume(dataSpec)).NotTo(HaveOccurred())
+
+		Expect(n.DetachVolume("data")).NotTo(HaveOccurred())
+		Expect(f.executed()).To(Equal([]string{"blockdev-add", "device_add", "query-block", "device_del", "blockdev-del"}))
+		Expect(f.arguments("device_del")).To(HaveKeyWithValue("id", "/machine/peripheral/disk-data"))
+		Expect(f.arguments("blockdev-del")).To(HaveKeyWithValue("node-name", "drive-data"))
+		Expect(n.node.Volumes()).To(BeEmpty())
+		Expect(n.node.volumePaths).NotTo(HaveKey("data"))
+
+		Expect(n.DetachVolume("data")).To(MatchError(ContainSubstring("not found")))
+	})
+})
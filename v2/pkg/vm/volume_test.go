@@ -236,4 +236,57 @@ path: DEVICE_CLASS_PATH
 		_, err = os.Stat(filepath.Join(temp, "root.img"))
 		Expect(err).NotTo(HaveOccurred())
 	})
+
+	It("should create cdrom volumes as specified", func() {
+		clusterYaml := `
+kind: Node
+name: boot-0
+cpu: 8
+memory: 2G
+volumes:
+- kind: cdrom
+  name: installer
+  image: ubuntu-iso
+- kind: cdrom
+  name: tools
+  path: /var/lib/tools.iso
+  bus: scsi
+- kind: cdrom
+  name: empty
+  bus: sata
+smbios:
+  serial: fb8f2417d0b4db30050719c31ce02a2e8141bbd8
+---
+kind: Image
+name: ubuntu-iso
+file: /var/lib/ubuntu.iso
+`
+		cluster, err := types.Parse(strings.NewReader(clusterYaml))
+		Expect(err).NotTo(HaveOccurred())
+
+		var args [][]string
+		for _, volumeSpec := range cluster.Nodes[0].Volumes {
+			volume, err := newNodeVolume(volumeSpec, cluster.Images, cluster.DeviceClasses)
+			Expect(err).NotTo(HaveOccurred())
+			a, err := volume.create(context.Background(), "", "")
+			Expect(err).NotTo(HaveOccurred())
+			args = append(args, a.args())
+		}
+		Expect(args).To(Equal([][]string{
+			{
+				"-drive", "if=none,id=cdrom-installer,media=cdrom,readonly=on,format=raw,file=/var/lib/ubuntu.iso",
+				"-device", "ide-cd,drive=cdrom-installer,id=cd-installer",
+			},
+			{
+				"-drive", "if=none,id=cdrom-tools,media=cdrom,readonly=on,format=raw,file=/var/lib/tools.iso",
+				"-device", "virtio-scsi-pci,id=scsi-tools",
+				"-device", "scsi-cd,bus=scsi-tools.0,drive=cdrom-tools,id=cd-tools",
+			},
+			{
+				"-drive", "if=none,id=cdrom-empty,media=cdrom,readonly=on",
+				"-device", "ahci,id=ahci-empty",
+				"-device", "ide-cd,bus=ahci-empty.0,drive=cdrom-empty,id=cd-empty",
+			},
+		}))
+	})
 })